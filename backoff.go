@@ -0,0 +1,61 @@
+package arigo
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// BackoffPolicy determines how long to wait between connection attempts.
+type BackoffPolicy interface {
+	// NextInterval returns the duration to wait before the given attempt.
+	// attempt is 0 for the first attempt after the connection was lost.
+	NextInterval(attempt int) time.Duration
+}
+
+// ConstantBackoff waits the same duration before every attempt.
+type ConstantBackoff time.Duration
+
+// NextInterval returns the duration b.
+func (b ConstantBackoff) NextInterval(int) time.Duration {
+	return time.Duration(b)
+}
+
+// NoBackoff reconnects immediately after the connection was lost
+// and keeps trying without waiting.
+const NoBackoff = ConstantBackoff(0)
+
+// ExponentialBackoff multiplies the duration to wait after every failed attempt.
+//
+// With Jitter set, the duration is picked at random between zero and the computed duration
+// ("full jitter"), so many clients losing their connection at the same time don't
+// reconnect in lockstep.
+type ExponentialBackoff struct {
+	Initial    time.Duration // duration before the first attempt
+	Max        time.Duration // upper bound of the duration, no bound if it's zero
+	Multiplier float64       // factor applied after every attempt, 2 if it's smaller than 1
+	Jitter     bool          // randomize the duration
+}
+
+// NextInterval returns Initial * Multiplier^attempt, capped at Max.
+func (b ExponentialBackoff) NextInterval(attempt int) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	interval := float64(b.Initial) * math.Pow(multiplier, float64(attempt))
+	if b.Max > 0 && interval > float64(b.Max) {
+		interval = float64(b.Max)
+	}
+
+	d := time.Duration(math.MaxInt64)
+	if interval < float64(math.MaxInt64) {
+		d = time.Duration(interval)
+	}
+
+	if b.Jitter && d > 0 {
+		d = time.Duration(rand.Int63n(int64(d)))
+	}
+	return d
+}
@@ -0,0 +1,55 @@
+package arigo
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstantBackoff(t *testing.T) {
+	b := ConstantBackoff(time.Second)
+	for attempt := 0; attempt < 5; attempt++ {
+		assert.Equal(t, time.Second, b.NextInterval(attempt))
+	}
+	assert.Equal(t, time.Duration(0), NoBackoff.NextInterval(3))
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff{Initial: 100 * time.Millisecond, Max: time.Second}
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for attempt, d := range expected {
+		assert.Equal(t, d, b.NextInterval(attempt), "attempt %d", attempt)
+	}
+
+	b.Multiplier = 3
+	assert.Equal(t, 900*time.Millisecond, b.NextInterval(2))
+
+	// without a cap the duration saturates instead of overflowing
+	b.Max = 0
+	assert.Equal(t, time.Duration(math.MaxInt64), b.NextInterval(1000))
+}
+
+func TestExponentialBackoffJitter(t *testing.T) {
+	b := ExponentialBackoff{Initial: 100 * time.Millisecond, Max: time.Second, Jitter: true}
+
+	for attempt := 0; attempt < 10; attempt++ {
+		ceiling := ExponentialBackoff{Initial: b.Initial, Max: b.Max}.NextInterval(attempt)
+		for i := 0; i < 100; i++ {
+			d := b.NextInterval(attempt)
+			assert.True(t, d >= 0 && d < ceiling, "attempt %d: %v not in [0, %v)", attempt, d, ceiling)
+		}
+	}
+
+	b.Max = 0
+	assert.True(t, b.NextInterval(1000) >= 0)
+}
@@ -1,18 +1,30 @@
 package arigo
 
 import (
+	"bufio"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"net/http"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
 	"os"
-
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Braurbeki/arigo/internal/pkg/httprpc"
 	"github.com/Braurbeki/arigo/internal/pkg/jsonrpc"
 	"github.com/Braurbeki/arigo/internal/pkg/wsrpc"
 	"github.com/Braurbeki/arigo/pkg/aria2proto"
 	"github.com/cenkalti/rpc2"
-	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -25,6 +37,85 @@ var (
 	ErrDownloadError = errors.New("download encountered error")
 	// ErrDownloadStopped is the error returned when a download is stopped
 	ErrDownloadStopped = errors.New("download stopped")
+	// ErrConnectionLost is returned by calls which failed because the connection was lost.
+	// It's only returned if reconnecting is enabled, the call may be retried once the
+	// client reconnected.
+	ErrConnectionLost = errors.New("connection lost")
+	// ErrUnauthorized matches RPCErrors returned because the secret token is wrong or missing.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrNotificationsUnsupported is returned by methods which rely on notifications
+	// if the client uses a transport which doesn't support them, like HTTP.
+	ErrNotificationsUnsupported = errors.New("notifications aren't supported by the transport")
+	// ErrClientClosed is returned by calls which are made, or were still pending,
+	// after the client was closed.
+	ErrClientClosed = errors.New("client is closed")
+	// ErrNoURIs is returned by AddURI and AddURIAtPosition if no uri was passed.
+	ErrNoURIs = errors.New("at least one uri is required")
+	// ErrSubprotocolNotSelected is returned by Dial and DialContext if the server didn't select
+	// any of the subprotocols passed to WithRequiredSubprotocols.
+	ErrSubprotocolNotSelected = errors.New("server didn't select any of the requested subprotocols")
+	// ErrOptionNotSet is returned by the typed option getters like GetSeedTime
+	// if the option has no value for the download.
+	ErrOptionNotSet = errors.New("option not set")
+	// ErrOptionsNotApplied is returned by the methods changing options of a client created
+	// using WithStrictOptions if aria2 ignored some of the options.
+	ErrOptionsNotApplied = errors.New("options not applied")
+	// ErrInvalidFileIndex is returned by SelectFiles and DeselectFiles if an index
+	// doesn't denote a file of the download.
+	ErrInvalidFileIndex = errors.New("invalid file index")
+)
+
+// ReadLimitError is returned by calls which failed because aria2 sent a message
+// larger than the limit set using WithReadLimit.
+type ReadLimitError = wsrpc.ReadLimitError
+
+// WriteTimeoutError is returned by calls which failed because the request couldn't be
+// written within the timeout set using WithWriteTimeout.
+type WriteTimeoutError = wsrpc.WriteTimeoutError
+
+// MessageDirection tells whether a message was received from or sent to aria2, see WithMessageObserver.
+type MessageDirection = wsrpc.Direction
+
+const (
+	// IncomingMessage is a message received from aria2.
+	IncomingMessage = wsrpc.Incoming
+	// OutgoingMessage is a message sent to aria2.
+	OutgoingMessage = wsrpc.Outgoing
+)
+
+// CloseError is returned by calls which failed because aria2, or a proxy in between,
+// closed the WebSocket connection with a close code other than a normal closure.
+// Its Temporary method reports whether reconnecting may help.
+type CloseError = wsrpc.CloseError
+
+// JSONEncoding is a JSON implementation used to encode and decode the messages
+// exchanged with aria2, see WithJSONEncoding.
+// Its encoders must write every value using a single Write.
+//
+// If the encoding has a CopiesData method which returns true, its Unmarshal must not keep
+// references to the data it decodes, the buffers holding the results of responses are reused then.
+type JSONEncoding = jsonrpc.Encoding
+
+// JSONEncoder writes JSON values to a stream, it's created by a JSONEncoding.
+type JSONEncoder = jsonrpc.Encoder
+
+// JSONDecoder reads successive JSON values from a stream, it's created by a JSONEncoding.
+type JSONDecoder = jsonrpc.Decoder
+
+// Request is the JSON-RPC envelope of an outgoing request or notification, see WithRequestInterceptor.
+type Request = jsonrpc.Request
+
+// Response is the JSON-RPC envelope of an incoming response, see WithResponseInterceptor.
+type Response = jsonrpc.Response
+
+// ProtocolVersion is the JSON-RPC version of the requests sent by a client, see WithProtocolVersion.
+type ProtocolVersion = jsonrpc.Version
+
+const (
+	// ProtocolVersion2 is JSON-RPC 2.0, the version used by default.
+	ProtocolVersion2 = jsonrpc.Version2
+	// ProtocolVersion1 is JSON-RPC 1.0, requests don't have a jsonrpc member and use numeric ids.
+	ProtocolVersion1 = jsonrpc.Version1
 )
 
 // URIs creates a string slice from the given uris.
@@ -34,718 +125,3220 @@ func URIs(uris ...string) []string {
 	return uris
 }
 
-// Client represents a connection to an aria2 rpc interface over websocket.
+// Client represents a connection to an aria2 rpc interface over websocket or HTTP.
+//
+// The methods ending in Context abort the call once the context is done and return the context's error.
+// A call which was already sent may still be executed by aria2, only its response is discarded.
+//
+// Clients created by Dial or DialContext send increasing request ids, which are unique for the
+// lifetime of the client, even if it reconnects.
 type Client struct {
+	mu        sync.Mutex // protects rpcClient, closed, runDone and the in-flight calls below
 	rpcClient *rpc2.Client
 	closed    bool
-
-	authToken string
+	// runDone is closed once Run returned, it's nil if Run wasn't called.
+	runDone chan struct{}
+
+	// calls is the number of calls in flight. Once draining is set by CloseGracefully,
+	// no new calls are started and drained is closed when the last one finished.
+	calls    int
+	draining bool
+	drained  chan struct{}
+
+	closeOnce sync.Once
+	closeErr  error // result of the first Close
+
+	authToken   string
+	callTimeout time.Duration
+	limiter     *rate.Limiter // nil if calls aren't rate limited
+	hooks       CallHooks
+	logger      Logger
+	verbose     bool
+	encoding    JSONEncoding
+
+	// pendingWrites holds a value for every call waiting for its request to be written,
+	// it's nil if their number isn't bounded, see WithMaxPendingWrites.
+	pendingWrites chan struct{}
+
+	// strictOptions is set if changed options are read back, see WithStrictOptions.
+	strictOptions bool
+	// defaultParams are appended to the params of the calls of their method, see WithDefaultParams.
+	defaultParams map[string][]interface{}
+
+	// retry decides whether failed calls are retried, it's nil if they aren't.
+	// retryOptIn contains the methods which are retried in addition to the idempotent ones.
+	retry      RetryPolicy
+	retryOptIn map[string]bool
 
 	evtTarget eventTarget
+	// noNotifications is set if the transport can't deliver notifications.
+	noNotifications bool
+
+	// transport is set if the client was created using WithTransport, rpcClient is nil then.
+	transport Transport
+
+	// redial establishes a new connection, it's nil unless reconnecting is enabled.
+	redial  func(ctx context.Context) (*rpc2.Client, error)
+	backoff BackoffPolicy
+
+	// resync tracks the status of the downloads, it's nil unless WithResyncOnReconnect is used.
+	resync *resyncState
+
+	// closeCtx is cancelled when the client is closed.
+	closeCtx    context.Context
+	closeCancel context.CancelFunc
+
+	// done is closed once the client is closed or lost its connection for good.
+	done     chan struct{}
+	doneOnce sync.Once
+
+	// pool contains the connections the calls are spread across, it's nil unless
+	// the client belongs to a ClientPool. next is used to pick the connection.
+	pool []*Client
+	next uint32
+
+	// tieDone is called when the goroutine started by AddURIWithContext returns, it's used by tests.
+	tieDone func(gid string)
 }
 
 // NewClient creates a new client.
 // The client needs to be manually ran
 // using the Run method.
 func NewClient(rpcClient *rpc2.Client, authToken string) *Client {
+	return newClient(rpcClient, authToken, newClientConfig(nil))
+}
+
+func newClient(rpcClient *rpc2.Client, authToken string, cfg *clientConfig) *Client {
+	if cfg.secret != "" {
+		authToken = cfg.secret
+	}
+
 	client := &Client{
-		rpcClient: rpcClient,
-		authToken: authToken,
-		closed:    false,
+		rpcClient:   rpcClient,
+		authToken:   authToken,
+		callTimeout: cfg.callTimeout,
+		limiter:     cfg.limiter,
+		retry:       cfg.retry,
+		retryOptIn:  cfg.retryMethods,
+		hooks:       cfg.hooks,
+		logger:      cfg.logger,
+		verbose:     cfg.verbose,
+		encoding:    cfg.encoding,
+		closed:      false,
+		done:        make(chan struct{}),
+
+		strictOptions: cfg.strictOptions,
+		defaultParams: cfg.defaultParams,
 	}
+	if cfg.maxPendingWrites > 0 {
+		client.pendingWrites = make(chan struct{}, cfg.maxPendingWrites)
+	}
+	client.closeCtx, client.closeCancel = context.WithCancel(context.Background())
 
-	rpcClient.Handle(aria2proto.OnDownloadStart, client.onDownloadStart)
-	rpcClient.Handle(aria2proto.OnDownloadPause, client.onDownloadPause)
-	rpcClient.Handle(aria2proto.OnDownloadStop, client.onDownloadStop)
-	rpcClient.Handle(aria2proto.OnDownloadComplete, client.onDownloadComplete)
-	rpcClient.Handle(aria2proto.OnDownloadError, client.onDownloadError)
-	rpcClient.Handle(aria2proto.OnBTDownloadComplete, client.onBTDownloadComplete)
+	if rpcClient != nil {
+		client.handleNotifications(rpcClient)
+	}
 
 	return client
 }
 
+// handleNotifications registers the handlers for the aria2 notifications on rpcClient.
+func (c *Client) handleNotifications(rpcClient *rpc2.Client) {
+	rpcClient.Handle(aria2proto.OnDownloadStart, c.onDownloadStart)
+	rpcClient.Handle(aria2proto.OnDownloadPause, c.onDownloadPause)
+	rpcClient.Handle(aria2proto.OnDownloadStop, c.onDownloadStop)
+	rpcClient.Handle(aria2proto.OnDownloadComplete, c.onDownloadComplete)
+	rpcClient.Handle(aria2proto.OnDownloadError, c.onDownloadError)
+	rpcClient.Handle(aria2proto.OnBTDownloadComplete, c.onBTDownloadComplete)
+	rpcClient.Handle(unknownNotification, c.onUnknownNotification)
+}
+
 // DialContext creates a new connection to an aria2 rpc interface.
 // It returns a new client.
-func DialContext(ctx context.Context, url string, authToken string) (client *Client, err error) {
-	dialer := websocket.Dialer{}
+//
+// The context bounds the connection establishment.
+// If it expires or is cancelled before the connection is established,
+// the returned error wraps the context's error, so errors.Is(err, context.DeadlineExceeded)
+// can be used to distinguish a timeout from a rejected handshake.
+// Once the connection is established, the context has no effect on the client.
+//
+// The transport is chosen by the scheme of url. "ws" and "wss" use a WebSocket connection,
+// "http" and "https" send every call as a separate POST request.
+// aria2 can't send notifications over HTTP, so event listeners are never called
+// and the methods waiting for downloads return ErrNotificationsUnsupported.
+func DialContext(ctx context.Context, url string, authToken string, opts ...ClientOption) (client *Client, err error) {
+	cfg := newClientConfig(opts)
+	if cfg.err != nil {
+		return nil, cfg.err
+	}
+
+	if cfg.transport != nil {
+		client = newTransportClient(cfg.transport, authToken, cfg)
+		go client.Run()
+		return client, nil
+	}
+
+	// request ids are shared by all connections of the client,
+	// so they are unique for the lifetime of the client.
+	ids := new(uint64)
+
+	httpTransport := isHTTPURL(url)
+
+	interceptors := cfg.interceptors
+	interceptors.Unmatched = func(id string) {
+		cfg.logger.Errorf("arigo: discarded response with unknown id %s from %s", id, url)
+	}
+
+	dialTransport := func(ctx context.Context) (*rpc2.Client, error) {
+		if httpTransport {
+			rwc := httprpc.NewReadWriteCloser(url, cfg.httpClient(), cfg.header)
+			codec := jsonrpc.NewJSONCodecWithVersion(rwc, ids, cfg.encoding, interceptors, cfg.version)
+			return newRPCClient(codec), nil
+		}
+
+		ws, resp, err := dialContext(ctx, cfg.dialer, url, cfg.header)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.subprotocolRequired && !containsSubprotocol(cfg.dialer.Subprotocols, ws.Subprotocol()) {
+			_ = ws.Close()
+			return nil, ErrSubprotocolNotSelected
+		}
+
+		rwc := wsrpc.NewReadWriteCloser(ws)
+		if cfg.readLimit > 0 {
+			_ = rwc.SetReadLimit(cfg.readLimit)
+		}
+		if cfg.compressThreshold > 0 {
+			_ = rwc.SetCompressionThreshold(cfg.compressThreshold)
+		}
+		if cfg.writeTimeout > 0 {
+			_ = rwc.SetWriteTimeout(cfg.writeTimeout)
+		}
+		if observer := cfg.messageObserver(url); observer != nil {
+			rwc.SetMessageObserver(observer)
+		}
+		codec := jsonrpc.NewJSONCodecWithVersion(rwc, ids, cfg.encoding, interceptors, cfg.version)
+		rpcClient := newRPCClient(codec)
+		rpcClient.State.Set(subprotocolKey, rwc.Subprotocol())
+		rpcClient.State.Set(compressionKey, cfg.dialer.EnableCompression && compressionNegotiated(resp.Header))
+		rpcClient.State.Set(wsKey, rwc)
+		return rpcClient, nil
+	}
+
+	dial := func(ctx context.Context) (*rpc2.Client, error) {
+		rpcClient, err := dialTransport(ctx)
+		if err != nil {
+			cfg.logger.Errorf("arigo: connecting to %s failed: %v", url, err)
+			return nil, err
+		}
+		cfg.logger.Debugf("arigo: connected to %s", url)
+		return rpcClient, nil
+	}
 
-	ws, _, err := dialer.DialContext(ctx, url, http.Header{})
+	rpcClient, err := dialRetry(ctx, dial, cfg)
 	if err != nil {
 		return
 	}
 
-	rwc := wsrpc.NewReadWriteCloser(ws)
-	codec := jsonrpc.NewJSONCodec(&rwc)
-	rpcClient := rpc2.NewClientWithCodec(codec)
-
-	client = NewClient(rpcClient, authToken)
+	client = newClient(rpcClient, authToken, cfg)
+	client.noNotifications = httpTransport
+	if cfg.reconnect {
+		client.redial = dial
+		client.backoff = cfg.backoff
+		if cfg.resync && !httpTransport {
+			client.resync = newResyncState()
+		}
+	}
 	go client.Run()
+	if client.resync != nil {
+		go client.resyncDownloads(client.closeCtx)
+	}
 
 	return
 }
 
+// containsSubprotocol reports whether protocol is one of the requested protocols.
+func containsSubprotocol(protocols []string, protocol string) bool {
+	for _, p := range protocols {
+		if p == protocol {
+			return protocol != ""
+		}
+	}
+	return false
+}
+
+// dialRetry establishes the initial connection using dial.
+// If dial retries are enabled, failed attempts are retried until one succeeds,
+// the attempts are exhausted or ctx is done.
+func dialRetry(ctx context.Context, dial func(ctx context.Context) (*rpc2.Client, error), cfg *clientConfig) (*rpc2.Client, error) {
+	for attempt := 0; ; attempt++ {
+		rpcClient, err := dial(ctx)
+		if err == nil || cfg.dialAttempts == 1 || ctx.Err() != nil {
+			return rpcClient, err
+		}
+		if cfg.dialAttempts > 0 && attempt+1 >= cfg.dialAttempts {
+			return nil, fmt.Errorf("giving up after %d attempts: %w", cfg.dialAttempts, err)
+		}
+
+		var wait time.Duration
+		if cfg.dialBackoff != nil {
+			wait = cfg.dialBackoff.NextInterval(attempt)
+		}
+
+		cfg.logger.Debugf("arigo: retrying to connect in %v (attempt %d)", wait, attempt+2)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// isHTTPURL reports whether url uses the http or https scheme.
+func isHTTPURL(url string) bool {
+	lower := strings.ToLower(url)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
 // Dial creates a new connection to an aria2 rpc interface.
 // It returns a new client.
-func Dial(url string, authToken string) (client *Client, err error) {
-	return DialContext(context.Background(), url, authToken)
+func Dial(url string, authToken string, opts ...ClientOption) (client *Client, err error) {
+	return DialContext(context.Background(), url, authToken, opts...)
 }
 
 // Run runs the underlying rpcClient.
 // There's no need to call this if the client
 // was created using the Dial function.
+//
+// If reconnecting is enabled, Run keeps reconnecting
+// whenever the connection is lost and only returns once the client is closed.
 func (c *Client) Run() {
-	c.rpcClient.Run()
-}
+	defer c.markDone()
 
-// Close closes the connection to the aria2 rpc interface.
-// The client becomes unusable after that point.
-func (c *Client) Close() error {
-	c.closed = true
+	c.mu.Lock()
+	if c.closed || c.runDone != nil {
+		c.mu.Unlock()
+		return
+	}
+	runDone := make(chan struct{})
+	c.runDone = runDone
+	c.mu.Unlock()
+	defer close(runDone)
+
+	if c.transport != nil {
+		// there's no read loop, the transport delivers the notifications by itself
+		<-c.closeCtx.Done()
+		return
+	}
 
-	return c.rpcClient.Close()
-}
+	for {
+		rpcClient := c.getRPCClient()
+		rpcClient.Run()
 
-func (c *Client) onDownloadStart(_ *rpc2.Client, event *DownloadEvent, _ *interface{}) error {
-	c.evtTarget.Dispatch(StartEvent, event)
-	return nil
-}
-func (c *Client) onDownloadPause(_ *rpc2.Client, event *DownloadEvent, _ *interface{}) error {
-	c.evtTarget.Dispatch(PauseEvent, event)
-	return nil
-}
-func (c *Client) onDownloadStop(_ *rpc2.Client, event *DownloadEvent, _ *interface{}) error {
-	c.evtTarget.Dispatch(StopEvent, event)
-	return nil
-}
-func (c *Client) onDownloadComplete(_ *rpc2.Client, event *DownloadEvent, _ *interface{}) error {
-	c.evtTarget.Dispatch(CompleteEvent, event)
-	return nil
-}
-func (c *Client) onDownloadError(_ *rpc2.Client, event *DownloadEvent, _ *interface{}) error {
-	c.evtTarget.Dispatch(ErrorEvent, event)
-	return nil
+		c.mu.Lock()
+		closed := c.closed
+		c.mu.Unlock()
+		if !closed {
+			c.logger.Errorf("arigo: connection lost: %v", connErr(rpcClient))
+		}
+
+		if !c.reconnect() {
+			return
+		}
+	}
 }
-func (c *Client) onBTDownloadComplete(_ *rpc2.Client, event *DownloadEvent, _ *interface{}) error {
-	c.evtTarget.Dispatch(BTCompleteEvent, event)
-	return nil
+
+// markDone closes the done channel, it's safe to call it multiple times.
+func (c *Client) markDone() {
+	c.doneOnce.Do(func() { close(c.done) })
 }
 
-// Subscribe registers the given listener for an event.
-// The listener will be called every time the event occurs.
-func (c *Client) Subscribe(evtType EventType, listener EventListener) UnsubscribeFunc {
-	return c.evtTarget.Subscribe(evtType, listener)
+// Done returns a channel which is closed once the client is closed or its connection was lost.
+// If reconnecting is enabled, a lost connection is replaced, so the channel is only closed
+// by Close. Use IsConnected to find out whether the client is connected right now.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
 }
 
-// WaitForDownload waits for a download denoted by its gid to finish.
-func (c *Client) WaitForDownload(gid string) error {
-	channel := make(chan error, 1)
+// Err returns the error which ended the connection once Done is closed.
+// It's a *ReadError if the connection broke down, and nil if the client was closed,
+// or if Done isn't closed yet.
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+	default:
+		return nil
+	}
 
-	sendResponse := func(err error) EventListener {
-		return func(ev *DownloadEvent) {
-			if ev.GID == gid {
-				channel <- err
-			}
-		}
+	c.mu.Lock()
+	closed := c.closed
+	rpcClient := c.rpcClient
+	c.mu.Unlock()
+
+	if closed {
+		return nil
 	}
+	return connErr(rpcClient)
+}
 
-	stopUnsub := c.Subscribe(StopEvent, sendResponse(ErrDownloadStopped))
-	completeUnsub := c.Subscribe(CompleteEvent, sendResponse(nil))
-	errUnsub := c.Subscribe(ErrorEvent, sendResponse(ErrDownloadError))
+// Subprotocol returns the WebSocket subprotocol the server selected from the ones requested
+// using WithSubprotocols or WithRequiredSubprotocols. It's "" if the server didn't select one
+// and for clients which don't use a WebSocket connection.
+// A reconnecting client negotiates the subprotocol again for every connection.
+func (c *Client) Subprotocol() string {
+	rpcClient := c.getRPCClient()
+	if rpcClient == nil || rpcClient.State == nil {
+		return ""
+	}
 
-	err := <-channel
+	protocol, _ := rpcClient.State.Get(subprotocolKey)
+	s, _ := protocol.(string)
+	return s
+}
 
-	stopUnsub()
-	completeUnsub()
-	errUnsub()
+// CompressionEnabled reports whether permessage-deflate compression was negotiated for the
+// connection of the client, see WithCompression. Some servers advertise compression but don't
+// agree to it during the handshake, the messages are sent uncompressed then.
+// It's false for clients which don't use a WebSocket connection.
+func (c *Client) CompressionEnabled() bool {
+	rpcClient := c.getRPCClient()
+	if rpcClient == nil || rpcClient.State == nil {
+		return false
+	}
 
-	return err
+	enabled, _ := rpcClient.State.Get(compressionKey)
+	b, _ := enabled.(bool)
+	return b
 }
 
-// Download adds a new download and waits for it to complete.
-// It returns the status of the finished download.
-func (c *Client) Download(uris []string, options *Options) (status Status, err error) {
-	return c.DownloadWithContext(context.Background(), uris, options)
+// IsConnected reports whether the connection of the client is alive.
+// It's false once the client is closed and while a reconnecting client is disconnected.
+// For clients using HTTP, there's no persistent connection, so it's true until the client is closed.
+func (c *Client) IsConnected() bool {
+	c.mu.Lock()
+	closed := c.closed
+	rpcClient := c.rpcClient
+	c.mu.Unlock()
+
+	if closed {
+		return false
+	}
+	if c.transport != nil {
+		return true
+	}
+
+	select {
+	case <-rpcClient.DisconnectNotify():
+		return false
+	default:
+		return true
+	}
 }
 
-// DownloadWithContext adds a new download and waits for it to complete.
-// The passed context can be used to cancel the download.
-// It returns the status of the finished download.
-func (c *Client) DownloadWithContext(ctx context.Context, uris []string, options *Options) (status Status, err error) {
-	gid, err := c.AddURI(uris, options)
-	if err != nil {
-		return
+// reconnect replaces the lost connection with a new one.
+// It keeps trying until it succeeds or the client is closed.
+// It returns false if the client won't reconnect.
+func (c *Client) reconnect() bool {
+	if c.redial == nil {
+		return false
 	}
 
-	downloadDone := make(chan error, 1)
+	for attempt := 0; ; attempt++ {
+		var wait time.Duration
+		if c.backoff != nil {
+			wait = c.backoff.NextInterval(attempt)
+		}
 
-	go func() {
-		downloadDone <- gid.WaitForDownload()
-	}()
+		c.logger.Debugf("arigo: reconnecting in %v (attempt %d)", wait, attempt+1)
+		timer := time.NewTimer(wait)
+		select {
+		case <-c.closeCtx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
 
-	select {
-	case <-downloadDone:
-		status, err = gid.TellStatus()
+		rpcClient, err := c.redial(c.closeCtx)
 		if err != nil {
-			return
+			continue
 		}
-	case <-ctx.Done():
-		_ = gid.Delete()
-		err = ctx.Err()
-	}
+		c.handleNotifications(rpcClient)
 
-	return
-}
-
-// Delete removes the download denoted by gid and deletes all corresponding files.
-// This is not an aria2 method.
-func (c *Client) Delete(gid string) (err error) {
-	err = c.Remove(gid)
-	if err != nil {
-		return
-	}
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			_ = rpcClient.Close()
+			return false
+		}
+		c.rpcClient = rpcClient
+		c.mu.Unlock()
 
-	files, err := c.GetFiles(gid)
-	if err == nil {
-		for _, file := range files {
-			_ = os.Remove(file.Path)
+		c.logger.Debugf("arigo: reconnected after %d attempts", attempt+1)
+		if c.resync != nil {
+			// the read loop of the new connection has to run for the calls of the sweep
+			go c.resyncDownloads(c.closeCtx)
 		}
+		return true
 	}
-
-	return
 }
 
-// GetGID creates a GID struct which you can use to interact with the download directly
-func (c *Client) GetGID(gid string) GID {
-	return GID{c, gid}
+func (c *Client) getRPCClient() *rpc2.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.rpcClient
 }
 
-func (c *Client) getArgs(args ...interface{}) []interface{} {
-	if c.authToken == "" {
-		if args != nil {
-			return args
-		}
-		return []interface{}{}
-	} else {
-		tokenArg := "token:" + c.authToken
-		return append([]interface{}{tokenArg}, args...)
+// callRPCClient returns the rpc client which performs the next call.
+// Clients of a ClientPool take turns using the connections of the pool.
+func (c *Client) callRPCClient() *rpc2.Client {
+	if len(c.pool) == 0 {
+		return c.getRPCClient()
 	}
+
+	n := atomic.AddUint32(&c.next, 1)
+	return c.pool[n%uint32(len(c.pool))].getRPCClient()
 }
 
-// AddURIAtPosition adds a new download at a specific position in the queue.
-// uris is a slice of HTTP/FTP/SFTP/BitTorrent URIs pointing to the same resource.
-// If you mix URIs pointing to different resources,
-// then the download may fail or be corrupted without aria2 complaining.
-//
-// When adding BitTorrent Magnet URIs, uris must have only one element and it should be BitTorrent Magnet URI.
+// callContext invokes the aria2 method with the given args and stores the result in reply.
 //
-// The new download will be inserted at position in the waiting queue.
-// If position is nil or position is larger than the current size of the queue,
-// the new download is appended to the end of the queue.
+// If ctx is done before the response arrives, the call returns the context's error right away.
+// The request may still reach aria2 and be executed. Its response is discarded once it arrives,
+// because responses are matched to calls by their id, it's never delivered to another call.
 //
-// This method returns the GID of the newly registered download.
-func (c *Client) AddURIAtPosition(uris []string, position uint, options *Options) (GID, error) {
-	args := c.getArgs(uris)
+// If the client has a call timeout and ctx has no deadline, the call is bounded by the timeout.
+// Failed calls are retried as decided by the retry policy of the client, see WithRetry.
+func (c *Client) callContext(ctx context.Context, method string, args interface{}, reply interface{}) (err error) {
+	if params, ok := args.([]interface{}); ok {
+		args = c.withDefaultParams(method, params)
+	}
 
-	if options != nil {
-		args = append(args, options)
+	if c.hooks.StartSpan != nil {
+		ctx = c.hooks.StartSpan(ctx, method)
+	}
+	if c.hooks.OnCallStart != nil {
+		c.hooks.OnCallStart(method)
+	}
+	start := time.Now()
+	if c.hooks.EndSpan != nil {
+		defer func() { c.hooks.EndSpan(ctx, newCallSpan(method, time.Since(start), err)) }()
+	}
+	if c.hooks.OnCallEnd != nil {
+		defer func() { c.hooks.OnCallEnd(method, time.Since(start), err) }()
 	}
 
-	if position != QueueEndPosition {
-		args = append(args, position)
+	if c.verbose {
+		c.logger.Debugf("arigo: calling %s with %s", method, c.payload(args))
+	} else {
+		c.logger.Debugf("arigo: calling %s", method)
 	}
+	defer func() { c.logCallEnd(method, time.Since(start), reply, err) }()
 
-	var reply string
-	err := c.rpcClient.Call(aria2proto.AddURI, args, &reply)
+	if !c.beginCall() {
+		return ErrClientClosed
+	}
+	defer c.endCall()
 
-	return c.GetGID(reply), err
+	for attempt := 0; ; attempt++ {
+		err = c.callOnce(ctx, method, args, reply)
+		if err == nil || !c.retryCall(ctx, method, attempt, err) {
+			return err
+		}
+	}
 }
 
-// AddURI adds a new download.
-// uris is a slice of HTTP/FTP/SFTP/BitTorrent URIs (strings) pointing to the same resource.
-// If you mix URIs pointing to different resources,
-// then the download may fail or be corrupted without aria2 complaining.
-//
-// When adding BitTorrent Magnet URIs, uris must have only one element and it should be BitTorrent Magnet URI.
-//
-// The new download is appended to the end of the queue.
-//
-// This method returns the GID of the newly registered download.
-func (c *Client) AddURI(uris []string, options *Options) (GID, error) {
-	return c.AddURIAtPosition(uris, QueueEndPosition, options)
+// newCallSpan creates the CallSpan of a call of method which took dur and returned err.
+func newCallSpan(method string, dur time.Duration, err error) CallSpan {
+	span := CallSpan{Method: method, Duration: dur, Err: err}
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		span.Code = rpcErr.Code
+	}
+	return span
 }
 
-// AddTorrentAtPosition adds a BitTorrent download at a specific position in the queue.
-// If you want to add a BitTorrent Magnet URI, use the AddURI() method instead.
-// torrent must be the contents of the “.torrent” file.
-// uris is an array of URIs (string). uris is used for Web-seeding.
-//
-// For single file torrents, the URI can be a complete URI pointing to the resource;
-// if URI ends with /, name in torrent file is added. For multi-file torrents,
-// name and path in torrent are added to form a URI for each file.
-//
-// The new download will be inserted at position in the waiting queue.
-// If position is nil or position is larger than the current size of the queue,
-// the new download is appended to the end of the queue.
-//
-// This method returns the GID of the newly registered download.
-func (c *Client) AddTorrentAtPosition(torrent []byte, uris []string, position uint, options *Options) (GID, error) {
-	encodedTorrent := base64.StdEncoding.EncodeToString(torrent)
-	args := c.getArgs(encodedTorrent, uris)
+// beginCall registers a call in flight, it returns false if the client doesn't accept new calls.
+func (c *Client) beginCall() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	if options != nil {
-		args = append(args, options)
+	if c.closed || c.draining {
+		return false
 	}
+	c.calls++
+	return true
+}
 
-	if position != QueueEndPosition {
-		args = append(args, position)
+// endCall unregisters a call registered by beginCall.
+func (c *Client) endCall() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls--
+	if c.calls == 0 && c.drained != nil {
+		close(c.drained)
+		c.drained = nil
 	}
+}
 
-	var reply string
-	err := c.rpcClient.Call(aria2proto.AddTorrent, args, &reply)
+// callConnKey is the context key of a *rpc2.Client variable, callOnce stores the connection
+// used by the call in it.
+type callConnKey struct{}
+
+// callOnce performs a single attempt of a call, see callContext.
+func (c *Client) callOnce(ctx context.Context, method string, args interface{}, reply interface{}) (err error) {
+	callCtx := ctx
+	if _, ok := ctx.Deadline(); !ok && c.callTimeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, c.callTimeout)
+		defer cancel()
+	}
 
-	return c.GetGID(reply), err
-}
+	rpcClient := c.callRPCClient()
+	if conn, ok := ctx.Value(callConnKey{}).(**rpc2.Client); ok {
+		*conn = rpcClient
+	}
 
-// AddTorrent adds a BitTorrent download by uploading a “.torrent” file.
-// If you want to add a BitTorrent Magnet URI, use the AddURI() method instead.
-// torrent must be the contents of the “.torrent” file.
-// uris is an array of URIs (string). uris is used for Web-seeding.
-//
-// For single file torrents, the URI can be a complete URI pointing to the resource;
+	err = c.waitLimiter(callCtx)
+	if err == nil {
+		switch {
+		case c.transport != nil:
+			err = c.transport.Call(callCtx, method, args, reply)
+		case callCtx.Done() == nil && c.pendingWrites == nil:
+			err = rpcClient.Call(method, args, reply)
+		default:
+			err = c.goContext(callCtx, rpcClient, method, args, reply)
+		}
+	}
+
+	if err == context.DeadlineExceeded && callCtx != ctx && ctx.Err() == nil {
+		return &TimeoutError{Method: method, Timeout: c.callTimeout}
+	}
+
+	if serverErr, ok := err.(rpc2.ServerError); ok {
+		return newRPCError(serverErr)
+	}
+	if err != nil && err != context.Canceled && err != context.DeadlineExceeded {
+		c.mu.Lock()
+		closed := c.closed
+		c.mu.Unlock()
+
+		if closed {
+			return ErrClientClosed
+		}
+		if c.redial != nil && isConnectionErr(err) {
+			return ErrConnectionLost
+		}
+		// pending calls fail with the bare error when the connection breaks down and
+		// later calls with ErrShutdown, report the error which ended the connection to both.
+		if connErr := connErr(rpcClient); connErr != nil {
+			return connErr
+		}
+	}
+
+	return err
+}
+
+// logCallEnd logs the result of a call.
+func (c *Client) logCallEnd(method string, dur time.Duration, reply interface{}, err error) {
+	switch {
+	case err != nil:
+		c.logger.Debugf("arigo: %s failed after %v: %v", method, dur, err)
+	case c.verbose:
+		c.logger.Debugf("arigo: %s returned after %v: %s", method, dur, c.payload(reply))
+	default:
+		c.logger.Debugf("arigo: %s returned after %v", method, dur)
+	}
+}
+
+// waitLimiter waits until the rate limiter allows another call.
+// It returns the context's error if ctx is done first. If the wait would exceed the
+// deadline of ctx, it returns context.DeadlineExceeded right away.
+func (c *Client) waitLimiter(ctx context.Context) error {
+	if c.limiter == nil {
+		return nil
+	}
+
+	if err := c.limiter.Wait(ctx); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		// the burst is at least 1, so the wait can only fail because of the deadline
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// goContext performs the call asynchronously and stops waiting for it once ctx is done.
+func (c *Client) goContext(ctx context.Context, rpcClient *rpc2.Client, method string, args interface{}, reply interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// The response is decoded into a buffer owned by the call, so a late response
+	// can't write to reply after the caller gave up on it.
+	var result json.RawMessage
+	done := make(chan *rpc2.Call, 1)
+
+	if err := c.acquireWrite(ctx); err != nil {
+		return err
+	}
+	// sending blocks if the connection is stalled, which must not block the caller either
+	go func() {
+		// Go returns once the request was written
+		rpcClient.Go(method, args, &result, done)
+		c.releaseWrite()
+	}()
+
+	select {
+	case call := <-done:
+		if call.Error != nil || reply == nil {
+			return call.Error
+		}
+		return c.encoding.Unmarshal(result, reply)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// acquireWrite waits until there's room for another pending write, see WithMaxPendingWrites.
+// It returns the context's error if ctx is done first.
+func (c *Client) acquireWrite(ctx context.Context) error {
+	if c.pendingWrites == nil {
+		return nil
+	}
+
+	select {
+	case c.pendingWrites <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseWrite frees the room taken by acquireWrite.
+func (c *Client) releaseWrite() {
+	if c.pendingWrites != nil {
+		<-c.pendingWrites
+	}
+}
+
+// isConnectionErr reports whether err was caused by a lost connection.
+func isConnectionErr(err error) bool {
+	return err == rpc2.ErrShutdown || err == io.ErrUnexpectedEOF || err == io.EOF ||
+		err == io.ErrClosedPipe || errors.As(err, new(net.Error)) ||
+		errors.As(err, new(*CloseError))
+}
+
+// Close closes the connection to the aria2 rpc interface.
+// The client becomes unusable after that point, pending and following calls
+// fail with ErrClientClosed. Close waits for Run to return.
+// CloseGracefully lets the pending calls finish first.
+//
+// It's safe to call Close multiple times, also concurrently,
+// every call returns the result of the first one.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closed = true
+		rpcClient := c.rpcClient
+		runDone := c.runDone
+		c.mu.Unlock()
+
+		c.closeCancel()
+		defer c.markDone()
+
+		if c.transport != nil {
+			c.closeErr = c.transport.Close()
+		} else {
+			c.closeErr = rpcClient.Close()
+		}
+		for _, conn := range c.pool {
+			if err := conn.Close(); c.closeErr == nil {
+				c.closeErr = err
+			}
+		}
+
+		if runDone != nil {
+			<-runDone
+		}
+	})
+
+	return c.closeErr
+}
+
+// CloseGracefully closes the client once the calls in flight finished, like http.Server.Shutdown.
+// Calls started after CloseGracefully was called fail with ErrClientClosed right away.
+//
+// If ctx is done before the calls finished, CloseGracefully returns the context's error
+// and leaves the client open, so the remaining calls can still complete.
+// Close closes it right away, failing the remaining calls.
+func (c *Client) CloseGracefully(ctx context.Context) error {
+	c.mu.Lock()
+	c.draining = true
+	var drained chan struct{}
+	if c.calls > 0 {
+		if c.drained == nil {
+			c.drained = make(chan struct{})
+		}
+		drained = c.drained
+	}
+	c.mu.Unlock()
+
+	if drained != nil {
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return c.Close()
+}
+
+// dispatch dispatches a received notification to the listeners.
+func (c *Client) dispatch(evtType EventType, event *DownloadEvent) {
+	c.logger.Debugf("arigo: received %s for %s", evtType, event.GID)
+	if c.resync != nil {
+		c.resync.observe(event.GID, evtType)
+	}
+	c.evtTarget.Dispatch(evtType, event)
+}
+
+func (c *Client) onDownloadStart(_ *rpc2.Client, event *DownloadEvent, _ *interface{}) error {
+	c.dispatch(StartEvent, event)
+	return nil
+}
+func (c *Client) onDownloadPause(_ *rpc2.Client, event *DownloadEvent, _ *interface{}) error {
+	c.dispatch(PauseEvent, event)
+	return nil
+}
+func (c *Client) onDownloadStop(_ *rpc2.Client, event *DownloadEvent, _ *interface{}) error {
+	c.dispatch(StopEvent, event)
+	return nil
+}
+func (c *Client) onDownloadComplete(_ *rpc2.Client, event *DownloadEvent, _ *interface{}) error {
+	c.dispatch(CompleteEvent, event)
+	return nil
+}
+func (c *Client) onDownloadError(_ *rpc2.Client, event *DownloadEvent, _ *interface{}) error {
+	c.dispatch(ErrorEvent, event)
+	return nil
+}
+func (c *Client) onBTDownloadComplete(_ *rpc2.Client, event *DownloadEvent, _ *interface{}) error {
+	c.dispatch(BTCompleteEvent, event)
+	return nil
+}
+func (c *Client) onUnknownNotification(_ *rpc2.Client, event *UnknownEvent, _ *interface{}) error {
+	c.logger.Debugf("arigo: received unknown notification %s", event.Method)
+	c.evtTarget.DispatchUnknown(event)
+	return nil
+}
+
+// NotificationsSupported reports whether the transport of the client delivers notifications.
+// It's false for clients using HTTP.
+func (c *Client) NotificationsSupported() bool {
+	return !c.noNotifications
+}
+
+// Subscribe registers the given listener for an event.
+// The listener will be called every time the event occurs.
+// If the client doesn't support notifications, for example because it uses HTTP,
+// the listener is never called, see NotificationsSupported.
+func (c *Client) Subscribe(evtType EventType, listener EventListener) UnsubscribeFunc {
+	return c.evtTarget.Subscribe(evtType, listener)
+}
+
+// SubscribeUnknown registers the given listener for notifications which aren't denoted by an EventType,
+// the listener receives the name and the parameters of the notification.
+// If the client doesn't support notifications, the listener is never called, see NotificationsSupported.
+func (c *Client) SubscribeUnknown(listener UnknownListener) UnsubscribeFunc {
+	return c.evtTarget.SubscribeUnknown(listener)
+}
+
+// SubscribeChan registers a listener for an event which delivers the events on the returned channel.
+// Every call creates a new channel, so multiple consumers of the same event each receive every event.
+// The channel buffers up to buffer events, further events are dropped until the consumer catches up,
+// which keeps a slow consumer from delaying the others. DroppedEvents counts the dropped events.
+// The channel is closed when the returned UnsubscribeFunc is called.
+func (c *Client) SubscribeChan(evtType EventType, buffer int) (<-chan *DownloadEvent, UnsubscribeFunc) {
+	return c.evtTarget.SubscribeChan(evtType, buffer)
+}
+
+// SubscribeChanWithPolicy is like SubscribeChan but policy decides what happens with an event
+// once the buffer of the channel is full:
+//   - DropNewest drops the new event, like SubscribeChan
+//   - DropOldest drops the oldest buffered event, so the channel holds the latest events
+//   - Block queues the event until the consumer made room for it. No event is lost and
+//     neither other listeners nor calls of the client wait for the consumer, but the queue
+//     grows for as long as the consumer falls behind.
+//
+// Events dropped by either policy are counted by DroppedEvents.
+func (c *Client) SubscribeChanWithPolicy(evtType EventType, buffer int, policy OverflowPolicy) (<-chan *DownloadEvent, UnsubscribeFunc) {
+	return c.evtTarget.SubscribeChanWithPolicy(evtType, buffer, policy)
+}
+
+// DroppedEvents returns the number of events which were dropped so far because the buffer
+// of a channel returned by SubscribeChan or SubscribeChanWithPolicy was full.
+func (c *Client) DroppedEvents() uint64 {
+	return c.evtTarget.Dropped()
+}
+
+// WaitForDownload waits for a download denoted by its gid to finish.
+// It returns ErrNotificationsUnsupported if the client doesn't support notifications.
+func (c *Client) WaitForDownload(gid string) error {
+	return c.WaitForDownloadContext(context.Background(), gid)
+}
+
+// WaitForDownloadContext is like WaitForDownload() but stops waiting once ctx is done.
+func (c *Client) WaitForDownloadContext(ctx context.Context, gid string) error {
+	if err := ValidateGID(gid); err != nil {
+		return err
+	}
+	if c.noNotifications {
+		return ErrNotificationsUnsupported
+	}
+	channel := make(chan error, 1)
+
+	sendResponse := func(err error) EventListener {
+		return func(ev *DownloadEvent) {
+			if ev.GID == gid {
+				channel <- err
+			}
+		}
+	}
+
+	stopUnsub := c.evtTarget.Subscribe(StopEvent, sendResponse(ErrDownloadStopped))
+	completeUnsub := c.evtTarget.Subscribe(CompleteEvent, sendResponse(nil))
+	errUnsub := c.evtTarget.Subscribe(ErrorEvent, sendResponse(ErrDownloadError))
+
+	var err error
+	select {
+	case err = <-channel:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	stopUnsub()
+	completeUnsub()
+	errUnsub()
+
+	return err
+}
+
+// WaitForDownloads waits until all downloads denoted by gids finished and returns their final statuses.
+// A download is finished once its status is complete, error or removed, the statuses can be
+// used to find the downloads which failed. Downloads which finished before the call are detected
+// as well.
+//
+// The downloads are tracked using notifications, their statuses are also polled every second,
+// which covers notifications lost while reconnecting and clients which don't support them.
+// The statuses of all pending downloads are fetched using a single multicall.
+// If ctx is done or a status can't be fetched, the statuses of the downloads which finished
+// so far are returned alongside the error.
+func (c *Client) WaitForDownloads(ctx context.Context, gids ...string) (map[string]Status, error) {
+	for _, gid := range gids {
+		if err := ValidateGID(gid); err != nil {
+			return nil, err
+		}
+	}
+
+	// the listener only passes on events of the awaited downloads and never blocks the dispatch,
+	// an event dropped because the buffer is full is made up for by the next poll.
+	awaited := make(map[string]bool, len(gids))
+	for _, gid := range gids {
+		awaited[gid] = true
+	}
+	finished := make(chan string, len(gids))
+
+	if c.NotificationsSupported() {
+		listener := func(ev *DownloadEvent) {
+			if !awaited[ev.GID] {
+				return
+			}
+			select {
+			case finished <- ev.GID:
+			default:
+			}
+		}
+		for _, evtType := range []EventType{StopEvent, CompleteEvent, ErrorEvent} {
+			unsub := c.evtTarget.Subscribe(evtType, listener)
+			defer unsub()
+		}
+	}
+
+	statuses := make(map[string]Status, len(gids))
+	pending := make(map[string]bool, len(gids))
+	for _, gid := range gids {
+		pending[gid] = true
+	}
+
+	// check updates the status of gid, it's called after subscribing,
+	// so downloads finishing at any time are noticed.
+	check := func(gid string) error {
+		status, err := c.TellStatusContext(ctx, GIDString(gid))
+		if err != nil {
+			return err
+		}
+		if isFinalStatus(status.Status) {
+			statuses[gid] = status
+			delete(pending, gid)
+		}
+		return nil
+	}
+
+	// checkPending updates the statuses of all pending downloads using a single multicall,
+	// which is a lot cheaper than a call per download if there are many.
+	checkPending := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		if len(pending) == 1 {
+			for gid := range pending {
+				return check(gid)
+			}
+		}
+
+		pendingGIDs := make([]string, 0, len(pending))
+		calls := make([]*MethodCall, 0, len(pending))
+		for gid := range pending {
+			pendingGIDs = append(pendingGIDs, gid)
+			calls = append(calls, NewMethodCall(aria2proto.TellStatus, gid))
+		}
+
+		results, err := c.MultiCallContext(ctx, calls...)
+		if err != nil {
+			return err
+		}
+		if len(results) != len(calls) {
+			return fmt.Errorf("multicall returned %d results for %d calls", len(results), len(calls))
+		}
+
+		for i, result := range results {
+			var status Status
+			if err := result.Unmarshal(&status); err != nil {
+				return err
+			}
+			// finished downloads are no longer tracked
+			if isFinalStatus(status.Status) {
+				statuses[pendingGIDs[i]] = status
+				delete(pending, pendingGIDs[i])
+			}
+		}
+		return nil
+	}
+
+	if err := checkPending(); err != nil {
+		return statuses, err
+	}
+
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+
+	for len(pending) > 0 {
+		select {
+		case gid := <-finished:
+			if pending[gid] {
+				if err := check(gid); err != nil {
+					return statuses, err
+				}
+			}
+		case <-ticker.C:
+			if err := checkPending(); err != nil {
+				return statuses, err
+			}
+		case <-ctx.Done():
+			return statuses, ctx.Err()
+		}
+	}
+
+	return statuses, nil
+}
+
+// Download adds a new download and waits for it to complete.
+// It returns the status of the finished download.
+func (c *Client) Download(uris []string, options *Options) (status Status, err error) {
+	return c.DownloadWithContext(context.Background(), uris, options)
+}
+
+// DownloadWithContext adds a new download and waits for it to complete.
+// The passed context can be used to cancel the download.
+// It returns the status of the finished download.
+func (c *Client) DownloadWithContext(ctx context.Context, uris []string, options *Options) (status Status, err error) {
+	if c.noNotifications {
+		err = ErrNotificationsUnsupported
+		return
+	}
+
+	gid, err := c.AddURIContext(ctx, uris, options)
+	if err != nil {
+		return
+	}
+
+	// a stopped or failed download is reported by its status
+	if waitErr := c.WaitForDownloadContext(ctx, gid.GID); waitErr != nil && ctx.Err() != nil {
+		_ = gid.Delete()
+		err = ctx.Err()
+		return
+	}
+
+	return c.TellStatusContext(ctx, GIDString(gid.GID))
+}
+
+// Delete removes the download denoted by gid and deletes all corresponding files.
+// This is not an aria2 method.
+func (c *Client) Delete(gid string) (err error) {
+	return c.DeleteContext(context.Background(), gid)
+}
+
+// DeleteContext is like Delete() but aborts the call once ctx is done.
+func (c *Client) DeleteContext(ctx context.Context, gid string) (err error) {
+	err = c.RemoveContext(ctx, GIDString(gid))
+	if err != nil {
+		return
+	}
+
+	files, err := c.GetFilesContext(ctx, GIDString(gid))
+	if err == nil {
+		for _, file := range files {
+			_ = os.Remove(file.Path)
+		}
+	}
+
+	return
+}
+
+// GetGID creates a GID struct which you can use to interact with the download directly
+func (c *Client) GetGID(gid string) GID {
+	return GID{c, gid}
+}
+
+// ParseGID is like GetGID but validates gid first.
+// The returned error wraps ErrInvalidGID if gid doesn't have the format used by aria2.
+func (c *Client) ParseGID(gid string) (GID, error) {
+	if err := ValidateGID(gid); err != nil {
+		return GID{}, err
+	}
+
+	return c.GetGID(gid), nil
+}
+
+func (c *Client) getArgs(args ...interface{}) []interface{} {
+	if c.authToken == "" {
+		if args != nil {
+			return args
+		}
+		return []interface{}{}
+	} else {
+		tokenArg := "token:" + c.authToken
+		return append([]interface{}{tokenArg}, args...)
+	}
+}
+
+// appendOptions appends the options and the position of the add methods to args.
+// aria2 expects the position after the options, so an empty options object is passed
+// if only the position is set.
+func appendOptions(args []interface{}, options *Options, position uint) ([]interface{}, error) {
+	optionMap := map[string]string{}
+	if options != nil {
+		var err error
+		if optionMap, err = options.ToMap(); err != nil {
+			return nil, err
+		}
+	}
+
+	if options != nil || position != QueueEndPosition {
+		args = append(args, optionMap)
+	}
+	if position != QueueEndPosition {
+		args = append(args, position)
+	}
+	return args, nil
+}
+
+// AddURIAtPosition adds a new download at a specific position in the queue.
+// uris is a slice of HTTP/FTP/SFTP/BitTorrent URIs pointing to the same resource.
+// If you mix URIs pointing to different resources,
+// then the download may fail or be corrupted without aria2 complaining.
+//
+// When adding BitTorrent Magnet URIs, uris must have only one element and it should be BitTorrent Magnet URI.
+//
+// The new download will be inserted at position in the waiting queue.
+// If position is QueueEndPosition or larger than the current size of the queue,
+// the new download is appended to the end of the queue. Position 0 adds it to the top.
+//
+// This method returns the GID of the newly registered download.
+func (c *Client) AddURIAtPosition(uris []string, position uint, options *Options) (GID, error) {
+	return c.AddURIAtPositionContext(context.Background(), uris, position, options)
+}
+
+// AddURIAtPositionContext is like AddURIAtPosition() but aborts the call once ctx is done.
+func (c *Client) AddURIAtPositionContext(ctx context.Context, uris []string, position uint, options *Options) (GID, error) {
+	if len(uris) == 0 {
+		return GID{}, ErrNoURIs
+	}
+
+	args := c.getArgs(uris)
+
+	args, err := appendOptions(args, options, position)
+	if err != nil {
+		return GID{}, err
+	}
+
+	var reply string
+	err = c.callContext(ctx, aria2proto.AddURI, args, &reply)
+
+	return c.GetGID(reply), err
+}
+
+// AddURI adds a new download.
+// uris is a slice of HTTP/FTP/SFTP/BitTorrent URIs (strings) pointing to the same resource.
+// All of them are passed in a single call and aria2 treats them as mirrors of one file,
+// use the URIs function to pass a single uri. ErrNoURIs is returned if uris is empty.
+// If you mix URIs pointing to different resources,
+// then the download may fail or be corrupted without aria2 complaining.
+//
+// When adding BitTorrent Magnet URIs, uris must have only one element and it should be BitTorrent Magnet URI.
+//
+// The new download is appended to the end of the queue.
+//
+// This method returns the GID of the newly registered download.
+// It blocks until aria2 responded, the GID is always the one assigned by aria2.
+func (c *Client) AddURI(uris []string, options *Options) (GID, error) {
+	return c.AddURIContext(context.Background(), uris, options)
+}
+
+// AddURIContext is like AddURI() but aborts the call once ctx is done.
+func (c *Client) AddURIContext(ctx context.Context, uris []string, options *Options) (GID, error) {
+	return c.AddURIAtPositionContext(ctx, uris, QueueEndPosition, options)
+}
+
+// AddURIWithContext is like AddURIContext but ties the lifetime of the download to ctx:
+// if ctx is done before the download has finished, the download is removed using ForceRemove.
+// Once the download completed, failed, was removed by someone else or its result was purged,
+// ctx has no effect anymore.
+// It's meant for downloads which only make sense as long as, for example, a request is served.
+//
+// Unless options sets the gid, the client picks a random one, so the download is also removed
+// if ctx is done after aria2 added it but before the response arrived.
+//
+// The download is watched like by Watch, by a goroutine which returns once the download
+// has finished, ctx is done or the client is closed. Closing the client doesn't remove the download.
+func (c *Client) AddURIWithContext(ctx context.Context, uris []string, options *Options) (GID, error) {
+	var opts Options
+	if options != nil {
+		opts = *options
+	}
+	if opts.GID == "" {
+		var err error
+		if opts.GID, err = newGID(); err != nil {
+			return GID{}, err
+		}
+	}
+
+	gid, err := c.AddURIContext(ctx, uris, &opts)
+	if err != nil {
+		// aria2 may have added the download before ctx was done, unless it rejected it
+		if ctx.Err() != nil && !errors.As(err, new(*RPCError)) {
+			go func() {
+				if err := c.ForceRemoveContext(c.closeCtx, opts.GID); err == nil {
+					c.logger.Debugf("arigo: removed %s which was added after its context was done", opts.GID)
+				}
+			}()
+		}
+		return gid, err
+	}
+
+	go c.tieDownload(ctx, gid.GID)
+
+	return gid, nil
+}
+
+// tieDownload removes the download denoted by gid once ctx is done, unless the download
+// finished before, see AddURIWithContext.
+func (c *Client) tieDownload(ctx context.Context, gid string) {
+	if c.tieDone != nil {
+		defer c.tieDone(gid)
+	}
+
+	watchCtx, cancel := context.WithCancel(c.closeCtx)
+	defer cancel()
+
+	var last Status
+	w, err := c.Watch(watchCtx, gid, waitPollInterval)
+	if err == nil {
+		watching := true
+		for watching {
+			select {
+			case status, ok := <-w.C:
+				if ok {
+					last = status
+				} else {
+					watching = false
+				}
+			case <-ctx.Done():
+				cancel()
+				// the watch may have seen the download finish in the meantime
+				for status := range w.C {
+					last = status
+				}
+				watching = false
+			}
+		}
+		err = w.Err()
+	}
+
+	if isFinalStatus(last.Status) || errors.Is(err, ErrNotFound) || c.closeCtx.Err() != nil {
+		// the download finished or was purged, or the client was closed
+		return
+	}
+
+	// ctx is done, or the download can't be watched anymore and is removed once it is
+	select {
+	case <-ctx.Done():
+	case <-c.closeCtx.Done():
+		return
+	}
+	if err := c.ForceRemoveContext(c.closeCtx, gid); err != nil && c.closeCtx.Err() == nil {
+		c.logger.Errorf("arigo: removing %s after its context was done failed: %v", gid, err)
+	}
+}
+
+// AddURIsFromReader adds a download for every line read from r, like the --input-file option of aria2.
+// A line holds the uri of a download, or several whitespace-separated uris which are mirrors of the
+// same file. Blank lines and lines starting with # are skipped. Unlike in an aria2 input file,
+// indented lines don't set options, options applies to all downloads.
+//
+// All downloads are added using a single multicall. The GIDs are returned in the order of the lines.
+// If aria2 rejects some of the downloads, their GIDs are empty and the error of the first one is
+// returned alongside the GIDs.
+func (c *Client) AddURIsFromReader(r io.Reader, options *Options) ([]GID, error) {
+	return c.AddURIsFromReaderContext(context.Background(), r, options)
+}
+
+// AddURIsFromReaderContext is like AddURIsFromReader() but aborts the call once ctx is done.
+func (c *Client) AddURIsFromReaderContext(ctx context.Context, r io.Reader, options *Options) ([]GID, error) {
+	var calls []*MethodCall
+	var lines []int
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		params, err := appendOptions([]interface{}{strings.Fields(text)}, options, QueueEndPosition)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, NewMethodCall(aria2proto.AddURI, params...))
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(calls) == 0 {
+		return nil, nil
+	}
+
+	results, err := c.MultiCallContext(ctx, calls...)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != len(calls) {
+		return nil, fmt.Errorf("multicall returned %d results for %d calls", len(results), len(calls))
+	}
+
+	gids := make([]GID, len(results))
+	var firstErr error
+	for i, result := range results {
+		var gid string
+		if err := result.Unmarshal(&gid); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("line %d: %w", lines[i], err)
+			}
+			continue
+		}
+		gids[i] = c.GetGID(gid)
+	}
+
+	return gids, firstErr
+}
+
+// AddURIIfAbsent is like AddURI but if an active, waiting or paused download already uses
+// one of uris, its GID is returned instead of adding another download.
+// added reports whether a new download was added.
+//
+// This is best-effort: the downloads are checked before the new one is added in a separate call,
+// so a download added concurrently, by this or another client, isn't detected.
+// Stopped downloads aren't checked. Use AddURI to always add a new download.
+func (c *Client) AddURIIfAbsent(uris []string, options *Options) (gid GID, added bool, err error) {
+	return c.AddURIIfAbsentContext(context.Background(), uris, options)
+}
+
+// AddURIIfAbsentContext is like AddURIIfAbsent() but aborts once ctx is done.
+func (c *Client) AddURIIfAbsentContext(ctx context.Context, uris []string, options *Options) (gid GID, added bool, err error) {
+	if len(uris) == 0 {
+		return GID{}, false, ErrNoURIs
+	}
+
+	existing, err := c.findURIs(ctx, uris)
+	if err != nil {
+		return GID{}, false, err
+	}
+	if existing != "" {
+		return c.GetGID(existing), false, nil
+	}
+
+	gid, err = c.AddURIContext(ctx, uris, options)
+	return gid, err == nil, err
+}
+
+// findURIs returns the gid of an active or waiting download which uses one of uris,
+// or an empty string if there is none.
+func (c *Client) findURIs(ctx context.Context, uris []string) (string, error) {
+	wanted := make(map[string]bool, len(uris))
+	for _, uri := range uris {
+		wanted[uri] = true
+	}
+	match := func(downloads []Status) string {
+		for _, status := range downloads {
+			for _, file := range status.Files {
+				for _, uri := range file.URIs {
+					if wanted[uri.URI] {
+						return status.GID
+					}
+				}
+			}
+		}
+		return ""
+	}
+
+	active, err := c.TellActiveContext(ctx, "gid", "files")
+	if err != nil {
+		return "", err
+	}
+	if gid := match(active); gid != "" {
+		return gid, nil
+	}
+
+	for offset := 0; ; offset += pageSize {
+		waiting, err := c.TellWaitingContext(ctx, offset, pageSize, "gid", "files")
+		if err != nil {
+			return "", err
+		}
+		if gid := match(waiting); gid != "" {
+			return gid, nil
+		}
+		if len(waiting) < pageSize {
+			return "", nil
+		}
+	}
+}
+
+// FindByInfoHash returns the GID of the BitTorrent download with the given info hash,
+// which is compared case-insensitively. The active, waiting and stopped downloads are searched
+// in this order, so it's O(n) in the number of downloads known to aria2.
+// It returns ErrNotFound if there's no such download.
+func (c *Client) FindByInfoHash(hash string) (GID, error) {
+	return c.FindByInfoHashContext(context.Background(), hash)
+}
+
+// FindByInfoHashContext is like FindByInfoHash() but aborts once ctx is done.
+func (c *Client) FindByInfoHashContext(ctx context.Context, hash string) (GID, error) {
+	match := func(downloads []Status) string {
+		for _, status := range downloads {
+			if status.InfoHash != "" && strings.EqualFold(status.InfoHash, hash) {
+				return status.GID
+			}
+		}
+		return ""
+	}
+
+	active, err := c.TellActiveContext(ctx, "gid", "infoHash")
+	if err != nil {
+		return GID{}, err
+	}
+	if gid := match(active); gid != "" {
+		return c.GetGID(gid), nil
+	}
+
+	lists := []func(ctx context.Context, offset int, num uint, keys ...string) ([]Status, error){
+		c.TellWaitingContext,
+		c.TellStoppedContext,
+	}
+	for _, list := range lists {
+		for offset := 0; ; offset += pageSize {
+			downloads, err := list(ctx, offset, pageSize, "gid", "infoHash")
+			if err != nil {
+				return GID{}, err
+			}
+			if gid := match(downloads); gid != "" {
+				return c.GetGID(gid), nil
+			}
+			if len(downloads) < pageSize {
+				break
+			}
+		}
+	}
+
+	return GID{}, ErrNotFound
+}
+
+// AddTorrentAtPosition adds a BitTorrent download at a specific position in the queue.
+// If you want to add a BitTorrent Magnet URI, use the AddURI() method instead.
+// torrent must be the contents of the “.torrent” file.
+// uris is an array of URIs (string). uris is used for Web-seeding.
+//
+// For single file torrents, the URI can be a complete URI pointing to the resource;
+// if URI ends with /, name in torrent file is added. For multi-file torrents,
+// name and path in torrent are added to form a URI for each file.
+//
+// The new download will be inserted at position in the waiting queue.
+// If position is QueueEndPosition or larger than the current size of the queue,
+// the new download is appended to the end of the queue. Position 0 adds it to the top.
+//
+// This method returns the GID of the newly registered download.
+// If aria2 rejects the torrent, the returned error wraps the error reported by aria2.
+func (c *Client) AddTorrentAtPosition(torrent []byte, uris []string, position uint, options *Options) (GID, error) {
+	return c.AddTorrentAtPositionContext(context.Background(), torrent, uris, position, options)
+}
+
+// AddTorrentAtPositionContext is like AddTorrentAtPosition() but aborts the call once ctx is done.
+func (c *Client) AddTorrentAtPositionContext(ctx context.Context, torrent []byte, uris []string, position uint, options *Options) (GID, error) {
+	// convert nil to empty slice, aria2 doesn't accept null for the web-seeding uris
+	if uris == nil {
+		uris = make([]string, 0)
+	}
+
+	encodedTorrent := base64.StdEncoding.EncodeToString(torrent)
+	args := c.getArgs(encodedTorrent, uris)
+
+	args, err := appendOptions(args, options, position)
+	if err != nil {
+		return GID{}, err
+	}
+
+	var reply string
+	err = c.callContext(ctx, aria2proto.AddTorrent, args, &reply)
+	if err != nil {
+		if errors.As(err, new(*RPCError)) {
+			err = fmt.Errorf("aria2 rejected torrent: %w", err)
+		}
+		return GID{}, err
+	}
+
+	return c.GetGID(reply), nil
+}
+
+// AddTorrent adds a BitTorrent download by uploading a “.torrent” file.
+// If you want to add a BitTorrent Magnet URI, use the AddURI() method instead.
+// torrent must be the contents of the “.torrent” file.
+// uris is an array of URIs (string). uris is used for Web-seeding.
+//
+// For single file torrents, the URI can be a complete URI pointing to the resource;
 // if URI ends with /, name in torrent file is added. For multi-file torrents,
 // name and path in torrent are added to form a URI for each file.
 //
-// The new download is appended to the end of the queue.
+// The new download is appended to the end of the queue.
+//
+// This method returns the GID of the newly registered download.
+func (c *Client) AddTorrent(torrent []byte, uris []string, options *Options) (GID, error) {
+	return c.AddTorrentContext(context.Background(), torrent, uris, options)
+}
+
+// AddTorrentContext is like AddTorrent() but aborts the call once ctx is done.
+func (c *Client) AddTorrentContext(ctx context.Context, torrent []byte, uris []string, options *Options) (GID, error) {
+	return c.AddTorrentAtPositionContext(ctx, torrent, uris, QueueEndPosition, options)
+}
+
+// AddTorrentFile is like AddTorrent but reads the “.torrent” file from path.
+func (c *Client) AddTorrentFile(path string, uris []string, options *Options) (GID, error) {
+	return c.AddTorrentFileContext(context.Background(), path, uris, options)
+}
+
+// AddTorrentFileContext is like AddTorrentFile() but aborts the call once ctx is done.
+func (c *Client) AddTorrentFileContext(ctx context.Context, path string, uris []string, options *Options) (GID, error) {
+	torrent, err := ioutil.ReadFile(path)
+	if err != nil {
+		return GID{}, err
+	}
+
+	return c.AddTorrentContext(ctx, torrent, uris, options)
+}
+
+// AddMetalinkAtPosition adds a Metalink download at a specific position in the queue by uploading a “.metalink” file.
+// metalink is the contents of the “.metalink” file.
+//
+// The new download will be inserted at position in the waiting queue.
+// If position is QueueEndPosition or larger than the current size of the queue,
+// the new download is appended to the end of the queue. Position 0 adds it to the top.
+//
+// This method returns an array of GIDs of newly registered downloads.
+func (c *Client) AddMetalinkAtPosition(metalink []byte, position uint, options *Options) ([]GID, error) {
+	return c.AddMetalinkAtPositionContext(context.Background(), metalink, position, options)
+}
+
+// AddMetalinkAtPositionContext is like AddMetalinkAtPosition() but aborts the call once ctx is done.
+func (c *Client) AddMetalinkAtPositionContext(ctx context.Context, metalink []byte, position uint, options *Options) ([]GID, error) {
+	encodedMetalink := base64.StdEncoding.EncodeToString(metalink)
+	args := c.getArgs(encodedMetalink)
+
+	args, err := appendOptions(args, options, position)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply []metalinkGID
+	err = c.callContext(ctx, aria2proto.AddMetalink, args, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	gids := make([]GID, 0, len(reply))
+	for _, rawGID := range reply {
+		gids = append(gids, c.GetGID(string(rawGID)))
+	}
+
+	return gids, nil
+}
+
+// AddMetalink adds a Metalink download by uploading a “.metalink” file.
+// metalink is the contents of the “.metalink” file.
+//
+// The new download is appended to the end of the queue.
+//
+// This method returns an array of GIDs of newly registered downloads.
+func (c *Client) AddMetalink(metalink []byte, options *Options) ([]GID, error) {
+	return c.AddMetalinkContext(context.Background(), metalink, options)
+}
+
+// AddMetalinkContext is like AddMetalink() but aborts the call once ctx is done.
+func (c *Client) AddMetalinkContext(ctx context.Context, metalink []byte, options *Options) ([]GID, error) {
+	return c.AddMetalinkAtPositionContext(ctx, metalink, QueueEndPosition, options)
+}
+
+// AddMetalinkFile is like AddMetalink but reads the “.metalink” file from path.
+func (c *Client) AddMetalinkFile(path string, options *Options) ([]GID, error) {
+	return c.AddMetalinkFileContext(context.Background(), path, options)
+}
+
+// AddMetalinkFileContext is like AddMetalinkFile() but aborts the call once ctx is done.
+func (c *Client) AddMetalinkFileContext(ctx context.Context, path string, options *Options) ([]GID, error) {
+	metalink, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.AddMetalinkContext(ctx, metalink, options)
+}
+
+// metalinkGID is a gid returned by aria2.addMetalink.
+// aria2 returns the gids as strings, but some versions returned objects holding the gid instead.
+type metalinkGID string
+
+// UnmarshalJSON loads a gid from either a string or an object with a gid key.
+func (g *metalinkGID) UnmarshalJSON(data []byte) error {
+	var gid string
+	if err := json.Unmarshal(data, &gid); err == nil {
+		*g = metalinkGID(gid)
+		return nil
+	}
+
+	var obj struct {
+		GID string `json:"gid"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+
+	*g = metalinkGID(obj.GID)
+	return nil
+}
+
+// Remove removes the download denoted by gid.
+// If the specified download is in progress, it is first stopped.
+// The status of the removed download becomes removed.
+// An error is returned unless aria2 confirmed the removal of gid.
+func (c *Client) Remove(gid GIDString) error {
+	return c.RemoveContext(context.Background(), gid)
+}
+
+// RemoveContext is like Remove() but aborts the call once ctx is done.
+func (c *Client) RemoveContext(ctx context.Context, gid GIDString) error {
+	if err := ValidateGID(string(gid)); err != nil {
+		return err
+	}
+	return c.callGID(ctx, aria2proto.Remove, string(gid))
+}
+
+// ForceRemove removes the download denoted by gid.
+// This method behaves just like Remove() except that this method removes the download
+// without performing any actions which take time, such as contacting BitTorrent trackers to
+// unregister the download first.
+func (c *Client) ForceRemove(gid string) error {
+	return c.ForceRemoveContext(context.Background(), gid)
+}
+
+// ForceRemoveContext is like ForceRemove() but aborts the call once ctx is done.
+func (c *Client) ForceRemoveContext(ctx context.Context, gid string) error {
+	if err := ValidateGID(gid); err != nil {
+		return err
+	}
+	return c.callGID(ctx, aria2proto.ForceRemove, gid)
+}
+
+// Pause pauses the download denoted by gid.
+// The status of paused download becomes paused. If the download was active,
+// the download is placed in the front of the queue. While the status is paused,
+// the download is not started. To change status to waiting, use the Unpause() method.
+func (c *Client) Pause(gid GIDString) error {
+	return c.PauseContext(context.Background(), gid)
+}
+
+// PauseContext is like Pause() but aborts the call once ctx is done.
+func (c *Client) PauseContext(ctx context.Context, gid GIDString) error {
+	if err := ValidateGID(string(gid)); err != nil {
+		return err
+	}
+	return c.callGID(ctx, aria2proto.Pause, string(gid))
+}
+
+// PauseAll is equal to calling Pause() for every active/waiting download.
+// If aria2 doesn't acknowledge the call with "OK" an *UnexpectedReplyError is returned.
+func (c *Client) PauseAll() error {
+	return c.PauseAllContext(context.Background())
+}
+
+// PauseAllContext is like PauseAll() but aborts the call once ctx is done.
+func (c *Client) PauseAllContext(ctx context.Context) error {
+	return c.callOK(ctx, aria2proto.PauseAll)
+}
+
+// ForcePause pauses the download denoted by gid.
+// This method behaves just like Pause() except that this method pauses downloads
+// without performing any actions which take time, such as contacting BitTorrent trackers to
+// unregister the download first.
+func (c *Client) ForcePause(gid string) error {
+	return c.ForcePauseContext(context.Background(), gid)
+}
+
+// ForcePauseContext is like ForcePause() but aborts the call once ctx is done.
+func (c *Client) ForcePauseContext(ctx context.Context, gid string) error {
+	if err := ValidateGID(gid); err != nil {
+		return err
+	}
+	return c.callGID(ctx, aria2proto.ForcePause, gid)
+}
+
+// ForcePauseAll is equal to calling ForcePause() for every active/waiting download.
+// If aria2 doesn't acknowledge the call with "OK" an *UnexpectedReplyError is returned.
+func (c *Client) ForcePauseAll() error {
+	return c.ForcePauseAllContext(context.Background())
+}
+
+// ForcePauseAllContext is like ForcePauseAll() but aborts the call once ctx is done.
+func (c *Client) ForcePauseAllContext(ctx context.Context) error {
+	return c.callOK(ctx, aria2proto.ForcePauseAll)
+}
+
+// Unpause changes the status of the download denoted by gid from paused to waiting,
+// making the download eligible to be restarted.
+func (c *Client) Unpause(gid GIDString) error {
+	return c.UnpauseContext(context.Background(), gid)
+}
+
+// UnpauseContext is like Unpause() but aborts the call once ctx is done.
+func (c *Client) UnpauseContext(ctx context.Context, gid GIDString) error {
+	if err := ValidateGID(string(gid)); err != nil {
+		return err
+	}
+	return c.callGID(ctx, aria2proto.Unpause, string(gid))
+}
+
+// UnpauseAll is equal to calling Unpause() for every paused download.
+// If aria2 doesn't acknowledge the call with "OK" an *UnexpectedReplyError is returned.
+func (c *Client) UnpauseAll() error {
+	return c.UnpauseAllContext(context.Background())
+}
+
+// UnpauseAllContext is like UnpauseAll() but aborts the call once ctx is done.
+func (c *Client) UnpauseAllContext(ctx context.Context) error {
+	return c.callOK(ctx, aria2proto.UnpauseAll)
+}
+
+// TellStatus returns the progress of the download denoted by gid.
+//
+// If specified, the returned Status only contains the keys passed to the method,
+// the fields of all other keys are left at their zero values. The keys are the aria2 names,
+// such as "completedLength", see the json tags of Status.
+// This is useful when you just want specific keys and avoid unnecessary transfers.
+//
+// Most keys are numbers or short strings which are cheap to request.
+// The size of "files" grows with the number of files and their uris, "bitfield" with the
+// number of pieces, and "bittorrent" with the announce list. Leave them out when polling the
+// progress of many downloads, "gid", "status", "totalLength", "completedLength" and
+// "downloadSpeed" are sufficient for a progress bar.
+func (c *Client) TellStatus(gid GIDString, keys ...string) (Status, error) {
+	return c.TellStatusContext(context.Background(), gid, keys...)
+}
+
+// TellStatusContext is like TellStatus() but aborts the call once ctx is done.
+func (c *Client) TellStatusContext(ctx context.Context, gid GIDString, keys ...string) (Status, error) {
+	if err := ValidateGID(string(gid)); err != nil {
+		return Status{}, err
+	}
+	var reply Status
+	err := c.callContext(ctx, aria2proto.TellStatus, c.getArgs(string(gid), statusKeys(keys)), &reply)
+
+	return reply, err
+}
+
+// GetURIs returns the URIs used in the download denoted by gid.
+// The response is a slice of URIs, the status of each URI tells whether
+// it's in use or waiting in the queue.
+func (c *Client) GetURIs(gid GIDString) ([]URI, error) {
+	return c.GetURIsContext(context.Background(), gid)
+}
+
+// GetURIsContext is like GetURIs() but aborts the call once ctx is done.
+func (c *Client) GetURIsContext(ctx context.Context, gid GIDString) ([]URI, error) {
+	if err := ValidateGID(string(gid)); err != nil {
+		return nil, err
+	}
+	var reply []URI
+	err := c.callContext(ctx, aria2proto.GetURIs, c.getArgs(string(gid)), &reply)
+
+	return reply, err
+}
+
+// GetFiles returns the file list of the download denoted by gid.
+// The response is a slice of Files.
+func (c *Client) GetFiles(gid GIDString) ([]File, error) {
+	return c.GetFilesContext(context.Background(), gid)
+}
+
+// GetFilesContext is like GetFiles() but aborts the call once ctx is done.
+func (c *Client) GetFilesContext(ctx context.Context, gid GIDString) ([]File, error) {
+	if err := ValidateGID(string(gid)); err != nil {
+		return nil, err
+	}
+	var reply []File
+	err := c.callContext(ctx, aria2proto.GetFiles, c.getArgs(string(gid)), &reply)
+
+	return reply, err
+}
+
+// SelectFiles sets the files of the download denoted by gid which are downloaded
+// using the SelectFile option. indices are the 1-based indices of the files, see File.Index.
+// The other files aren't downloaded, the Selected flags returned by GetFiles reflect the selection.
+//
+// The indices are checked against the files of the download before the option is changed,
+// an index out of range results in an error wrapping ErrInvalidFileIndex.
+// At least one file has to be selected.
+func (c *Client) SelectFiles(gid string, indices ...int) error {
+	return c.SelectFilesContext(context.Background(), gid, indices...)
+}
+
+// SelectFilesContext is like SelectFiles() but aborts the call once ctx is done.
+func (c *Client) SelectFilesContext(ctx context.Context, gid string, indices ...int) error {
+	if len(indices) == 0 {
+		return fmt.Errorf("%w: no files selected", ErrInvalidFileIndex)
+	}
+
+	files, err := c.GetFilesContext(ctx, GIDString(gid))
+	if err != nil {
+		return err
+	}
+	for _, index := range indices {
+		if index < 1 || index > len(files) {
+			return fmt.Errorf("%w: %d, the download has %d files", ErrInvalidFileIndex, index, len(files))
+		}
+	}
+
+	return c.selectFiles(ctx, gid, indices)
+}
+
+// SelectAllFiles selects all files of the download denoted by gid, see SelectFiles.
+func (c *Client) SelectAllFiles(gid string) error {
+	return c.SelectAllFilesContext(context.Background(), gid)
+}
+
+// SelectAllFilesContext is like SelectAllFiles() but aborts the call once ctx is done.
+func (c *Client) SelectAllFilesContext(ctx context.Context, gid string) error {
+	files, err := c.GetFilesContext(ctx, GIDString(gid))
+	if err != nil {
+		return err
+	}
+
+	indices := make([]int, len(files))
+	for i := range indices {
+		indices[i] = i + 1
+	}
+	return c.selectFiles(ctx, gid, indices)
+}
+
+// DeselectFiles stops downloading the files denoted by indices of the download denoted by gid,
+// the files which are currently selected stay selected. See SelectFiles for the restrictions.
+func (c *Client) DeselectFiles(gid string, indices ...int) error {
+	return c.DeselectFilesContext(context.Background(), gid, indices...)
+}
+
+// DeselectFilesContext is like DeselectFiles() but aborts the call once ctx is done.
+func (c *Client) DeselectFilesContext(ctx context.Context, gid string, indices ...int) error {
+	files, err := c.GetFilesContext(ctx, GIDString(gid))
+	if err != nil {
+		return err
+	}
+
+	deselected := make(map[int]bool, len(indices))
+	for _, index := range indices {
+		if index < 1 || index > len(files) {
+			return fmt.Errorf("%w: %d, the download has %d files", ErrInvalidFileIndex, index, len(files))
+		}
+		deselected[index] = true
+	}
+
+	var selected []int
+	for _, file := range files {
+		if index := int(file.Index); bool(file.Selected) && !deselected[index] {
+			selected = append(selected, index)
+		}
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("%w: no files would be selected", ErrInvalidFileIndex)
+	}
+	return c.selectFiles(ctx, gid, selected)
+}
+
+// selectFiles sets the select-file option of the download denoted by gid to indices.
+// Duplicate indices are sent once.
+func (c *Client) selectFiles(ctx context.Context, gid string, indices []int) error {
+	sorted := append([]int(nil), indices...)
+	sort.Ints(sorted)
+
+	values := make([]string, 0, len(sorted))
+	for i, index := range sorted {
+		if i == 0 || index != sorted[i-1] {
+			values = append(values, strconv.Itoa(index))
+		}
+	}
+	return c.ChangeOptionContext(ctx, gid, "select-file", strings.Join(values, ","))
+}
+
+// GetPeers returns a list of peers of the download denoted by gid.
+// This method is for BitTorrent only.
+// The response is a slice of Peers, which is empty for downloads which aren't BitTorrent
+// downloads, just like aria2 doesn't report an error for them either.
+func (c *Client) GetPeers(gid string) ([]Peer, error) {
+	return c.GetPeersContext(context.Background(), gid)
+}
+
+// GetPeersContext is like GetPeers() but aborts the call once ctx is done.
+func (c *Client) GetPeersContext(ctx context.Context, gid string) ([]Peer, error) {
+	if err := ValidateGID(gid); err != nil {
+		return nil, err
+	}
+	var reply []Peer
+	err := c.callContext(ctx, aria2proto.GetPeers, c.getArgs(gid), &reply)
+	if err == nil && reply == nil {
+		reply = []Peer{}
+	}
+
+	return reply, err
+}
+
+// GetServers returns currently connected HTTP(S)/FTP/SFTP servers of the download denoted by gid.
+// Returns a slice of FileServers.
+func (c *Client) GetServers(gid string) ([]FileServers, error) {
+	return c.GetServersContext(context.Background(), gid)
+}
+
+// GetServersContext is like GetServers() but aborts the call once ctx is done.
+func (c *Client) GetServersContext(ctx context.Context, gid string) ([]FileServers, error) {
+	if err := ValidateGID(gid); err != nil {
+		return nil, err
+	}
+	var reply []FileServers
+	err := c.callContext(ctx, aria2proto.GetServers, c.getArgs(gid), &reply)
+
+	return reply, err
+}
+
+// statusKeys converts nil keys to an empty slice, which aria2 interprets as all keys.
+// This prevents the error "The parameter at 1 has wrong type.".
+func statusKeys(keys []string) []string {
+	if keys == nil {
+		return make([]string, 0)
+	}
+	return keys
+}
+
+// TellActive returns a slice of active downloads represented by their Status.
+// keys does the same as in the TellStatus() method, if no keys are passed
+// all keys are returned.
+func (c *Client) TellActive(keys ...string) ([]Status, error) {
+	return c.TellActiveContext(context.Background(), keys...)
+}
+
+// TellActiveContext is like TellActive() but aborts the call once ctx is done.
+func (c *Client) TellActiveContext(ctx context.Context, keys ...string) ([]Status, error) {
+	var reply []Status
+	err := c.callContext(ctx, aria2proto.TellActive, c.getArgs(statusKeys(keys)), &reply)
+
+	return reply, err
+}
+
+// TellWaiting returns a slice of waiting downloads including paused ones represented by their Status.
+//
+// offset is an integer and specifies the offset from the download waiting at the front.
+// num is an integer and specifies the max. number of downloads to be returned.
+//
+// If offset is a positive integer, this method returns downloads in the range of [offset, offset + num).
+// offset can be a negative integer. offset == -1 points last download in the waiting queue and offset == -2 points to
+// the download before the last download, and so on. The returned statuses are in reversed order then.
+//
+// If specified, the returned Statuses only contain the keys passed to the method,
+// otherwise they contain all keys.
+func (c *Client) TellWaiting(offset int, num uint, keys ...string) ([]Status, error) {
+	return c.TellWaitingContext(context.Background(), offset, num, keys...)
+}
+
+// TellWaitingContext is like TellWaiting() but aborts the call once ctx is done.
+func (c *Client) TellWaitingContext(ctx context.Context, offset int, num uint, keys ...string) ([]Status, error) {
+	var reply []Status
+	err := c.callContext(ctx, aria2proto.TellWaiting, c.getArgs(offset, num, statusKeys(keys)), &reply)
+
+	return reply, err
+}
+
+// TellStopped returns a slice of stopped downloads represented by their Status.
+//
+// offset is an integer and specifies the offset from the least recently stopped download.
+// num is an integer and specifies the max. number of downloads to be returned.
+//
+// If offset is a positive integer, this method returns downloads in the range of [offset, offset + num).
+// offset can be a negative integer. offset == -1 points to the most recently stopped download and offset == -2
+// points to the download stopped before that, and so on. The returned statuses are in reversed order then.
+//
+// If specified, the returned Statuses only contain the keys passed to the method,
+// otherwise they contain all keys.
+func (c *Client) TellStopped(offset int, num uint, keys ...string) ([]Status, error) {
+	return c.TellStoppedContext(context.Background(), offset, num, keys...)
+}
+
+// TellStoppedContext is like TellStopped() but aborts the call once ctx is done.
+func (c *Client) TellStoppedContext(ctx context.Context, offset int, num uint, keys ...string) ([]Status, error) {
+	var reply []Status
+	err := c.callContext(ctx, aria2proto.TellStopped, c.getArgs(offset, num, statusKeys(keys)), &reply)
+
+	return reply, err
+}
+
+// PositionSetBehaviour determines how a position is to be interpreted
+type PositionSetBehaviour string
+
+const (
+	// SetPositionStart sets the position relative to the start
+	SetPositionStart PositionSetBehaviour = "POS_SET"
+
+	// SetPositionEnd sets the position relative to the end
+	SetPositionEnd PositionSetBehaviour = "POS_END"
+
+	// SetPositionRelative sets the position relative to the current position
+	SetPositionRelative PositionSetBehaviour = "POS_CUR"
+)
+
+// Valid reports whether b is one of the behaviours supported by aria2.
+func (b PositionSetBehaviour) Valid() bool {
+	switch b {
+	case SetPositionStart, SetPositionEnd, SetPositionRelative:
+		return true
+	}
+	return false
+}
+
+// ChangePosition changes the position of the download denoted by gid in the queue.
+//
+// If how is SetPositionStart, it moves the download to a position relative to the beginning of the queue.
+// If how is SetPositionRelative, it moves the download to a position relative to the current position.
+// If how is SetPositionEnd, it moves the download to a position relative to the end of the queue.
+// If the destination position is less than 0 or beyond the end of the queue,
+// it moves the download to the beginning or the end of the queue respectively.
+//
+// The response is an integer denoting the resulting position.
+// An invalid how is rejected without contacting aria2.
+func (c *Client) ChangePosition(gid string, pos int, how PositionSetBehaviour) (int, error) {
+	return c.ChangePositionContext(context.Background(), gid, pos, how)
+}
+
+// ChangePositionContext is like ChangePosition() but aborts the call once ctx is done.
+func (c *Client) ChangePositionContext(ctx context.Context, gid string, pos int, how PositionSetBehaviour) (int, error) {
+	if err := ValidateGID(gid); err != nil {
+		return 0, err
+	}
+	if !how.Valid() {
+		return 0, fmt.Errorf("invalid position set behaviour %q", how)
+	}
+
+	var reply int
+	err := c.callContext(ctx, aria2proto.ChangePosition, c.getArgs(gid, pos, how), &reply)
+
+	return reply, err
+}
+
+// ChangeURIAt removes the URIs in delUris from and appends the URIs in addUris to download denoted by gid.
+// A download can contain multiple files and URIs are attached to each file.
+// fileIndex is used to select which file to remove/attach given URIs. fileIndex is 1-based, 0 is rejected.
+// position is used to specify where URIs are inserted in the existing waiting URI list. position is 0-based.
+// This allows replacing a slow or dead mirror of a download without restarting it.
+//
+// This method first executes the removal and then the addition.
+// position is the position after URIs are removed, not the position when this method is called.
+// When removing an URI, if the same URIs exist in download, only one of them is removed for each URI in delUris.
+//
+// Returns two integers.
+// The first integer is the number of URIs deleted.
+// The second integer is the number of URIs added.
+func (c *Client) ChangeURIAt(gid string, fileIndex uint, delURIs []string, addURIs []string, position uint) (uint, uint, error) {
+	return c.ChangeURIAtContext(context.Background(), gid, fileIndex, delURIs, addURIs, position)
+}
+
+// ChangeURIAtContext is like ChangeURIAt() but aborts the call once ctx is done.
+func (c *Client) ChangeURIAtContext(ctx context.Context, gid string, fileIndex uint, delURIs []string, addURIs []string, position uint) (uint, uint, error) {
+	if err := validateChangeURI(gid, fileIndex); err != nil {
+		return 0, 0, err
+	}
+	return c.changeURI(ctx, c.getArgs(gid, fileIndex, uriList(delURIs), uriList(addURIs), position))
+}
+
+// ChangeURI removes the URIs in delUris from and appends the URIs in addUris to download denoted by gid.
+// A download can contain multiple files and URIs are attached to each file.
+// fileIndex is used to select which file to remove/attach given URIs. fileIndex is 1-based, 0 is rejected.
+// URIs are appended to the back of the list.
+//
+// This method first executes the removal and then the addition.
+// position is the position after URIs are removed, not the position when this method is called.
+// When removing an URI, if the same URIs exist in download, only one of them is removed for each URI in delUris.
+//
+// Returns two integers.
+// The first integer is the number of URIs deleted.
+// The second integer is the number of URIs added.
+func (c *Client) ChangeURI(gid string, fileIndex uint, delURIs []string, addURIs []string) (uint, uint, error) {
+	return c.ChangeURIContext(context.Background(), gid, fileIndex, delURIs, addURIs)
+}
+
+// ChangeURIContext is like ChangeURI() but aborts the call once ctx is done.
+func (c *Client) ChangeURIContext(ctx context.Context, gid string, fileIndex uint, delURIs []string, addURIs []string) (uint, uint, error) {
+	if err := validateChangeURI(gid, fileIndex); err != nil {
+		return 0, 0, err
+	}
+	return c.changeURI(ctx, c.getArgs(gid, fileIndex, uriList(delURIs), uriList(addURIs)))
+}
+
+// validateChangeURI checks the arguments of ChangeURI and ChangeURIAt.
+func validateChangeURI(gid string, fileIndex uint) error {
+	if err := ValidateGID(gid); err != nil {
+		return err
+	}
+	if fileIndex < 1 {
+		return fmt.Errorf("invalid file index %d, file indices start at 1", fileIndex)
+	}
+	return nil
+}
+
+// uriList converts nil to an empty slice, aria2 doesn't accept null for the lists of uris.
+func uriList(uris []string) []string {
+	if uris == nil {
+		return make([]string, 0)
+	}
+	return uris
+}
+
+// changeURI calls aria2.changeUri with args and decodes the numbers of deleted and added uris.
+func (c *Client) changeURI(ctx context.Context, args []interface{}) (deleted uint, added uint, err error) {
+	var reply []uint
+	if err := c.callContext(ctx, aria2proto.ChangeURI, args, &reply); err != nil {
+		return 0, 0, err
+	}
+	if len(reply) != 2 {
+		return 0, 0, fmt.Errorf("%s returned %d numbers instead of 2", aria2proto.ChangeURI, len(reply))
+	}
+
+	return reply[0], reply[1], nil
+}
+
+// GetOptions returns Options of the download denoted by gid.
+// Note that this method does not return options which have no default value and have not been set on the command-line,
+// in configuration files or RPC methods.
+func (c *Client) GetOptions(gid string) (Options, error) {
+	return c.GetOptionsContext(context.Background(), gid)
+}
+
+// GetOptionsContext is like GetOptions() but aborts the call once ctx is done.
+func (c *Client) GetOptionsContext(ctx context.Context, gid string) (Options, error) {
+	if err := ValidateGID(gid); err != nil {
+		return Options{}, err
+	}
+	var reply map[string]string
+	err := c.callContext(ctx, aria2proto.GetOptions, c.getArgs(gid), &reply)
+
+	return optionsFromMap(reply), err
+}
+
+// ChangeOptions changes options of the download denoted by gid dynamically.
+//
+// Except for following options, all options are available:
+//   - DryRun
+//   - MetalinkBaseURI
+//   - ParameterizedURI
+//   - Pause
+//   - PieceLength
+//   - RPCSaveUploadMetadata
+//
+// Except for the following options, changing the other options of active download makes it restart
+// (restart itself is managed by aria2, and no user intervention is required):
+//   - BtMaxPeers
+//   - BtRequestPeerSpeedLimit
+//   - BtRemoveUnselectedFile
+//   - ForceSave
+//   - MaxDownloadLimit
+//   - MaxUploadLimit
+func (c *Client) ChangeOptions(gid string, options Options) error {
+	return c.ChangeOptionsContext(context.Background(), gid, options)
+}
+
+// ChangeOptionsContext is like ChangeOptions() but aborts the call once ctx is done.
+func (c *Client) ChangeOptionsContext(ctx context.Context, gid string, options Options) error {
+	if err := ValidateGID(gid); err != nil {
+		return err
+	}
+	optionMap, err := options.ToMap()
+	if err != nil {
+		return err
+	}
+
+	if err := c.callContext(ctx, aria2proto.ChangeOptions, c.getArgs(gid, optionMap), nil); err != nil {
+		return err
+	}
+	if c.strictOptions {
+		return c.verifyOptions(ctx, aria2proto.GetOptions, c.getArgs(gid), optionMap)
+	}
+	return nil
+}
+
+// ChangeOption changes a single option of the download denoted by gid dynamically.
+// key is the aria2 name of the option, for example "max-download-limit".
+// The same restrictions as for ChangeOptions() apply.
+func (c *Client) ChangeOption(gid string, key string, value string) error {
+	return c.ChangeOptionContext(context.Background(), gid, key, value)
+}
+
+// ChangeOptionContext is like ChangeOption() but aborts the call once ctx is done.
+func (c *Client) ChangeOptionContext(ctx context.Context, gid string, key string, value string) error {
+	return c.ChangeOptionsContext(ctx, gid, Options{Extra: map[string]string{key: value}})
+}
+
+// GetGlobalOptions returns the global options.
+// Note that this method does not return options which have no default value and have not been set on the command-line,
+// in configuration files or RPC methods.
+//
+// Because global options are used as a template for the options of newly added downloads,
+// the response contains keys returned by the GetOption() method.
+func (c *Client) GetGlobalOptions() (Options, error) {
+	return c.GetGlobalOptionsContext(context.Background())
+}
+
+// GetGlobalOptionsContext is like GetGlobalOptions() but aborts the call once ctx is done.
+func (c *Client) GetGlobalOptionsContext(ctx context.Context) (Options, error) {
+	var reply map[string]string
+	err := c.callContext(ctx, aria2proto.GetGlobalOptions, c.getArgs(), &reply)
+
+	return optionsFromMap(reply), err
+}
+
+// TODO global options
+
+// ChangeGlobalOptions changes global options dynamically.
+//
+// The following global options are available:
+//   - BtMaxOpenFiles
+//   - DownloadResult
+//   - KeepUnfinishedDownloadResult
+//   - Log
+//   - LogLevel
+//   - MaxConcurrentDownloads
+//   - MaxDownloadResult
+//   - MaxOverallDownloadLimit
+//   - MaxOverallUploadLimit
+//   - OptimizeConcurrentDownloads
+//   - SaveCookies
+//   - SaveSession
+//   - ServerStatOf
+//
+// Except for the following options, all other Options are available as well:
+//   - Checksum
+//   - IndexOut
+//   - Out
+//   - Pause
+//   - SelectFile
 //
-// This method returns the GID of the newly registered download.
-func (c *Client) AddTorrent(torrent []byte, uris []string, options *Options) (GID, error) {
-	return c.AddTorrentAtPosition(torrent, uris, QueueEndPosition, options)
+// With the log option, you can dynamically start logging or change log file.
+// To stop logging, specify an empty string as the parameter value.
+// Note that log file is always opened in append mode.
+func (c *Client) ChangeGlobalOptions(options Options) error {
+	return c.ChangeGlobalOptionsContext(context.Background(), options)
 }
 
-// AddMetalinkAtPosition adds a Metalink download at a specific position in the queue by uploading a “.metalink” file.
-// metalink is the contents of the “.metalink” file.
-//
-// The new download will be inserted at position in the waiting queue.
-// If position is nil or position is larger than the current size of the queue,
-// the new download is appended to the end of the queue.
-//
-// This method returns an array of GIDs of newly registered downloads.
-func (c *Client) AddMetalinkAtPosition(metalink []byte, position uint, options *Options) ([]GID, error) {
-	encodedMetalink := base64.StdEncoding.EncodeToString(metalink)
-	args := c.getArgs(encodedMetalink)
+// ChangeGlobalOptionsContext is like ChangeGlobalOptions() but aborts the call once ctx is done.
+func (c *Client) ChangeGlobalOptionsContext(ctx context.Context, options Options) error {
+	optionMap, err := options.ToMap()
+	if err != nil {
+		return err
+	}
 
-	if options != nil {
-		args = append(args, options)
+	if err := c.callContext(ctx, aria2proto.ChangeGlobalOptions, c.getArgs(optionMap), nil); err != nil {
+		return err
+	}
+	if c.strictOptions {
+		return c.verifyOptions(ctx, aria2proto.GetGlobalOptions, c.getArgs(), optionMap)
 	}
+	return nil
+}
 
-	if position != QueueEndPosition {
-		args = append(args, position)
+// verifyOptions reads the options back using method and returns an error wrapping
+// ErrOptionsNotApplied which lists the keys of changed which are missing, see WithStrictOptions.
+func (c *Client) verifyOptions(ctx context.Context, method string, args []interface{}, changed map[string]string) error {
+	var reply map[string]string
+	if err := c.callContext(ctx, method, args, &reply); err != nil {
+		return err
 	}
 
-	var reply []string
-	err := c.rpcClient.Call(aria2proto.AddMetalink, args, &reply)
+	var missing []string
+	for key, value := range changed {
+		if _, ok := reply[key]; !ok && value != "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return fmt.Errorf("%w: %s", ErrOptionsNotApplied, strings.Join(missing, ", "))
+}
 
-	gids := make([]GID, len(reply))
-	for _, rawGID := range reply {
-		gids = append(gids, c.GetGID(rawGID))
+// ChangeGlobalOption changes a single global option dynamically.
+// key is the aria2 name of the option, for example "max-concurrent-downloads".
+// The same restrictions as for ChangeGlobalOptions() apply.
+func (c *Client) ChangeGlobalOption(key string, value string) error {
+	return c.ChangeGlobalOptionContext(context.Background(), key, value)
+}
+
+// ChangeGlobalOptionContext is like ChangeGlobalOption() but aborts the call once ctx is done.
+func (c *Client) ChangeGlobalOptionContext(ctx context.Context, key string, value string) error {
+	return c.ChangeGlobalOptionsContext(ctx, Options{Extra: map[string]string{key: value}})
+}
+
+// FormatSpeedLimit formats a speed limit in bytes/sec as a value of the aria2 limit options.
+// Multiples of 1024 are formatted using the K and M suffixes, 0 means unrestricted.
+// It returns an error if bytesPerSec is negative.
+func FormatSpeedLimit(bytesPerSec int64) (string, error) {
+	switch {
+	case bytesPerSec < 0:
+		return "", fmt.Errorf("invalid speed limit %d, must not be negative", bytesPerSec)
+	case bytesPerSec == 0:
+		return "0", nil
+	case bytesPerSec%(1024*1024) == 0:
+		return strconv.FormatInt(bytesPerSec/(1024*1024), 10) + "M", nil
+	case bytesPerSec%1024 == 0:
+		return strconv.FormatInt(bytesPerSec/1024, 10) + "K", nil
 	}
+	return strconv.FormatInt(bytesPerSec, 10), nil
+}
 
-	return gids, err
+// SetDownloadLimit sets the max-download-limit option of the download denoted by gid.
+// bytesPerSec is formatted by FormatSpeedLimit, 0 removes the limit.
+func (c *Client) SetDownloadLimit(gid string, bytesPerSec int64) error {
+	return c.SetDownloadLimitContext(context.Background(), gid, bytesPerSec)
 }
 
-// AddMetalink adds a Metalink download by uploading a “.metalink” file.
-// metalink is the contents of the “.metalink” file.
+// SetDownloadLimitContext is like SetDownloadLimit() but aborts the call once ctx is done.
+func (c *Client) SetDownloadLimitContext(ctx context.Context, gid string, bytesPerSec int64) error {
+	return c.setSpeedLimit(ctx, gid, "max-download-limit", bytesPerSec)
+}
+
+// SetUploadLimit sets the max-upload-limit option of the download denoted by gid.
+// bytesPerSec is formatted by FormatSpeedLimit, 0 removes the limit.
+func (c *Client) SetUploadLimit(gid string, bytesPerSec int64) error {
+	return c.SetUploadLimitContext(context.Background(), gid, bytesPerSec)
+}
+
+// SetUploadLimitContext is like SetUploadLimit() but aborts the call once ctx is done.
+func (c *Client) SetUploadLimitContext(ctx context.Context, gid string, bytesPerSec int64) error {
+	return c.setSpeedLimit(ctx, gid, "max-upload-limit", bytesPerSec)
+}
+
+// SetGlobalDownloadLimit sets the max-overall-download-limit global option.
+// bytesPerSec is formatted by FormatSpeedLimit, 0 removes the limit.
+func (c *Client) SetGlobalDownloadLimit(bytesPerSec int64) error {
+	return c.SetGlobalDownloadLimitContext(context.Background(), bytesPerSec)
+}
+
+// SetGlobalDownloadLimitContext is like SetGlobalDownloadLimit() but aborts the call once ctx is done.
+func (c *Client) SetGlobalDownloadLimitContext(ctx context.Context, bytesPerSec int64) error {
+	value, err := FormatSpeedLimit(bytesPerSec)
+	if err != nil {
+		return err
+	}
+	return c.ChangeGlobalOptionContext(ctx, "max-overall-download-limit", value)
+}
+
+// SetGlobalUploadLimit sets the max-overall-upload-limit global option.
+// bytesPerSec is formatted by FormatSpeedLimit, 0 removes the limit.
+func (c *Client) SetGlobalUploadLimit(bytesPerSec int64) error {
+	return c.SetGlobalUploadLimitContext(context.Background(), bytesPerSec)
+}
+
+// SetGlobalUploadLimitContext is like SetGlobalUploadLimit() but aborts the call once ctx is done.
+func (c *Client) SetGlobalUploadLimitContext(ctx context.Context, bytesPerSec int64) error {
+	value, err := FormatSpeedLimit(bytesPerSec)
+	if err != nil {
+		return err
+	}
+	return c.ChangeGlobalOptionContext(ctx, "max-overall-upload-limit", value)
+}
+
+// SetMaxConcurrentDownloads sets the max-concurrent-downloads global option,
+// the number of downloads aria2 runs in parallel. n must be at least 1.
+// Lowering it while downloads are active doesn't stop any of them,
+// aria2 keeps them running and starts no more until fewer than n are active.
+// The limit on the overall download speed is set using SetGlobalDownloadLimit.
+func (c *Client) SetMaxConcurrentDownloads(n int) error {
+	return c.SetMaxConcurrentDownloadsContext(context.Background(), n)
+}
+
+// SetMaxConcurrentDownloadsContext is like SetMaxConcurrentDownloads() but aborts the call once ctx is done.
+func (c *Client) SetMaxConcurrentDownloadsContext(ctx context.Context, n int) error {
+	if n < 1 {
+		return fmt.Errorf("invalid max concurrent downloads %d, must be at least 1", n)
+	}
+	return c.ChangeGlobalOptionContext(ctx, "max-concurrent-downloads", strconv.Itoa(n))
+}
+
+// GetMaxConcurrentDownloads returns the max-concurrent-downloads global option.
+func (c *Client) GetMaxConcurrentDownloads() (int, error) {
+	return c.GetMaxConcurrentDownloadsContext(context.Background())
+}
+
+// GetMaxConcurrentDownloadsContext is like GetMaxConcurrentDownloads() but aborts the call once ctx is done.
+func (c *Client) GetMaxConcurrentDownloadsContext(ctx context.Context) (int, error) {
+	options, err := c.GetGlobalOptionsContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int(options.MaxConcurrentDownloads), nil
+}
+
+// SetSeedRatio sets the seed-ratio option of the download denoted by gid.
+// aria2 stops seeding a BitTorrent download once the share ratio reaches ratio,
+// 0 makes it seed regardless of the ratio. ratio must not be negative.
+func (c *Client) SetSeedRatio(gid string, ratio float64) error {
+	return c.SetSeedRatioContext(context.Background(), gid, ratio)
+}
+
+// SetSeedRatioContext is like SetSeedRatio() but aborts the call once ctx is done.
+func (c *Client) SetSeedRatioContext(ctx context.Context, gid string, ratio float64) error {
+	if ratio < 0 || math.IsNaN(ratio) || math.IsInf(ratio, 0) {
+		return fmt.Errorf("invalid seed ratio %g, must be a non-negative number", ratio)
+	}
+	return c.ChangeOptionContext(ctx, gid, "seed-ratio", strconv.FormatFloat(ratio, 'f', -1, 64))
+}
+
+// GetSeedRatio returns the seed-ratio option of the download denoted by gid.
+func (c *Client) GetSeedRatio(gid string) (float64, error) {
+	return c.GetSeedRatioContext(context.Background(), gid)
+}
+
+// GetSeedRatioContext is like GetSeedRatio() but aborts the call once ctx is done.
+func (c *Client) GetSeedRatioContext(ctx context.Context, gid string) (float64, error) {
+	value, err := c.getOption(ctx, gid, "seed-ratio")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// SetSeedTime sets the seed-time option of the download denoted by gid.
+// aria2 stops seeding a BitTorrent download once it seeded for d, 0 stops it as soon as the download is complete.
+// aria2 expects the seed time in minutes, d is sent as whole minutes and must be a non-negative multiple of time.Minute.
+func (c *Client) SetSeedTime(gid string, d time.Duration) error {
+	return c.SetSeedTimeContext(context.Background(), gid, d)
+}
+
+// SetSeedTimeContext is like SetSeedTime() but aborts the call once ctx is done.
+func (c *Client) SetSeedTimeContext(ctx context.Context, gid string, d time.Duration) error {
+	if d < 0 || d%time.Minute != 0 {
+		return fmt.Errorf("invalid seed time %s, must be a non-negative number of minutes", d)
+	}
+	return c.ChangeOptionContext(ctx, gid, "seed-time", strconv.FormatInt(int64(d/time.Minute), 10))
+}
+
+// GetSeedTime returns the seed-time option of the download denoted by gid.
+// It returns ErrOptionNotSet if there's no seed time, which means aria2 seeds until the seed ratio is reached.
+func (c *Client) GetSeedTime(gid string) (time.Duration, error) {
+	return c.GetSeedTimeContext(context.Background(), gid)
+}
+
+// GetSeedTimeContext is like GetSeedTime() but aborts the call once ctx is done.
+func (c *Client) GetSeedTimeContext(ctx context.Context, gid string) (time.Duration, error) {
+	value, err := c.getOption(ctx, gid, "seed-time")
+	if err != nil {
+		return 0, err
+	}
+	// aria2 accepts fractional minutes if the option is set elsewhere
+	minutes, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(minutes * float64(time.Minute)), nil
+}
+
+// SetBtMaxPeers sets the bt-max-peers option of the download denoted by gid,
+// the maximum number of peers of a BitTorrent download. 0 means unlimited, n must not be negative.
+// Changing it doesn't restart an active download.
+func (c *Client) SetBtMaxPeers(gid string, n int) error {
+	return c.SetBtMaxPeersContext(context.Background(), gid, n)
+}
+
+// SetBtMaxPeersContext is like SetBtMaxPeers() but aborts the call once ctx is done.
+func (c *Client) SetBtMaxPeersContext(ctx context.Context, gid string, n int) error {
+	if n < 0 {
+		return fmt.Errorf("invalid max peers %d, must not be negative", n)
+	}
+	return c.ChangeOptionContext(ctx, gid, "bt-max-peers", strconv.Itoa(n))
+}
+
+// GetBtMaxPeers returns the bt-max-peers option of the download denoted by gid.
+func (c *Client) GetBtMaxPeers(gid string) (int, error) {
+	return c.GetBtMaxPeersContext(context.Background(), gid)
+}
+
+// GetBtMaxPeersContext is like GetBtMaxPeers() but aborts the call once ctx is done.
+func (c *Client) GetBtMaxPeersContext(ctx context.Context, gid string) (int, error) {
+	value, err := c.getOption(ctx, gid, "bt-max-peers")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+// getOption returns the raw value of the option key of the download denoted by gid.
+// The options aren't decoded into Options to keep the exact value.
+func (c *Client) getOption(ctx context.Context, gid string, key string) (string, error) {
+	if err := ValidateGID(gid); err != nil {
+		return "", err
+	}
+	var reply map[string]string
+	if err := c.callContext(ctx, aria2proto.GetOptions, c.getArgs(gid), &reply); err != nil {
+		return "", err
+	}
+	value, ok := reply[key]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", key, ErrOptionNotSet)
+	}
+	return value, nil
+}
+
+// setSpeedLimit changes the limit option key of the download denoted by gid.
+func (c *Client) setSpeedLimit(ctx context.Context, gid string, key string, bytesPerSec int64) error {
+	value, err := FormatSpeedLimit(bytesPerSec)
+	if err != nil {
+		return err
+	}
+	return c.ChangeOptionContext(ctx, gid, key, value)
+}
+
+// GetGlobalStats returns global statistics such as the overall download and upload speeds.
+func (c *Client) GetGlobalStats() (Stats, error) {
+	return c.GetGlobalStatsContext(context.Background())
+}
+
+// GetGlobalStatsContext is like GetGlobalStats() but aborts the call once ctx is done.
+func (c *Client) GetGlobalStatsContext(ctx context.Context) (Stats, error) {
+	var reply Stats
+	err := c.callContext(ctx, aria2proto.GetGlobalStats, c.getArgs(), &reply)
+
+	return reply, err
+}
+
+// PollGlobalStats sends the global statistics on the returned channel,
+// the channel is closed once ctx is done.
 //
-// The new download is appended to the end of the queue.
+// If aria2 advertises the aria2.onGlobalStat notification by ListNotifications, which some builds
+// push periodically, the statistics of the notifications are sent. Statistics pushed while the
+// receiver falls behind are dropped. Whenever no notification arrived for an interval, for example
+// because aria2 stopped pushing them, GetGlobalStats() is called instead.
 //
-// This method returns an array of GIDs of newly registered downloads.
-func (c *Client) AddMetalink(metalink []byte, options *Options) ([]GID, error) {
-	return c.AddMetalinkAtPosition(metalink, QueueEndPosition, options)
+// Otherwise, including when the notifications aren't supported by the client or ListNotifications fails,
+// it calls GetGlobalStats() every interval. Failed calls are skipped and if the receiver falls behind,
+// the statistics are fetched less often, at most one call is made per interval in either case.
+func (c *Client) PollGlobalStats(ctx context.Context, interval time.Duration) <-chan Stats {
+	stats := make(chan Stats)
+
+	go func() {
+		defer close(stats)
+
+		if c.globalStatsPushed(ctx) {
+			c.receiveGlobalStats(ctx, interval, stats)
+		} else {
+			c.pollGlobalStats(ctx, interval, stats)
+		}
+	}()
+
+	return stats
 }
 
-// Remove removes the download denoted by gid.
-// If the specified download is in progress, it is first stopped.
-// The status of the removed download becomes removed.
-func (c *Client) Remove(gid string) error {
-	return c.rpcClient.Call(aria2proto.Remove, c.getArgs(gid), nil)
+// globalStatsPushed reports whether aria2 sends the aria2.onGlobalStat notification.
+func (c *Client) globalStatsPushed(ctx context.Context) bool {
+	if c.noNotifications {
+		return false
+	}
+	notifications, err := c.ListNotificationsContext(ctx)
+	if err != nil {
+		return false
+	}
+	for _, notification := range notifications {
+		if notification == aria2proto.OnGlobalStat {
+			return true
+		}
+	}
+	return false
 }
 
-// ForceRemove removes the download denoted by gid.
-// This method behaves just like Remove() except that this method removes the download
-// without performing any actions which take time, such as contacting BitTorrent trackers to
-// unregister the download first.
-func (c *Client) ForceRemove(gid string) error {
-	return c.rpcClient.Call(aria2proto.ForceRemove, c.getArgs(gid), nil)
+// receiveGlobalStats sends the statistics of the aria2.onGlobalStat notifications on stats until ctx is done.
+// If no notification arrived for interval, the statistics are fetched using GetGlobalStats().
+func (c *Client) receiveGlobalStats(ctx context.Context, interval time.Duration, stats chan<- Stats) {
+	pushed := make(chan Stats, 1)
+	unsubscribe := c.SubscribeUnknown(func(event *UnknownEvent) {
+		if event.Method != aria2proto.OnGlobalStat || len(event.Params) == 0 {
+			return
+		}
+		var s Stats
+		if err := c.encoding.Unmarshal(event.Params[0], &s); err != nil {
+			c.logger.Debugf("arigo: invalid %s notification: %v", aria2proto.OnGlobalStat, err)
+			return
+		}
+		select {
+		case pushed <- s:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	fallback := time.NewTimer(interval)
+	defer fallback.Stop()
+
+	for {
+		var s Stats
+		select {
+		case s = <-pushed:
+			if !fallback.Stop() {
+				<-fallback.C
+			}
+		case <-fallback.C:
+			reply, err := c.GetGlobalStatsContext(ctx)
+			if err != nil {
+				fallback.Reset(interval)
+				continue
+			}
+			s = reply
+		case <-ctx.Done():
+			return
+		}
+
+		select {
+		case stats <- s:
+		case <-ctx.Done():
+			return
+		}
+		fallback.Reset(interval)
+	}
 }
 
-// Pause pauses the download denoted by gid.
-// The status of paused download becomes paused. If the download was active,
-// the download is placed in the front of the queue. While the status is paused,
-// the download is not started. To change status to waiting, use the Unpause() method.
-func (c *Client) Pause(gid string) error {
-	return c.rpcClient.Call(aria2proto.Pause, c.getArgs(gid), nil)
+// pollGlobalStats sends the result of GetGlobalStats() on stats every interval until ctx is done.
+func (c *Client) pollGlobalStats(ctx context.Context, interval time.Duration, stats chan<- Stats) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		reply, err := c.GetGlobalStatsContext(ctx)
+		if err != nil {
+			continue
+		}
+
+		select {
+		case stats <- reply:
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
-// PauseAll is equal to calling Pause() for every active/waiting download.
-func (c *Client) PauseAll() error {
-	return c.rpcClient.Call(aria2proto.PauseAll, c.getArgs(), nil)
+// callGID calls a method which responds with the gid of the affected download
+// and makes sure the response matches gid.
+func (c *Client) callGID(ctx context.Context, method string, gid string) error {
+	var reply string
+	if err := c.callContext(ctx, method, c.getArgs(gid), &reply); err != nil {
+		return err
+	}
+	if !strings.EqualFold(reply, gid) {
+		return fmt.Errorf("%s: aria2 responded with gid %q instead of %q", method, reply, gid)
+	}
+
+	return nil
 }
 
-// ForcePause pauses the download denoted by gid.
-// This method behaves just like Pause() except that this method pauses downloads
-// without performing any actions which take time, such as contacting BitTorrent trackers to
-// unregister the download first.
-func (c *Client) ForcePause(gid string) error {
-	return c.rpcClient.Call(aria2proto.ForcePause, c.getArgs(gid), nil)
+// callOK calls method which takes no parameters and is acknowledged with "OK".
+// If aria2 responds with anything else an *UnexpectedReplyError is returned.
+func (c *Client) callOK(ctx context.Context, method string) error {
+	var reply string
+	if err := c.callContext(ctx, method, c.getArgs(), &reply); err != nil {
+		return err
+	}
+	if reply != "OK" {
+		return &UnexpectedReplyError{Method: method, Reply: reply}
+	}
+
+	return nil
 }
 
-// ForcePauseAll is equal to calling ForcePause() for every active/waiting download.
-func (c *Client) ForcePauseAll() error {
-	return c.rpcClient.Call(aria2proto.ForcePauseAll, c.getArgs(), nil)
+// PurgeDownloadResults purges completed/error/removed downloads to free memory
+func (c *Client) PurgeDownloadResults() error {
+	return c.PurgeDownloadResultsContext(context.Background())
 }
 
-// Unpause changes the status of the download denoted by gid from paused to waiting,
-// making the download eligible to be restarted.
-func (c *Client) Unpause(gid string) error {
-	return c.rpcClient.Call(aria2proto.Unpause, c.getArgs(gid), nil)
+// PurgeDownloadResultsContext is like PurgeDownloadResults() but aborts the call once ctx is done.
+func (c *Client) PurgeDownloadResultsContext(ctx context.Context) error {
+	return c.callContext(ctx, aria2proto.PurgeDownloadResults, c.getArgs(), nil)
 }
 
-// UnpauseAll is equal to calling Unpause() for every paused download.
-func (c *Client) UnpauseAll() error {
-	return c.rpcClient.Call(aria2proto.UnpauseAll, c.getArgs(), nil)
+// RemoveDownloadResult removes a completed/error/removed download denoted by gid from memory.
+// The error matches ErrDownloadNotFinished for downloads which are still active, waiting or paused,
+// and ErrNotFound for unknown downloads. aria2 responds to both with the same error, so the status
+// of the download is fetched to tell them apart, which takes an additional call.
+func (c *Client) RemoveDownloadResult(gid string) error {
+	return c.RemoveDownloadResultContext(context.Background(), gid)
 }
 
-// TellStatus returns the progress of the download denoted by gid.
-//
-// If specified, the returned Status only contains the keys passed to the method.
-// This is useful when you just want specific keys and avoid unnecessary transfers.
-func (c *Client) TellStatus(gid string, keys ...string) (Status, error) {
-	var reply Status
-	// convert nil to empty slice, prevent error The parameter at 1 has wrong type.
-	if len(keys) == 0 {
-		keys = make([]string, 0)
+// RemoveDownloadResultContext is like RemoveDownloadResult() but aborts the call once ctx is done.
+func (c *Client) RemoveDownloadResultContext(ctx context.Context, gid string) error {
+	if err := ValidateGID(gid); err != nil {
+		return err
 	}
-	err := c.rpcClient.Call(aria2proto.TellStatus, c.getArgs(gid, keys), &reply)
+	err := c.callContext(ctx, aria2proto.RemoveDownloadResult, c.getArgs(gid), nil)
 
-	return reply, err
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || !rpcErr.isRemoveResultErr() {
+		return err
+	}
+	status, statusErr := c.TellStatusContext(ctx, GIDString(gid), "status")
+	switch {
+	case errors.Is(statusErr, ErrNotFound):
+		return &removeResultError{RPCError: rpcErr, cause: ErrNotFound}
+	case statusErr == nil && (status.Status == StatusActive || status.Status == StatusWaiting || status.Status == StatusPaused):
+		return &removeResultError{RPCError: rpcErr, cause: ErrDownloadNotFinished}
+	}
+	return err
 }
 
-// GetURIs returns the URIs used in the download denoted by gid.
-// The response is a slice of URIs.
-func (c *Client) GetURIs(gid string) ([]URI, error) {
-	var reply []URI
-	err := c.rpcClient.Call(aria2proto.GetURIs, c.getArgs(gid), &reply)
+// GetVersion returns the version of aria2 and the list of enabled features.
+func (c *Client) GetVersion() (VersionInfo, error) {
+	return c.GetVersionContext(context.Background())
+}
+
+// GetVersionContext is like GetVersion() but aborts the call once ctx is done.
+func (c *Client) GetVersionContext(ctx context.Context) (VersionInfo, error) {
+	var reply VersionInfo
+	err := c.callContext(ctx, aria2proto.GetVersion, c.getArgs(), &reply)
 
 	return reply, err
 }
 
-// GetFiles returns the file list of the download denoted by gid.
-// The response is a slice of Files.
-func (c *Client) GetFiles(gid string) ([]File, error) {
-	var reply []File
-	err := c.rpcClient.Call(aria2proto.GetFiles, c.getArgs(gid), &reply)
+// Ping measures the round-trip time of a call to aria2.getVersion.
+// Unlike IsConnected, it exercises the whole request/response path including the secret token,
+// the response isn't decoded. It returns the error of the call if it failed.
+func (c *Client) Ping(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+	if err := c.callContext(ctx, aria2proto.GetVersion, c.getArgs(), nil); err != nil {
+		return 0, err
+	}
 
-	return reply, err
+	return time.Since(start), nil
 }
 
-// GetPeers returns a list of peers of the download denoted by gid.
-// This method is for BitTorrent only.
-// The response is a slice of Peers.
-func (c *Client) GetPeers(gid string) ([]Peer, error) {
-	var reply []Peer
-	err := c.rpcClient.Call(aria2proto.GetPeers, c.getArgs(gid), &reply)
+// GetSessionInfo returns session information.
+func (c *Client) GetSessionInfo() (SessionInfo, error) {
+	return c.GetSessionInfoContext(context.Background())
+}
+
+// GetSessionInfoContext is like GetSessionInfo() but aborts the call once ctx is done.
+func (c *Client) GetSessionInfoContext(ctx context.Context) (SessionInfo, error) {
+	var reply SessionInfo
+	err := c.callContext(ctx, aria2proto.GetSessionInfo, c.getArgs(), &reply)
 
 	return reply, err
 }
 
-// GetServers returns currently connected HTTP(S)/FTP/SFTP servers of the download denoted by gid.
-// Returns a slice of FileServers.
-func (c *Client) GetServers(gid string) ([]FileServers, error) {
-	var reply []FileServers
-	err := c.rpcClient.Call(aria2proto.GetServers, c.getArgs(gid), &reply)
+// Shutdown shuts down aria2.
+// Because aria2 doesn't respond to any calls afterwards, the client is closed once
+// aria2 acknowledged the shutdown. If aria2 closes the connection before the acknowledgement
+// arrives, the shutdown is considered successful as well.
+func (c *Client) Shutdown() error {
+	return c.ShutdownContext(context.Background())
+}
 
-	return reply, err
+// ShutdownContext is like Shutdown() but aborts the call once ctx is done.
+func (c *Client) ShutdownContext(ctx context.Context) error {
+	return c.shutdown(ctx, aria2proto.Shutdown)
+}
+
+// ForceShutdown shuts down aria2.
+// Behaves like the Shutdown() method but doesn't perform any actions which take time,
+// such as contacting BitTorrent trackers to unregister downloads first.
+func (c *Client) ForceShutdown() error {
+	return c.ForceShutdownContext(context.Background())
+}
+
+// ForceShutdownContext is like ForceShutdown() but aborts the call once ctx is done.
+func (c *Client) ForceShutdownContext(ctx context.Context) error {
+	return c.shutdown(ctx, aria2proto.ForceShutdown)
+}
+
+// shutdown calls the shutdown method and closes the client.
+// aria2 may close the connection before it responds, which is only accepted as success
+// once the request was written to the connection.
+func (c *Client) shutdown(ctx context.Context, method string) error {
+	var conn *rpc2.Client
+	err := c.callContext(context.WithValue(ctx, callConnKey{}, &conn), method, c.getArgs(), nil)
+	if err != nil && !(hasSentShutdown(conn) && (err == ErrConnectionLost || isConnectionErr(err))) {
+		return err
+	}
+
+	_ = c.Close()
+	return nil
+}
+
+// SaveSession saves the current session to a file specified by the SaveSession option.
+// A nil error means aria2 confirmed that the session was written.
+func (c *Client) SaveSession() error {
+	return c.SaveSessionContext(context.Background())
 }
 
-// TellActive returns a slice of active downloads represented by their Status.
-// keys does the same as in the TellStatus() method.
-func (c *Client) TellActive(keys ...string) ([]Status, error) {
-	var reply []Status
-	err := c.rpcClient.Call(aria2proto.TellActive, c.getArgs(keys), &reply)
+// SaveSessionContext is like SaveSession() but aborts the call once ctx is done.
+func (c *Client) SaveSessionContext(ctx context.Context) error {
+	var reply string
+	if err := c.callContext(ctx, aria2proto.SaveSession, c.getArgs(), &reply); err != nil {
+		return fmt.Errorf("save session: %w", err)
+	}
+	if reply != "OK" {
+		return fmt.Errorf("save session: unexpected response %q", reply)
+	}
 
-	return reply, err
+	return nil
 }
 
-// TellWaiting returns a slice of waiting downloads including paused ones represented by their Status.
-//
-// offset is an integer and specifies the offset from the download waiting at the front.
-// num is an integer and specifies the max. number of downloads to be returned.
-//
-// If offset is a positive integer, this method returns downloads in the range of [offset, offset + num).
-// offset can be a negative integer. offset == -1 points last download in the waiting queue and offset == -2 points to
-// the download before the last download, and so on. The returned statuses are in reversed order then.
-//
-// If specified, the returned Statuses only contain the keys passed to the method.
-func (c *Client) TellWaiting(offset int, num uint, keys ...string) ([]Status, error) {
-	var reply []Status
-	err := c.rpcClient.Call(aria2proto.TellWaiting, c.getArgs(offset, num, keys), &reply)
+// PurgeAndSave purges the completed/error/removed downloads and then saves the session,
+// so the saved session only contains the downloads which are still to be done,
+// for example right before a restart.
+// If purging fails, the session isn't saved. The returned error tells which step failed.
+func (c *Client) PurgeAndSave() error {
+	return c.PurgeAndSaveContext(context.Background())
+}
 
-	return reply, err
+// PurgeAndSaveContext is like PurgeAndSave() but aborts the calls once ctx is done.
+func (c *Client) PurgeAndSaveContext(ctx context.Context) error {
+	if err := c.PurgeDownloadResultsContext(ctx); err != nil {
+		return fmt.Errorf("purge download results: %w", err)
+	}
+	return c.SaveSessionContext(ctx)
 }
 
-// TellStopped returns a slice of stopped downloads represented by their Status.
+// AutoSaveSession calls SaveSession() every interval until ctx is done or saving fails.
+// It blocks and returns the error of SaveSession() or the context's error.
 //
-// offset is an integer and specifies the offset from the download waiting at the front.
-// num is an integer and specifies the max. number of downloads to be returned.
-//
-// If offset is a positive integer, this method returns downloads in the range of [offset, offset + num).
-// offset can be a negative integer. offset == -1 points last download in the waiting queue and offset == -2 points to
-// the download before the last download, and so on. The returned statuses are in reversed order then.
-//
-// If specified, the returned Statuses only contain the keys passed to the method.
-func (c *Client) TellStopped(offset int, num uint, keys ...string) ([]Status, error) {
-	var reply []Status
-	err := c.rpcClient.Call(aria2proto.TellStopped, c.getArgs(offset, num, keys), &reply)
-
-	return reply, err
+// aria2 only reads the SaveSessionInterval option on startup,
+// this can be used to checkpoint the session of a running aria2 instead.
+func (c *Client) AutoSaveSession(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.SaveSessionContext(ctx); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 }
 
-// PositionSetBehaviour determines how a position is to be interpreted
-type PositionSetBehaviour string
+// ListMethods returns the names of all methods supported by aria2.
+// aria2 doesn't require the secret token for this method.
+func (c *Client) ListMethods() ([]string, error) {
+	return c.ListMethodsContext(context.Background())
+}
 
-const (
-	// SetPositionStart sets the position relative to the start
-	SetPositionStart PositionSetBehaviour = "POS_SET"
+// ListMethodsContext is like ListMethods() but aborts the call once ctx is done.
+func (c *Client) ListMethodsContext(ctx context.Context) ([]string, error) {
+	return c.listNames(ctx, aria2proto.ListMethods)
+}
 
-	// SetPositionEnd sets the position relative to the end
-	SetPositionEnd PositionSetBehaviour = "POS_END"
+// ListNotifications returns the names of all notifications sent by aria2.
+// aria2 doesn't require the secret token for this method.
+// Versions of aria2 which don't support the method yet cause an error matching ErrNoSuchMethod.
+func (c *Client) ListNotifications() ([]string, error) {
+	return c.ListNotificationsContext(context.Background())
+}
 
-	// SetPositionRelative sets the position relative to the current position
-	SetPositionRelative PositionSetBehaviour = "POS_CUR"
-)
+// ListNotificationsContext is like ListNotifications() but aborts the call once ctx is done.
+func (c *Client) ListNotificationsContext(ctx context.Context) ([]string, error) {
+	return c.listNames(ctx, aria2proto.ListNotifications)
+}
 
-// ChangePosition changes the position of the download denoted by gid in the queue.
-//
-// If how is SetPositionStart, it moves the download to a position relative to the beginning of the queue.
-// If how is SetPositionRelative, it moves the download to a position relative to the current position.
-// If how is SetPositionEnd, it moves the download to a position relative to the end of the queue.
-// If the destination position is less than 0 or beyond the end of the queue,
-// it moves the download to the beginning or the end of the queue respectively.
-//
-// The response is an integer denoting the resulting position.
-func (c *Client) ChangePosition(gid string, pos int, how PositionSetBehaviour) (int, error) {
-	args := c.getArgs(gid, pos)
-	if how != "" {
-		args = append(args, how)
+// listNames calls one of the system methods which return a list of names.
+func (c *Client) listNames(ctx context.Context, method string) ([]string, error) {
+	var reply []string
+	err := c.callContext(ctx, method, []interface{}{}, &reply)
+	if errors.Is(err, ErrNoSuchMethod) {
+		return nil, fmt.Errorf("aria2 doesn't support %s: %w", method, err)
 	}
 
-	var reply int
-	err := c.rpcClient.Call(aria2proto.ChangePosition, args, &reply)
-
 	return reply, err
 }
 
-// ChangeURIAt removes the URIs in delUris from and appends the URIs in addUris to download denoted by gid.
-// A download can contain multiple files and URIs are attached to each file.
-// fileIndex is used to select which file to remove/attach given URIs. fileIndex is 1-based.
-// position is used to specify where URIs are inserted in the existing waiting URI list. position is 0-based.
-//
-// This method first executes the removal and then the addition.
-// position is the position after URIs are removed, not the position when this method is called.
-// When removing an URI, if the same URIs exist in download, only one of them is removed for each URI in delUris.
+// Call invokes an arbitrary aria2 method with params and stores the result in result,
+// which may be nil to discard it. It can be used for methods which don't have a
+// typed method on the client yet.
 //
-// Returns two integers.
-// The first integer is the number of URIs deleted.
-// The second integer is the number of URIs added.
-func (c *Client) ChangeURIAt(gid string, fileIndex uint, delURIs []string, addURIs []string, position uint) (uint, uint, error) {
-	args := c.getArgs(gid, fileIndex, delURIs, addURIs, position)
-
-	var reply []uint
-	err := c.rpcClient.Call(aria2proto.ChangeURI, args, &reply)
-
-	return reply[0], reply[1], err
+// The calls of the typed methods take the same path, so Call honours the call timeout,
+// rate limit, hooks and reconnecting of the client, and aria2 errors are returned as *RPCError.
+// The secret token is passed as first parameter, except for the methods of the system
+// namespace which don't accept it.
+func (c *Client) Call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	return c.callContext(ctx, method, c.methodArgs(method, params), result)
 }
 
-// ChangeURI removes the URIs in delUris from and appends the URIs in addUris to download denoted by gid.
-// A download can contain multiple files and URIs are attached to each file.
-// fileIndex is used to select which file to remove/attach given URIs. fileIndex is 1-based.
-// position is used to specify where URIs are inserted in the existing waiting URI list. position is 0-based.
-// URIs are appended to the back of the list.
-//
-// This method first executes the removal and then the addition.
-// position is the position after URIs are removed, not the position when this method is called.
-// When removing an URI, if the same URIs exist in download, only one of them is removed for each URI in delUris.
-//
-// Returns two integers.
-// The first integer is the number of URIs deleted.
-// The second integer is the number of URIs added.
-func (c *Client) ChangeURI(gid string, fileIndex uint, delURIs []string, addURIs []string) (uint, uint, error) {
-	args := c.getArgs(gid, fileIndex, delURIs, addURIs)
+// Notify sends a notification for method with params.
+// A notification has no id, so the peer doesn't respond to it and Notify returns as soon as
+// it's written. The secret token is passed like it is by Call.
+// It's meant for aria2-compatible servers and extensions which handle notifications.
+func (c *Client) Notify(method string, params []interface{}) error {
+	c.logger.Debugf("arigo: notifying %s", method)
+	var err error
+	args := c.withDefaultParams(method, c.methodArgs(method, params))
+	if c.transport != nil {
+		err = c.transport.Notify(method, args)
+	} else {
+		err = c.callRPCClient().Notify(method, args)
+	}
+	if err != nil {
+		c.mu.Lock()
+		closed := c.closed
+		c.mu.Unlock()
 
-	var reply []uint
-	err := c.rpcClient.Call(aria2proto.ChangeURI, args, &reply)
+		if closed {
+			return ErrClientClosed
+		}
+	}
+	return err
+}
 
-	return reply[0], reply[1], err
+// methodArgs returns the arguments of a call of method with params.
+// The secret token is added unless method belongs to the system namespace.
+func (c *Client) methodArgs(method string, params []interface{}) []interface{} {
+	if !strings.HasPrefix(method, "system.") {
+		return c.getArgs(params...)
+	}
+	if params == nil {
+		return []interface{}{}
+	}
+	return params
 }
 
-// GetOptions returns Options of the download denoted by gid.
-// Note that this method does not return options which have no default value and have not been set on the command-line,
-// in configuration files or RPC methods.
-func (c *Client) GetOptions(gid string) (Options, error) {
-	var reply Options
-	err := c.rpcClient.Call(aria2proto.GetOptions, c.getArgs(gid), &reply)
+// withDefaultParams appends the params set for method using WithDefaultParams to args.
+// args is left untouched.
+func (c *Client) withDefaultParams(method string, args []interface{}) []interface{} {
+	defaults := c.defaultParams[method]
+	if len(defaults) == 0 {
+		return args
+	}
 
-	return reply, err
+	params := make([]interface{}, 0, len(args)+len(defaults))
+	params = append(params, args...)
+	return append(params, defaults...)
 }
 
-// ChangeOptions changes options of the download denoted by gid dynamically.
-//
-// Except for following options, all options are available:
-//   - DryRun
-//   - MetalinkBaseURI
-//   - ParameterizedURI
-//   - Pause
-//   - PieceLength
-//   - RPCSaveUploadMetadata
+// MultiCall executes multiple method calls in one request.
+// Returns a MethodResult for each MethodCall in order.
+// A failing method call doesn't fail the whole request,
+// its error is reported in the corresponding MethodResult instead.
 //
-// Except for the following options, changing the other options of active download makes it restart
-// (restart itself is managed by aria2, and no user intervention is required):
-//   - BtMaxPeers
-//   - BtRequestPeerSpeedLimit
-//   - BtRemoveUnselectedFile
-//   - ForceSave
-//   - MaxDownloadLimit
-//   - MaxUploadLimit
-func (c *Client) ChangeOptions(gid string, options Options) error {
-	return c.rpcClient.Call(aria2proto.ChangeOptions, c.getArgs(gid, options), nil)
+// The secret token is added to the parameters of every method call, followed by the
+// default params set using WithDefaultParams, the passed MethodCalls are left untouched.
+func (c *Client) MultiCall(methods ...*MethodCall) ([]MethodResult, error) {
+	return c.MultiCallContext(context.Background(), methods...)
 }
 
+// MultiCallContext is like MultiCall() but aborts the call once ctx is done.
+func (c *Client) MultiCallContext(ctx context.Context, methods ...*MethodCall) ([]MethodResult, error) {
+	calls := make([]*MethodCall, len(methods))
+	for i, method := range methods {
+		calls[i] = NewMethodCall(method.MethodName, c.withDefaultParams(method.MethodName, c.getArgs(method.Params...))...)
+	}
 
-func (c *Client) ChangeOption(gid string, key string, value string) error {
-    options := map[string]string{key: value}
-    return c.rpcClient.Call(aria2proto.ChangeOptions, c.getArgs(gid, options), nil)
-}
+	var rawResults []json.RawMessage
+	err := c.callContext(ctx, aria2proto.Multicall, []interface{}{calls}, &rawResults)
+	if err != nil {
+		return nil, err
+	}
 
-// GetGlobalOptions returns the global options.
-// Note that this method does not return options which have no default value and have not been set on the command-line,
-// in configuration files or RPC methods.
-//
-// Because global options are used as a template for the options of newly added downloads,
-// the response contains keys returned by the GetOption() method.
-func (c *Client) GetGlobalOptions() (Options, error) {
-	var reply Options
-	err := c.rpcClient.Call(aria2proto.GetGlobalOptions, c.getArgs(), &reply)
+	results := make([]MethodResult, len(rawResults))
+	for i, rawResult := range rawResults {
+		results[i] = parseMethodResult(c.encoding, rawResult)
+	}
 
-	return reply, err
+	return results, nil
 }
 
-// TODO global options
+// multiCallGIDs calls method for each of the gids using a single MultiCall.
+// It returns the error of each call in order of the gids.
+// Malformed gids aren't sent to aria2, their error wraps ErrInvalidGID.
+func (c *Client) multiCallGIDs(ctx context.Context, method string, gids []string) ([]error, error) {
+	errs := make([]error, len(gids))
+
+	var calls []*MethodCall
+	var indices []int
+	for i, gid := range gids {
+		if err := ValidateGID(gid); err != nil {
+			errs[i] = err
+			continue
+		}
 
-// ChangeGlobalOptions changes global options dynamically.
-//
-// The following global options are available:
-//   - BtMaxOpenFiles
-//   - DownloadResult
-//   - KeepUnfinishedDownloadResult
-//   - Log
-//   - LogLevel
-//   - MaxConcurrentDownloads
-//   - MaxDownloadResult
-//   - MaxOverallDownloadLimit
-//   - MaxOverallUploadLimit
-//   - OptimizeConcurrentDownloads
-//   - SaveCookies
-//   - SaveSession
-//   - ServerStatOf
-//
-// Except for the following options, all other Options are available as well:
-//   - Checksum
-//   - IndexOut
-//   - Out
-//   - Pause
-//   - SelectFile
-//
-// With the log option, you can dynamically start logging or change log file.
-// To stop logging, specify an empty string as the parameter value.
-// Note that log file is always opened in append mode.
-func (c *Client) ChangeGlobalOptions(options Options) error {
-	return c.rpcClient.Call(aria2proto.ChangeGlobalOptions, c.getArgs(options), nil)
-}
+		calls = append(calls, NewMethodCall(method, gid))
+		indices = append(indices, i)
+	}
 
-// GetGlobalStats returns global statistics such as the overall download and upload speeds.
-func (c *Client) GetGlobalStats() (Stats, error) {
-	var reply Stats
-	err := c.rpcClient.Call(aria2proto.GetGlobalStats, c.getArgs(), &reply)
+	if len(calls) == 0 {
+		return errs, nil
+	}
 
-	return reply, err
+	results, err := c.MultiCallContext(ctx, calls...)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != len(calls) {
+		return nil, fmt.Errorf("multicall returned %d results for %d calls", len(results), len(calls))
+	}
+
+	for i, result := range results {
+		errs[indices[i]] = result.Error
+	}
+
+	return errs, nil
 }
 
-// PurgeDownloadResults purges completed/error/removed downloads to free memory
-func (c *Client) PurgeDownloadResults() error {
-	return c.rpcClient.Call(aria2proto.PurgeDownloadResults, c.getArgs(), nil)
+// PauseMany pauses all downloads denoted by gids in a single request.
+// It returns the error for each gid in order, which is nil if the download was paused.
+// The returned error is only set if the request as a whole failed.
+func (c *Client) PauseMany(gids ...string) ([]error, error) {
+	return c.PauseManyContext(context.Background(), gids...)
 }
 
-// RemoveDownloadResult removes a completed/error/removed download denoted by gid from memory.
-func (c *Client) RemoveDownloadResult(gid string) error {
-	return c.rpcClient.Call(aria2proto.RemoveDownloadResult, c.getArgs(gid), nil)
+// PauseManyContext is like PauseMany() but aborts the call once ctx is done.
+func (c *Client) PauseManyContext(ctx context.Context, gids ...string) ([]error, error) {
+	return c.multiCallGIDs(ctx, aria2proto.Pause, gids)
 }
 
-// GetVersion returns the version of aria2 and the list of enabled features.
-func (c *Client) GetVersion() (VersionInfo, error) {
-	var reply VersionInfo
-	err := c.rpcClient.Call(aria2proto.GetVersion, c.getArgs(), &reply)
+// UnpauseMany unpauses all downloads denoted by gids in a single request.
+// The errors are reported like for PauseMany().
+func (c *Client) UnpauseMany(gids ...string) ([]error, error) {
+	return c.UnpauseManyContext(context.Background(), gids...)
+}
 
-	return reply, err
+// UnpauseManyContext is like UnpauseMany() but aborts the call once ctx is done.
+func (c *Client) UnpauseManyContext(ctx context.Context, gids ...string) ([]error, error) {
+	return c.multiCallGIDs(ctx, aria2proto.Unpause, gids)
 }
 
-// GetSessionInfo returns session information.
-func (c *Client) GetSessionInfo() (SessionInfo, error) {
-	var reply SessionInfo
-	err := c.rpcClient.Call(aria2proto.GetSessionInfo, c.getArgs(), &reply)
+// PauseWhere pauses all active and waiting downloads for which filter returns true,
+// for example all downloads from a certain mirror. Downloads which are already paused are skipped.
+// The downloads are fetched using TellActive and TellWaiting, the matching ones are paused
+// using a single multicall.
+//
+// It returns the gids of the paused downloads. If some downloads couldn't be paused,
+// the error of the first one is returned alongside them.
+func (c *Client) PauseWhere(filter func(Status) bool) ([]string, error) {
+	return c.PauseWhereContext(context.Background(), filter)
+}
 
-	return reply, err
+// PauseWhereContext is like PauseWhere() but aborts once ctx is done.
+func (c *Client) PauseWhereContext(ctx context.Context, filter func(Status) bool) ([]string, error) {
+	return c.callWhere(ctx, aria2proto.Pause, func(status Status) bool {
+		return status.Status != StatusPaused && filter(status)
+	})
 }
 
-// Shutdown shuts down aria2.
-func (c *Client) Shutdown() error {
-	return c.rpcClient.Call(aria2proto.Shutdown, c.getArgs(), nil)
+// UnpauseWhere unpauses all paused downloads for which filter returns true,
+// for example all torrents. The results are reported like for PauseWhere().
+func (c *Client) UnpauseWhere(filter func(Status) bool) ([]string, error) {
+	return c.UnpauseWhereContext(context.Background(), filter)
 }
 
-// ForceShutdown shuts down aria2.
-// Behaves like the Shutdown() method but doesn't perform any actions which take time,
-// such as contacting BitTorrent trackers to unregister downloads first.
-func (c *Client) ForceShutdown() error {
-	return c.rpcClient.Call(aria2proto.ForceShutdown, c.getArgs(), nil)
+// UnpauseWhereContext is like UnpauseWhere() but aborts once ctx is done.
+func (c *Client) UnpauseWhereContext(ctx context.Context, filter func(Status) bool) ([]string, error) {
+	return c.callWhere(ctx, aria2proto.Unpause, func(status Status) bool {
+		return status.Status == StatusPaused && filter(status)
+	})
 }
 
-// SaveSession saves the current session to a file specified by the SaveSession option.
-func (c *Client) SaveSession() error {
-	return c.rpcClient.Call(aria2proto.SaveSession, c.getArgs(), nil)
+// callWhere calls method for all active and waiting downloads for which filter returns true
+// using a single multicall. It returns the gids of the downloads the call succeeded for,
+// and the error of the first failed call.
+func (c *Client) callWhere(ctx context.Context, method string, filter func(Status) bool) ([]string, error) {
+	active, err := c.TellActiveContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var gids []string
+	seen := make(map[string]bool)
+	add := func(downloads []Status) {
+		for _, status := range downloads {
+			// downloads starting in the meantime may show up twice
+			if !seen[status.GID] && filter(status) {
+				gids = append(gids, status.GID)
+			}
+			seen[status.GID] = true
+		}
+	}
+	add(active)
+
+	for offset := 0; ; offset += pageSize {
+		waiting, err := c.TellWaitingContext(ctx, offset, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		add(waiting)
+
+		if len(waiting) < pageSize {
+			break
+		}
+	}
+
+	if len(gids) == 0 {
+		return nil, nil
+	}
+	errs, err := c.multiCallGIDs(ctx, method, gids)
+	if err != nil {
+		return nil, err
+	}
+
+	var affected []string
+	var firstErr error
+	for i, err := range errs {
+		if err == nil {
+			affected = append(affected, gids[i])
+		} else if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return affected, firstErr
 }
 
-// MultiCall executes multiple method calls in one request.
-// Returns a MethodResult for each MethodCall in order.
-func (c *Client) MultiCall(methods ...*MethodCall) ([]MethodResult, error) {
-	var rawResults []json.RawMessage
-	err := c.rpcClient.Call(aria2proto.Multicall, c.getArgs(methods), &rawResults)
+// pageSize is the number of downloads fetched, or results removed, per request
+// by the methods which iterate over all downloads.
+const pageSize = 100
 
-	results := make([]MethodResult, len(rawResults))
+// CleanupResults removes the results of all stopped downloads for which filter returns true.
+// The stopped downloads are fetched using TellStopped in pages, the matching results
+// are removed using multicalls of RemoveDownloadResult once all pages were fetched.
+//
+// It returns the number of removed results. If some results couldn't be removed,
+// the error of the first one is returned alongside the number of removed results.
+func (c *Client) CleanupResults(filter func(Status) bool) (int, error) {
+	return c.CleanupResultsContext(context.Background(), filter)
+}
 
-	for i, rawResult := range rawResults {
-		var methodResult []byte
+// CleanupResultsContext is like CleanupResults() but aborts once ctx is done.
+func (c *Client) CleanupResultsContext(ctx context.Context, filter func(Status) bool) (int, error) {
+	var gids []string
+	seen := make(map[string]bool)
+
+	for offset := 0; ; offset += pageSize {
+		stopped, err := c.TellStoppedContext(ctx, offset, pageSize)
+		if err != nil {
+			return 0, err
+		}
 
-		var methodErr MethodCallError
-		_ = json.Unmarshal(rawResult, &methodErr)
+		for _, status := range stopped {
+			// downloads stopping in the meantime may shift the pages
+			if !seen[status.GID] && filter(status) {
+				gids = append(gids, status.GID)
+			}
+			seen[status.GID] = true
+		}
 
-		if methodErr == (MethodCallError{}) {
-			var resultArray [1]json.RawMessage
-			_ = json.Unmarshal(rawResult, &resultArray)
+		if len(stopped) < pageSize {
+			break
+		}
+	}
 
-			methodResult = resultArray[0]
+	removed := 0
+	var firstErr error
+	for start := 0; start < len(gids); start += pageSize {
+		end := start + pageSize
+		if end > len(gids) {
+			end = len(gids)
 		}
 
-		results[i] = MethodResult{Result: methodResult, Error: &methodErr}
+		errs, err := c.multiCallGIDs(ctx, aria2proto.RemoveDownloadResult, gids[start:end])
+		if err != nil {
+			return removed, err
+		}
+		for _, err := range errs {
+			if err == nil {
+				removed++
+			} else if firstErr == nil {
+				firstErr = err
+			}
+		}
 	}
 
-	return results, err
+	return removed, firstErr
+}
+
+// RemoveMany removes all downloads denoted by gids in a single request.
+// The errors are reported like for PauseMany().
+func (c *Client) RemoveMany(gids ...string) ([]error, error) {
+	return c.RemoveManyContext(context.Background(), gids...)
+}
+
+// RemoveManyContext is like RemoveMany() but aborts the call once ctx is done.
+func (c *Client) RemoveManyContext(ctx context.Context, gids ...string) ([]error, error) {
+	return c.multiCallGIDs(ctx, aria2proto.Remove, gids)
 }
@@ -1,6 +1,33 @@
 package arigo
 
-import "fmt"
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
 
 // Dial is a convenience method which connects to an aria2 RPC interface.
 // It establishes a WebSocket connection to the given url and passes it
@@ -45,3 +72,3083 @@ func ExampleClient() {
 
 	fmt.Println(status.Status)
 }
+
+// newStalledListener returns the ws url of a listener which accepts connections
+// but never answers the WebSocket handshake.
+func newStalledListener(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+		}
+	}()
+
+	return "ws://" + listener.Addr().String() + "/jsonrpc"
+}
+
+func TestDialContextDeadline(t *testing.T) {
+	url := newStalledListener(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := DialContext(ctx, url, "")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error %v", err)
+	assert.True(t, time.Since(start) < time.Second, "dial wasn't aborted by the context")
+}
+
+func TestDialContextCancel(t *testing.T) {
+	url := newStalledListener(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := DialContext(ctx, url, "")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.Canceled), "unexpected error %v", err)
+}
+
+// unusedAddr returns a local address nothing is listening on.
+func unusedAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	return addr
+}
+
+func TestDialRetry(t *testing.T) {
+	addr := unusedAddr(t)
+
+	dialed := make(chan error, 1)
+	var client *Client
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var err error
+		client, err = DialContext(ctx, "ws://"+addr+"/jsonrpc", "", WithDialRetry(0, ConstantBackoff(20*time.Millisecond)))
+		dialed <- err
+	}()
+
+	// aria2 starts while the client is retrying
+	time.Sleep(100 * time.Millisecond)
+	server := startMockServer(t, func(handler http.Handler) *httptest.Server {
+		server := httptest.NewUnstartedServer(handler)
+		listener, err := net.Listen("tcp", addr)
+		require.NoError(t, err)
+		_ = server.Listener.Close()
+		server.Listener = listener
+		server.Start()
+		return server
+	})
+	server.reply("aria2.getVersion", map[string]string{"version": "1.36.0"})
+
+	require.NoError(t, <-dialed)
+	defer client.Close()
+
+	version, err := client.GetVersion()
+	require.NoError(t, err)
+	assert.Equal(t, "1.36.0", version.Version)
+}
+
+func TestDialRetryExhausted(t *testing.T) {
+	url := "ws://" + unusedAddr(t) + "/jsonrpc"
+
+	_, err := Dial(url, "", WithDialRetry(3, ConstantBackoff(time.Millisecond)))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "giving up after 3 attempts")
+
+	// the deadline ends the retries
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = DialContext(ctx, url, "", WithDialRetry(0, ConstantBackoff(10*time.Millisecond)))
+	require.Error(t, err)
+	assert.True(t, time.Since(start) < time.Second, "retries didn't stop at the deadline")
+}
+
+func TestDialRetryDefaultBackoff(t *testing.T) {
+	cfg := newClientConfig([]ClientOption{WithDialRetry(0, nil)})
+	require.NotNil(t, cfg.dialBackoff)
+	assert.Equal(t, 100*time.Millisecond, cfg.dialBackoff.NextInterval(0))
+	assert.Equal(t, 5*time.Second, cfg.dialBackoff.NextInterval(10))
+
+	url := "ws://" + unusedAddr(t) + "/jsonrpc"
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+
+	logger := &testLogger{}
+	_, err := DialContext(ctx, url, "", WithDialRetry(0, nil), WithLogger(logger))
+	require.Error(t, err)
+	debugs, _ := logger.messages()
+	assert.True(t, strings.Count(debugs, "retrying to connect") <= 2, "retried without waiting")
+}
+
+func TestDialHandshakeTimeout(t *testing.T) {
+	url := newStalledListener(t)
+
+	_, err := Dial(url, "", WithHandshakeTimeout(50*time.Millisecond))
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestDialRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "token required\n"+strings.Repeat("a", 2*maxDialErrorBody), http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/jsonrpc", "")
+	var dialErr *DialError
+	require.True(t, errors.As(err, &dialErr), "unexpected error %v", err)
+	assert.Equal(t, http.StatusForbidden, dialErr.StatusCode)
+	assert.Equal(t, "403 Forbidden", dialErr.Status)
+	assert.True(t, strings.HasPrefix(dialErr.Body, "token required"))
+	assert.Len(t, dialErr.Body, maxDialErrorBody)
+	assert.True(t, errors.Is(err, websocket.ErrBadHandshake))
+	assert.Contains(t, err.Error(), "403 Forbidden: token required")
+}
+
+// startUpgraderServer starts a WebSocket server using upgrader which discards all messages
+// and returns its url.
+func startUpgraderServer(t *testing.T, upgrader websocket.Upgrader) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/jsonrpc"
+}
+
+func TestSubprotocols(t *testing.T) {
+	url := startUpgraderServer(t, websocket.Upgrader{Subprotocols: []string{"aria2.v1"}})
+
+	client, err := Dial(url, "", WithRequiredSubprotocols("aria2.v2", "aria2.v1"))
+	require.NoError(t, err)
+	assert.Equal(t, "aria2.v1", client.Subprotocol())
+	require.NoError(t, client.Close())
+
+	client, err = Dial(url, "", WithSubprotocols("aria2.v2"))
+	require.NoError(t, err)
+	assert.Equal(t, "", client.Subprotocol())
+	assert.True(t, client.IsConnected())
+	require.NoError(t, client.Close())
+
+	_, err = Dial(url, "", WithRequiredSubprotocols("aria2.v2"))
+	assert.Equal(t, ErrSubprotocolNotSelected, err)
+}
+
+func TestCompressionEnabled(t *testing.T) {
+	compressing := startUpgraderServer(t, websocket.Upgrader{EnableCompression: true})
+	plain := startUpgraderServer(t, websocket.Upgrader{})
+
+	tests := []struct {
+		url      string
+		opts     []ClientOption
+		expected bool
+	}{
+		{compressing, []ClientOption{WithCompression()}, true},
+		{compressing, []ClientOption{WithCompressionThreshold(1024)}, true},
+		{compressing, nil, false},
+		{plain, []ClientOption{WithCompression()}, false},
+	}
+
+	for _, test := range tests {
+		client, err := Dial(test.url, "", test.opts...)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, client.CompressionEnabled())
+		require.NoError(t, client.Close())
+	}
+}
+
+// eventually calls f until it returns true or the timeout is reached.
+func eventually(t *testing.T, f func() bool, msg string) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	server := newMockServer(t)
+	server.handle("aria2.getVersion", func(params []json.RawMessage) (interface{}, *mockError) {
+		if len(params) == 0 || string(params[0]) != `"token:secret"` {
+			return nil, &mockError{Code: 1, Message: "Unauthorized"}
+		}
+		return VersionInfo{Version: "1.36.0"}, nil
+	})
+
+	client := server.dial("secret", WithReconnect(ConstantBackoff(10*time.Millisecond)))
+
+	events := make(chan *DownloadEvent, 1)
+	client.Subscribe(StartEvent, func(event *DownloadEvent) {
+		events <- event
+	})
+
+	_, err := client.GetVersion()
+	require.NoError(t, err)
+
+	server.dropConnections()
+
+	// calls fail with ErrConnectionLost until the client has reconnected
+	eventually(t, func() bool {
+		_, err = client.GetVersion()
+		if err != nil {
+			assert.Equal(t, ErrConnectionLost, err)
+		}
+		return err == nil
+	}, "client didn't reconnect")
+
+	// subscriptions carry over to the new connection
+	server.notify("aria2.onDownloadStart", "2089b05ecca3d829")
+	select {
+	case event := <-events:
+		assert.Equal(t, "2089b05ecca3d829", event.GID)
+	case <-time.After(time.Second):
+		t.Fatal("event not received after reconnecting")
+	}
+}
+
+func TestReconnectInFlight(t *testing.T) {
+	server := newMockServer(t)
+
+	received := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server.handle("aria2.tellStatus", func([]json.RawMessage) (interface{}, *mockError) {
+		close(received)
+		<-release
+		return nil, nil
+	})
+
+	client := server.dial("", WithReconnect(ConstantBackoff(10*time.Millisecond)))
+
+	go func() {
+		<-received
+		server.dropConnections()
+	}()
+
+	_, err := client.TellStatus("2089b05ecca3d829")
+	assert.Equal(t, ErrConnectionLost, err)
+}
+
+func TestNoReconnect(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getVersion", VersionInfo{Version: "1.36.0"})
+
+	client := server.dial("")
+	_, err := client.GetVersion()
+	require.NoError(t, err)
+
+	server.dropConnections()
+
+	eventually(t, func() bool {
+		_, err = client.GetVersion()
+		return err != nil
+	}, "call succeeded on a dropped connection")
+	assert.NotEqual(t, ErrConnectionLost, err)
+}
+
+func TestCloseStopsReconnect(t *testing.T) {
+	server := newMockServer(t)
+	client := server.dial("", WithReconnect(ConstantBackoff(10*time.Millisecond)))
+
+	eventually(t, func() bool { return server.connectionCount() == 1 }, "client didn't connect")
+	require.NoError(t, client.Close())
+
+	server.dropConnections()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, server.connectionCount())
+}
+
+func TestCloseGracefully(t *testing.T) {
+	server := newMockServer(t)
+	release := make(chan struct{})
+	server.handle("aria2.getVersion", func([]json.RawMessage) (interface{}, *mockError) {
+		<-release
+		return map[string]string{"version": "1.36.0"}, nil
+	})
+	client := server.dial("")
+
+	const calls = 3
+	results := make(chan error, calls)
+	for i := 0; i < calls; i++ {
+		go func() {
+			_, err := client.GetVersion()
+			results <- err
+		}()
+	}
+	eventually(t, func() bool { return len(server.receivedRequests()) == calls }, "calls weren't sent")
+
+	closed := make(chan error, 1)
+	go func() { closed <- client.CloseGracefully(context.Background()) }()
+
+	eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.draining
+	}, "client isn't draining")
+
+	// new calls are rejected while draining
+	_, err := client.GetVersion()
+	assert.Equal(t, ErrClientClosed, err)
+	assert.Len(t, server.receivedRequests(), calls)
+
+	select {
+	case <-closed:
+		t.Fatal("CloseGracefully returned before the calls finished")
+	default:
+	}
+	assert.True(t, client.IsConnected())
+
+	close(release)
+	for i := 0; i < calls; i++ {
+		assert.NoError(t, <-results, "in-flight calls must complete")
+	}
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("CloseGracefully didn't return")
+	}
+	assert.False(t, client.IsConnected())
+}
+
+func TestCloseGracefullyTimeout(t *testing.T) {
+	server := newMockServer(t)
+	release := make(chan struct{})
+	server.handle("aria2.getVersion", func([]json.RawMessage) (interface{}, *mockError) {
+		<-release
+		return map[string]string{"version": "1.36.0"}, nil
+	})
+	defer close(release)
+	client := server.dial("")
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := client.GetVersion()
+		result <- err
+	}()
+	eventually(t, func() bool { return len(server.receivedRequests()) == 1 }, "call wasn't sent")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, client.CloseGracefully(ctx))
+	assert.True(t, client.IsConnected(), "the client stays open if the drain times out")
+
+	require.NoError(t, client.Close())
+	assert.Equal(t, ErrClientClosed, <-result)
+}
+
+func TestCloseConcurrent(t *testing.T) {
+	server := newMockServer(t)
+	release := make(chan struct{})
+	server.handle("aria2.getVersion", func([]json.RawMessage) (interface{}, *mockError) {
+		<-release
+		return map[string]string{"version": "1.36.0"}, nil
+	})
+	defer close(release)
+
+	client := server.dial("", WithReconnect(ConstantBackoff(10*time.Millisecond)))
+	eventually(t, func() bool { return server.connectionCount() == 1 }, "client didn't connect")
+
+	pending := make(chan error, 1)
+	go func() {
+		_, err := client.GetVersion()
+		pending <- err
+	}()
+	eventually(t, func() bool { return len(server.receivedRequests()) == 1 }, "call wasn't sent")
+
+	const closers = 8
+	errs := make(chan error, closers)
+	var wg sync.WaitGroup
+	for i := 0; i < closers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- client.Close()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	first := <-errs
+	for err := range errs {
+		assert.Equal(t, first, err, "every Close must return the same result")
+	}
+
+	// the read loop has stopped once Close returned
+	select {
+	case <-client.runDone:
+	default:
+		t.Fatal("Run is still running")
+	}
+	select {
+	case <-client.Done():
+	default:
+		t.Fatal("Done wasn't closed")
+	}
+
+	assert.Equal(t, ErrClientClosed, <-pending)
+	_, err := client.GetVersion()
+	assert.Equal(t, ErrClientClosed, err)
+	assert.Equal(t, first, client.Close())
+}
+
+func TestChangeOption(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.changeOption", "OK")
+
+	client := server.dial("secret")
+	require.NoError(t, client.ChangeOption("2089b05ecca3d829", "max-download-limit", "1M"))
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 1)
+	require.Len(t, requests[0].Params, 3)
+	assert.JSONEq(t, `"token:secret"`, string(requests[0].Params[0]))
+	assert.JSONEq(t, `"2089b05ecca3d829"`, string(requests[0].Params[1]))
+	assert.JSONEq(t, `{"max-download-limit":"1M"}`, string(requests[0].Params[2]))
+
+	err := client.ChangeOption("2089b05ecca3d829", "file-allocation", "fast")
+	assert.Error(t, err)
+	assert.Len(t, server.receivedRequests(), 1, "invalid option was sent")
+}
+
+func TestFormatSpeedLimit(t *testing.T) {
+	tests := []struct {
+		bytesPerSec int64
+		value       string
+	}{
+		{0, "0"},
+		{1, "1"},
+		{1000, "1000"},
+		{1023, "1023"},
+		{1024, "1K"},
+		{1536, "1536"},
+		{500 * 1024, "500K"},
+		{1024 * 1024, "1M"},
+		{1024*1024 + 1024, "1025K"},
+		{5 * 1024 * 1024 * 1024, "5120M"},
+	}
+
+	for _, tt := range tests {
+		value, err := FormatSpeedLimit(tt.bytesPerSec)
+		require.NoError(t, err)
+		assert.Equal(t, tt.value, value, "%d bytes/sec", tt.bytesPerSec)
+	}
+
+	_, err := FormatSpeedLimit(-1)
+	assert.Error(t, err)
+}
+
+func TestSetSpeedLimits(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.changeOption", "OK")
+	server.reply("aria2.changeGlobalOption", "OK")
+	client := server.dial("")
+
+	require.NoError(t, client.SetDownloadLimit("2089b05ecca3d829", 1024*1024))
+	require.NoError(t, client.SetUploadLimit("2089b05ecca3d829", 0))
+	require.NoError(t, client.SetGlobalDownloadLimit(100*1024))
+	require.NoError(t, client.SetGlobalUploadLimit(1000))
+
+	assert.Error(t, client.SetDownloadLimit("2089b05ecca3d829", -1))
+	assert.Error(t, client.SetUploadLimit("", 1024), "an empty gid must not change the global limit")
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 4)
+	assert.Equal(t, `["2089b05ecca3d829",{"max-download-limit":"1M"}]`, rawParams(requests[0].Params))
+	assert.Equal(t, `["2089b05ecca3d829",{"max-upload-limit":"0"}]`, rawParams(requests[1].Params))
+	assert.Equal(t, "aria2.changeGlobalOption", requests[2].Method)
+	assert.Equal(t, `[{"max-overall-download-limit":"100K"}]`, rawParams(requests[2].Params))
+	assert.Equal(t, `[{"max-overall-upload-limit":"1000"}]`, rawParams(requests[3].Params))
+}
+
+func TestMaxConcurrentDownloads(t *testing.T) {
+	server := newMockServer(t)
+
+	var mu sync.Mutex
+	stored := map[string]string{"max-concurrent-downloads": "5"}
+	server.handle("aria2.changeGlobalOption", func(params []json.RawMessage) (interface{}, *mockError) {
+		var changes map[string]string
+		_ = json.Unmarshal(params[0], &changes)
+
+		mu.Lock()
+		defer mu.Unlock()
+		for key, value := range changes {
+			stored[key] = value
+		}
+		return "OK", nil
+	})
+	server.handle("aria2.getGlobalOption", func([]json.RawMessage) (interface{}, *mockError) {
+		mu.Lock()
+		defer mu.Unlock()
+		return stored, nil
+	})
+	client := server.dial("")
+
+	n, err := client.GetMaxConcurrentDownloads()
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	require.NoError(t, client.SetMaxConcurrentDownloads(2))
+	n, err = client.GetMaxConcurrentDownloads()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	assert.Error(t, client.SetMaxConcurrentDownloads(0))
+	assert.Error(t, client.SetMaxConcurrentDownloads(-1))
+	assert.Len(t, server.receivedRequests(), 3, "invalid values must not be sent")
+}
+
+func TestBitTorrentOptions(t *testing.T) {
+	server := newMockServer(t)
+
+	var mu sync.Mutex
+	stored := map[string]string{"seed-ratio": "1.0", "bt-max-peers": "55"}
+	server.handle("aria2.changeOption", func(params []json.RawMessage) (interface{}, *mockError) {
+		var changes map[string]string
+		_ = json.Unmarshal(params[1], &changes)
+
+		mu.Lock()
+		defer mu.Unlock()
+		for key, value := range changes {
+			stored[key] = value
+		}
+		return "OK", nil
+	})
+	server.handle("aria2.getOption", func([]json.RawMessage) (interface{}, *mockError) {
+		mu.Lock()
+		defer mu.Unlock()
+		return stored, nil
+	})
+	client := server.dial("")
+	gid := "2089b05ecca3d829"
+
+	_, err := client.GetSeedTime(gid)
+	assert.True(t, errors.Is(err, ErrOptionNotSet))
+
+	require.NoError(t, client.SetSeedRatio(gid, 0.1))
+	require.NoError(t, client.SetSeedTime(gid, 90*time.Minute))
+	require.NoError(t, client.SetBtMaxPeers(gid, 0))
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 4)
+	assert.Equal(t, `["2089b05ecca3d829",{"seed-ratio":"0.1"}]`, rawParams(requests[1].Params))
+	assert.Equal(t, `["2089b05ecca3d829",{"seed-time":"90"}]`, rawParams(requests[2].Params))
+	assert.Equal(t, `["2089b05ecca3d829",{"bt-max-peers":"0"}]`, rawParams(requests[3].Params))
+
+	ratio, err := client.GetSeedRatio(gid)
+	require.NoError(t, err)
+	assert.Equal(t, 0.1, ratio)
+
+	seedTime, err := client.GetSeedTime(gid)
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Minute, seedTime)
+
+	peers, err := client.GetBtMaxPeers(gid)
+	require.NoError(t, err)
+	assert.Equal(t, 0, peers)
+
+	// set on the command-line, aria2 accepts fractional minutes
+	mu.Lock()
+	stored["seed-time"] = "1.5"
+	mu.Unlock()
+	seedTime, err = client.GetSeedTime(gid)
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Second, seedTime)
+
+	assert.Error(t, client.SetSeedRatio(gid, -1))
+	assert.Error(t, client.SetSeedRatio(gid, math.NaN()))
+	assert.Error(t, client.SetSeedTime(gid, -time.Minute))
+	assert.Error(t, client.SetSeedTime(gid, 90*time.Second), "aria2 expects whole minutes")
+	assert.Error(t, client.SetBtMaxPeers(gid, -1))
+	assert.Error(t, client.SetBtMaxPeers("", 10))
+	assert.Len(t, server.receivedRequests(), 8, "invalid values must not be sent")
+}
+
+func TestSelectFiles(t *testing.T) {
+	server := newMockServer(t)
+
+	var mu sync.Mutex
+	selected := "1,2,3,4"
+	server.handle("aria2.changeOption", func(params []json.RawMessage) (interface{}, *mockError) {
+		var changes map[string]string
+		_ = json.Unmarshal(params[1], &changes)
+
+		mu.Lock()
+		defer mu.Unlock()
+		selected = changes["select-file"]
+		return "OK", nil
+	})
+	server.handle("aria2.getFiles", func([]json.RawMessage) (interface{}, *mockError) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		files := make([]map[string]string, 4)
+		for i := range files {
+			index := strconv.Itoa(i + 1)
+			files[i] = map[string]string{
+				"index":    index,
+				"selected": strconv.FormatBool(containsString(strings.Split(selected, ","), index)),
+			}
+		}
+		return files, nil
+	})
+	client := server.dial("")
+	gid := "2089b05ecca3d829"
+
+	selectedFiles := func() []int {
+		files, err := client.GetFiles(GIDString(gid))
+		require.NoError(t, err)
+
+		var indices []int
+		for _, file := range files {
+			if file.Selected {
+				indices = append(indices, int(file.Index))
+			}
+		}
+		return indices
+	}
+
+	require.NoError(t, client.SelectFiles(gid, 3, 1, 3))
+	assert.Equal(t, []int{1, 3}, selectedFiles())
+
+	require.NoError(t, client.DeselectFiles(gid, 1))
+	assert.Equal(t, []int{3}, selectedFiles())
+
+	require.NoError(t, client.SelectAllFiles(gid))
+	assert.Equal(t, []int{1, 2, 3, 4}, selectedFiles())
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 9)
+	assert.Equal(t, `["2089b05ecca3d829",{"select-file":"1,3"}]`, rawParams(requests[1].Params))
+
+	for _, indices := range [][]int{{0}, {2, 5}, {}} {
+		err := client.SelectFiles(gid, indices...)
+		assert.True(t, errors.Is(err, ErrInvalidFileIndex), "%v", indices)
+	}
+	assert.True(t, errors.Is(client.DeselectFiles(gid, 1, 2, 3, 4), ErrInvalidFileIndex))
+	for _, request := range server.receivedRequests()[9:] {
+		assert.NotEqual(t, "aria2.changeOption", request.Method, "invalid indices must not be sent")
+	}
+}
+
+func TestStrictOptions(t *testing.T) {
+	server := newMockServer(t)
+
+	var mu sync.Mutex
+	stored := map[string]string{"max-download-limit": "0"}
+	// like aria2, the server silently ignores unknown options
+	known := map[string]bool{"max-download-limit": true, "seed-ratio": true, "max-concurrent-downloads": true}
+	change := func(params []json.RawMessage) (interface{}, *mockError) {
+		var changes map[string]string
+		_ = json.Unmarshal(params[len(params)-1], &changes)
+
+		mu.Lock()
+		defer mu.Unlock()
+		for key, value := range changes {
+			if known[key] {
+				stored[key] = value
+			}
+		}
+		return "OK", nil
+	}
+	get := func([]json.RawMessage) (interface{}, *mockError) {
+		mu.Lock()
+		defer mu.Unlock()
+		return stored, nil
+	}
+	server.handle("aria2.changeOption", change)
+	server.handle("aria2.changeGlobalOption", change)
+	server.handle("aria2.getOption", get)
+	server.handle("aria2.getGlobalOption", get)
+
+	gid := "2089b05ecca3d829"
+	client := server.dial("", WithStrictOptions())
+
+	require.NoError(t, client.ChangeOption(gid, "max-download-limit", "1M"))
+	require.NoError(t, client.ChangeGlobalOption("max-concurrent-downloads", "2"))
+
+	err := client.ChangeOptions(gid, Options{SeedRatio: 2, Extra: map[string]string{"max-downlaod-limit": "2M", "bt-tracker-timout": "10"}})
+	assert.True(t, errors.Is(err, ErrOptionsNotApplied))
+	assert.EqualError(t, err, "options not applied: bt-tracker-timout, max-downlaod-limit")
+
+	err = client.ChangeGlobalOption("max-concurent-downloads", "3")
+	assert.True(t, errors.Is(err, ErrOptionsNotApplied))
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 8, "every change is read back")
+	assert.Equal(t, "aria2.getOption", requests[1].Method)
+	assert.Equal(t, "aria2.getGlobalOption", requests[3].Method)
+
+	// without the option, the options aren't read back
+	lenient := server.dial("")
+	require.NoError(t, lenient.ChangeOption(gid, "max-downlaod-limit", "2M"))
+	assert.Len(t, server.receivedRequests(), 9)
+}
+
+func TestGetOptionsRoundTrip(t *testing.T) {
+	server := newMockServer(t)
+
+	var mu sync.Mutex
+	stored := map[string]string{"dir": "/downloads", "split": "5"}
+	server.handle("aria2.changeOption", func(params []json.RawMessage) (interface{}, *mockError) {
+		var changes map[string]string
+		_ = json.Unmarshal(params[1], &changes)
+
+		mu.Lock()
+		defer mu.Unlock()
+		for key, value := range changes {
+			stored[key] = value
+		}
+		return "OK", nil
+	})
+	server.handle("aria2.getOption", func([]json.RawMessage) (interface{}, *mockError) {
+		mu.Lock()
+		defer mu.Unlock()
+		return stored, nil
+	})
+
+	client := server.dial("")
+	require.NoError(t, client.ChangeOptions("2089b05ecca3d829", Options{
+		MaxConnectionPerServer: 4,
+		Continue:               true,
+		Extra:                  map[string]string{"some-future-option": "value"},
+	}))
+
+	options, err := client.GetOptions("2089b05ecca3d829")
+	require.NoError(t, err)
+	assert.Equal(t, Options{
+		Dir:                    "/downloads",
+		Split:                  5,
+		MaxConnectionPerServer: 4,
+		Continue:               true,
+		Extra:                  map[string]string{"some-future-option": "value"},
+	}, options)
+}
+
+func TestSubscribeChan(t *testing.T) {
+	server := newMockServer(t)
+	client := server.dial("")
+
+	events, unsub := client.SubscribeChan(CompleteEvent, 1)
+	defer unsub()
+
+	eventually(t, func() bool { return server.connectionCount() == 1 }, "client didn't connect")
+	server.notify("aria2.onDownloadStart", "2089b05ecca3d829")
+	server.notify("aria2.onDownloadComplete", "2089b05ecca3d829")
+
+	select {
+	case event := <-events:
+		assert.Equal(t, "2089b05ecca3d829", event.GID)
+	case <-time.After(time.Second):
+		t.Fatal("event not received")
+	}
+}
+
+func TestSubscribeChanMultipleSubscribers(t *testing.T) {
+	server := newMockServer(t)
+	client := server.dial("")
+
+	logger, unsubLogger := client.SubscribeChan(CompleteEvent, 1)
+	defer unsubLogger()
+	ui, unsubUI := client.SubscribeChan(CompleteEvent, 1)
+	defer unsubUI()
+
+	eventually(t, func() bool { return server.connectionCount() == 1 }, "client didn't connect")
+	server.notify("aria2.onDownloadComplete", "2089b05ecca3d829")
+
+	for _, events := range []<-chan *DownloadEvent{logger, ui} {
+		select {
+		case event := <-events:
+			assert.Equal(t, "2089b05ecca3d829", event.GID)
+		case <-time.After(time.Second):
+			t.Fatal("event not received by every subscriber")
+		}
+	}
+	assert.Equal(t, uint64(0), client.DroppedEvents())
+}
+
+func TestEventRouting(t *testing.T) {
+	server := newMockServer(t)
+	client := server.dial("")
+
+	tests := []struct {
+		method  string
+		evtType EventType
+	}{
+		{"aria2.onDownloadStart", StartEvent},
+		{"aria2.onDownloadPause", PauseEvent},
+		{"aria2.onDownloadStop", StopEvent},
+		{"aria2.onDownloadComplete", CompleteEvent},
+		{"aria2.onBtDownloadComplete", BTCompleteEvent},
+		{"aria2.onDownloadError", ErrorEvent},
+	}
+
+	types := make(chan EventType, len(tests))
+	for _, test := range tests {
+		evtType := test.evtType
+		unsub := client.Subscribe(evtType, func(event *DownloadEvent) {
+			assert.Equal(t, "2089b05ecca3d829", event.GID)
+			types <- evtType
+		})
+		defer unsub()
+	}
+
+	unknown := make(chan *UnknownEvent, 1)
+	unsub := client.SubscribeUnknown(func(event *UnknownEvent) { unknown <- event })
+	defer unsub()
+
+	eventually(t, func() bool { return server.connectionCount() == 1 }, "client didn't connect")
+
+	for _, test := range tests {
+		server.notify(test.method, "2089b05ecca3d829")
+		select {
+		case evtType := <-types:
+			assert.Equal(t, test.evtType, evtType, test.method)
+		case <-time.After(time.Second):
+			t.Fatalf("%s not dispatched", test.method)
+		}
+	}
+
+	server.notifyParams("aria2.onDownloadUnknown", map[string]string{"gid": "2089b05ecca3d829"}, 1)
+	select {
+	case event := <-unknown:
+		assert.Equal(t, "aria2.onDownloadUnknown", event.Method)
+		require.Len(t, event.Params, 2)
+		assert.JSONEq(t, `{"gid": "2089b05ecca3d829"}`, string(event.Params[0]))
+		assert.JSONEq(t, `1`, string(event.Params[1]))
+	case <-time.After(time.Second):
+		t.Fatal("unknown notification not dispatched")
+	}
+
+	// the connection survives unknown notifications
+	server.notify("aria2.onDownloadStart", "2089b05ecca3d829")
+	select {
+	case evtType := <-types:
+		assert.Equal(t, StartEvent, evtType)
+	case <-time.After(time.Second):
+		t.Fatal("event not dispatched after unknown notification")
+	}
+	assert.Empty(t, types)
+}
+
+func TestInterceptors(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("custom.getVersion", VersionInfo{Version: "1.36.0"})
+
+	errRejected := errors.New("rejected")
+	client := server.dial("",
+		WithRequestInterceptor(func(req *Request) error {
+			if req.Method == "aria2.tellStatus" {
+				return errRejected
+			}
+			req.Method = strings.Replace(req.Method, "aria2.", "custom.", 1)
+			req.Fields = map[string]interface{}{"jsonrpc": "2.0", "x-trace": "abc"}
+			return nil
+		}),
+		WithResponseInterceptor(func(resp *Response) {
+			resp.Result = json.RawMessage(strings.Replace(string(resp.Result), "1.36.0", "1.37.0", 1))
+		}),
+		WithRequestInterceptor(nil),
+	)
+
+	version, err := client.GetVersion()
+	require.NoError(t, err)
+	assert.Equal(t, "1.37.0", version.Version, "the response interceptor must change the result")
+
+	_, err = client.TellStatus("2089b05ecca3d829")
+	assert.Equal(t, errRejected, err)
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 1, "rejected requests must not be sent")
+	assert.Equal(t, "custom.getVersion", requests[0].Method)
+
+	var envelope map[string]interface{}
+	require.NoError(t, json.Unmarshal(requests[0].Raw, &envelope))
+	assert.Equal(t, "2.0", envelope["jsonrpc"])
+	assert.Equal(t, "abc", envelope["x-trace"])
+	assert.NotEmpty(t, envelope["id"])
+}
+
+func TestInterceptorChain(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getVersion", VersionInfo{Version: "1.36.0"})
+
+	var order []string
+	errRejected := errors.New("rejected")
+	client := server.dial("",
+		WithRequestInterceptor(func(req *Request) error {
+			order = append(order, "first request")
+			if req.Method == "aria2.tellStatus" {
+				return errRejected
+			}
+			return nil
+		}),
+		WithRequestInterceptor(func(req *Request) error {
+			order = append(order, "second request")
+			if req.Method == "aria2.getPeers" {
+				req.ID = ""
+			}
+			return nil
+		}),
+		WithResponseInterceptor(func(resp *Response) { order = append(order, "first response") }),
+		WithResponseInterceptor(func(resp *Response) { order = append(order, "second response") }),
+	)
+
+	_, err := client.GetVersion()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first request", "second request", "first response", "second response"}, order)
+
+	order = nil
+	_, err = client.TellStatus("2089b05ecca3d829")
+	assert.Equal(t, errRejected, err)
+	assert.Equal(t, []string{"first request"}, order, "the chain must stop at the first error")
+
+	// without an id, the response couldn't be matched and the call would never return
+	_, err = client.GetPeers("2089b05ecca3d829")
+	assert.Error(t, err)
+	assert.Len(t, server.receivedRequests(), 1, "requests without id must not be sent")
+}
+
+func TestProtocolVersion(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getVersion", VersionInfo{Version: "1.36.0"})
+
+	for _, version := range []ProtocolVersion{ProtocolVersion2, ProtocolVersion1} {
+		client := server.dial("", WithProtocolVersion(version))
+		info, err := client.GetVersion()
+		require.NoError(t, err)
+		assert.Equal(t, "1.36.0", info.Version)
+	}
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 2)
+
+	var envelope map[string]interface{}
+	require.NoError(t, json.Unmarshal(requests[0].Raw, &envelope))
+	assert.Equal(t, "2.0", envelope["jsonrpc"])
+	assert.IsType(t, "", envelope["id"])
+
+	envelope = nil
+	require.NoError(t, json.Unmarshal(requests[1].Raw, &envelope))
+	assert.NotContains(t, envelope, "jsonrpc")
+	assert.IsType(t, float64(0), envelope["id"], "1.0 requests must have numeric ids")
+
+	_, err := Dial(server.url(), "", WithProtocolVersion("3.0"))
+	assert.Error(t, err)
+}
+
+func TestDefaultParams(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getVersion", VersionInfo{Version: "1.36.0"})
+	server.reply("aria2.tellStatus", map[string]string{"gid": "2089b05ecca3d829"})
+	client := server.dial("secret", WithDefaultParams("aria2.tellStatus", "context", 1))
+
+	_, err := client.TellStatus("2089b05ecca3d829", "gid")
+	require.NoError(t, err)
+	_, err = client.GetVersion()
+	require.NoError(t, err)
+	_, err = client.MultiCall(
+		NewMethodCall("aria2.tellStatus", "2089b05ecca3d829"),
+		NewMethodCall("aria2.getVersion"),
+	)
+	require.NoError(t, err)
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 3)
+	assert.Equal(t, `["token:secret","2089b05ecca3d829",["gid"],"context",1]`, rawParams(requests[0].Params))
+	assert.Equal(t, `["token:secret"]`, rawParams(requests[1].Params))
+	assert.Equal(t, `[[{"methodName":"aria2.tellStatus","params":["token:secret","2089b05ecca3d829","context",1]},`+
+		`{"methodName":"aria2.getVersion","params":["token:secret"]}]]`, rawParams(requests[2].Params))
+}
+
+func TestSecret(t *testing.T) {
+	server := newMockServer(t)
+	server.requireSecret("secret")
+	server.reply("aria2.getVersion", VersionInfo{Version: "1.36.0"})
+	server.reply("aria2.pause", "2089b05ecca3d829")
+
+	client := server.dial("", WithSecret("secret"))
+
+	version, err := client.GetVersion()
+	require.NoError(t, err)
+	assert.Equal(t, "1.36.0", version.Version)
+
+	results, err := client.MultiCall(NewMethodCall("aria2.pause", "2089b05ecca3d829"))
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.NoError(t, results[0].Error)
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 2)
+	var calls []MethodCall
+	require.NoError(t, json.Unmarshal(requests[1].Params[0], &calls))
+	assert.Equal(t, []interface{}{"token:secret", "2089b05ecca3d829"}, calls[0].Params)
+}
+
+func TestUnauthorized(t *testing.T) {
+	server := newMockServer(t)
+	server.requireSecret("secret")
+	server.reply("aria2.pause", "2089b05ecca3d829")
+
+	for _, client := range []*Client{server.dial(""), server.dial("wrong")} {
+		assert.True(t, errors.Is(client.Pause("2089b05ecca3d829"), ErrUnauthorized))
+
+		errs, err := client.PauseMany("2089b05ecca3d829")
+		require.NoError(t, err)
+		require.Len(t, errs, 1)
+		assert.True(t, errors.Is(errs[0], ErrUnauthorized))
+	}
+
+	// errors which aren't related to the token must not be reported as ErrUnauthorized
+	client := server.dial("secret")
+	err := client.Unpause("2089b05ecca3d829")
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, ErrUnauthorized))
+}
+
+func TestPollGlobalStats(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getGlobalStat", map[string]string{"downloadSpeed": "1024", "numActive": "1"})
+
+	client := server.dial("")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stats := client.PollGlobalStats(ctx, 10*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case s := <-stats:
+			assert.Equal(t, Stats{DownloadSpeed: 1024, NumActive: 1}, s)
+		case <-time.After(time.Second):
+			t.Fatal("stats not received")
+		}
+	}
+
+	cancel()
+	for range stats {
+	}
+}
+
+func TestPollGlobalStatsNotifications(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("system.listNotifications", []string{"aria2.onDownloadStart", "aria2.onGlobalStat"})
+	server.handle("aria2.getGlobalStat", func([]json.RawMessage) (interface{}, *mockError) {
+		t.Error("aria2.getGlobalStat must not be polled")
+		return nil, &mockError{Code: 1, Message: "unexpected call"}
+	})
+	client := server.dial("")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	// the statistics are only polled if there was no notification for an interval
+	stats := client.PollGlobalStats(ctx, time.Hour)
+
+	// wait until the notifications were detected
+	eventually(t, func() bool { return len(server.receivedRequests()) == 1 }, "notifications not listed")
+	for i := 1; i <= 2; i++ {
+		// the subscription may not be registered yet, so the notification is repeated
+		var s Stats
+		for s.NumActive != Int64(i) {
+			server.notifyParams("aria2.onGlobalStat", map[string]string{"downloadSpeed": "2048", "numActive": fmt.Sprint(i)})
+			select {
+			case s = <-stats:
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+		assert.Equal(t, Stats{DownloadSpeed: 2048, NumActive: Int64(i)}, s)
+	}
+
+	cancel()
+	for range stats {
+	}
+	assert.Len(t, server.receivedRequests(), 1)
+}
+
+func TestPollGlobalStatsNotificationsStopped(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("system.listNotifications", []string{"aria2.onGlobalStat"})
+	server.reply("aria2.getGlobalStat", map[string]string{"downloadSpeed": "1024", "numActive": "1"})
+	client := server.dial("")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stats := client.PollGlobalStats(ctx, 10*time.Millisecond)
+
+	// aria2 advertises the notification but doesn't push it, so the statistics are polled
+	for i := 0; i < 2; i++ {
+		select {
+		case s := <-stats:
+			assert.Equal(t, Stats{DownloadSpeed: 1024, NumActive: 1}, s)
+		case <-time.After(time.Second):
+			t.Fatal("stats not received")
+		}
+	}
+
+	cancel()
+	for range stats {
+	}
+	requests := server.receivedRequests()
+	require.True(t, len(requests) >= 3)
+	assert.Equal(t, "system.listNotifications", requests[0].Method)
+	assert.Equal(t, "aria2.getGlobalStat", requests[1].Method)
+}
+
+func TestAddTorrentFile(t *testing.T) {
+	torrent := []byte("d8:announce35:http://tracker.example.com/announcee")
+	path := filepath.Join(t.TempDir(), "example.torrent")
+	require.NoError(t, ioutil.WriteFile(path, torrent, 0644))
+
+	server := newMockServer(t)
+	server.handle("aria2.addTorrent", func(params []json.RawMessage) (interface{}, *mockError) {
+		var encoded string
+		_ = json.Unmarshal(params[0], &encoded)
+		if encoded != base64.StdEncoding.EncodeToString(torrent) {
+			return nil, &mockError{Code: 1, Message: "Bad torrent"}
+		}
+		return "2089b05ecca3d829", nil
+	})
+
+	client := server.dial("")
+
+	gid, err := client.AddTorrentFile(path, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "2089b05ecca3d829", gid.GID)
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 1)
+	require.Len(t, requests[0].Params, 2)
+	assert.JSONEq(t, `[]`, string(requests[0].Params[1]))
+
+	gid, err = client.AddTorrent([]byte("not a torrent"), nil, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Bad torrent")
+	assert.True(t, errors.As(err, new(*RPCError)))
+	assert.True(t, gid.IsZero())
+
+	_, err = client.AddTorrentFile(filepath.Join(t.TempDir(), "missing.torrent"), nil, nil)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAddMetalink(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply interface{}
+	}{
+		{"strings", []string{"2089b05ecca3d829", "d2703803b52216d1"}},
+		{"objects", []map[string]string{{"gid": "2089b05ecca3d829"}, {"gid": "d2703803b52216d1"}}},
+	}
+
+	path := filepath.Join(t.TempDir(), "example.metalink")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`<metalink xmlns="urn:ietf:params:xml:ns:metalink"/>`), 0644))
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newMockServer(t)
+			server.reply("aria2.addMetalink", test.reply)
+
+			client := server.dial("")
+
+			gids, err := client.AddMetalinkFile(path, nil)
+			require.NoError(t, err)
+			require.Len(t, gids, 2)
+			assert.Equal(t, "2089b05ecca3d829", gids[0].GID)
+			assert.Equal(t, "d2703803b52216d1", gids[1].GID)
+		})
+	}
+}
+
+func TestTellPaging(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.tellActive", []map[string]string{{"gid": "2089b05ecca3d829"}})
+	server.reply("aria2.tellWaiting", []map[string]string{{"gid": "d2703803b52216d1"}})
+	server.reply("aria2.tellStopped", []map[string]string{})
+
+	client := server.dial("")
+
+	active, err := client.TellActive()
+	require.NoError(t, err)
+	assert.Equal(t, []Status{{GID: "2089b05ecca3d829"}}, active)
+
+	waiting, err := client.TellWaiting(-1, 10, "gid", "status")
+	require.NoError(t, err)
+	assert.Equal(t, []Status{{GID: "d2703803b52216d1"}}, waiting)
+
+	stopped, err := client.TellStopped(0, 100)
+	require.NoError(t, err)
+	assert.Empty(t, stopped)
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 3)
+	assert.JSONEq(t, `[]`, string(requests[0].Params[0]))
+	assert.JSONEq(t, `[-1, 10, ["gid", "status"]]`, rawParams(requests[1].Params))
+	assert.JSONEq(t, `[0, 100, []]`, rawParams(requests[2].Params))
+}
+
+// rawParams joins params into a JSON array.
+func rawParams(params []json.RawMessage) string {
+	data, _ := json.Marshal(params)
+	return string(data)
+}
+
+func TestChangePosition(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.changePosition", 0)
+
+	client := server.dial("")
+
+	pos, err := client.ChangePosition("2089b05ecca3d829", 0, SetPositionStart)
+	require.NoError(t, err)
+	assert.Equal(t, 0, pos)
+
+	_, err = client.ChangePosition("2089b05ecca3d829", 0, "POS_TOP")
+	assert.Error(t, err)
+
+	_, err = client.ChangePosition("2089b05ecca3d829", 0, "")
+	assert.Error(t, err)
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 1, "invalid behaviour was sent")
+	assert.JSONEq(t, `["2089b05ecca3d829", 0, "POS_SET"]`, rawParams(requests[0].Params))
+}
+
+func TestGetPeersNoTorrent(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getPeers", []interface{}{})
+
+	client := server.dial("")
+
+	peers, err := client.GetPeers("2089b05ecca3d829")
+	require.NoError(t, err)
+	assert.NotNil(t, peers)
+	assert.Empty(t, peers)
+}
+
+func TestShutdown(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.shutdown", "OK")
+	server.handle("aria2.forceShutdown", func([]json.RawMessage) (interface{}, *mockError) {
+		// aria2 may close the connection before the response is sent
+		server.dropConnections()
+		return "OK", nil
+	})
+
+	client := server.dial("")
+	require.NoError(t, client.Shutdown())
+	_, err := client.GetVersion()
+	assert.Error(t, err, "client wasn't closed")
+
+	client = server.dial("", WithReconnect(ConstantBackoff(10*time.Millisecond)))
+	require.NoError(t, client.ForceShutdown())
+	eventually(t, func() bool { return server.connectionCount() == 0 }, "client reconnected after shutdown")
+
+	// a connection which is lost before the request was sent isn't a successful shutdown
+	client = server.dial("")
+	eventually(t, func() bool { return server.connectionCount() == 1 }, "client didn't connect")
+	server.dropConnections()
+	<-client.Done()
+	assert.Error(t, client.Shutdown())
+}
+
+func TestRemove(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.remove", "2089b05ecca3d829")
+	server.reply("aria2.forceRemove", "d2703803b52216d1")
+	server.handle("aria2.removeDownloadResult", func([]json.RawMessage) (interface{}, *mockError) {
+		return nil, &mockError{Code: 1, Message: "Could not remove download result of GID#2089b05ecca3d829"}
+	})
+
+	client := server.dial("")
+
+	assert.NoError(t, client.Remove("2089b05ecca3d829"))
+	assert.NoError(t, client.ForceRemove("d2703803b52216d1"))
+	// aria2 confirmed a different download
+	assert.Error(t, client.ForceRemove("2089b05ecca3d829"))
+
+	err := client.RemoveDownloadResult("2089b05ecca3d829")
+	var rpcErr *RPCError
+	require.True(t, errors.As(err, &rpcErr), "unexpected error %v", err)
+	assert.Equal(t, "Could not remove download result of GID#2089b05ecca3d829", rpcErr.Message)
+
+	methods := make([]string, 0, 4)
+	for _, req := range server.receivedRequests() {
+		methods = append(methods, req.Method)
+	}
+	// the status tells unfinished and unknown downloads apart
+	assert.Equal(t, []string{"aria2.remove", "aria2.forceRemove", "aria2.forceRemove", "aria2.removeDownloadResult", "aria2.tellStatus"}, methods)
+}
+
+func TestPause(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.pause", "2089b05ecca3d829")
+	server.reply("aria2.forcePause", "2089b05ecca3d829")
+	server.reply("aria2.pauseAll", "OK")
+	server.reply("aria2.forcePauseAll", "OK")
+	server.reply("aria2.unpauseAll", "OK")
+
+	client := server.dial("")
+
+	assert.NoError(t, client.Pause("2089b05ecca3d829"))
+	assert.NoError(t, client.ForcePause("2089b05ecca3d829"))
+	assert.NoError(t, client.PauseAll())
+	assert.NoError(t, client.ForcePauseAll())
+	assert.NoError(t, client.UnpauseAll())
+
+	methods := make([]string, 0, 5)
+	for _, req := range server.receivedRequests() {
+		methods = append(methods, req.Method)
+	}
+	assert.Equal(t, []string{"aria2.pause", "aria2.forcePause", "aria2.pauseAll", "aria2.forcePauseAll", "aria2.unpauseAll"}, methods)
+
+	server.reply("aria2.pauseAll", "NG")
+	err := client.PauseAll()
+	var replyErr *UnexpectedReplyError
+	require.True(t, errors.As(err, &replyErr), "unexpected error %v", err)
+	assert.Equal(t, &UnexpectedReplyError{Method: "aria2.pauseAll", Reply: "NG"}, replyErr)
+
+	server.handle("aria2.unpauseAll", func([]json.RawMessage) (interface{}, *mockError) {
+		return nil, &mockError{Code: 1, Message: "Unauthorized"}
+	})
+	err = client.UnpauseAll()
+	var rpcErr *RPCError
+	require.True(t, errors.As(err, &rpcErr), "unexpected error %v", err)
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+}
+
+func TestListMethods(t *testing.T) {
+	server := newMockServer(t)
+	server.requireSecret("secret")
+	server.reply("system.listMethods", []string{"aria2.addUri", "system.listMethods"})
+
+	client := server.dial("secret")
+
+	methods, err := client.ListMethods()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"aria2.addUri", "system.listMethods"}, methods)
+
+	// an old aria2 without system.listNotifications
+	_, err = client.ListNotifications()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrNoSuchMethod))
+	assert.Contains(t, err.Error(), "system.listNotifications")
+
+	server.reply("system.listNotifications", []string{"aria2.onDownloadStart"})
+	notifications, err := client.ListNotifications()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"aria2.onDownloadStart"}, notifications)
+
+	for _, req := range server.receivedRequests() {
+		assert.Empty(t, req.Params, "token sent to %s", req.Method)
+	}
+}
+
+func TestTellStatusKeys(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.tellStatus", map[string]string{"status": "active", "completedLength": "1024"})
+	client := server.dial("")
+
+	status, err := client.TellStatus("2089b05ecca3d829", "status", "completedLength")
+	require.NoError(t, err)
+	assert.Equal(t, Status{Status: StatusActive, CompletedLength: 1024}, status)
+
+	_, err = client.TellStatus("2089b05ecca3d829")
+	require.NoError(t, err)
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 2)
+	assert.Equal(t, `["2089b05ecca3d829",["status","completedLength"]]`, rawParams(requests[0].Params))
+	assert.Equal(t, `["2089b05ecca3d829",[]]`, rawParams(requests[1].Params))
+}
+
+func TestCall(t *testing.T) {
+	server := newMockServer(t)
+	server.requireSecret("secret")
+	server.reply("aria2.newMethod", map[string]string{"key": "value"})
+	server.reply("system.listMethods", []string{"aria2.newMethod"})
+
+	var started []string
+	client := server.dial("secret", WithCallHooks(CallHooks{
+		OnCallStart: func(method string) { started = append(started, method) },
+	}))
+
+	var result map[string]string
+	require.NoError(t, client.Call(context.Background(), "aria2.newMethod", []interface{}{"2089b05ecca3d829", 1}, &result))
+	assert.Equal(t, map[string]string{"key": "value"}, result)
+
+	require.NoError(t, client.Call(context.Background(), "system.listMethods", nil, nil))
+
+	err := client.Call(context.Background(), "aria2.unknown", nil, nil)
+	assert.True(t, errors.Is(err, ErrNoSuchMethod), "unexpected error %v", err)
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 3)
+	assert.Equal(t, `["token:secret","2089b05ecca3d829",1]`, rawParams(requests[0].Params))
+	assert.Equal(t, `[]`, rawParams(requests[1].Params))
+	assert.Equal(t, `["token:secret"]`, rawParams(requests[2].Params))
+	assert.Equal(t, []string{"aria2.newMethod", "system.listMethods", "aria2.unknown"}, started)
+}
+
+func TestNotify(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getVersion", map[string]string{"version": "1.36.0"})
+	client := server.dial("secret")
+
+	require.NoError(t, client.Notify("custom.event", []interface{}{"2089b05ecca3d829"}))
+	eventually(t, func() bool { return len(server.receivedRequests()) == 1 }, "notification not received")
+
+	// the notification didn't get a response, calls are still matched to theirs
+	_, err := client.GetVersion()
+	require.NoError(t, err)
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 2)
+	assert.Equal(t, "custom.event", requests[0].Method)
+	assert.Nil(t, requests[0].ID)
+	assert.Equal(t, `["token:secret","2089b05ecca3d829"]`, rawParams(requests[0].Params))
+	assert.NotNil(t, requests[1].ID)
+}
+
+func TestCallContextCancel(t *testing.T) {
+	release := make(chan struct{})
+
+	server := newMockServer(t)
+	server.handle("aria2.tellStatus", func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		_ = json.Unmarshal(params[0], &gid)
+		if gid == "2089b05ecca3d829" {
+			<-release
+		}
+		return map[string]string{"gid": gid}, nil
+	})
+
+	client := server.dial("")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	status, err := client.TellStatusContext(ctx, "2089b05ecca3d829")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Empty(t, status.GID)
+
+	// the late response must be discarded instead of being delivered to the next call
+	close(release)
+	for i := 0; i < 10; i++ {
+		status, err = client.TellStatusContext(context.Background(), "d2703803b52216d1")
+		require.NoError(t, err)
+		assert.Equal(t, "d2703803b52216d1", status.GID)
+	}
+
+	// a done context must not send the call at all
+	_, err = client.TellStatusContext(ctx, "d2703803b52216d1")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Len(t, server.receivedRequests(), 11)
+}
+
+func TestWaitForDownloadContext(t *testing.T) {
+	server := newMockServer(t)
+	client := server.dial("")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, client.WaitForDownloadContext(ctx, "2089b05ecca3d829"))
+}
+
+func TestCallTimeout(t *testing.T) {
+	server := newMockServer(t)
+	server.handle("aria2.tellStatus", func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		_ = json.Unmarshal(params[0], &gid)
+		if gid == "2089b05ecca3d829" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		return map[string]string{"gid": gid}, nil
+	})
+
+	client := server.dial("", WithCallTimeout(30*time.Millisecond))
+
+	_, err := client.TellStatus("2089b05ecca3d829")
+	var timeoutErr *TimeoutError
+	require.True(t, errors.As(err, &timeoutErr), "unexpected error %v", err)
+	assert.Equal(t, "aria2.tellStatus", timeoutErr.Method)
+	assert.Equal(t, 30*time.Millisecond, timeoutErr.Timeout)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// the straggling response must not be delivered to the following call
+	status, err := client.TellStatus("d2703803b52216d1")
+	require.NoError(t, err)
+	assert.Equal(t, "d2703803b52216d1", status.GID)
+
+	// a context deadline overrides the timeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	status, err = client.TellStatusContext(ctx, "2089b05ecca3d829")
+	require.NoError(t, err)
+	assert.Equal(t, "2089b05ecca3d829", status.GID)
+}
+
+// newLatencyServer returns a mock server which answers tellStatus after a delay,
+// simulating the latency of a real aria2.
+func newLatencyServer(t testing.TB, latency time.Duration) *mockServer {
+	server := newMockServer(t)
+	server.handle("aria2.tellStatus", func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		_ = json.Unmarshal(params[0], &gid)
+		time.Sleep(latency)
+		return map[string]string{"gid": gid}, nil
+	})
+	return server
+}
+
+func TestConcurrentCalls(t *testing.T) {
+	server := newLatencyServer(t, 10*time.Millisecond)
+	client := server.dial("")
+
+	const calls = 50
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			gid := fmt.Sprintf("%016x", i)
+			status, err := client.TellStatus(GIDString(gid))
+			if assert.NoError(t, err) {
+				assert.Equal(t, gid, status.GID)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// sequential calls would take at least calls * latency
+	assert.True(t, time.Since(start) < calls*10*time.Millisecond/2, "calls weren't executed concurrently")
+}
+
+func BenchmarkTellStatus(b *testing.B) {
+	server := newLatencyServer(b, time.Millisecond)
+	client := server.dial("")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.TellStatus("2089b05ecca3d829"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTellStatusParallel(b *testing.B) {
+	server := newLatencyServer(b, time.Millisecond)
+	client := server.dial("")
+
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := client.TellStatus("2089b05ecca3d829"); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// countingEncoding is a JSONEncoding which counts the values encoded and decoded by encoding/json.
+type countingEncoding struct {
+	encoded, decoded int64
+}
+
+func (e *countingEncoding) NewEncoder(w io.Writer) JSONEncoder {
+	return countingEncoder{json.NewEncoder(w), &e.encoded}
+}
+
+func (e *countingEncoding) NewDecoder(r io.Reader) JSONDecoder {
+	return countingDecoder{json.NewDecoder(r), &e.decoded}
+}
+
+func (e *countingEncoding) Unmarshal(data []byte, v interface{}) error {
+	atomic.AddInt64(&e.decoded, 1)
+	return json.Unmarshal(data, v)
+}
+
+type countingEncoder struct {
+	*json.Encoder
+	n *int64
+}
+
+func (e countingEncoder) Encode(v interface{}) error {
+	atomic.AddInt64(e.n, 1)
+	return e.Encoder.Encode(v)
+}
+
+type countingDecoder struct {
+	*json.Decoder
+	n *int64
+}
+
+func (d countingDecoder) Decode(v interface{}) error {
+	err := d.Decoder.Decode(v)
+	if err == nil {
+		atomic.AddInt64(d.n, 1)
+	}
+	return err
+}
+
+func TestJSONEncoding(t *testing.T) {
+	server := newLatencyServer(t, 0)
+	encoding := &countingEncoding{}
+
+	for _, url := range []string{server.url(), server.httpURL()} {
+		client, err := Dial(url, "", WithJSONEncoding(encoding))
+		require.NoError(t, err)
+
+		status, err := client.TellStatus("2089b05ecca3d829")
+		require.NoError(t, err)
+		assert.Equal(t, "2089b05ecca3d829", status.GID)
+		require.NoError(t, client.Close())
+	}
+
+	assert.Equal(t, int64(2), atomic.LoadInt64(&encoding.encoded), "requests weren't encoded by the encoding")
+	// the message and the result of each response
+	assert.Equal(t, int64(4), atomic.LoadInt64(&encoding.decoded), "responses weren't decoded by the encoding")
+}
+
+// typeRecordingEncoding is a JSONEncoding which records the types of the values passed to Unmarshal.
+type typeRecordingEncoding struct {
+	countingEncoding
+
+	mu    sync.Mutex
+	types []string
+}
+
+func (e *typeRecordingEncoding) Unmarshal(data []byte, v interface{}) error {
+	e.mu.Lock()
+	e.types = append(e.types, fmt.Sprintf("%T", v))
+	e.mu.Unlock()
+	return json.Unmarshal(data, v)
+}
+
+func TestJSONEncodingOptionsAndMultiCall(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getGlobalOption", map[string]string{"dir": "/downloads", "max-concurrent-downloads": "5"})
+	encoding := &typeRecordingEncoding{}
+	client := server.dial("", WithJSONEncoding(encoding))
+
+	options, err := client.GetGlobalOptions()
+	require.NoError(t, err)
+	assert.Equal(t, Options{Dir: "/downloads", MaxConcurrentDownloads: 5}, options)
+
+	results, err := client.MultiCall(NewMethodCall("aria2.getGlobalOption"))
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	var m map[string]string
+	require.NoError(t, results[0].Unmarshal(&m))
+	assert.Equal(t, "/downloads", m["dir"])
+
+	encoding.mu.Lock()
+	defer encoding.mu.Unlock()
+	// the options are decoded into a map, not by Options.UnmarshalJSON using encoding/json,
+	// and the entries of the multicall response are decoded by the encoding as well
+	rawMessages := fmt.Sprintf("%T", &[]json.RawMessage{})
+	assert.Equal(t, []string{"*map[string]string", rawMessages, rawMessages, "*map[string]string"}, encoding.types)
+}
+
+func BenchmarkJSONEncoding(b *testing.B) {
+	encodings := []struct {
+		name     string
+		encoding JSONEncoding
+	}{
+		{"default", nil},
+		{"custom", &countingEncoding{}},
+	}
+
+	for _, e := range encodings {
+		b.Run(e.name, func(b *testing.B) {
+			server := newLatencyServer(b, 0)
+			client := server.dial("", WithJSONEncoding(e.encoding))
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := client.TellStatus("2089b05ecca3d829"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	server := newMockServer(t)
+	server.handle("aria2.tellStatus", func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		_ = json.Unmarshal(params[0], &gid)
+		return map[string]string{"gid": gid}, nil
+	})
+
+	client := server.dial("", WithReconnect(ConstantBackoff(10*time.Millisecond)))
+
+	const calls = 2000
+
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			gid := fmt.Sprintf("%016x", i)
+			status, err := client.TellStatus(GIDString(gid))
+			if assert.NoError(t, err) {
+				assert.Equal(t, gid, status.GID, "response delivered to the wrong call")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// the ids must stay unique after reconnecting
+	server.dropConnections()
+	eventually(t, func() bool {
+		_, err := client.TellStatus("2089b05ecca3d829")
+		return err == nil
+	}, "client didn't reconnect")
+
+	ids := make(map[string]bool)
+	for _, req := range server.receivedRequests() {
+		var id string
+		require.NoError(t, json.Unmarshal(*req.ID, &id), "id %s isn't a string", *req.ID)
+		assert.False(t, ids[id], "id %s used twice", id)
+		ids[id] = true
+	}
+	assert.True(t, len(ids) > calls)
+}
+
+func TestHTTPTransport(t *testing.T) {
+	server := newMockServer(t)
+	server.requireSecret("secret")
+	server.reply("aria2.getVersion", map[string]interface{}{"version": "1.36.0", "enabledFeatures": []string{}})
+	server.handle("aria2.tellStatus", func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		_ = json.Unmarshal(params[1], &gid)
+		return map[string]string{"gid": gid, "status": "active"}, nil
+	})
+
+	client, err := Dial(server.httpURL(), "secret")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	assert.False(t, client.NotificationsSupported())
+
+	version, err := client.GetVersion()
+	require.NoError(t, err)
+	assert.Equal(t, "1.36.0", version.Version)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, err := client.TellStatus("0123456789abcdef")
+			if assert.NoError(t, err) {
+				assert.Equal(t, StatusActive, status.Status)
+			}
+		}()
+	}
+	wg.Wait()
+
+	_, err = client.GetGlobalStats()
+	assert.True(t, errors.Is(err, ErrNoSuchMethod))
+
+	assert.Equal(t, ErrNotificationsUnsupported, client.WaitForDownload("0123456789abcdef"))
+	_, err = client.Download(URIs("http://example.com"), nil)
+	assert.Equal(t, ErrNotificationsUnsupported, err)
+	assert.False(t, client.NotificationsSupported())
+}
+
+func TestTLSConfig(t *testing.T) {
+	server := newMockTLSServer(t)
+	server.reply("aria2.getVersion", map[string]interface{}{"version": "1.36.0", "enabledFeatures": []string{}})
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.server.Certificate())
+	tlsConfig := &tls.Config{RootCAs: pool}
+
+	require.True(t, strings.HasPrefix(server.url(), "wss://"))
+	require.True(t, strings.HasPrefix(server.httpURL(), "https://"))
+
+	for _, url := range []string{server.url(), server.httpURL()} {
+		t.Run(url, func(t *testing.T) {
+			// the HTTP transport only connects once a call is made
+			if untrusted, err := Dial(url, ""); err == nil {
+				_, err = untrusted.GetVersion()
+				_ = untrusted.Close()
+				assert.Error(t, err, "the self-signed certificate must not be trusted by default")
+			}
+
+			client, err := Dial(url, "", WithTLSConfig(tlsConfig))
+			require.NoError(t, err)
+			defer client.Close()
+
+			version, err := client.GetVersion()
+			require.NoError(t, err)
+			assert.Equal(t, "1.36.0", version.Version)
+		})
+	}
+}
+
+func TestHeader(t *testing.T) {
+	server := newMockServer(t)
+	server.requireHeader("Authorization", "Bearer token")
+	server.requireHeader("X-Proxy-Token", "a")
+	server.requireHeader("X-Proxy-Token", "b")
+	server.reply("aria2.getVersion", map[string]interface{}{"version": "1.36.0", "enabledFeatures": []string{}})
+
+	_, err := Dial(server.url(), "", WithHeader("Authorization", "Bearer token"))
+	assert.Error(t, err, "handshake must be rejected without all headers")
+
+	opts := []ClientOption{
+		WithHeader("Authorization", "Bearer token"),
+		WithHTTPHeaders(http.Header{"X-Proxy-Token": {"a", "b"}}),
+	}
+
+	for _, url := range []string{server.url(), server.httpURL()} {
+		t.Run(url, func(t *testing.T) {
+			client, err := Dial(url, "", opts...)
+			require.NoError(t, err)
+			defer client.Close()
+
+			version, err := client.GetVersion()
+			require.NoError(t, err)
+			assert.Equal(t, "1.36.0", version.Version)
+		})
+	}
+}
+
+func TestReadLimit(t *testing.T) {
+	const limit = 1024
+
+	server := newMockServer(t)
+	server.handle("aria2.tellStatus", func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		_ = json.Unmarshal(params[0], &gid)
+
+		// the rest of the response is less than 100 bytes long
+		padding := limit - 100
+		if gid == "2089b05ecca3d829" {
+			padding = limit
+		}
+		return map[string]string{"gid": gid, "dir": strings.Repeat("a", padding)}, nil
+	})
+
+	client := server.dial("", WithReadLimit(limit), WithReadBufferSize(256), WithWriteBufferSize(256))
+
+	_, err := client.TellStatus("0123456789abcdef")
+	require.NoError(t, err, "a message under the limit must be received")
+
+	_, err = client.TellStatus("2089b05ecca3d829")
+	var limitErr *ReadLimitError
+	require.True(t, errors.As(err, &limitErr), "unexpected error %v", err)
+	assert.Equal(t, int64(limit), limitErr.Limit)
+}
+
+func TestMessageObserver(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getVersion", VersionInfo{Version: "1.36.0"})
+	files := make([]File, 100)
+	for i := range files {
+		files[i] = File{Index: Int64(i + 1), Path: "/downloads/file"}
+	}
+	server.reply("aria2.getFiles", files)
+
+	var mu sync.Mutex
+	sizes := make(map[MessageDirection][]int)
+	logger := &testLogger{}
+	client := server.dial("", WithLogger(logger), WithLargeMessageWarning(1000),
+		WithMessageObserver(func(direction MessageDirection, size int) {
+			mu.Lock()
+			defer mu.Unlock()
+			sizes[direction] = append(sizes[direction], size)
+		}))
+
+	_, err := client.GetVersion()
+	require.NoError(t, err)
+	_, err = client.GetFiles("2089b05ecca3d829")
+	require.NoError(t, err)
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 2)
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sizes[IncomingMessage]) == 2
+	}, "the responses weren't observed")
+
+	mu.Lock()
+	assert.Equal(t, []int{len(requests[0].Raw), len(requests[1].Raw)}, sizes[OutgoingMessage])
+	assert.True(t, sizes[IncomingMessage][0] < 1000)
+	assert.True(t, sizes[IncomingMessage][1] > 1000)
+	large := sizes[IncomingMessage][1]
+	mu.Unlock()
+
+	_, errs := logger.messages()
+	assert.Contains(t, errs, fmt.Sprintf("arigo: incoming message of %d bytes exceeds 1000 bytes", large))
+	assert.NotContains(t, errs, "outgoing message")
+
+	_, err = Dial(server.url(), "", WithLargeMessageWarning(-1))
+	assert.Error(t, err)
+}
+
+func TestWriteTimeout(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	// the server never reads, so the socket buffers fill up eventually
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		<-done
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/jsonrpc"
+
+	_, err := Dial(url, "", WithWriteTimeout(-time.Second))
+	assert.Error(t, err)
+
+	client, err := Dial(url, "", WithWriteTimeout(100*time.Millisecond))
+	require.NoError(t, err)
+	defer client.Close()
+
+	uri := "http://example.com/" + strings.Repeat("a", 1<<20)
+	var timeoutErr *WriteTimeoutError
+	for i := 0; i < 1000 && !errors.As(err, &timeoutErr); i++ {
+		err = client.Notify("aria2.addUri", []interface{}{[]string{uri}})
+	}
+	require.True(t, errors.As(err, &timeoutErr), "unexpected error %v", err)
+	assert.Equal(t, 100*time.Millisecond, timeoutErr.Limit)
+}
+
+func TestAddURIMirrors(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.addUri", "2089b05ecca3d829")
+	client := server.dial("")
+
+	gid, err := client.AddURI(URIs("http://a.example.com/file", "http://b.example.com/file"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "2089b05ecca3d829", gid.GID)
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, `[["http://a.example.com/file","http://b.example.com/file"]]`, rawParams(requests[0].Params))
+
+	_, err = client.AddURI(nil, nil)
+	assert.Equal(t, ErrNoURIs, err)
+	_, err = client.AddURIAtPosition([]string{}, 0, nil)
+	assert.Equal(t, ErrNoURIs, err)
+	assert.Len(t, server.receivedRequests(), 1, "no call must be made without uris")
+}
+
+func TestAddURISlowServer(t *testing.T) {
+	server := newMockServer(t)
+	var mu sync.Mutex
+	downloads := make(map[string]bool)
+	server.handle("aria2.addUri", func([]json.RawMessage) (interface{}, *mockError) {
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		gid := fmt.Sprintf("%016x", len(downloads)+1)
+		downloads[gid] = true
+		return gid, nil
+	})
+	server.handle("aria2.tellStatus", func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		_ = json.Unmarshal(params[0], &gid)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if !downloads[gid] {
+			return nil, &mockError{Code: 1, Message: "GID " + gid + " is not found"}
+		}
+		return map[string]string{"gid": gid, "status": "active"}, nil
+	})
+	client := server.dial("")
+
+	for i := 0; i < 2; i++ {
+		gid, err := client.AddURI(URIs("http://example.com/file"), nil)
+		require.NoError(t, err)
+
+		// the gid has to be usable right away
+		status, err := client.TellStatus(GIDString(gid.GID))
+		require.NoError(t, err)
+		assert.Equal(t, gid.GID, status.GID)
+		assert.Equal(t, fmt.Sprintf("%016x", i+1), gid.GID)
+	}
+}
+
+func TestAddURIAtPosition(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.addUri", "2089b05ecca3d829")
+	server.reply("aria2.addTorrent", "2089b05ecca3d829")
+	client := server.dial("")
+
+	_, err := client.AddURIAtPosition(URIs("http://example.com/file"), 0, nil)
+	require.NoError(t, err)
+	_, err = client.AddURIAtPosition(URIs("http://example.com/file"), 2, &Options{Dir: "/tmp"})
+	require.NoError(t, err)
+	_, err = client.AddURIAtPosition(URIs("http://example.com/file"), QueueEndPosition, nil)
+	require.NoError(t, err)
+	_, err = client.AddTorrentAtPosition([]byte("torrent"), nil, 0, nil)
+	require.NoError(t, err)
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 4)
+	// the position always follows the options
+	assert.Equal(t, `[["http://example.com/file"],{},0]`, rawParams(requests[0].Params))
+	assert.Equal(t, `[["http://example.com/file"],{"dir":"/tmp"},2]`, rawParams(requests[1].Params))
+	assert.Equal(t, `[["http://example.com/file"]]`, rawParams(requests[2].Params))
+	assert.Equal(t, `["dG9ycmVudA==",[],{},0]`, rawParams(requests[3].Params))
+}
+
+func TestDownloadWithContext(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.addUri", "2089b05ecca3d829")
+	server.reply("aria2.tellStatus", map[string]string{"gid": "2089b05ecca3d829", "status": "complete"})
+	server.reply("aria2.remove", "2089b05ecca3d829")
+	server.reply("aria2.getFiles", []File{})
+	client := server.dial("")
+
+	// completed
+	done := make(chan error, 1)
+	go func() {
+		status, err := client.DownloadWithContext(context.Background(), URIs("http://example.com/file"), nil)
+		assert.Equal(t, StatusCompleted, status.Status)
+		done <- err
+	}()
+	eventually(t, func() bool { return listenerCount(client) == 3 }, "the download isn't waited for")
+	server.notify("aria2.onDownloadComplete", "2089b05ecca3d829")
+	require.NoError(t, <-done)
+
+	// cancelled, nothing keeps waiting for the download
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, err := client.DownloadWithContext(ctx, URIs("http://example.com/file"), nil)
+		done <- err
+	}()
+	eventually(t, func() bool { return listenerCount(client) == 3 }, "the download isn't waited for")
+	cancel()
+	assert.True(t, errors.Is(<-done, context.Canceled))
+	assert.Zero(t, listenerCount(client))
+
+	var removed bool
+	for _, req := range server.receivedRequests() {
+		removed = removed || req.Method == "aria2.remove"
+	}
+	assert.True(t, removed, "the cancelled download wasn't deleted")
+}
+
+// listenerCount returns the number of event listeners registered on client.
+func listenerCount(client *Client) int {
+	client.evtTarget.mut.RLock()
+	defer client.evtTarget.mut.RUnlock()
+
+	n := 0
+	for _, listeners := range client.evtTarget.listenerMap {
+		n += len(listeners)
+	}
+	return n
+}
+
+func TestAddURIWithContext(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.addUri", "2089b05ecca3d829")
+	server.reply("aria2.forceRemove", "2089b05ecca3d829")
+	var mu sync.Mutex
+	status := "active"
+	server.handle("aria2.tellStatus", func([]json.RawMessage) (interface{}, *mockError) {
+		mu.Lock()
+		defer mu.Unlock()
+		return map[string]string{"gid": "2089b05ecca3d829", "status": status}, nil
+	})
+	client := server.dial("")
+	tieDone := make(chan string, 1)
+	client.tieDone = func(gid string) { tieDone <- gid }
+
+	calls := func(method string) int {
+		n := 0
+		for _, req := range server.receivedRequests() {
+			if req.Method == method {
+				n++
+			}
+		}
+		return n
+	}
+
+	// cancelled before the download completed
+	ctx, cancel := context.WithCancel(context.Background())
+	gid, err := client.AddURIWithContext(ctx, URIs("http://example.com/file"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "2089b05ecca3d829", gid.GID)
+	eventually(t, func() bool { return calls("aria2.tellStatus") == 1 }, "the download isn't watched")
+	assert.Zero(t, calls("aria2.forceRemove"))
+
+	// the client picks the gid
+	var opts map[string]string
+	require.NoError(t, json.Unmarshal(server.receivedRequests()[0].Params[1], &opts))
+	assert.NoError(t, ValidateGID(opts["gid"]))
+
+	cancel()
+	assert.Equal(t, "2089b05ecca3d829", <-tieDone)
+	assert.Equal(t, 1, calls("aria2.forceRemove"))
+
+	// completed before the context was cancelled
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	_, err = client.AddURIWithContext(ctx, URIs("http://example.com/file"), &Options{GID: "d0b0e7c087a1d2ba"})
+	require.NoError(t, err)
+	eventually(t, func() bool { return calls("aria2.tellStatus") == 2 }, "the download isn't watched")
+
+	// a gid passed by the caller is kept
+	for _, req := range server.receivedRequests() {
+		if req.Method == "aria2.addUri" {
+			require.NoError(t, json.Unmarshal(req.Params[1], &opts))
+		}
+	}
+	assert.Equal(t, "d0b0e7c087a1d2ba", opts["gid"])
+
+	mu.Lock()
+	status = "complete"
+	mu.Unlock()
+	server.notify("aria2.onDownloadComplete", "2089b05ecca3d829")
+	assert.Equal(t, "2089b05ecca3d829", <-tieDone)
+
+	// the goroutine has returned, so cancelling doesn't remove the download anymore
+	cancel()
+	assert.Equal(t, 1, calls("aria2.forceRemove"))
+}
+
+func TestAddURIWithContextPurged(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.addUri", "2089b05ecca3d829")
+	server.reply("aria2.forceRemove", "2089b05ecca3d829")
+	var mu sync.Mutex
+	purged := false
+	server.handle("aria2.tellStatus", func([]json.RawMessage) (interface{}, *mockError) {
+		mu.Lock()
+		defer mu.Unlock()
+		if purged {
+			return nil, &mockError{Code: 1, Message: "GID 2089b05ecca3d829 is not found"}
+		}
+		return map[string]string{"gid": "2089b05ecca3d829", "status": "active"}, nil
+	})
+	client := server.dial("")
+	tieDone := make(chan string, 1)
+	client.tieDone = func(gid string) { tieDone <- gid }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := client.AddURIWithContext(ctx, URIs("http://example.com/file"), nil)
+	require.NoError(t, err)
+
+	// the result is purged while the download is watched
+	mu.Lock()
+	purged = true
+	mu.Unlock()
+	server.notify("aria2.onDownloadStop", "2089b05ecca3d829")
+	assert.Equal(t, "2089b05ecca3d829", <-tieDone)
+
+	cancel()
+	for _, req := range server.receivedRequests() {
+		assert.NotEqual(t, "aria2.forceRemove", req.Method, "a purged download must not be removed")
+	}
+}
+
+func TestAddURIWithContextCancelledCall(t *testing.T) {
+	server := newMockServer(t)
+	added := make(chan string, 1)
+	release := make(chan struct{})
+	defer close(release)
+	server.handle("aria2.addUri", func(params []json.RawMessage) (interface{}, *mockError) {
+		var opts map[string]string
+		_ = json.Unmarshal(params[1], &opts)
+		added <- opts["gid"]
+		// aria2 added the download, but the response arrives too late
+		<-release
+		return opts["gid"], nil
+	})
+	server.reply("aria2.forceRemove", "2089b05ecca3d829")
+	client := server.dial("")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-added
+		cancel()
+	}()
+	_, err := client.AddURIWithContext(ctx, URIs("http://example.com/file"), nil)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	var removed []json.RawMessage
+	eventually(t, func() bool {
+		for _, req := range server.receivedRequests() {
+			if req.Method == "aria2.forceRemove" {
+				removed = req.Params
+				return true
+			}
+		}
+		return false
+	}, "the orphaned download wasn't removed")
+
+	var addOpts map[string]string
+	require.NoError(t, json.Unmarshal(server.receivedRequests()[0].Params[1], &addOpts))
+	assert.JSONEq(t, fmt.Sprintf("%q", addOpts["gid"]), string(removed[0]))
+}
+
+func TestAddURIsFromReader(t *testing.T) {
+	server := newMockServer(t)
+	gids := map[string]string{
+		"http://example.com/a":           "2089b05ecca3d829",
+		"http://mirror.example.com/b":    "d2703803b52216d1",
+		"magnet:?xt=urn:btih:248d0a1cd0": "0123456789abcdef",
+	}
+	var received [][]string
+	server.handle("aria2.addUri", func(params []json.RawMessage) (interface{}, *mockError) {
+		var uris []string
+		var options map[string]string
+		if len(params) != 2 || json.Unmarshal(params[0], &uris) != nil || json.Unmarshal(params[1], &options) != nil {
+			return nil, &mockError{Code: 1, Message: "The parameter at 0 has wrong type."}
+		}
+		if options["dir"] != "/downloads" {
+			return nil, &mockError{Code: 1, Message: "options missing"}
+		}
+		received = append(received, uris)
+
+		gid, ok := gids[uris[0]]
+		if !ok {
+			return nil, &mockError{Code: 1, Message: "No URI to download."}
+		}
+		return gid, nil
+	})
+	client := server.dial("")
+
+	input := `# downloads for today
+http://example.com/a
+
+  http://mirror.example.com/b	http://mirror2.example.com/b
+# magnet links work too
+magnet:?xt=urn:btih:248d0a1cd0
+`
+	result, err := client.AddURIsFromReader(strings.NewReader(input), &Options{Dir: "/downloads"})
+	require.NoError(t, err)
+	require.Len(t, result, 3)
+	assert.Equal(t, "2089b05ecca3d829", result[0].GID)
+	assert.Equal(t, "d2703803b52216d1", result[1].GID)
+	assert.Equal(t, "0123456789abcdef", result[2].GID)
+	assert.Equal(t, [][]string{
+		{"http://example.com/a"},
+		{"http://mirror.example.com/b", "http://mirror2.example.com/b"},
+		{"magnet:?xt=urn:btih:248d0a1cd0"},
+	}, received)
+
+	var multicalls int
+	for _, req := range server.receivedRequests() {
+		if req.Method == "system.multicall" {
+			multicalls++
+		}
+	}
+	assert.Equal(t, 1, multicalls)
+
+	result, err = client.AddURIsFromReader(strings.NewReader("http://example.com/a\nunknown://file\n"), &Options{Dir: "/downloads"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+	require.Len(t, result, 2)
+	assert.Equal(t, "2089b05ecca3d829", result[0].GID)
+	assert.Equal(t, "", result[1].GID)
+
+	result, err = client.AddURIsFromReader(strings.NewReader("# nothing\n\n"), nil)
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+}
+
+func TestAddURIIfAbsent(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.tellActive", []interface{}{
+		map[string]interface{}{"gid": "2089b05ecca3d829", "files": []interface{}{
+			map[string]interface{}{"uris": []interface{}{map[string]string{"uri": "http://example.com/active", "status": "used"}}},
+		}},
+	})
+	server.reply("aria2.tellWaiting", []interface{}{
+		map[string]interface{}{"gid": "d2703803b52216d1", "files": []interface{}{
+			map[string]interface{}{"uris": []interface{}{map[string]string{"uri": "http://example.com/waiting", "status": "waiting"}}},
+		}},
+	})
+	server.reply("aria2.addUri", "0123456789abcdef")
+	client := server.dial("")
+
+	gid, added, err := client.AddURIIfAbsent(URIs("http://example.com/active"), nil)
+	require.NoError(t, err)
+	assert.False(t, added)
+	assert.Equal(t, "2089b05ecca3d829", gid.GID)
+
+	gid, added, err = client.AddURIIfAbsent(URIs("http://mirror.example.com/file", "http://example.com/waiting"), nil)
+	require.NoError(t, err)
+	assert.False(t, added)
+	assert.Equal(t, "d2703803b52216d1", gid.GID)
+
+	gid, added, err = client.AddURIIfAbsent(URIs("http://example.com/new"), nil)
+	require.NoError(t, err)
+	assert.True(t, added)
+	assert.Equal(t, "0123456789abcdef", gid.GID)
+
+	var addCalls int
+	for _, req := range server.receivedRequests() {
+		if req.Method == "aria2.addUri" {
+			addCalls++
+		}
+	}
+	assert.Equal(t, 1, addCalls, "existing downloads must not be added again")
+
+	_, _, err = client.AddURIIfAbsent(nil, nil)
+	assert.Equal(t, ErrNoURIs, err)
+}
+
+func TestFindByInfoHash(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.tellActive", []interface{}{
+		map[string]string{"gid": "2089b05ecca3d829"},
+	})
+	server.reply("aria2.tellWaiting", []interface{}{
+		map[string]string{"gid": "d2703803b52216d1", "infoHash": "248d0a1cd08284299de78d5c1ed359bb46717d8c"},
+	})
+	server.reply("aria2.tellStopped", []interface{}{
+		map[string]string{"gid": "0123456789abcdef", "infoHash": "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"},
+	})
+	client := server.dial("")
+
+	gid, err := client.FindByInfoHash("248D0A1CD08284299DE78D5C1ED359BB46717D8C")
+	require.NoError(t, err)
+	assert.Equal(t, "d2703803b52216d1", gid.GID)
+
+	gid, err = client.FindByInfoHash("c12fe1c06bba254a9dc9f519b335aa7c1367a88a")
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef", gid.GID)
+
+	_, err = client.FindByInfoHash("0000000000000000000000000000000000000000")
+	assert.Equal(t, ErrNotFound, err)
+
+	_, err = client.FindByInfoHash("")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestDone(t *testing.T) {
+	server := newMockServer(t)
+	client := server.dial("")
+
+	eventually(t, func() bool { return server.connectionCount() == 1 }, "client didn't connect")
+	assert.True(t, client.IsConnected())
+	assert.NoError(t, client.Err())
+
+	server.dropConnections()
+
+	select {
+	case <-client.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done wasn't closed after the connection was lost")
+	}
+	assert.False(t, client.IsConnected())
+
+	var readErr *ReadError
+	assert.True(t, errors.As(client.Err(), &readErr), "unexpected error %v", client.Err())
+
+	// closing the client afterwards must not panic
+	_ = client.Close()
+}
+
+func TestDoneReconnect(t *testing.T) {
+	server := newMockServer(t)
+	client := server.dial("", WithReconnect(nil))
+
+	eventually(t, func() bool { return server.connectionCount() == 1 }, "client didn't connect")
+	server.dropConnections()
+	eventually(t, func() bool { return server.connectionCount() == 1 && client.IsConnected() }, "client didn't reconnect")
+
+	select {
+	case <-client.Done():
+		t.Fatal("Done was closed although the client reconnected")
+	default:
+	}
+
+	require.NoError(t, client.Close())
+	select {
+	case <-client.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done wasn't closed by Close")
+	}
+	assert.False(t, client.IsConnected())
+	assert.NoError(t, client.Err())
+}
+
+func TestRateLimit(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getVersion", map[string]interface{}{"version": "1.36.0", "enabledFeatures": []string{}})
+
+	client := server.dial("", WithRateLimit(rate.Every(20*time.Millisecond), 2))
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		_, err := client.GetVersion()
+		require.NoError(t, err)
+	}
+	// the burst covers the first two calls, the other four wait for the limiter
+	assert.True(t, time.Since(start) >= 70*time.Millisecond, "calls weren't limited: %v", time.Since(start))
+}
+
+func TestRateLimitDeadline(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getVersion", map[string]interface{}{"version": "1.36.0", "enabledFeatures": []string{}})
+
+	client := server.dial("", WithRateLimit(rate.Every(time.Minute), 1), WithCallTimeout(time.Second))
+
+	_, err := client.GetVersion()
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = client.GetVersion()
+	var timeoutErr *TimeoutError
+	assert.True(t, errors.As(err, &timeoutErr), "unexpected error %v", err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.GetVersionContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	assert.True(t, time.Since(start) < 500*time.Millisecond, "calls waited for the limiter")
+	assert.Len(t, server.receivedRequests(), 1)
+}
+
+func TestCallHooks(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getVersion", map[string]interface{}{"version": "1.36.0", "enabledFeatures": []string{}})
+	server.handle("aria2.tellStatus", func([]json.RawMessage) (interface{}, *mockError) {
+		time.Sleep(100 * time.Millisecond)
+		return map[string]string{}, nil
+	})
+
+	type callEnd struct {
+		method string
+		err    error
+	}
+
+	var mu sync.Mutex
+	var started []string
+	var ended []callEnd
+	hooks := CallHooks{
+		OnCallStart: func(method string) {
+			mu.Lock()
+			defer mu.Unlock()
+			started = append(started, method)
+		},
+		OnCallEnd: func(method string, dur time.Duration, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			assert.True(t, dur > 0)
+			ended = append(ended, callEnd{method, err})
+		},
+	}
+
+	client := server.dial("", WithCallHooks(hooks), WithCallTimeout(20*time.Millisecond))
+
+	_, err := client.GetVersion()
+	require.NoError(t, err)
+	_, err = client.TellStatus("2089b05ecca3d829")
+	require.Error(t, err)
+	_, err = client.GetGlobalStats()
+	require.Error(t, err)
+
+	server.dropConnections()
+	eventually(t, func() bool { return !client.IsConnected() }, "connection wasn't lost")
+	_, err = client.GetVersion()
+	require.Error(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, []string{"aria2.getVersion", "aria2.tellStatus", "aria2.getGlobalStat", "aria2.getVersion"}, started)
+	require.Len(t, ended, 4)
+	assert.NoError(t, ended[0].err)
+	var timeoutErr *TimeoutError
+	assert.True(t, errors.As(ended[1].err, &timeoutErr))
+	assert.True(t, errors.Is(ended[2].err, ErrNoSuchMethod))
+	var readErr *ReadError
+	assert.True(t, errors.As(ended[3].err, &readErr))
+
+	// hooks are optional
+	_, err = server.dial("", WithCallHooks(CallHooks{})).GetVersion()
+	assert.NoError(t, err)
+}
+
+// spanKey is the context key of the span started by the StartSpan hook in TestCallSpans.
+type spanKey struct{}
+
+func TestCallSpans(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getVersion", VersionInfo{Version: "1.36.0"})
+
+	type parentKey struct{}
+	var mu sync.Mutex
+	var spans []CallSpan
+	hooks := CallHooks{
+		StartSpan: func(ctx context.Context, method string) context.Context {
+			return context.WithValue(ctx, spanKey{}, "span "+method)
+		},
+		EndSpan: func(ctx context.Context, span CallSpan) {
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, "span "+span.Method, ctx.Value(spanKey{}), "EndSpan must receive the context of StartSpan")
+			assert.Equal(t, "parent", ctx.Value(parentKey{}), "the span must be derived from the context of the call")
+			assert.True(t, span.Duration > 0)
+			spans = append(spans, span)
+		},
+	}
+	client := server.dial("", WithCallHooks(hooks))
+
+	ctx := context.WithValue(context.Background(), parentKey{}, "parent")
+	_, err := client.GetVersionContext(ctx)
+	require.NoError(t, err)
+	_, err = client.TellStatusContext(ctx, "2089b05ecca3d829")
+	require.Error(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Len(t, spans, 2)
+	assert.Equal(t, "aria2.getVersion", spans[0].Method)
+	assert.NoError(t, spans[0].Err)
+	assert.Zero(t, spans[0].Code)
+	assert.Equal(t, "aria2.tellStatus", spans[1].Method)
+	assert.True(t, errors.Is(spans[1].Err, ErrNoSuchMethod))
+	assert.Equal(t, 1, spans[1].Code, "the aria2 error code must be recorded")
+}
+
+// testLogger records the logged messages.
+type testLogger struct {
+	mu     sync.Mutex
+	debugs []string
+	errors []string
+}
+
+func (l *testLogger) Debugf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.debugs = append(l.debugs, fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) Errorf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) messages() (debugs, errors string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.debugs, "\n"), strings.Join(l.errors, "\n")
+}
+
+func TestLogger(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.tellStatus", map[string]string{"gid": "2089b05ecca3d829", "dir": "/secret/dir"})
+
+	logger := &testLogger{}
+	client := server.dial("secret", WithLogger(logger))
+
+	_, err := client.TellStatus("2089b05ecca3d829")
+	require.NoError(t, err)
+
+	events, unsub := client.SubscribeChan(StartEvent, 1)
+	defer unsub()
+	eventually(t, func() bool { return server.connectionCount() == 1 }, "client didn't connect")
+	server.notify("aria2.onDownloadStart", "2089b05ecca3d829")
+	<-events
+
+	server.dropConnections()
+	<-client.Done()
+
+	debugs, errs := logger.messages()
+	assert.Contains(t, debugs, "arigo: connected to "+server.url())
+	assert.Contains(t, debugs, "arigo: calling aria2.tellStatus")
+	assert.Contains(t, debugs, "arigo: aria2.tellStatus returned after")
+	assert.Contains(t, debugs, "arigo: received StartEvent for 2089b05ecca3d829")
+	assert.Contains(t, errs, "arigo: connection lost")
+	assert.NotContains(t, debugs, "/secret/dir", "payloads must not be logged by default")
+	assert.NotContains(t, debugs, "token:secret")
+
+	_, err = Dial("ws://127.0.0.1:1/jsonrpc", "", WithLogger(logger))
+	require.Error(t, err)
+	_, errs = logger.messages()
+	assert.Contains(t, errs, "arigo: connecting to ws://127.0.0.1:1/jsonrpc failed")
+}
+
+func TestVerboseLogging(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.tellStatus", map[string]string{"gid": "2089b05ecca3d829", "dir": "/secret/dir"})
+
+	logger := &testLogger{}
+	client := server.dial("secret", WithLogger(logger), WithVerboseLogging())
+
+	_, err := client.TellStatus("2089b05ecca3d829")
+	require.NoError(t, err)
+
+	debugs, _ := logger.messages()
+	assert.Contains(t, debugs, `arigo: calling aria2.tellStatus with ["token:[redacted]","2089b05ecca3d829",[]]`)
+	assert.Contains(t, debugs, "/secret/dir")
+	assert.NotContains(t, debugs, "token:secret")
+}
+
+func TestPauseWhere(t *testing.T) {
+	download := func(gid, status, uri, infoHash string) map[string]interface{} {
+		return map[string]interface{}{
+			"gid":      gid,
+			"status":   status,
+			"infoHash": infoHash,
+			"files":    []map[string]interface{}{{"index": "1", "uris": []map[string]string{{"uri": uri, "status": "used"}}}},
+		}
+	}
+
+	server := newMockServer(t)
+	server.reply("aria2.tellActive", []map[string]interface{}{
+		download("0000000000000001", "active", "http://mirror-x.example.com/a", ""),
+		download("0000000000000002", "active", "http://mirror-y.example.com/b", ""),
+		download("0000000000000003", "active", "", "248d0a1cd08284299de78d5c1ed359bb46717d8c"),
+	})
+	server.reply("aria2.tellWaiting", []map[string]interface{}{
+		download("0000000000000004", "waiting", "http://mirror-x.example.com/c", ""),
+		download("0000000000000005", "paused", "http://mirror-x.example.com/d", ""),
+		download("0000000000000006", "paused", "", "c89b0af0a4d4f6d5eb7526b7dd90f7d2ce7e0f12"),
+	})
+
+	var mu sync.Mutex
+	var called []string
+	handle := func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		_ = json.Unmarshal(params[0], &gid)
+
+		mu.Lock()
+		defer mu.Unlock()
+		called = append(called, gid)
+		if gid == "0000000000000004" {
+			return nil, &mockError{Code: 1, Message: "GID#" + gid + " cannot be paused now"}
+		}
+		return gid, nil
+	}
+	server.handle("aria2.pause", handle)
+	server.handle("aria2.unpause", handle)
+	client := server.dial("")
+
+	fromMirrorX := func(status Status) bool {
+		for _, file := range status.Files {
+			for _, uri := range file.URIs {
+				if strings.HasPrefix(uri.URI, "http://mirror-x.example.com/") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	paused, err := client.PauseWhere(fromMirrorX)
+	assert.Error(t, err, "the failed pause must be reported")
+	assert.Equal(t, []string{"0000000000000001"}, paused)
+	mu.Lock()
+	assert.Equal(t, []string{"0000000000000001", "0000000000000004"}, called, "paused downloads must be skipped")
+	called = nil
+	mu.Unlock()
+
+	unpaused, err := client.UnpauseWhere(func(status Status) bool { return status.InfoHash != "" })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0000000000000006"}, unpaused)
+
+	requests := server.receivedRequests()
+	assert.Equal(t, "system.multicall", requests[len(requests)-1].Method, "the actions must be sent in a single multicall")
+
+	// nothing matches, so no action is sent
+	count := len(requests)
+	none, err := client.PauseWhere(func(Status) bool { return false })
+	require.NoError(t, err)
+	assert.Empty(t, none)
+	assert.Len(t, server.receivedRequests(), count+2)
+}
+
+func TestCleanupResults(t *testing.T) {
+	const stoppedCount = 250
+
+	var mu sync.Mutex
+	var stopped []map[string]string
+	for i := 0; i < stoppedCount; i++ {
+		status := "complete"
+		if i%3 == 0 {
+			status = "error"
+		}
+		stopped = append(stopped, map[string]string{"gid": fmt.Sprintf("%016x", i), "status": status})
+	}
+
+	server := newMockServer(t)
+	server.handle("aria2.tellStopped", func(params []json.RawMessage) (interface{}, *mockError) {
+		var offset, num int
+		_ = json.Unmarshal(params[0], &offset)
+		_ = json.Unmarshal(params[1], &num)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if offset > len(stopped) {
+			offset = len(stopped)
+		}
+		end := offset + num
+		if end > len(stopped) {
+			end = len(stopped)
+		}
+		return stopped[offset:end], nil
+	})
+
+	var removed []string
+	server.handle("aria2.removeDownloadResult", func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		_ = json.Unmarshal(params[0], &gid)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if gid == fmt.Sprintf("%016x", 3) {
+			return nil, &mockError{Code: 1, Message: "Could not remove download result of GID#" + gid}
+		}
+		removed = append(removed, gid)
+		return "OK", nil
+	})
+
+	client := server.dial("")
+
+	count, err := client.CleanupResults(func(status Status) bool {
+		return status.Status == StatusError
+	})
+	assert.Error(t, err, "the failed removal must be reported")
+	assert.Equal(t, 83, count)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, removed, 83)
+	for _, gid := range removed {
+		var i int
+		_, _ = fmt.Sscanf(gid, "%x", &i)
+		assert.Equal(t, 0, i%3, "gid %s doesn't match the filter", gid)
+	}
+
+	var pages int
+	for _, req := range server.receivedRequests() {
+		if req.Method == "aria2.tellStopped" {
+			pages++
+		}
+	}
+	assert.Equal(t, 3, pages)
+}
+
+func TestWaitForDownloads(t *testing.T) {
+	var mu sync.Mutex
+	states := map[string]string{
+		"2089b05ecca3d829": "complete",
+		"d2703803b52216d1": "active",
+		"0123456789abcdef": "waiting",
+	}
+	setState := func(gid, state string) {
+		mu.Lock()
+		defer mu.Unlock()
+		states[gid] = state
+	}
+
+	server := newMockServer(t)
+	server.handle("aria2.tellStatus", func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		_ = json.Unmarshal(params[0], &gid)
+
+		mu.Lock()
+		defer mu.Unlock()
+		return map[string]string{"gid": gid, "status": states[gid]}, nil
+	})
+	client := server.dial("")
+	eventually(t, func() bool { return server.connectionCount() == 1 }, "client didn't connect")
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		setState("d2703803b52216d1", "error")
+		server.notify("aria2.onDownloadError", "d2703803b52216d1")
+
+		time.Sleep(20 * time.Millisecond)
+		setState("0123456789abcdef", "complete")
+		server.notify("aria2.onDownloadComplete", "0123456789abcdef")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	statuses, err := client.WaitForDownloads(ctx, "2089b05ecca3d829", "d2703803b52216d1", "0123456789abcdef")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Status{
+		"2089b05ecca3d829": {GID: "2089b05ecca3d829", Status: StatusCompleted},
+		"d2703803b52216d1": {GID: "d2703803b52216d1", Status: StatusError},
+		"0123456789abcdef": {GID: "0123456789abcdef", Status: StatusCompleted},
+	}, statuses)
+}
+
+func TestWaitForDownloadsCancel(t *testing.T) {
+	server := newMockServer(t)
+	server.handle("aria2.tellStatus", func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		_ = json.Unmarshal(params[0], &gid)
+		if gid == "2089b05ecca3d829" {
+			return map[string]string{"gid": gid, "status": "removed"}, nil
+		}
+		return map[string]string{"gid": gid, "status": "active"}, nil
+	})
+	client := server.dial("")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	statuses, err := client.WaitForDownloads(ctx, "2089b05ecca3d829", "d2703803b52216d1")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, map[string]Status{"2089b05ecca3d829": {GID: "2089b05ecca3d829", Status: StatusRemoved}}, statuses)
+
+	_, err = client.WaitForDownloads(context.Background(), "invalid")
+	assert.True(t, errors.Is(err, ErrInvalidGID))
+}
+
+func TestWaitForDownloadsMulticall(t *testing.T) {
+	server := newMockServer(t)
+	server.handle("aria2.tellStatus", func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		_ = json.Unmarshal(params[0], &gid)
+		return map[string]string{"gid": gid, "status": "complete"}, nil
+	})
+	client := server.dial("")
+
+	gids := make([]string, 100)
+	for i := range gids {
+		gids[i] = fmt.Sprintf("%016x", i)
+	}
+
+	statuses, err := client.WaitForDownloads(context.Background(), gids...)
+	require.NoError(t, err)
+	assert.Len(t, statuses, len(gids))
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "system.multicall", requests[0].Method)
+}
+
+func TestWaitForDownloadsOtherEvents(t *testing.T) {
+	server := newMockServer(t)
+	var calls int32
+	checking := make(chan struct{})
+	release := make(chan struct{})
+	server.handle("aria2.tellStatus", func([]json.RawMessage) (interface{}, *mockError) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return map[string]string{"gid": "2089b05ecca3d829", "status": "active"}, nil
+		}
+		close(checking)
+		<-release
+		return map[string]string{"gid": "2089b05ecca3d829", "status": "complete"}, nil
+	})
+	client := server.dial("")
+	var releaseOnce sync.Once
+	unblock := func() { releaseOnce.Do(func() { close(release) }) }
+	t.Cleanup(unblock)
+
+	var stopped int32
+	client.Subscribe(StopEvent, func(*DownloadEvent) { atomic.AddInt32(&stopped, 1) })
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.WaitForDownloads(context.Background(), "2089b05ecca3d829")
+		done <- err
+	}()
+	eventually(t, func() bool { return atomic.LoadInt32(&calls) == 1 }, "initial status wasn't fetched")
+
+	// the check triggered by the event blocks, while other downloads keep stopping
+	server.notify("aria2.onDownloadComplete", "2089b05ecca3d829")
+	<-checking
+	for i := 0; i < 10; i++ {
+		server.notify("aria2.onDownloadStop", "d2703803b52216d1")
+	}
+	eventually(t, func() bool { return atomic.LoadInt32(&stopped) == 10 }, "events weren't dispatched")
+
+	events := make(chan *DownloadEvent, 1)
+	subscribed := make(chan struct{})
+	go func() {
+		unsub := client.Subscribe(StopEvent, func(event *DownloadEvent) {
+			select {
+			case events <- event:
+			default:
+			}
+		})
+		defer unsub()
+		close(subscribed)
+		<-release
+	}()
+	select {
+	case <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("events of other downloads block the subscriptions")
+	}
+
+	server.notify("aria2.onDownloadStop", "d2703803b52216d1")
+	select {
+	case <-events:
+	case <-time.After(time.Second):
+		t.Fatal("events of other downloads block the dispatch")
+	}
+
+	unblock()
+	require.NoError(t, <-done)
+}
+
+func BenchmarkWaitForDownloads(b *testing.B) {
+	server := newMockServer(b)
+	server.handle("aria2.tellStatus", func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		_ = json.Unmarshal(params[0], &gid)
+		return map[string]string{"gid": gid, "status": "complete"}, nil
+	})
+	client := server.dial("")
+
+	gids := make([]string, 500)
+	for i := range gids {
+		gids[i] = fmt.Sprintf("%016x", i)
+	}
+
+	b.Run("multicall", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := client.WaitForDownloads(context.Background(), gids...); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	// the initial check as it was done before, using a call per download
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, gid := range gids {
+				if _, err := client.TellStatus(GIDString(gid)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+// newConnectProxy starts a proxy which tunnels CONNECT requests and counts them.
+func newConnectProxy(t *testing.T) (*httptest.Server, *int32) {
+	var tunnels int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer target.Close()
+
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		atomic.AddInt32(&tunnels, 1)
+		_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+		done := make(chan struct{}, 2)
+		go func() { _, _ = io.Copy(target, conn); done <- struct{}{} }()
+		go func() { _, _ = io.Copy(conn, target); done <- struct{}{} }()
+		<-done
+	}))
+	t.Cleanup(proxy.Close)
+
+	return proxy, &tunnels
+}
+
+func TestProxy(t *testing.T) {
+	proxy, tunnels := newConnectProxy(t)
+
+	for _, server := range []*mockServer{newMockServer(t), newMockTLSServer(t)} {
+		server.reply("aria2.getVersion", map[string]interface{}{"version": "1.36.0", "enabledFeatures": []string{}})
+
+		pool := x509.NewCertPool()
+		if cert := server.server.Certificate(); cert != nil {
+			pool.AddCert(cert)
+		}
+
+		t.Run(server.url(), func(t *testing.T) {
+			before := atomic.LoadInt32(tunnels)
+
+			client, err := Dial(server.url(), "", WithProxy(proxy.URL), WithTLSConfig(&tls.Config{RootCAs: pool}))
+			require.NoError(t, err)
+			defer client.Close()
+
+			version, err := client.GetVersion()
+			require.NoError(t, err)
+			assert.Equal(t, "1.36.0", version.Version)
+			assert.Equal(t, before+1, atomic.LoadInt32(tunnels), "the connection didn't go through the proxy")
+		})
+	}
+
+	_, err := Dial("ws://localhost:6800/jsonrpc", "", WithProxy("://invalid"))
+	assert.Error(t, err)
+}
+
+func TestPing(t *testing.T) {
+	server := newMockServer(t)
+	server.requireSecret("secret")
+	server.handle("aria2.getVersion", func([]json.RawMessage) (interface{}, *mockError) {
+		time.Sleep(10 * time.Millisecond)
+		return map[string]interface{}{"version": "1.36.0", "enabledFeatures": []string{}}, nil
+	})
+
+	client := server.dial("secret")
+	latency, err := client.Ping(context.Background())
+	require.NoError(t, err)
+	assert.True(t, latency >= 10*time.Millisecond, "latency %v is too low", latency)
+
+	_, err = server.dial("wrong").Ping(context.Background())
+	assert.True(t, errors.Is(err, ErrUnauthorized), "unexpected error %v", err)
+
+	server.dropConnections()
+	eventually(t, func() bool { return !client.IsConnected() }, "connection wasn't lost")
+	_, err = client.Ping(context.Background())
+	assert.Error(t, err)
+}
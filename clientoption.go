@@ -0,0 +1,653 @@
+package arigo
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Braurbeki/arigo/internal/pkg/jsonrpc"
+	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+)
+
+// ClientOption configures a Client.
+// ClientOptions are passed to Dial and DialContext.
+type ClientOption func(*clientConfig)
+
+// clientConfig holds the configuration assembled from ClientOptions.
+type clientConfig struct {
+	dialer      websocket.Dialer
+	header      http.Header
+	readLimit   int64
+	secret      string
+	callTimeout time.Duration
+
+	// subprotocolRequired is set if the server must select one of dialer.Subprotocols.
+	subprotocolRequired bool
+	// compressThreshold is the size from which messages are compressed, 0 compresses all messages.
+	compressThreshold int
+	// writeTimeout bounds the time writing a message may take, 0 means there's no limit.
+	writeTimeout time.Duration
+	// maxPendingWrites bounds the calls waiting for their request to be written, 0 means there's no limit.
+	maxPendingWrites int
+
+	// observer is called for every message, see WithMessageObserver.
+	// Messages larger than largeMessage are logged, 0 disables the warning.
+	observer     func(direction MessageDirection, size int)
+	largeMessage int
+
+	limiter *rate.Limiter
+	hooks   CallHooks
+
+	retry        RetryPolicy
+	retryMethods map[string]bool
+
+	logger  Logger
+	verbose bool
+
+	// strictOptions is set if changed options are read back, see WithStrictOptions.
+	strictOptions bool
+	// defaultParams are appended to the params of the calls of their method, see WithDefaultParams.
+	defaultParams map[string][]interface{}
+
+	encoding     JSONEncoding
+	interceptors jsonrpc.Interceptors
+
+	// version is the JSON-RPC version of the requests, see WithProtocolVersion.
+	version ProtocolVersion
+
+	// err is set by options which received an invalid argument, DialContext returns it.
+	err error
+
+	reconnect bool
+	backoff   BackoffPolicy
+
+	// resync is set if the downloads are resynced after reconnecting, see WithResyncOnReconnect.
+	resync bool
+
+	// dialAttempts is the number of attempts to establish the initial connection,
+	// 0 means there's no limit.
+	dialAttempts int
+	dialBackoff  BackoffPolicy
+
+	// transport replaces the connection to the url passed to DialContext if it's set.
+	transport Transport
+}
+
+func newClientConfig(opts []ClientOption) *clientConfig {
+	cfg := &clientConfig{logger: noopLogger{}, encoding: jsonrpc.StdEncoding, version: ProtocolVersion2, dialAttempts: 1}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithHandshakeTimeout limits the time the WebSocket handshake may take.
+// Without it, the handshake is only bounded by the context passed to DialContext.
+func WithHandshakeTimeout(timeout time.Duration) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.dialer.HandshakeTimeout = timeout
+	}
+}
+
+// WithCompression requests permessage-deflate compression during the WebSocket handshake.
+// Compression is only used if the server agrees to it, otherwise messages are sent uncompressed.
+// Client.CompressionEnabled reports whether it did.
+func WithCompression() ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.dialer.EnableCompression = true
+	}
+}
+
+// WithCompressionThreshold is like WithCompression but only messages of at least threshold bytes
+// are compressed, like the base64 encoded payloads of AddTorrent and AddMetalink.
+// Small, frequent calls like TellStatus are sent uncompressed, which saves the cost of compressing them.
+func WithCompressionThreshold(threshold int) ClientOption {
+	return func(cfg *clientConfig) {
+		if threshold < 0 {
+			cfg.err = fmt.Errorf("invalid compression threshold %d", threshold)
+			return
+		}
+		cfg.dialer.EnableCompression = true
+		cfg.compressThreshold = threshold
+	}
+}
+
+// WithSubprotocols requests the WebSocket subprotocols during the handshake, in order of preference.
+// Some gateways in front of aria2 require a specific subprotocol. The connection is established
+// even if the server doesn't select any of them, Client.Subprotocol returns the selected one.
+func WithSubprotocols(protocols ...string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.dialer.Subprotocols = protocols
+	}
+}
+
+// WithRequiredSubprotocols is like WithSubprotocols but Dial fails with ErrSubprotocolNotSelected
+// if the server doesn't select one of the protocols. A reconnecting client treats such
+// a connection like a failed attempt.
+func WithRequiredSubprotocols(protocols ...string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.dialer.Subprotocols = protocols
+		cfg.subprotocolRequired = true
+	}
+}
+
+// WithReadBufferSize sets the size in bytes of the read buffer of the WebSocket connection.
+// The default of 4096 bytes may be lowered to save memory on constrained devices.
+// The buffer size doesn't limit the size of the messages which can be received.
+func WithReadBufferSize(size int) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.dialer.ReadBufferSize = size
+	}
+}
+
+// WithWriteBufferSize sets the size in bytes of the write buffer of the WebSocket connection.
+// The default is 4096 bytes.
+func WithWriteBufferSize(size int) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.dialer.WriteBufferSize = size
+	}
+}
+
+// WithReadLimit limits the size in bytes of the messages received over the WebSocket connection.
+// If aria2 sends a larger message, the connection is closed and the pending calls
+// fail with a *ReadLimitError. By default, there's no limit.
+// The limit doesn't apply to clients using HTTP.
+func WithReadLimit(limit int64) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.readLimit = limit
+	}
+}
+
+// WithWriteTimeout limits the time writing a single message to the WebSocket connection may take.
+// If aria2 stops reading and the socket buffers are full, the call fails with a *WriteTimeoutError
+// instead of blocking, and the connection is unusable afterwards.
+// It's independent of WithCallTimeout, which also includes waiting for the response.
+// The timeout doesn't apply to clients using HTTP.
+func WithWriteTimeout(timeout time.Duration) ClientOption {
+	return func(cfg *clientConfig) {
+		if timeout < 0 {
+			cfg.err = fmt.Errorf("invalid write timeout %v", timeout)
+			return
+		}
+		cfg.writeTimeout = timeout
+	}
+}
+
+// WithMaxPendingWrites bounds the number of calls whose request is waiting to be written to n.
+// Requests are written one at a time, so if aria2 is slow to read, calls queue up behind the
+// one being written. Once n requests are waiting, a new call blocks until one of them was
+// written instead of adding to the queue. n of 0 lifts the bound, which is the default.
+//
+// A call blocked on a full queue counts towards its timeout: it fails with a *TimeoutError
+// if the call timeout expires first, or with the context's error if the context passed to a
+// method ending in Context is done first. Its request is never sent in that case.
+// A MultiCall counts as a single call. The bound doesn't apply to clients created using WithTransport.
+func WithMaxPendingWrites(n int) ClientOption {
+	return func(cfg *clientConfig) {
+		if n < 0 {
+			cfg.err = fmt.Errorf("invalid number of pending writes %d", n)
+			return
+		}
+		cfg.maxPendingWrites = n
+	}
+}
+
+// WithMessageObserver makes the client call observer with the size in bytes of every message
+// received from and sent to aria2, for example to collect metrics for tuning the read limit or
+// deciding whether compression is worth it. A nil observer is ignored.
+// observer is called by the goroutines reading and writing the messages, it must not block.
+//
+// The observer applies to WebSocket connections only.
+func WithMessageObserver(observer func(direction MessageDirection, size int)) ClientOption {
+	return func(cfg *clientConfig) {
+		if observer != nil {
+			cfg.observer = observer
+		}
+	}
+}
+
+// WithLargeMessageWarning makes the client log messages larger than threshold bytes using the
+// Errorf method of its Logger. Large messages usually are file lists of big torrents or long
+// lists of downloads, which may warrant compression or paging.
+// A threshold of 0 disables the warning, which is the default.
+//
+// The warning applies to WebSocket connections only.
+func WithLargeMessageWarning(threshold int) ClientOption {
+	return func(cfg *clientConfig) {
+		if threshold < 0 {
+			cfg.err = fmt.Errorf("invalid large message threshold %d", threshold)
+			return
+		}
+		cfg.largeMessage = threshold
+	}
+}
+
+// messageObserver returns the message observer for the connections to url,
+// or nil if the messages aren't observed.
+func (cfg *clientConfig) messageObserver(url string) func(direction MessageDirection, size int) {
+	if cfg.largeMessage == 0 {
+		return cfg.observer
+	}
+
+	threshold, observer, logger := cfg.largeMessage, cfg.observer, cfg.logger
+	return func(direction MessageDirection, size int) {
+		if size > threshold {
+			logger.Errorf("arigo: %s message of %d bytes exceeds %d bytes on %s", direction, size, threshold, url)
+		}
+		if observer != nil {
+			observer(direction, size)
+		}
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used for wss:// and https:// urls.
+// It can be used to trust a private CA by setting RootCAs, to pin certificates
+// using VerifyPeerCertificate, or to present a client certificate.
+//
+// Setting InsecureSkipVerify disables the verification of the server's certificate.
+// Anyone able to intercept the connection can then impersonate aria2 and read the
+// secret token and all calls, so it should only ever be used for development.
+func WithTLSConfig(tlsConfig *tls.Config) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.dialer.TLSClientConfig = tlsConfig
+	}
+}
+
+// WithHeader adds a header which is sent with the WebSocket handshake,
+// or with every request if the client uses HTTP.
+// It can be used to authenticate with a reverse proxy in front of aria2.
+// Using it multiple times with the same key sends all values.
+func WithHeader(key, value string) ClientOption {
+	return func(cfg *clientConfig) {
+		if cfg.header == nil {
+			cfg.header = make(http.Header)
+		}
+		cfg.header.Add(key, value)
+	}
+}
+
+// WithHTTPHeaders is like WithHeader but adds all values of header.
+func WithHTTPHeaders(header http.Header) ClientOption {
+	return func(cfg *clientConfig) {
+		for key, values := range header {
+			for _, value := range values {
+				WithHeader(key, value)(cfg)
+			}
+		}
+	}
+}
+
+// WithProxy makes the client connect to aria2 through the proxy at proxyURL.
+// WebSocket connections are tunneled using the CONNECT method for both ws:// and wss:// urls.
+// Dial and DialContext fail if proxyURL can't be parsed.
+func WithProxy(proxyURL string) ClientOption {
+	return func(cfg *clientConfig) {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			cfg.err = fmt.Errorf("invalid proxy url: %w", err)
+			return
+		}
+		WithProxyFunc(http.ProxyURL(u))(cfg)
+	}
+}
+
+// WithProxyFunc is like WithProxy but calls proxy to determine the proxy for each connection.
+// proxy works like http.Transport.Proxy, returning a nil url means no proxy is used.
+// http.ProxyFromEnvironment can be passed to use the proxy configured by the environment.
+func WithProxyFunc(proxy func(*http.Request) (*url.URL, error)) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.dialer.Proxy = proxy
+	}
+}
+
+// WithSecret sets the secret token configured on aria2 using --rpc-secret.
+// The token is sent with every call, including each call of a MultiCall.
+// It takes precedence over the authToken passed to Dial or DialContext.
+// Calls which aria2 rejected because of a wrong token fail with an error matching ErrUnauthorized.
+func WithSecret(token string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.secret = token
+	}
+}
+
+// WithCallTimeout limits the time every call may take to d.
+// A call which doesn't receive a response in time fails with a *TimeoutError.
+// The timeout can be overridden for a single call by passing a context with a deadline
+// to one of the methods ending in Context, the deadline of the context is used instead.
+//
+// A timed out call may still be executed by aria2, its response is discarded once it arrives.
+func WithCallTimeout(d time.Duration) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.callTimeout = d
+	}
+}
+
+// WithRateLimit limits the rate of outgoing calls to r calls per second,
+// allowing bursts of up to burst calls. A burst smaller than 1 is treated as 1.
+// Notifications sent by aria2 aren't affected.
+//
+// A call waiting for the limiter counts towards its timeout: it fails with a *TimeoutError
+// if it can't be sent before the call timeout expires, or with the context's error
+// if the context passed to a method ending in Context is done first.
+// The wait is skipped entirely if the deadline can't be met anyway.
+// A MultiCall counts as a single call.
+func WithRateLimit(r rate.Limit, burst int) ClientOption {
+	if burst < 1 {
+		burst = 1
+	}
+	return func(cfg *clientConfig) {
+		cfg.limiter = rate.NewLimiter(r, burst)
+	}
+}
+
+// CallHooks are called around every call made by a Client, for example to collect metrics.
+// Any hook may be nil. The hooks are called from the goroutine making the call,
+// so they must be safe for concurrent use and should return quickly.
+type CallHooks struct {
+	// OnCallStart is called before the call is made, including the wait for the rate limiter.
+	OnCallStart func(method string)
+	// OnCallEnd is called exactly once for every call which was started,
+	// with the time the call took and the error returned to the caller, if any.
+	// This includes calls which timed out or failed because of the connection.
+	OnCallEnd func(method string, dur time.Duration, err error)
+
+	// StartSpan is called before OnCallStart with the context of the call, which is
+	// context.Background() for the methods not ending in Context. The call uses the returned
+	// context, so a tracer can start a span and attach it to the context. It must not return nil.
+	StartSpan func(ctx context.Context, method string) context.Context
+	// EndSpan is called after OnCallEnd with the context returned by StartSpan,
+	// for example to end the span and record the outcome of the call.
+	EndSpan func(ctx context.Context, span CallSpan)
+}
+
+// CallSpan describes a finished call, see CallHooks.EndSpan.
+// Retries of the call are part of the same span.
+type CallSpan struct {
+	Method   string
+	Duration time.Duration
+	// Err is the error returned to the caller, nil if the call succeeded.
+	Err error
+	// Code is the code of the aria2 error if Err is an *RPCError, 0 otherwise.
+	Code int
+}
+
+// WithCallHooks registers hooks which are called around every call.
+// A MultiCall is reported as a single call of system.multicall.
+func WithCallHooks(hooks CallHooks) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.hooks = hooks
+	}
+}
+
+// WithLogger makes the client log connects, reconnects, the methods of the calls it makes and
+// of the notifications it receives, as well as transport errors to logger.
+// Payloads are only logged if WithVerboseLogging is used as well.
+// By default, nothing is logged.
+func WithLogger(logger Logger) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.logger = logger
+	}
+}
+
+// WithVerboseLogging makes the client log the parameters and results of all calls using Debugf.
+// The secret token is redacted, but the payloads may still contain sensitive data such as
+// the credentials in download uris. It has no effect without WithLogger.
+func WithVerboseLogging() ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.verbose = true
+	}
+}
+
+// WithStrictOptions makes the client verify the options changed by ChangeOption, ChangeOptions,
+// ChangeGlobalOption and ChangeGlobalOptions. aria2 silently ignores options it doesn't know,
+// so after a change the options are read back and the call fails with ErrOptionsNotApplied
+// if any of the changed options is missing, for example because of a typo in the key.
+//
+// Only the presence of the options is checked, not their values, since aria2 normalizes
+// some of them. Options changed to an empty string are skipped, aria2 doesn't report them.
+// Every change takes an additional call.
+func WithStrictOptions() ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.strictOptions = true
+	}
+}
+
+// WithJSONEncoding makes the client encode and decode all messages using encoding
+// instead of encoding/json, for example to plug in a faster JSON library.
+// A nil encoding is ignored.
+func WithJSONEncoding(encoding JSONEncoding) ClientOption {
+	return func(cfg *clientConfig) {
+		if encoding != nil {
+			cfg.encoding = encoding
+		}
+	}
+}
+
+// WithProtocolVersion sets the JSON-RPC version of the requests sent by the client.
+// By default, requests are JSON-RPC 2.0 envelopes. ProtocolVersion1 is meant for
+// proxies and older servers which expect JSON-RPC 1.0. Responses of both versions are accepted.
+//
+// The version applies to the WebSocket and HTTP connections, not to a transport set using WithTransport.
+func WithProtocolVersion(version ProtocolVersion) ClientOption {
+	return func(cfg *clientConfig) {
+		if version != ProtocolVersion1 && version != ProtocolVersion2 {
+			cfg.err = fmt.Errorf("invalid protocol version %q", version)
+			return
+		}
+		cfg.version = version
+	}
+}
+
+// WithDefaultParams makes the client append params to the parameters of every call of method,
+// after the secret token and the parameters of the call, for aria2-compatible servers which expect
+// additional parameters like a trailing context. It applies to calls made using the methods of the
+// client and Call, to notifications sent using Notify, and to the calls of method inside a MultiCall.
+// It doesn't apply to system.multicall itself unless that's the method.
+// Using it again for the same method replaces its params, no params remove them.
+func WithDefaultParams(method string, params ...interface{}) ClientOption {
+	return func(cfg *clientConfig) {
+		if cfg.defaultParams == nil {
+			cfg.defaultParams = make(map[string][]interface{})
+		}
+		if len(params) == 0 {
+			delete(cfg.defaultParams, method)
+			return
+		}
+		cfg.defaultParams[method] = append([]interface{}(nil), params...)
+	}
+}
+
+// WithRequestInterceptor makes the client pass the envelope of every request and notification to
+// interceptor before it's written, which may log, modify or validate it. Fields added to the
+// envelope are sent alongside the method, params and id, for aria2-compatible servers which expect them.
+// If interceptor returns an error, the message isn't sent and the call fails with the error.
+// A request must keep an id, calls whose id was cleared fail without being sent.
+// A nil interceptor is ignored.
+//
+// The params include the secret token of the client as their first element, interceptors
+// which log requests should redact it.
+//
+// If the option is passed multiple times, the interceptors run in the order they were passed,
+// until one of them returns an error.
+// Interceptors run on the WebSocket and HTTP connections, not on a transport set using WithTransport.
+func WithRequestInterceptor(interceptor func(req *Request) error) ClientOption {
+	return func(cfg *clientConfig) {
+		if interceptor == nil {
+			return
+		}
+		if previous := cfg.interceptors.Request; previous != nil {
+			cfg.interceptors.Request = func(req *Request) error {
+				if err := previous(req); err != nil {
+					return err
+				}
+				return interceptor(req)
+			}
+			return
+		}
+		cfg.interceptors.Request = interceptor
+	}
+}
+
+// WithResponseInterceptor makes the client pass the envelope of every response to interceptor,
+// before it's matched to its call. Changes made by interceptor are seen by the call.
+// A nil interceptor is ignored.
+// If the option is passed multiple times, the interceptors run in the order they were passed.
+func WithResponseInterceptor(interceptor func(resp *Response)) ClientOption {
+	return func(cfg *clientConfig) {
+		if interceptor == nil {
+			return
+		}
+		if previous := cfg.interceptors.Response; previous != nil {
+			cfg.interceptors.Response = func(resp *Response) {
+				previous(resp)
+				interceptor(resp)
+			}
+			return
+		}
+		cfg.interceptors.Response = interceptor
+	}
+}
+
+// WithRetry makes the client try failed calls again as decided by policy, see RetryTransient.
+// By default only the methods which don't change any state are retried:
+// TellStatus, GetURIs, GetFiles, GetPeers, GetServers, GetOptions, TellActive,
+// TellWaiting, TellStopped, GetGlobalOptions, GetGlobalStats, GetVersion, GetSessionInfo,
+// and the system.listMethods and system.listNotifications methods.
+// Other methods may run twice if a response was lost, they're only retried after passing
+// them to WithRetryMethods.
+//
+// Every attempt is bounded by the call timeout on its own, the retries end once the
+// context of the call is done or the client is closed.
+func WithRetry(policy RetryPolicy) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.retry = policy
+	}
+}
+
+// WithRetryMethods makes the client retry the given aria2 methods in addition to the ones
+// retried by default, for example aria2proto.AddURI. It has no effect without WithRetry.
+func WithRetryMethods(methods ...string) ClientOption {
+	return func(cfg *clientConfig) {
+		if cfg.retryMethods == nil {
+			cfg.retryMethods = make(map[string]bool)
+		}
+		for _, method := range methods {
+			cfg.retryMethods[method] = true
+		}
+	}
+}
+
+// WithReconnect makes the client reconnect whenever the connection to aria2 is lost.
+// backoff determines the time to wait before each attempt, see ConstantBackoff and
+// ExponentialBackoff. If it's nil or NoBackoff the client reconnects immediately.
+// The client keeps trying until it succeeds or is closed.
+//
+// Calls which are in-flight when the connection is lost, or are made before the client has
+// reconnected, fail with ErrConnectionLost. The client never resends a call on its own,
+// so every call is delivered at most once. Note that a call which failed with ErrConnectionLost
+// may or may not have been executed by aria2, it's up to the caller to decide whether
+// retrying it is safe.
+//
+// The secret token is sent with every call and the event subscriptions are kept by the client,
+// so both carry over to the new connection. Notifications sent by aria2 while the client was
+// disconnected are lost, see WithResyncOnReconnect to make up for them.
+//
+// Reconnecting is only supported for clients created by Dial or DialContext.
+func WithReconnect(backoff BackoffPolicy) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.reconnect = true
+		cfg.backoff = backoff
+	}
+}
+
+// WithResyncOnReconnect makes a client created using WithReconnect make up for the notifications
+// lost while it was disconnected. The client keeps track of the status of all downloads, and once
+// it reconnected, it fetches the status of the active, waiting and stopped downloads and dispatches
+// an event for every download whose status changed in the meantime, for example a CompleteEvent
+// for a download which completed during the outage. Their Resynced field tells them apart from
+// the events sent by aria2. Client.Resynced reports when the statuses were fetched first.
+//
+// Resyncing is best-effort: the events are dispatched once the status was fetched, so a complete
+// or error event may arrive slightly late, and an event may be dispatched twice if aria2 sends
+// the notification while the status is fetched. BTCompleteEvents can't be recovered.
+// Downloads whose result was purged in the meantime are missed.
+// It costs a few calls per connection, which grow with the number of downloads.
+//
+// It has no effect without WithReconnect and on clients using HTTP.
+func WithResyncOnReconnect() ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.resync = true
+	}
+}
+
+// WithDialRetry makes Dial and DialContext retry the initial connection attempt
+// if it fails, for example because aria2 hasn't started yet.
+// attempts is the total number of attempts, if it's 0 or less DialContext keeps trying
+// until it succeeds or the context is done. backoff determines the time to wait before
+// each retry, attempt 0 is the first retry. If it's nil, the client waits 100ms before the
+// first retry and doubles the wait up to 5s, use NoBackoff to retry immediately.
+//
+// Once the context is done, DialContext returns the error of the last attempt.
+// This only applies to the initial connection, see WithReconnect for connections
+// which are lost later on.
+func WithDialRetry(attempts int, backoff BackoffPolicy) ClientOption {
+	return func(cfg *clientConfig) {
+		if attempts < 0 {
+			attempts = 0
+		}
+		if backoff == nil {
+			backoff = defaultDialBackoff
+		}
+		cfg.dialAttempts = attempts
+		cfg.dialBackoff = backoff
+	}
+}
+
+// defaultDialBackoff is used by WithDialRetry if no backoff is passed,
+// so a client waiting for aria2 to start doesn't retry in a busy loop.
+var defaultDialBackoff BackoffPolicy = ExponentialBackoff{Initial: 100 * time.Millisecond, Max: 5 * time.Second}
+
+// WithTransport makes the client use transport instead of connecting to the url passed to Dial,
+// which is ignored then. It's meant for injecting a mock transport in unit tests, see package arigotest.
+// The options configuring the connection, like WithReconnect or WithHeader, don't affect the transport.
+func WithTransport(transport Transport) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.transport = transport
+	}
+}
+
+// WithDryRun makes the client record its calls instead of sending them, see Client.RecordedCalls.
+// No connection is established and the url passed to Dial is ignored. It's meant for unit testing
+// code which orchestrates downloads without running aria2 or a mock server.
+//
+// The calls succeed with zero values as their result. Only the responses the client verifies
+// are answered like aria2 would, for example Pause returns nil and MultiCall returns a result per call.
+// The client can't receive notifications in a dry run, like a client using HTTP.
+func WithDryRun() ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.transport = new(dryRunTransport)
+	}
+}
+
+// httpClient returns the http.Client used for http:// and https:// urls.
+func (cfg *clientConfig) httpClient() *http.Client {
+	if cfg.dialer.TLSClientConfig == nil && cfg.dialer.Proxy == nil {
+		return nil
+	}
+
+	proxy := cfg.dialer.Proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           proxy,
+			TLSClientConfig: cfg.dialer.TLSClientConfig,
+		},
+	}
+}
@@ -0,0 +1,200 @@
+package arigo
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/Braurbeki/arigo/pkg/aria2proto"
+	"github.com/cenkalti/rpc2"
+)
+
+// unknownNotification is the method connCodec routes notifications to
+// which aren't sent by aria2, see isAria2Notification.
+const unknownNotification = "arigo.unknownNotification"
+
+// connCodecKey is the key of the connCodec in the State of the rpc2 clients created by newRPCClient.
+const connCodecKey = "arigo.connCodec"
+
+// subprotocolKey is the key of the negotiated WebSocket subprotocol in the State of the rpc2 clients.
+const subprotocolKey = "arigo.subprotocol"
+
+// compressionKey is the key of the flag in the State of the rpc2 clients which is set
+// if compression was negotiated for the WebSocket connection.
+const compressionKey = "arigo.compression"
+
+// wsKey is the key of the *wsrpc.ReadWriteCloser of the WebSocket connection
+// in the State of the rpc2 clients.
+const wsKey = "arigo.ws"
+
+// ReadError is returned by calls which failed because the connection to aria2 broke down
+// while reading a message, for example because of a malformed message or a transport error.
+// Once the connection broke down, every following call fails with the same error right away,
+// until the client reconnects.
+type ReadError struct {
+	Err error
+}
+
+func (e *ReadError) Error() string {
+	return "connection failed: " + e.Err.Error()
+}
+
+// Unwrap returns the error which ended the connection.
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// connCodec wraps the codec of a connection.
+// It records the error which ended the read loop of the rpc2 client
+// and turns panics while reading a message into such an error.
+type connCodec struct {
+	rpc2.Codec
+
+	mu  sync.Mutex
+	err error
+	// shutdownSent is set once a shutdown request was written, see hasSentShutdown.
+	shutdownSent bool
+
+	// method is the name of the unknown notification whose body is read next.
+	method string
+}
+
+// newRPCClient creates an rpc2 client which records the error ending its read loop,
+// see connErr.
+func newRPCClient(codec rpc2.Codec) *rpc2.Client {
+	cc := &connCodec{Codec: codec}
+
+	rpcClient := rpc2.NewClientWithCodec(cc)
+	rpcClient.State = rpc2.NewState()
+	rpcClient.State.Set(connCodecKey, cc)
+	return rpcClient
+}
+
+// connErr returns the error which ended the read loop of rpcClient, or nil if it's still running.
+// It always returns nil for rpc2 clients which weren't created by newRPCClient.
+func connErr(rpcClient *rpc2.Client) error {
+	if rpcClient == nil || rpcClient.State == nil {
+		return nil
+	}
+	v, ok := rpcClient.State.Get(connCodecKey)
+	if !ok {
+		return nil
+	}
+
+	cc := v.(*connCodec)
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	return cc.err
+}
+
+// hasSentShutdown reports whether a shutdown or forceShutdown request was written to the
+// connection of rpcClient. It always returns false for rpc2 clients which weren't created by newRPCClient.
+func hasSentShutdown(rpcClient *rpc2.Client) bool {
+	if rpcClient == nil || rpcClient.State == nil {
+		return false
+	}
+	v, ok := rpcClient.State.Get(connCodecKey)
+	if !ok {
+		return false
+	}
+
+	cc := v.(*connCodec)
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	return cc.shutdownSent
+}
+
+// fail records err as the error ending the read loop and closes the connection.
+// Only the first error is kept.
+func (c *connCodec) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err == nil {
+		// rpc2 reports a premature EOF to the pending calls as io.ErrUnexpectedEOF
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		c.err = &ReadError{Err: err}
+
+		// rpc2 doesn't close the connection if the read loop ends because of an error,
+		// the stream can't be recovered after a malformed message either.
+		_ = c.Codec.Close()
+	}
+}
+
+// recoverRead converts a panic while reading a message into an error.
+func recoverRead(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("panic while reading message: %v", r)
+	}
+}
+
+// ReadHeader reads the header of the next message, every error ends the read loop.
+func (c *connCodec) ReadHeader(req *rpc2.Request, resp *rpc2.Response) (err error) {
+	defer func() {
+		if err != nil {
+			c.fail(err)
+		}
+	}()
+	defer recoverRead(&err)
+
+	if err = c.Codec.ReadHeader(req, resp); err != nil {
+		return err
+	}
+
+	// rpc2 responds to requests for methods without a handler, which fails for notifications.
+	// Route them to the unknownNotification handler instead so they aren't lost.
+	c.method = ""
+	if req.Method != "" && req.Seq == 0 && !isAria2Notification(req.Method) {
+		c.method = req.Method
+		req.Method = unknownNotification
+	}
+	return nil
+}
+
+// isAria2Notification reports whether method is one of the notifications sent by aria2.
+func isAria2Notification(method string) bool {
+	_, ok := notificationEvents[method]
+	return ok
+}
+
+// ReadRequestBody reads the body of a request, every error ends the read loop.
+func (c *connCodec) ReadRequestBody(x interface{}) (err error) {
+	defer func() {
+		if err != nil {
+			c.fail(err)
+		}
+	}()
+	defer recoverRead(&err)
+
+	if event, ok := x.(*UnknownEvent); ok && c.method != "" {
+		event.Method = c.method
+		return c.Codec.ReadRequestBody(&event.Params)
+	}
+	return c.Codec.ReadRequestBody(x)
+}
+
+// ReadResponseBody reads the body of a response.
+// Errors only fail the call the response belongs to.
+func (c *connCodec) ReadResponseBody(x interface{}) (err error) {
+	defer recoverRead(&err)
+
+	return c.Codec.ReadResponseBody(x)
+}
+
+// WriteRequest writes a request and records whether it was a shutdown.
+func (c *connCodec) WriteRequest(req *rpc2.Request, x interface{}) error {
+	if err := c.Codec.WriteRequest(req, x); err != nil {
+		return err
+	}
+
+	if req.Method == aria2proto.Shutdown || req.Method == aria2proto.ForceShutdown {
+		c.mu.Lock()
+		c.shutdownSent = true
+		c.mu.Unlock()
+	}
+	return nil
+}
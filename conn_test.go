@@ -0,0 +1,215 @@
+package arigo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Braurbeki/arigo/internal/pkg/jsonrpc"
+	"github.com/cenkalti/rpc2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingConn is a transport whose Read blocks until fail is closed and then returns err.
+// Written requests are discarded, written receives a value after the first one.
+// Once the conn is closed, Read returns io.ErrClosedPipe.
+type failingConn struct {
+	fail    chan struct{}
+	err     error
+	written chan struct{}
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newFailingConn(err error) *failingConn {
+	return &failingConn{fail: make(chan struct{}), err: err, written: make(chan struct{}, 1), closed: make(chan struct{})}
+}
+
+func (c *failingConn) Read([]byte) (int, error) {
+	select {
+	case <-c.fail:
+		return 0, c.err
+	case <-c.closed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+func (c *failingConn) Write(p []byte) (int, error) {
+	select {
+	case c.written <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+func (c *failingConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+// panicCodec panics while reading the header of the first message.
+type panicCodec struct {
+	rpc2.Codec
+	read chan struct{}
+}
+
+func (c *panicCodec) ReadHeader(*rpc2.Request, *rpc2.Response) error {
+	<-c.read
+	panic("corrupted state")
+}
+
+// startConnClient starts a client on codec and makes a call which is pending until the connection fails.
+func startConnClient(t *testing.T, codec rpc2.Codec) (*Client, <-chan error) {
+	client := newClient(newRPCClient(codec), "", newClientConfig(nil))
+	go client.Run()
+	t.Cleanup(func() { _ = client.Close() })
+
+	pending := make(chan error, 1)
+	go func() {
+		_, err := client.GetVersion()
+		pending <- err
+	}()
+
+	return client, pending
+}
+
+// requireReadError asserts that the pending call and following calls fail with a ReadError.
+func requireReadError(t *testing.T, client *Client, pending <-chan error) *ReadError {
+	var err error
+	select {
+	case err = <-pending:
+	case <-time.After(time.Second):
+		t.Fatal("pending call didn't return")
+	}
+
+	var readErr *ReadError
+	require.True(t, errors.As(err, &readErr), "unexpected error %v", err)
+
+	_, err = client.GetVersion()
+	var laterErr *ReadError
+	require.True(t, errors.As(err, &laterErr), "unexpected error %v", err)
+	assert.Equal(t, readErr, laterErr)
+
+	return readErr
+}
+
+func TestReadErrorTransport(t *testing.T) {
+	hardErr := errors.New("hardware failure")
+	conn := newFailingConn(hardErr)
+
+	client, pending := startConnClient(t, jsonrpc.NewJSONCodec(conn))
+	<-conn.written
+	close(conn.fail)
+
+	readErr := requireReadError(t, client, pending)
+	assert.True(t, errors.Is(readErr, hardErr))
+}
+
+func TestReadErrorEOF(t *testing.T) {
+	conn := newFailingConn(io.EOF)
+
+	client, pending := startConnClient(t, jsonrpc.NewJSONCodec(conn))
+	<-conn.written
+	close(conn.fail)
+
+	readErr := requireReadError(t, client, pending)
+	assert.True(t, errors.Is(readErr, io.ErrUnexpectedEOF))
+}
+
+func TestReadErrorPanic(t *testing.T) {
+	conn := newFailingConn(nil)
+	codec := &panicCodec{Codec: jsonrpc.NewJSONCodec(conn), read: make(chan struct{})}
+
+	client, pending := startConnClient(t, codec)
+	<-conn.written
+	close(codec.read)
+
+	readErr := requireReadError(t, client, pending)
+	assert.Contains(t, readErr.Error(), "corrupted state")
+}
+
+func TestReadErrorClosed(t *testing.T) {
+	conn := newFailingConn(io.EOF)
+	client := newClient(newRPCClient(jsonrpc.NewJSONCodec(conn)), "", newClientConfig(nil))
+	go client.Run()
+
+	require.NoError(t, client.Close())
+	close(conn.fail)
+
+	_, err := client.GetVersion()
+	assert.Equal(t, ErrClientClosed, err, "calls on a closed client must not report a ReadError")
+}
+
+// stalledConn is a failingConn whose Write blocks until unblock is closed,
+// like a connection to a server which stopped reading.
+type stalledConn struct {
+	*failingConn
+	// writing receives a value whenever a Write starts.
+	writing chan struct{}
+	unblock chan struct{}
+}
+
+func (c *stalledConn) Write(p []byte) (int, error) {
+	c.writing <- struct{}{}
+	select {
+	case <-c.unblock:
+		return len(p), nil
+	case <-c.closed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+func TestMaxPendingWrites(t *testing.T) {
+	conn := &stalledConn{failingConn: newFailingConn(io.EOF), writing: make(chan struct{}, 10), unblock: make(chan struct{})}
+	cfg := newClientConfig([]ClientOption{WithMaxPendingWrites(1)})
+	client := newClient(newRPCClient(jsonrpc.NewJSONCodec(conn)), "", cfg)
+	go client.Run()
+	t.Cleanup(func() { _ = client.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _, _ = client.GetVersionContext(ctx) }()
+	select {
+	case <-conn.writing:
+	case <-time.After(time.Second):
+		t.Fatal("first request wasn't written")
+	}
+
+	// the queue is full, later calls block until they're done
+	timeoutCtx, timeoutCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer timeoutCancel()
+	_, err := client.GetVersionContext(timeoutCtx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	cancelCtx, cancelCall := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancelCall)
+	_, err = client.GetVersionContext(cancelCtx)
+	assert.Equal(t, context.Canceled, err)
+
+	blocked := make(chan struct{})
+	go func() {
+		defer close(blocked)
+		_, _ = client.GetVersion()
+	}()
+	select {
+	case <-conn.writing:
+		t.Fatal("request was written while the queue was full")
+	case <-blocked:
+		t.Fatal("call returned while the queue was full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the first request was written, which makes room for the blocked call
+	close(conn.unblock)
+	select {
+	case <-conn.writing:
+	case <-time.After(time.Second):
+		t.Fatal("blocked request wasn't written")
+	}
+	assert.Empty(t, conn.writing, "the requests of the cancelled calls must not be sent")
+}
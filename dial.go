@@ -0,0 +1,148 @@
+package arigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxDialErrorBody is the maximum number of bytes of the handshake response body kept by a DialError.
+const maxDialErrorBody = 512
+
+// DialError is returned by Dial and DialContext if the server rejected the WebSocket handshake,
+// for example because a reverse proxy requires authentication or doesn't know the path.
+// It wraps websocket.ErrBadHandshake.
+type DialError struct {
+	StatusCode int    // status code of the handshake response
+	Status     string // status line of the handshake response, e.g. "403 Forbidden"
+	Body       string // start of the response body, truncated to 512 bytes
+	Err        error
+}
+
+func (e *DialError) Error() string {
+	msg := "websocket handshake rejected with status " + e.Status
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
+
+// newDialError creates a DialError from the response to a rejected handshake.
+func newDialError(resp *http.Response, err error) *DialError {
+	dialErr := &DialError{StatusCode: resp.StatusCode, Status: resp.Status, Err: err}
+	if dialErr.Status == "" {
+		dialErr.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	if resp.Body != nil {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxDialErrorBody))
+		dialErr.Body = strings.TrimSpace(string(body))
+	}
+	return dialErr
+}
+
+// dialContext performs the WebSocket handshake like websocket.Dialer.DialContext.
+// In addition to the context's deadline, which the dialer already respects,
+// it aborts the handshake as soon as the context is cancelled.
+// The returned error wraps the context's error if the context ended the dial.
+func dialContext(ctx context.Context, dialer websocket.Dialer, url string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	var mu sync.Mutex
+	var conn net.Conn
+	cancelled := false
+
+	netDial := dialer.NetDialContext
+	if netDial == nil {
+		netDial = (&net.Dialer{}).DialContext
+	}
+	dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := netDial(ctx, network, addr)
+		if err == nil {
+			mu.Lock()
+			conn = c
+			if cancelled {
+				_ = c.SetDeadline(time.Now())
+			}
+			mu.Unlock()
+		}
+		return c, err
+	}
+
+	dialDone := make(chan struct{})
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		select {
+		case <-ctx.Done():
+			mu.Lock()
+			cancelled = true
+			if conn != nil {
+				// unblocks the handshake
+				_ = conn.SetDeadline(time.Now())
+			}
+			mu.Unlock()
+		case <-dialDone:
+		}
+	}()
+
+	ws, resp, err := dialer.DialContext(ctx, url, header)
+	close(dialDone)
+	<-watchDone
+
+	if err == nil && cancelled {
+		// the deadline may have been set on the established connection
+		_ = ws.Close()
+		ws = nil
+		err = ctx.Err()
+	}
+	if err == websocket.ErrBadHandshake && resp != nil {
+		err = newDialError(resp, err)
+	}
+	if err != nil {
+		err = wrapContextErr(ctx, err)
+	}
+
+	return ws, resp, err
+}
+
+// compressionNegotiated reports whether the handshake response header accepts
+// the permessage-deflate extension.
+func compressionNegotiated(header http.Header) bool {
+	for _, value := range header["Sec-Websocket-Extensions"] {
+		for _, extension := range strings.Split(value, ",") {
+			name := strings.TrimSpace(strings.Split(extension, ";")[0])
+			if strings.EqualFold(name, "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wrapContextErr makes sure err wraps the context's error if the context is done.
+func wrapContextErr(ctx context.Context, err error) error {
+	ctxErr := ctx.Err()
+	if ctxErr == nil {
+		// the dialer applies the context's deadline to the connection,
+		// which may expire before the context reports it.
+		if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+			ctxErr = context.DeadlineExceeded
+		}
+	}
+	if ctxErr == nil || errors.Is(err, ctxErr) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ctxErr, err)
+}
@@ -0,0 +1,131 @@
+package arigo
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/Braurbeki/arigo/pkg/aria2proto"
+)
+
+// RecordedCall is a call or notification which a client created using WithDryRun would have sent.
+type RecordedCall struct {
+	Method string
+	// Params contains the JSON encoded parameters, starting with the secret token if the client has one.
+	Params []json.RawMessage
+}
+
+// ackMethods are the methods whose "OK" acknowledgement is checked by the client.
+var ackMethods = map[string]bool{
+	aria2proto.PauseAll:      true,
+	aria2proto.ForcePauseAll: true,
+	aria2proto.UnpauseAll:    true,
+	aria2proto.SaveSession:   true,
+}
+
+// gidMethods are the methods which respond with the gid they were called with.
+var gidMethods = map[string]bool{
+	aria2proto.Remove:      true,
+	aria2proto.ForceRemove: true,
+	aria2proto.Pause:       true,
+	aria2proto.ForcePause:  true,
+	aria2proto.Unpause:     true,
+}
+
+// dryRunTransport is the Transport used by WithDryRun.
+// It records the calls and answers them with zero values, except for the responses
+// the client verifies, which are answered like aria2 would if the call succeeded.
+type dryRunTransport struct {
+	mu    sync.Mutex
+	calls []RecordedCall
+}
+
+func (t *dryRunTransport) Call(ctx context.Context, method string, params interface{}, reply interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	args, err := t.record(method, params)
+	if err != nil {
+		return err
+	}
+	if reply == nil {
+		return nil
+	}
+
+	var result interface{}
+	switch {
+	case ackMethods[method]:
+		result = "OK"
+	case gidMethods[method] && len(args) > 0:
+		result = args[len(args)-1]
+	case method == aria2proto.Multicall && len(args) == 1:
+		var calls []json.RawMessage
+		if err := json.Unmarshal(args[0], &calls); err != nil {
+			return err
+		}
+		results := make([][]interface{}, len(calls))
+		for i := range results {
+			results[i] = []interface{}{nil}
+		}
+		result = results
+	default:
+		return nil
+	}
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, reply)
+}
+
+// Notify records the notification like a call.
+func (t *dryRunTransport) Notify(method string, params interface{}) error {
+	_, err := t.record(method, params)
+	return err
+}
+
+// Subscribe does nothing, there are no notifications in a dry run.
+func (t *dryRunTransport) Subscribe(NotificationHandler) {}
+
+// NotificationsSupported returns false, there are no notifications in a dry run.
+func (t *dryRunTransport) NotificationsSupported() bool {
+	return false
+}
+
+func (t *dryRunTransport) Close() error {
+	return nil
+}
+
+// record adds a call of method with params to the recorded calls.
+func (t *dryRunTransport) record(method string, params interface{}) ([]json.RawMessage, error) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	var args []json.RawMessage
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	t.calls = append(t.calls, RecordedCall{Method: method, Params: args})
+	t.mu.Unlock()
+
+	return args, nil
+}
+
+// RecordedCalls returns the calls and notifications recorded by a client created using WithDryRun,
+// in the order they were made. It returns nil for other clients.
+func (c *Client) RecordedCalls() []RecordedCall {
+	t, ok := c.transport.(*dryRunTransport)
+	if !ok {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]RecordedCall(nil), t.calls...)
+}
@@ -0,0 +1,85 @@
+package arigo
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Braurbeki/arigo/pkg/aria2proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	client, err := Dial("ws://localhost:1/jsonrpc", "secret", WithDryRun())
+	require.NoError(t, err)
+	defer client.Close()
+
+	gid, err := client.AddURI(URIs("https://example.org/file"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "", gid.GID)
+
+	status, err := client.TellStatus("2089b05ecca3d829")
+	require.NoError(t, err)
+	assert.Equal(t, Status{}, status)
+
+	require.NoError(t, client.Pause("2089b05ecca3d829"))
+	require.NoError(t, client.PauseAll())
+
+	results, err := client.MultiCall(NewMethodCall(aria2proto.TellStatus, "2089b05ecca3d829"), NewMethodCall(aria2proto.GetVersion))
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.NoError(t, results[0].Error)
+
+	require.NoError(t, client.Notify("custom.notification", []interface{}{1}))
+
+	calls := client.RecordedCalls()
+	methods := make([]string, len(calls))
+	for i, call := range calls {
+		methods[i] = call.Method
+	}
+	assert.Equal(t, []string{
+		aria2proto.AddURI,
+		aria2proto.TellStatus,
+		aria2proto.Pause,
+		aria2proto.PauseAll,
+		aria2proto.Multicall,
+		"custom.notification",
+	}, methods)
+	assert.Equal(t, []json.RawMessage{json.RawMessage(`"token:secret"`), json.RawMessage(`"2089b05ecca3d829"`)}, calls[2].Params)
+}
+
+func TestDryRunNotifications(t *testing.T) {
+	client, err := Dial("", "", WithDryRun())
+	require.NoError(t, err)
+	defer client.Close()
+
+	assert.False(t, client.NotificationsSupported())
+
+	err = client.WaitForDownloadContext(context.Background(), "2089b05ecca3d829")
+	assert.Equal(t, ErrNotificationsUnsupported, err)
+	assert.Empty(t, client.RecordedCalls())
+}
+
+func TestTransportNotificationsSupported(t *testing.T) {
+	// a transport without NotificationsSupported is assumed to deliver notifications
+	client, err := Dial("", "", WithTransport(struct{ Transport }{&dryRunTransport{}}))
+	require.NoError(t, err)
+	defer client.Close()
+	assert.True(t, client.NotificationsSupported())
+
+	client, err = Dial("", "", WithTransport(&dryRunTransport{}))
+	require.NoError(t, err)
+	defer client.Close()
+	assert.False(t, client.NotificationsSupported())
+}
+
+func TestRecordedCallsWithoutDryRun(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getVersion", VersionInfo{Version: "1.36.0"})
+	client := server.dial("")
+
+	_, err := client.GetVersion()
+	require.NoError(t, err)
+	assert.Nil(t, client.RecordedCalls())
+}
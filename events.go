@@ -1,6 +1,11 @@
 package arigo
 
-import "sync"
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/Braurbeki/arigo/pkg/aria2proto"
+)
 
 //go:generate stringer -type=EventType
 
@@ -23,10 +28,24 @@ const (
 	ErrorEvent
 )
 
+// notificationEvents maps the notifications sent by aria2 to the type of their events.
+var notificationEvents = map[string]EventType{
+	aria2proto.OnDownloadStart:      StartEvent,
+	aria2proto.OnDownloadPause:      PauseEvent,
+	aria2proto.OnDownloadStop:       StopEvent,
+	aria2proto.OnDownloadComplete:   CompleteEvent,
+	aria2proto.OnBTDownloadComplete: BTCompleteEvent,
+	aria2proto.OnDownloadError:      ErrorEvent,
+}
+
 // DownloadEvent represents the event emitted by aria2 concerning downloads.
-// It only contains the gid of the download.
+// It contains the gid of the download.
 type DownloadEvent struct {
 	GID string
+	// Resynced is set if the client dispatched the event itself because it noticed
+	// the change of the status after reconnecting, see WithResyncOnReconnect.
+	// aria2 didn't send a notification for it.
+	Resynced bool `json:"-"`
 }
 
 func (e *DownloadEvent) String() string {
@@ -37,10 +56,43 @@ func (e *DownloadEvent) String() string {
 // when an event occurs.
 type EventListener func(event *DownloadEvent)
 
+// UnknownEvent represents a notification sent by aria2 which isn't one of the
+// notifications denoted by an EventType, for example one added by a newer version of aria2.
+type UnknownEvent struct {
+	// Method is the name of the notification.
+	Method string
+	// Params contains the JSON encoded parameters of the notification.
+	Params []json.RawMessage
+}
+
+// UnknownListener represents a function which should be called
+// when an unknown notification is received.
+type UnknownListener func(event *UnknownEvent)
+
 // UnsubscribeFunc is a function which when called, unsubscribes from an
 // event.
 type UnsubscribeFunc func() bool
 
+// OverflowPolicy decides what a channel subscription does with an event
+// once its buffer is full, see SubscribeChanWithPolicy.
+type OverflowPolicy int
+
+const (
+	// DropNewest drops the event which doesn't fit into the buffer anymore.
+	// The consumer receives the oldest events, and it never holds up other listeners.
+	// It's the policy of SubscribeChan.
+	DropNewest OverflowPolicy = iota
+	// DropOldest drops the oldest buffered event to make room for the new one.
+	// The consumer receives the latest events, which suits consumers which only
+	// care about the current state, and it never holds up other listeners either.
+	DropOldest
+	// Block queues the event until the consumer made room for it, so no event is lost.
+	// The dispatch doesn't wait for the consumer, and the queued events are delivered
+	// in the order they were dispatched. The queue grows for as long as the consumer
+	// falls behind, so only use it if the consumer catches up eventually.
+	Block
+)
+
 // EventSubscriber is an interface which can be subscribed to.
 type EventSubscriber interface {
 	Subscribe(evtType EventType, listener EventListener) UnsubscribeFunc
@@ -57,9 +109,13 @@ type listenerData struct {
 }
 
 type eventTarget struct {
-	listenerMap map[EventType][]listenerData
-	currentID   uint64
-	mut         sync.RWMutex
+	listenerMap      map[EventType][]listenerData
+	unknownListeners map[uint64]UnknownListener
+	currentID        uint64
+	mut              sync.RWMutex
+
+	droppedMut sync.Mutex
+	dropped    uint64 // number of events dropped by channel subscriptions
 }
 
 func (t *eventTarget) unsubscribe(evtType EventType, id uint64) bool {
@@ -112,6 +168,162 @@ func (t *eventTarget) Subscribe(evtType EventType, listener EventListener) Unsub
 	}
 }
 
+// SubscribeChan is like Subscribe but delivers the events on the returned channel,
+// which buffers up to buffer events.
+// Every subscription gets its own channel, so all of them receive every event.
+// Events which don't fit into the buffer are dropped instead of blocking the dispatch,
+// so a slow consumer doesn't hold up the other listeners. Dropped events are counted, see Dropped.
+// The channel is closed when the returned UnsubscribeFunc is called.
+func (t *eventTarget) SubscribeChan(evtType EventType, buffer int) (<-chan *DownloadEvent, UnsubscribeFunc) {
+	return t.SubscribeChanWithPolicy(evtType, buffer, DropNewest)
+}
+
+// SubscribeChanWithPolicy is like SubscribeChan but policy decides what happens
+// with an event once the buffer is full.
+func (t *eventTarget) SubscribeChanWithPolicy(evtType EventType, buffer int, policy OverflowPolicy) (<-chan *DownloadEvent, UnsubscribeFunc) {
+	s := &chanSubscription{
+		target: t,
+		policy: policy,
+		events: make(chan *DownloadEvent, buffer),
+		done:   make(chan struct{}),
+	}
+
+	unsubscribe := t.Subscribe(evtType, s.receive)
+
+	return s.events, func() bool {
+		ok := unsubscribe()
+		s.close()
+		return ok
+	}
+}
+
+// chanSubscription delivers the events of a channel subscription.
+// receive never blocks the dispatch. It sends the event right away if the channel has room,
+// otherwise the policy decides. Block queues the event, and a single goroutine per subscription
+// forwards the queue to the channel, so the events arrive in the order they were dispatched.
+type chanSubscription struct {
+	target *eventTarget
+	policy OverflowPolicy
+	events chan *DownloadEvent
+	// closed by close to release the delivering goroutine
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mut        sync.Mutex
+	closed     bool
+	queue      []*DownloadEvent // events waiting for room in the channel, only used by Block
+	delivering bool             // whether the goroutine forwarding the queue is running
+}
+
+func (s *chanSubscription) receive(event *DownloadEvent) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	// queued events go first
+	if len(s.queue) == 0 {
+		select {
+		case s.events <- event:
+			return
+		default:
+		}
+	}
+
+	switch s.policy {
+	case Block:
+		s.queue = append(s.queue, event)
+		if !s.delivering {
+			s.delivering = true
+			go s.deliver()
+		}
+	case DropOldest:
+		for {
+			select {
+			case <-s.events:
+				s.target.addDropped()
+			default:
+				// unbuffered without a receiver, there's nothing to make room in
+				s.target.addDropped()
+				return
+			}
+			select {
+			case s.events <- event:
+				return
+			default:
+			}
+		}
+	default:
+		s.target.addDropped()
+	}
+}
+
+// deliver forwards the queued events to the channel until the queue is empty
+// or the subscription is closed.
+func (s *chanSubscription) deliver() {
+	for {
+		s.mut.Lock()
+		if s.closed || len(s.queue) == 0 {
+			s.delivering = false
+			if s.closed {
+				close(s.events)
+			}
+			s.mut.Unlock()
+			return
+		}
+		// the event stays queued until it's sent, so receive doesn't overtake it
+		event := s.queue[0]
+		s.mut.Unlock()
+
+		select {
+		case s.events <- event:
+			s.mut.Lock()
+			if !s.closed {
+				s.queue[0] = nil
+				s.queue = s.queue[1:]
+			}
+			s.mut.Unlock()
+		case <-s.done:
+		}
+	}
+}
+
+// close discards the queued events and closes the channel,
+// or leaves closing it to the delivering goroutine if it's running.
+func (s *chanSubscription) close() {
+	s.closeOnce.Do(func() {
+		s.mut.Lock()
+		s.closed = true
+		s.queue = nil
+		if !s.delivering {
+			close(s.events)
+		}
+		s.mut.Unlock()
+
+		close(s.done)
+	})
+}
+
+// addDropped counts an event dropped by a channel subscription.
+func (t *eventTarget) addDropped() {
+	t.droppedMut.Lock()
+	t.dropped++
+	t.droppedMut.Unlock()
+}
+
+// Dropped returns the number of events dropped so far because the buffer of a channel
+// subscription was full.
+func (t *eventTarget) Dropped() uint64 {
+	t.droppedMut.Lock()
+	defer t.droppedMut.Unlock()
+
+	return t.dropped
+}
+
+// Dispatch calls all listeners registered for evtType.
+// Every listener receives its own copy of event, so it may keep or modify it.
 func (t *eventTarget) Dispatch(evtType EventType, event *DownloadEvent) {
 	t.mut.RLock()
 	defer t.mut.RUnlock()
@@ -122,8 +334,50 @@ func (t *eventTarget) Dispatch(evtType EventType, event *DownloadEvent) {
 
 	wg.Add(len(listeners))
 	for _, listener := range listeners {
-		go func(l listenerData) {
-			l.f(event)
+		go func(l listenerData, event DownloadEvent) {
+			l.f(&event)
+			wg.Done()
+		}(listener, *event)
+	}
+
+	wg.Wait()
+}
+
+// SubscribeUnknown registers the given listener for notifications which aren't
+// denoted by an EventType.
+func (t *eventTarget) SubscribeUnknown(listener UnknownListener) UnsubscribeFunc {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	id := t.currentID
+	t.currentID++
+
+	if t.unknownListeners == nil {
+		t.unknownListeners = make(map[uint64]UnknownListener)
+	}
+	t.unknownListeners[id] = listener
+
+	return func() bool {
+		t.mut.Lock()
+		defer t.mut.Unlock()
+
+		_, ok := t.unknownListeners[id]
+		delete(t.unknownListeners, id)
+		return ok
+	}
+}
+
+// DispatchUnknown calls all listeners registered using SubscribeUnknown.
+func (t *eventTarget) DispatchUnknown(event *UnknownEvent) {
+	t.mut.RLock()
+	defer t.mut.RUnlock()
+
+	var wg sync.WaitGroup
+
+	wg.Add(len(t.unknownListeners))
+	for _, listener := range t.unknownListeners {
+		go func(l UnknownListener) {
+			l(event)
 			wg.Done()
 		}(listener)
 	}
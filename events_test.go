@@ -3,7 +3,9 @@ package arigo
 import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestEventTarget(t *testing.T) {
@@ -15,14 +17,14 @@ func TestEventTarget(t *testing.T) {
 		events = append(events, event)
 	})
 
-	evtTarget.Dispatch(StartEvent, &DownloadEvent{"1"})
-	evtTarget.Dispatch(CompleteEvent, &DownloadEvent{"2"})
-	evtTarget.Dispatch(StartEvent, &DownloadEvent{"3"})
+	evtTarget.Dispatch(StartEvent, &DownloadEvent{GID: "1"})
+	evtTarget.Dispatch(CompleteEvent, &DownloadEvent{GID: "2"})
+	evtTarget.Dispatch(StartEvent, &DownloadEvent{GID: "3"})
 
 	unsub()
 	unsub()
 
-	evtTarget.Dispatch(StartEvent, &DownloadEvent{"4"})
+	evtTarget.Dispatch(StartEvent, &DownloadEvent{GID: "4"})
 
 	require.Len(t, events, 2, "should only receive two events")
 
@@ -32,3 +34,150 @@ func TestEventTarget(t *testing.T) {
 	second := events[1].GID
 	assert.Equal(t, "3", second)
 }
+
+func TestEventTargetSubscribeChan(t *testing.T) {
+	var evtTarget eventTarget
+
+	events, unsub := evtTarget.SubscribeChan(StartEvent, 2)
+
+	evtTarget.Dispatch(StartEvent, &DownloadEvent{GID: "1"})
+	evtTarget.Dispatch(CompleteEvent, &DownloadEvent{GID: "2"})
+	evtTarget.Dispatch(StartEvent, &DownloadEvent{GID: "3"})
+	// the buffer is full, so this one must be dropped instead of blocking
+	evtTarget.Dispatch(StartEvent, &DownloadEvent{GID: "4"})
+
+	assert.True(t, unsub())
+	assert.False(t, unsub())
+
+	// must not panic after the channel was closed
+	evtTarget.Dispatch(StartEvent, &DownloadEvent{GID: "5"})
+
+	var gids []string
+	for event := range events {
+		gids = append(gids, event.GID)
+	}
+
+	assert.Equal(t, []string{"1", "3"}, gids)
+	assert.Equal(t, uint64(1), evtTarget.Dropped())
+}
+
+func TestEventTargetSubscribeChanPolicies(t *testing.T) {
+	tests := []struct {
+		policy  OverflowPolicy
+		gids    []string
+		dropped uint64
+	}{
+		{DropNewest, []string{"1", "2"}, 2},
+		{DropOldest, []string{"3", "4"}, 2},
+		{Block, []string{"1", "2", "3", "4"}, 0},
+	}
+
+	for _, tt := range tests {
+		var evtTarget eventTarget
+		events, unsub := evtTarget.SubscribeChanWithPolicy(StartEvent, 2, tt.policy)
+
+		dispatched := make(chan struct{})
+		go func() {
+			defer close(dispatched)
+			for _, gid := range []string{"1", "2", "3", "4"} {
+				evtTarget.Dispatch(StartEvent, &DownloadEvent{GID: gid})
+			}
+		}()
+
+		var gids []string
+		if tt.policy == Block {
+			// the dispatch queues the events the channel has no room for
+			for len(gids) < 4 {
+				gids = append(gids, (<-events).GID)
+			}
+			<-dispatched
+		} else {
+			<-dispatched
+			for len(events) > 0 {
+				gids = append(gids, (<-events).GID)
+			}
+		}
+
+		assert.Equal(t, tt.gids, gids, "policy %d", tt.policy)
+		assert.Equal(t, tt.dropped, evtTarget.Dropped(), "policy %d", tt.policy)
+		assert.True(t, unsub())
+	}
+}
+
+func TestEventTargetSubscribeChanBlockUnsubscribe(t *testing.T) {
+	var evtTarget eventTarget
+	events, unsub := evtTarget.SubscribeChanWithPolicy(StartEvent, 0, Block)
+
+	// nobody receives, so the event is queued instead of blocking the dispatch
+	evtTarget.Dispatch(StartEvent, &DownloadEvent{GID: "1"})
+
+	// unsubscribing must stop the delivery and close the channel
+	assert.True(t, unsub())
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after unsubscribing")
+	}
+}
+
+func TestEventTargetSubscribeChanBlockOrder(t *testing.T) {
+	var evtTarget eventTarget
+	events, unsub := evtTarget.SubscribeChanWithPolicy(StartEvent, 1, Block)
+	defer unsub()
+
+	var others []string
+	evtTarget.Subscribe(StartEvent, func(event *DownloadEvent) {
+		others = append(others, event.GID)
+	})
+
+	// the consumer doesn't receive yet, which must hold up neither the dispatch
+	// nor the other listener
+	var want []string
+	for i := 0; i < 100; i++ {
+		gid := strconv.Itoa(i)
+		want = append(want, gid)
+		evtTarget.Dispatch(StartEvent, &DownloadEvent{GID: gid})
+	}
+	assert.Equal(t, want, others)
+
+	var gids []string
+	for len(gids) < len(want) {
+		select {
+		case event := <-events:
+			gids = append(gids, event.GID)
+		case <-time.After(time.Second):
+			t.Fatalf("received %d of %d events", len(gids), len(want))
+		}
+	}
+
+	assert.Equal(t, want, gids)
+	assert.Equal(t, uint64(0), evtTarget.Dropped())
+}
+
+func TestEventTargetSubscribeChanFanOut(t *testing.T) {
+	var evtTarget eventTarget
+
+	logger, unsubLogger := evtTarget.SubscribeChan(CompleteEvent, 2)
+	ui, unsubUI := evtTarget.SubscribeChan(CompleteEvent, 1)
+
+	evtTarget.Dispatch(CompleteEvent, &DownloadEvent{GID: "1"})
+
+	loggerEvent := <-logger
+	uiEvent := <-ui
+	assert.Equal(t, "1", loggerEvent.GID)
+	assert.Equal(t, "1", uiEvent.GID)
+	// every subscriber gets its own copy
+	loggerEvent.GID = "changed"
+	assert.Equal(t, "1", uiEvent.GID)
+
+	// unsubscribing only removes that subscriber
+	assert.True(t, unsubUI())
+	evtTarget.Dispatch(CompleteEvent, &DownloadEvent{GID: "2"})
+	assert.Equal(t, "2", (<-logger).GID)
+	_, ok := <-ui
+	assert.False(t, ok)
+
+	assert.True(t, unsubLogger())
+	assert.Equal(t, uint64(0), evtTarget.Dropped())
+}
@@ -1,5 +1,7 @@
 package arigo
 
+import "strconv"
+
 //go:generate stringer -type=ExitStatus
 
 // ExitStatus is an integer returned by aria2 for downloads which describes why a download exited.
@@ -110,3 +112,24 @@ const (
 	// ChecksumValidationFailed indicates that the checksum validation failed.
 	ChecksumValidationFailed
 )
+
+// MarshalJSON encodes the exit status as a quoted string, like aria2 does.
+func (i ExitStatus) MarshalJSON() ([]byte, error) {
+	return Int64(i).MarshalJSON()
+}
+
+// UnmarshalJSON decodes a quoted or bare exit status.
+func (i *ExitStatus) UnmarshalJSON(data []byte) error {
+	s, isNull := unquoteScalar(data)
+	if isNull {
+		return nil
+	}
+
+	v, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return err
+	}
+
+	*i = ExitStatus(v)
+	return nil
+}
@@ -25,11 +25,11 @@ func TestFileFormat(t *testing.T) {
 	assert.Len(t, files, 1)
 
 	file := files[0]
-	assert.Equal(t, 1, file.Index)
-	assert.Equal(t, uint(34896138), file.Length)
-	assert.Equal(t, uint(34896138), file.CompletedLength)
+	assert.Equal(t, Int64(1), file.Index)
+	assert.Equal(t, Int64(34896138), file.Length)
+	assert.Equal(t, Int64(34896138), file.CompletedLength)
 	assert.Equal(t, "/downloads/file", file.Path)
-	assert.Equal(t, true, file.Selected)
+	assert.Equal(t, Bool(true), file.Selected)
 
 	uris := file.URIs
 	assert.Len(t, uris, 1)
@@ -38,3 +38,25 @@ func TestFileFormat(t *testing.T) {
 	assert.Equal(t, URIUsed, uri.Status)
 	assert.Equal(t, "http://example.org/file", uri.URI)
 }
+
+func TestFileProgress(t *testing.T) {
+	assert.Equal(t, 0.25, File{Length: 1000, CompletedLength: 250}.Progress())
+	assert.Equal(t, 0.0, File{Length: 1000}.Progress())
+	assert.Equal(t, 1.0, File{Length: 6442450944, CompletedLength: 6442450944}.Progress())
+	assert.Equal(t, 1.0, File{}.Progress())
+}
+
+func TestFileBareValues(t *testing.T) {
+	data := []byte(`{"index": 1, "path": "/downloads/file", "length": 34896138, "completedLength": "34896138", "selected": true, "uris": []}`)
+
+	var file File
+	assert.NoError(t, json.Unmarshal(data, &file))
+	assert.Equal(t, File{
+		Index:           1,
+		Path:            "/downloads/file",
+		Length:          34896138,
+		CompletedLength: 34896138,
+		Selected:        true,
+		URIs:            []URI{},
+	}, file)
+}
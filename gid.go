@@ -1,8 +1,76 @@
 package arigo
 
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidGID is returned when a gid doesn't have the format used by aria2.
+var ErrInvalidGID = errors.New("invalid gid")
+
+// gidLength is the length of the hex string aria2 uses to represent a gid.
+const gidLength = 16
+
+// ValidateGID checks whether gid has the format used by aria2,
+// which is a hex string with 16 characters.
+// The returned error wraps ErrInvalidGID.
+func ValidateGID(gid string) error {
+	if len(gid) != gidLength {
+		return fmt.Errorf("%w %q: expected %d hex characters", ErrInvalidGID, gid, gidLength)
+	}
+
+	for i := 0; i < len(gid); i++ {
+		c := gid[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return fmt.Errorf("%w %q: unexpected character %q", ErrInvalidGID, gid, c)
+		}
+	}
+
+	return nil
+}
+
+// GIDString is the gid of a download as used by aria2, a hex string with 16 characters.
+// Use ParseGID to validate a gid received from elsewhere, the methods taking a GIDString
+// validate it as well and return an error wrapping ErrInvalidGID without calling aria2.
+//
+// It's named GIDString since GID is the handle returned by the methods adding downloads.
+type GIDString string
+
+// ParseGID validates gid, see ValidateGID, and returns it as a GIDString.
+// Use Client.ParseGID to get a GID handle instead.
+func ParseGID(gid string) (GIDString, error) {
+	if err := ValidateGID(gid); err != nil {
+		return "", err
+	}
+	return GIDString(gid), nil
+}
+
+// IsZero reports whether gid is empty.
+func (gid GIDString) IsZero() bool {
+	return gid == ""
+}
+
+func (gid GIDString) String() string {
+	return string(gid)
+}
+
+// newGID returns a random gid, which can be passed using the gid option.
+func newGID() (string, error) {
+	b := make([]byte, gidLength/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 // GID provides an object oriented approach to arigo.
 // Instead of calling the methods on the client directly,
 // you can call them on the GID instance.
+// It's the handle returned by the methods which add downloads, such as AddURI and AddTorrent.
 type GID struct {
 	client *Client
 	GID    string // gid of the download
@@ -12,8 +80,15 @@ func (gid *GID) String() string {
 	return gid.GID
 }
 
+// IsZero reports whether gid doesn't denote a download,
+// for example because it was returned alongside an error.
+func (gid *GID) IsZero() bool {
+	return gid.GID == ""
+}
+
 // Subscribe subscribes to the given event but only dispatches events concerning
-// this GID.
+// this GID. Like for Client.Subscribe, the listener is never called
+// if the client doesn't support notifications.
 func (gid *GID) Subscribe(evtType EventType, listener EventListener) UnsubscribeFunc {
 	return gid.client.Subscribe(evtType, func(event *DownloadEvent) {
 		if event.GID == gid.GID {
@@ -32,11 +107,75 @@ func (gid *GID) WaitForDownload() error {
 	return gid.client.WaitForDownload(gid.GID)
 }
 
+// WaitUntilComplete waits for the download to finish and returns its final status.
+// It returns ErrDownloadError if the download failed and ErrDownloadStopped if it was removed,
+// alongside the final status. If ctx is done first, the context's error is returned.
+//
+// Unlike WaitForDownload, it also works for clients which don't support notifications,
+// in which case the status is polled every second.
+func (gid *GID) WaitUntilComplete(ctx context.Context) (Status, error) {
+	w, err := gid.Watch(ctx, waitPollInterval)
+	if err != nil {
+		return Status{}, err
+	}
+
+	// the last status sent before the channel is closed is the final one
+	var status Status
+	for s := range w.C {
+		status = s
+	}
+
+	switch {
+	case w.Err() != nil:
+		return status, w.Err()
+	case status.Status == StatusCompleted:
+		return status, nil
+	case status.Status == StatusError:
+		return status, ErrDownloadError
+	case status.Status == StatusRemoved:
+		return status, ErrDownloadStopped
+	case ctx.Err() != nil:
+		return status, ctx.Err()
+	default:
+		return status, fmt.Errorf("download %s ended with status %q", gid.GID, status.Status)
+	}
+}
+
+// Context returns a context which is cancelled once the download has finished,
+// that is once it completed, failed or was removed, so cleanup logic can wait for ctx.Done().
+//
+// The download is watched like by WaitUntilComplete. The context is cancelled when the
+// client is closed as well, and right away if the status of the download can't be fetched,
+// for example because aria2 doesn't know it. The goroutine watching the download
+// returns as soon as it has cancelled the context.
+// Every call watches the download separately, so the context should be kept instead of being
+// requested repeatedly.
+func (gid *GID) Context() context.Context {
+	ctx, cancel := context.WithCancel(gid.client.closeCtx)
+	download, interval := *gid, waitPollInterval
+
+	go func() {
+		defer cancel()
+
+		w, err := download.Watch(ctx, interval)
+		if err != nil {
+			return
+		}
+		for range w.C {
+		}
+	}()
+
+	return ctx
+}
+
+// waitPollInterval is the interval WaitUntilComplete fetches the status at.
+var waitPollInterval = time.Second
+
 // Remove removes the download.
 // If the specified download is in progress, it is first stopped.
 // The status of the removed download becomes removed.
 func (gid *GID) Remove() error {
-	return gid.client.Remove(gid.GID)
+	return gid.client.Remove(GIDString(gid.GID))
 }
 
 // ForceRemove removes the download.
@@ -52,7 +191,7 @@ func (gid *GID) ForceRemove() error {
 // the download is placed in the front of the queue. While the status is paused,
 // the download is not started. To change status to waiting, use the Unpause() method.
 func (gid *GID) Pause() error {
-	return gid.client.Pause(gid.GID)
+	return gid.client.Pause(GIDString(gid.GID))
 }
 
 // ForcePause pauses the download.
@@ -66,7 +205,7 @@ func (gid *GID) ForcePause() error {
 // Unpause changes the status of the download from paused to waiting,
 // making the download eligible to be restarted.
 func (gid *GID) Unpause() error {
-	return gid.client.Unpause(gid.GID)
+	return gid.client.Unpause(GIDString(gid.GID))
 }
 
 // TellStatus returns the progress of the download.
@@ -74,19 +213,51 @@ func (gid *GID) Unpause() error {
 // If keys is empty, the response contains all keys.
 // This is useful when you just want specific keys and avoid unnecessary transfers.
 func (gid *GID) TellStatus(keys ...string) (Status, error) {
-	return gid.client.TellStatus(gid.GID, keys...)
+	return gid.client.TellStatus(GIDString(gid.GID), keys...)
+}
+
+// Status returns the progress of the download.
+// It's a shorthand for TellStatus without keys.
+func (gid *GID) Status() (Status, error) {
+	return gid.TellStatus()
+}
+
+// Watch sends the status of the download on the channel of the returned Watcher whenever it changes.
+// See Client.Watch for details.
+func (gid *GID) Watch(ctx context.Context, interval time.Duration) (*Watcher, error) {
+	return gid.client.Watch(ctx, gid.GID, interval)
 }
 
 // GetURIs returns the URIs used in the download.
 // The response is a slice of URI.
 func (gid *GID) GetURIs() ([]URI, error) {
-	return gid.client.GetURIs(gid.GID)
+	return gid.client.GetURIs(GIDString(gid.GID))
 }
 
 // GetFiles returns the file list of the download.
 // The response is a slice of File.
 func (gid *GID) GetFiles() ([]File, error) {
-	return gid.client.GetFiles(gid.GID)
+	return gid.client.GetFiles(GIDString(gid.GID))
+}
+
+// Files is a shorthand for GetFiles.
+func (gid *GID) Files() ([]File, error) {
+	return gid.GetFiles()
+}
+
+// SelectFiles selects the files of the download which are downloaded, see Client.SelectFiles.
+func (gid *GID) SelectFiles(indices ...int) error {
+	return gid.client.SelectFiles(gid.GID, indices...)
+}
+
+// SelectAllFiles selects all files of the download.
+func (gid *GID) SelectAllFiles() error {
+	return gid.client.SelectAllFiles(gid.GID)
+}
+
+// DeselectFiles stops downloading the files denoted by indices, see Client.DeselectFiles.
+func (gid *GID) DeselectFiles(indices ...int) error {
+	return gid.client.DeselectFiles(gid.GID, indices...)
 }
 
 // GetPeers returns a list of peers of the download denoted by gid.
@@ -178,6 +349,12 @@ func (gid *GID) ChangeOptions(changes Options) error {
 	return gid.client.ChangeOptions(gid.GID, changes)
 }
 
+// ChangeOption changes a single option of the download dynamically.
+// key is the aria2 name of the option, for example "max-download-limit".
+func (gid *GID) ChangeOption(key string, value string) error {
+	return gid.client.ChangeOption(gid.GID, key, value)
+}
+
 // RemoveDownloadResult removes a completed/error/removed download denoted by gid from memory.
 func (gid *GID) RemoveDownloadResult() error {
 	return gid.client.RemoveDownloadResult(gid.GID)
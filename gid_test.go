@@ -0,0 +1,223 @@
+package arigo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateGID(t *testing.T) {
+	tests := []struct {
+		gid   string
+		valid bool
+	}{
+		{"2089b05ecca3d829", true},
+		{"2089B05ECCA3D829", true},
+		{"", false},
+		{"2089b05ecca3d82", false},
+		{"2089b05ecca3d8290", false},
+		{"2089b05ecca3d82g", false},
+		{" 2089b05ecca3d82", false},
+	}
+
+	for _, test := range tests {
+		err := ValidateGID(test.gid)
+		if test.valid {
+			assert.NoError(t, err, test.gid)
+		} else {
+			assert.True(t, errors.Is(err, ErrInvalidGID), "gid %q: unexpected error %v", test.gid, err)
+		}
+	}
+}
+
+func TestParseGID(t *testing.T) {
+	client := &Client{}
+
+	gid, err := client.ParseGID("2089b05ecca3d829")
+	require.NoError(t, err)
+	assert.Equal(t, "2089b05ecca3d829", gid.String())
+	assert.False(t, gid.IsZero())
+
+	gid, err = client.ParseGID("not a gid")
+	assert.True(t, errors.Is(err, ErrInvalidGID))
+	assert.True(t, gid.IsZero())
+}
+
+func TestParseGIDString(t *testing.T) {
+	gid, err := ParseGID("2089b05ecca3d829")
+	require.NoError(t, err)
+	assert.Equal(t, GIDString("2089b05ecca3d829"), gid)
+	assert.Equal(t, "2089b05ecca3d829", gid.String())
+	assert.False(t, gid.IsZero())
+
+	gid, err = ParseGID("2089b05ecca3d82")
+	assert.True(t, errors.Is(err, ErrInvalidGID))
+	assert.True(t, gid.IsZero())
+}
+
+func TestInvalidGIDNotSent(t *testing.T) {
+	server := newMockServer(t)
+	client := server.dial("")
+
+	_, err := client.TellStatus("")
+	assert.True(t, errors.Is(err, ErrInvalidGID))
+
+	assert.True(t, errors.Is(client.Remove("2089b05ecca3d82"), ErrInvalidGID))
+	assert.True(t, errors.Is(client.Pause("2089b05ecca3d82x"), ErrInvalidGID))
+	assert.True(t, errors.Is(client.Unpause("gid"), ErrInvalidGID))
+
+	_, err = client.GetFiles("")
+	assert.True(t, errors.Is(err, ErrInvalidGID))
+
+	_, err = client.GetURIs("")
+	assert.True(t, errors.Is(err, ErrInvalidGID))
+
+	assert.Empty(t, server.receivedRequests())
+}
+
+func TestWaitUntilComplete(t *testing.T) {
+	interval := waitPollInterval
+	waitPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { waitPollInterval = interval })
+
+	tests := []struct {
+		status string
+		err    error
+	}{
+		{"complete", nil},
+		{"error", ErrDownloadError},
+		{"removed", ErrDownloadStopped},
+	}
+
+	for _, test := range tests {
+		t.Run(test.status, func(t *testing.T) {
+			server := progressServer(t, func(call int) map[string]string {
+				if call < 3 {
+					return map[string]string{"gid": "2089b05ecca3d829", "status": "active", "completedLength": strconv.Itoa(call)}
+				}
+				return map[string]string{"gid": "2089b05ecca3d829", "status": test.status}
+			})
+			server.reply("aria2.addUri", "2089b05ecca3d829")
+
+			// HTTP doesn't deliver notifications, so the status must be polled
+			client, err := Dial(server.httpURL(), "")
+			require.NoError(t, err)
+			defer client.Close()
+
+			gid, err := client.AddURI(URIs("http://example.com/file"), nil)
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			status, err := gid.WaitUntilComplete(ctx)
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, DownloadStatus(test.status), status.Status)
+		})
+	}
+}
+
+func TestGIDContext(t *testing.T) {
+	interval := waitPollInterval
+	waitPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { waitPollInterval = interval })
+
+	for _, status := range []string{"complete", "error"} {
+		status := status
+		t.Run(status, func(t *testing.T) {
+			var finished int32
+			server := progressServer(t, func(int) map[string]string {
+				if atomic.LoadInt32(&finished) == 1 {
+					return map[string]string{"gid": "2089b05ecca3d829", "status": status}
+				}
+				return map[string]string{"gid": "2089b05ecca3d829", "status": "active"}
+			})
+			gid := GID{client: server.dial(""), GID: "2089b05ecca3d829"}
+
+			ctx := gid.Context()
+			select {
+			case <-ctx.Done():
+				t.Fatal("context cancelled while the download is active")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			atomic.StoreInt32(&finished, 1)
+			select {
+			case <-ctx.Done():
+				assert.Equal(t, context.Canceled, ctx.Err())
+			case <-time.After(time.Second):
+				t.Fatal("context not cancelled once the download finished")
+			}
+		})
+	}
+}
+
+func TestGIDContextClientClosed(t *testing.T) {
+	server := progressServer(t, func(int) map[string]string {
+		return map[string]string{"gid": "2089b05ecca3d829", "status": "active"}
+	})
+	client := server.dial("")
+	gid := GID{client: client, GID: "2089b05ecca3d829"}
+
+	ctx := gid.Context()
+	require.NoError(t, client.Close())
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not cancelled once the client was closed")
+	}
+
+	// the status of an unknown download can't be fetched
+	server = newMockServer(t)
+	server.handle("aria2.tellStatus", func([]json.RawMessage) (interface{}, *mockError) {
+		return nil, &mockError{Code: 1, Message: "GID 2089b05ecca3d829 is not found"}
+	})
+	gid = GID{client: server.dial(""), GID: "2089b05ecca3d829"}
+	select {
+	case <-gid.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not cancelled for an unknown download")
+	}
+}
+
+func TestWaitUntilCompleteCancel(t *testing.T) {
+	server := progressServer(t, func(int) map[string]string {
+		return map[string]string{"gid": "2089b05ecca3d829", "status": "active"}
+	})
+	gid := GID{client: server.dial(""), GID: "2089b05ecca3d829"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	status, err := gid.WaitUntilComplete(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, StatusActive, status.Status)
+}
+
+func TestWaitUntilCompletePurged(t *testing.T) {
+	interval := waitPollInterval
+	waitPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { waitPollInterval = interval })
+
+	server := newMockServer(t)
+	var calls int32
+	server.handle("aria2.tellStatus", func([]json.RawMessage) (interface{}, *mockError) {
+		if atomic.AddInt32(&calls, 1) > 2 {
+			return nil, &mockError{Code: 1, Message: "GID 2089b05ecca3d829 is not found"}
+		}
+		return map[string]string{"gid": "2089b05ecca3d829", "status": "active"}, nil
+	})
+	gid := GID{client: server.dial(""), GID: "2089b05ecca3d829"}
+
+	// the download vanishing must end the wait even without a deadline
+	status, err := gid.WaitUntilComplete(context.Background())
+	assert.True(t, errors.Is(err, ErrNotFound), "unexpected error %v", err)
+	assert.Equal(t, StatusActive, status.Status)
+}
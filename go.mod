@@ -8,4 +8,5 @@ require (
 	github.com/cenkalti/rpc2 v0.0.0-20180727162946-9642ea02d0aa
 	github.com/gorilla/websocket v1.4.1
 	github.com/stretchr/testify v1.3.0
+	golang.org/x/time v0.3.0
 )
@@ -0,0 +1,101 @@
+package arigo
+
+import (
+	"context"
+	"time"
+
+	"github.com/Braurbeki/arigo/internal/pkg/wsrpc"
+)
+
+// Health is the result of HealthCheck.
+//
+// The two checks tell the common failures apart:
+//   - TransportOK and RPCOK: aria2 is up and responds
+//   - TransportOK but not RPCOK: the connection is fine, but aria2 doesn't answer calls,
+//     for example because the process hangs or the secret token is wrong
+//   - neither: the connection to aria2 is lost
+type Health struct {
+	// TransportOK is set if the connection to aria2 is alive.
+	// For WebSocket connections, it's checked by a ping frame which aria2 answers
+	// without processing a request.
+	TransportOK bool
+	// TransportLatency is the round-trip time of the ping.
+	// It's zero if the check failed or the client doesn't use a WebSocket connection.
+	TransportLatency time.Duration
+
+	// RPCOK is set if aria2 answered a call to aria2.getVersion.
+	RPCOK bool
+	// RPCLatency is the round-trip time of the call, see Ping. It's zero if the call failed.
+	RPCLatency time.Duration
+}
+
+// HealthCheck checks the connection to aria2 and whether aria2 answers calls,
+// see Health for telling the outcomes apart.
+//
+// The transport is checked first. For clients which don't use a WebSocket connection,
+// there's no ping, TransportOK is the result of IsConnected then.
+// If the transport is down, no call is made.
+// Both checks share ctx, so its deadline should allow for the ping and the call.
+//
+// The returned error is the error of the first failed check, the Health is filled in either way.
+func (c *Client) HealthCheck(ctx context.Context) (Health, error) {
+	var health Health
+
+	if err := c.pingTransport(ctx, &health); err != nil {
+		return health, err
+	}
+	if !health.TransportOK {
+		return health, ErrConnectionLost
+	}
+
+	latency, err := c.Ping(ctx)
+	if err != nil {
+		return health, err
+	}
+	health.RPCOK = true
+	health.RPCLatency = latency
+
+	return health, nil
+}
+
+// pingTransport sends a ping frame on the WebSocket connection of the client
+// and records the outcome in health.
+func (c *Client) pingTransport(ctx context.Context, health *Health) error {
+	if c.transport != nil {
+		health.TransportOK = c.IsConnected()
+		return nil
+	}
+
+	rpcClient := c.getRPCClient()
+	var ws *wsrpc.ReadWriteCloser
+	if rpcClient != nil && rpcClient.State != nil {
+		value, _ := rpcClient.State.Get(wsKey)
+		ws, _ = value.(*wsrpc.ReadWriteCloser)
+	}
+	if ws == nil {
+		health.TransportOK = c.IsConnected()
+		return nil
+	}
+
+	// the pong never arrives once the connection is lost
+	pingCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-rpcClient.DisconnectNotify():
+			cancel()
+		case <-pingCtx.Done():
+		}
+	}()
+
+	latency, err := ws.Ping(pingCtx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ErrConnectionLost
+	}
+	health.TransportOK = true
+	health.TransportLatency = latency
+	return nil
+}
@@ -0,0 +1,74 @@
+package arigo
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthCheck(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getVersion", map[string]interface{}{"version": "1.36.0", "enabledFeatures": []string{}})
+	client := server.dial("")
+
+	health, err := client.HealthCheck(context.Background())
+	require.NoError(t, err)
+	assert.True(t, health.TransportOK)
+	assert.True(t, health.TransportLatency > 0)
+	assert.True(t, health.RPCOK)
+	assert.True(t, health.RPCLatency > 0)
+}
+
+func TestHealthCheckHung(t *testing.T) {
+	server := newMockServer(t)
+	hung := make(chan struct{})
+	defer close(hung)
+	// the connection is served, but aria2 never answers the call
+	server.handle("aria2.getVersion", func([]json.RawMessage) (interface{}, *mockError) {
+		<-hung
+		return nil, nil
+	})
+	client := server.dial("")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	health, err := client.HealthCheck(ctx)
+	assert.Error(t, err)
+	assert.True(t, health.TransportOK)
+	assert.True(t, health.TransportLatency > 0)
+	assert.False(t, health.RPCOK)
+	assert.Equal(t, time.Duration(0), health.RPCLatency)
+}
+
+func TestHealthCheckConnectionLost(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getVersion", map[string]interface{}{"version": "1.36.0", "enabledFeatures": []string{}})
+	client := server.dial("")
+	eventually(t, func() bool { return server.connectionCount() == 1 }, "client didn't connect")
+
+	server.dropConnections()
+	eventually(t, func() bool { return !client.IsConnected() }, "connection wasn't lost")
+
+	health, err := client.HealthCheck(context.Background())
+	assert.Equal(t, ErrConnectionLost, err)
+	assert.Equal(t, Health{}, health)
+	assert.Empty(t, server.receivedRequests(), "no call must be made without a connection")
+}
+
+func TestHealthCheckHTTP(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getVersion", map[string]interface{}{"version": "1.36.0", "enabledFeatures": []string{}})
+	client, err := Dial(server.httpURL(), "")
+	require.NoError(t, err)
+	defer client.Close()
+
+	health, err := client.HealthCheck(context.Background())
+	require.NoError(t, err)
+	assert.True(t, health.TransportOK)
+	assert.Equal(t, time.Duration(0), health.TransportLatency)
+	assert.True(t, health.RPCOK)
+}
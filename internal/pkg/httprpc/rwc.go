@@ -0,0 +1,159 @@
+// Package httprpc provides a ReadWriteCloser which sends JSON-RPC requests
+// using HTTP POST requests.
+package httprpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// ReadWriteCloser is a rwc based on HTTP POST requests.
+//
+// Every Write is sent as the body of a separate POST request, so each Write must
+// contain exactly one JSON-RPC request. The requests are sent concurrently.
+// The bodies of the responses can be read using Read in the order they arrive.
+//
+// If a request fails before the server responded, a JSON-RPC error response with
+// code 0 is synthesized for it, so the caller waiting for the response is notified.
+// HTTP doesn't allow the server to send notifications, Read only ever returns responses.
+type ReadWriteCloser struct {
+	url    string
+	client *http.Client
+	header http.Header
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	pr      *io.PipeReader
+	pwMu    sync.Mutex // serializes the writes of response bodies
+	pw      *io.PipeWriter
+	closeMu sync.Once
+}
+
+// NewReadWriteCloser creates a new rwc which posts the requests to url using client.
+// If client is nil, http.DefaultClient is used.
+// header is added to every request and may be nil.
+func NewReadWriteCloser(url string, client *http.Client, header http.Header) *ReadWriteCloser {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	pr, pw := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &ReadWriteCloser{
+		url:    url,
+		client: client,
+		header: header,
+		ctx:    ctx,
+		cancel: cancel,
+		pr:     pr,
+		pw:     pw,
+	}
+}
+
+// Read reads the bodies of the responses.
+// It returns io.EOF once the rwc is closed.
+func (rwc *ReadWriteCloser) Read(p []byte) (int, error) {
+	return rwc.pr.Read(p)
+}
+
+// Write sends p as the body of a POST request.
+// It returns without waiting for the response.
+func (rwc *ReadWriteCloser) Write(p []byte) (int, error) {
+	if rwc.ctx.Err() != nil {
+		return 0, io.ErrClosedPipe
+	}
+
+	body := append([]byte(nil), p...)
+	go rwc.post(body)
+
+	return len(p), nil
+}
+
+// post sends the request and passes the response to the reader.
+func (rwc *ReadWriteCloser) post(body []byte) {
+	resp := rwc.do(body)
+	if resp == nil {
+		return
+	}
+
+	rwc.pwMu.Lock()
+	defer rwc.pwMu.Unlock()
+
+	_, _ = rwc.pw.Write(resp)
+}
+
+// do sends the request and returns the body of the response.
+// It returns nil if there's no one waiting for the response.
+func (rwc *ReadWriteCloser) do(body []byte) []byte {
+	req, err := http.NewRequest(http.MethodPost, rwc.url, bytes.NewReader(body))
+	if err != nil {
+		return errorResponse(body, err)
+	}
+	req = req.WithContext(rwc.ctx)
+
+	for key, values := range rwc.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := rwc.client.Do(req)
+	if err != nil {
+		if rwc.ctx.Err() != nil {
+			return nil
+		}
+		return errorResponse(body, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errorResponse(body, err)
+	}
+
+	// aria2 sends errors with an error status but a regular JSON-RPC body
+	if !json.Valid(data) {
+		return errorResponse(body, fmt.Errorf("unexpected response %s", resp.Status))
+	}
+
+	return data
+}
+
+// errorResponse creates a JSON-RPC error response for the request in body.
+// It returns nil if the request is a notification.
+func errorResponse(body []byte, err error) []byte {
+	var req struct {
+		ID *json.RawMessage `json:"id"`
+	}
+	if json.Unmarshal(body, &req) != nil || req.ID == nil {
+		return nil
+	}
+
+	resp, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      req.ID,
+		"error": map[string]interface{}{
+			"code":    0,
+			"message": "httprpc: " + err.Error(),
+		},
+	})
+	return resp
+}
+
+// Close aborts all pending requests.
+// Read returns io.EOF afterwards.
+func (rwc *ReadWriteCloser) Close() error {
+	rwc.closeMu.Do(func() {
+		rwc.cancel()
+		_ = rwc.pw.Close()
+	})
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package httprpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRWC starts an HTTP server using handler and returns a rwc posting to it.
+func newTestRWC(t *testing.T, handler http.HandlerFunc) *ReadWriteCloser {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	rwc := NewReadWriteCloser(server.URL, nil, nil)
+	t.Cleanup(func() { _ = rwc.Close() })
+	return rwc
+}
+
+func TestRoundTrip(t *testing.T) {
+	rwc := newTestRWC(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		body, _ := ioutil.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	})
+
+	_, err := rwc.Write([]byte(`{"id":"1","method":"echo"}`))
+	require.NoError(t, err)
+
+	var resp map[string]interface{}
+	require.NoError(t, json.NewDecoder(rwc).Decode(&resp))
+	assert.Equal(t, "1", resp["id"])
+	assert.Equal(t, "echo", resp["method"])
+}
+
+func TestErrorResponse(t *testing.T) {
+	rwc := newTestRWC(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+
+	_, err := rwc.Write([]byte(`{"id":"7","method":"aria2.getVersion"}`))
+	require.NoError(t, err)
+
+	var resp struct {
+		ID    string `json:"id"`
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.NewDecoder(rwc).Decode(&resp))
+	assert.Equal(t, "7", resp.ID)
+	assert.Equal(t, 0, resp.Error.Code)
+	assert.Contains(t, resp.Error.Message, "404")
+}
+
+func TestClose(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	rwc := newTestRWC(t, func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	})
+
+	_, err := rwc.Write([]byte(`{"id":"1","method":"aria2.getVersion"}`))
+	require.NoError(t, err)
+
+	require.NoError(t, rwc.Close())
+
+	_, err = bufio.NewReader(rwc).ReadByte()
+	assert.Equal(t, io.EOF, err)
+
+	_, err = rwc.Write([]byte(`{}`))
+	assert.Equal(t, io.ErrClosedPipe, err)
+}
@@ -0,0 +1,65 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Encoder writes JSON values to a stream.
+// Every call of Encode must write the value, followed by a newline, using a single Write,
+// because the WebSocket transport sends every Write as a separate message.
+// json.Encoder satisfies it.
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder reads successive JSON values from a stream.
+// json.Decoder satisfies it.
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// Encoding is the JSON implementation used by a codec to encode and decode messages.
+// It must support the struct tags and the json.Marshaler and json.Unmarshaler
+// interfaces just like encoding/json.
+type Encoding interface {
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// CopyingEncoding is an Encoding which knows whether its Unmarshal copies all data
+// it keeps, like encoding/json does.
+// If CopiesData returns true, codecs read the results of responses into pooled buffers,
+// which are reused once the result was decoded.
+type CopyingEncoding interface {
+	Encoding
+	CopiesData() bool
+}
+
+// copiesData reports whether encoding is a CopyingEncoding which copies all data.
+func copiesData(encoding Encoding) bool {
+	c, ok := encoding.(CopyingEncoding)
+	return ok && c.CopiesData()
+}
+
+// StdEncoding is the Encoding using encoding/json. It's used by default.
+var StdEncoding Encoding = stdEncoding{}
+
+type stdEncoding struct{}
+
+func (stdEncoding) NewEncoder(w io.Writer) Encoder {
+	return json.NewEncoder(w)
+}
+
+func (stdEncoding) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
+
+func (stdEncoding) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (stdEncoding) CopiesData() bool {
+	return true
+}
@@ -0,0 +1,80 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// Request is the envelope of an outgoing request or notification, as passed to a request interceptor.
+type Request struct {
+	Method string
+	Params []interface{}
+	// ID is the id of the request, it's empty for notifications.
+	ID string
+	// Fields holds additional members of the envelope, for example "x-trace": "abc".
+	// They don't replace the method, params and id members.
+	Fields map[string]interface{}
+}
+
+// Response is the envelope of an incoming response, as passed to a response interceptor.
+type Response struct {
+	ID     string
+	Result json.RawMessage // nil if the response has no result
+	Error  interface{}     // decoded error member, nil if the response has none
+}
+
+// Interceptors inspect or modify the envelopes exchanged by a codec.
+// Any of them may be nil.
+type Interceptors struct {
+	// Request is called before a request or notification is written.
+	// If it returns an error, the message isn't written and the call fails with the error.
+	Request func(req *Request) error
+	// Response is called for every response read, before it's matched to its request.
+	Response func(resp *Response)
+	// Unmatched is called with the id of every response which doesn't belong to a pending request,
+	// for example a duplicate response, before the response is discarded.
+	Unmatched func(id string)
+}
+
+// envelope returns the value encoded for req using the envelope of version.
+func (req *Request) envelope(version Version) interface{} {
+	if len(req.Fields) == 0 {
+		if version == Version1 {
+			return &clientRequestV1{Method: req.Method, Params: req.Params, Id: req.idV1()}
+		}
+
+		msg := &clientRequest{JSONRPC: version, Method: req.Method, Params: req.Params}
+		if req.ID != "" {
+			msg.Id = &req.ID
+		}
+		return msg
+	}
+
+	msg := make(map[string]interface{}, len(req.Fields)+4)
+	if version != Version1 {
+		msg["jsonrpc"] = version
+	}
+	for key, value := range req.Fields {
+		msg[key] = value
+	}
+	msg["method"] = req.Method
+	msg["params"] = req.Params
+	if version == Version1 {
+		msg["id"] = req.idV1()
+	} else if req.ID != "" {
+		msg["id"] = req.ID
+	}
+	return msg
+}
+
+// idV1 returns the id of req in a JSON-RPC 1.0 envelope.
+// The ids assigned by the codec are sent as numbers, a notification has a null id.
+func (req *Request) idV1() interface{} {
+	if req.ID == "" {
+		return nil
+	}
+	if id, err := strconv.ParseUint(req.ID, 10, 64); err == nil {
+		return id
+	}
+	return req.ID
+}
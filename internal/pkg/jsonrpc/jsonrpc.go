@@ -7,15 +7,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/cenkalti/rpc2"
 )
 
 type jsonCodec struct {
-	dec *json.Decoder // for reading JSON values
-	enc *json.Encoder // for writing JSON values
-	c   io.Closer
+	dec      Decoder  // for reading JSON values
+	enc      Encoder  // for writing JSON values
+	encoding Encoding // for decoding the params and results
+	c        io.Closer
 
 	// temporary work space
 	msg            message
@@ -28,21 +32,79 @@ type jsonCodec struct {
 	// but save the original request ID in the pending map.
 	// When rpc responds, we use the sequence number in
 	// the response to find the original request ID.
-	mutex   sync.Mutex // protects seq, pending
+	mutex   sync.Mutex // protects seq, pending, clientPending
 	pending map[uint64]*json.RawMessage
 	seq     uint64
+
+	// Outgoing requests get their id from ids instead of the rpc2 sequence number,
+	// clientPending maps the ids back to the sequence numbers of the pending requests.
+	ids           *uint64
+	clientPending map[string]uint64
+
+	interceptors Interceptors
+
+	// version is the protocol version of the envelopes written by WriteRequest.
+	version Version
+
+	// pool is set if the results of responses are decoded into pooled buffers,
+	// resultBuf is the buffer of the current message, see acquireResult.
+	pool      bool
+	resultBuf *json.RawMessage
 }
 
 // NewJSONCodec returns a new rpc2.Codec using JSON-RPC on conn.
 func NewJSONCodec(conn io.ReadWriteCloser) rpc2.Codec {
+	return NewJSONCodecWithIDs(conn, new(uint64))
+}
+
+// NewJSONCodecWithIDs is like NewJSONCodec but generates the ids of requests by
+// atomically incrementing ids. The ids are sent as strings.
+// Codecs sharing ids never use the same request id twice,
+// no matter how many requests are in-flight.
+func NewJSONCodecWithIDs(conn io.ReadWriteCloser, ids *uint64) rpc2.Codec {
+	return NewJSONCodecWithEncoding(conn, ids, StdEncoding)
+}
+
+// NewJSONCodecWithEncoding is like NewJSONCodecWithIDs but encodes and decodes
+// all messages using encoding instead of encoding/json.
+func NewJSONCodecWithEncoding(conn io.ReadWriteCloser, ids *uint64, encoding Encoding) rpc2.Codec {
+	return NewJSONCodecWithInterceptors(conn, ids, encoding, Interceptors{})
+}
+
+// NewJSONCodecWithInterceptors is like NewJSONCodecWithEncoding but passes the envelopes
+// of outgoing requests and incoming responses to interceptors.
+func NewJSONCodecWithInterceptors(conn io.ReadWriteCloser, ids *uint64, encoding Encoding, interceptors Interceptors) rpc2.Codec {
+	return NewJSONCodecWithVersion(conn, ids, encoding, interceptors, Version2)
+}
+
+// NewJSONCodecWithVersion is like NewJSONCodecWithInterceptors but writes requests using
+// the envelopes of version. Responses of both versions are accepted.
+func NewJSONCodecWithVersion(conn io.ReadWriteCloser, ids *uint64, encoding Encoding, interceptors Interceptors, version Version) rpc2.Codec {
 	return &jsonCodec{
-		dec:     json.NewDecoder(conn),
-		enc:     json.NewEncoder(conn),
-		c:       conn,
-		pending: make(map[uint64]*json.RawMessage),
+		dec:           encoding.NewDecoder(conn),
+		enc:           encoding.NewEncoder(conn),
+		encoding:      encoding,
+		c:             conn,
+		pending:       make(map[uint64]*json.RawMessage),
+		ids:           ids,
+		clientPending: make(map[string]uint64),
+		interceptors:  interceptors,
+		version:       version,
+		pool:          copiesData(encoding) && interceptors.Response == nil,
 	}
 }
 
+// Version is a JSON-RPC protocol version.
+type Version string
+
+const (
+	// Version2 envelopes have a "jsonrpc": "2.0" member, it's the default.
+	Version2 Version = "2.0"
+	// Version1 envelopes have no jsonrpc member, requests have numeric ids
+	// and notifications are requests with a null id.
+	Version1 Version = "1.0"
+)
+
 // serverRequest and clientResponse combined
 type message struct {
 	Method string           `json:"method"`
@@ -59,7 +121,7 @@ type serverRequest struct {
 	Id     *json.RawMessage `json:"id"`
 }
 type clientResponse struct {
-	Id     uint64           `json:"id"`
+	Id     string           `json:"id"`
 	Result *json.RawMessage `json:"result"`
 	Error  interface{}      `json:"error"`
 }
@@ -71,16 +133,35 @@ type serverResponse struct {
 	Error  interface{}      `json:"error"`
 }
 type clientRequest struct {
+	JSONRPC Version       `json:"jsonrpc"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+	Id      *string       `json:"id,omitempty"` // nil for notifications
+}
+
+// clientRequestV1 is a JSON-RPC 1.0 request, it has no jsonrpc member
+// and notifications have a null id.
+type clientRequestV1 struct {
 	Method string        `json:"method"`
 	Params []interface{} `json:"params"`
-	Id     *uint64       `json:"id"`
+	Id     interface{}   `json:"id"`
 }
 
+// ReadHeader reads the next message.
+// Messages with a method are requests or notifications sent by the peer,
+// all other messages are responses to the requests sent by WriteRequest
+// and are matched to them by their id, so a notification received while
+// a request is pending is never mistaken for its response.
 func (c *jsonCodec) ReadHeader(req *rpc2.Request, resp *rpc2.Response) error {
-	c.msg = message{}
+	c.releaseResult()
+	c.msg = message{Result: c.acquireResult()}
 	if err := c.dec.Decode(&c.msg); err != nil {
 		return err
 	}
+	if c.msg.Result != nil && len(*c.msg.Result) == 0 {
+		// the pooled buffer wasn't filled, the message has no result
+		c.msg.Result = nil
+	}
 
 	if c.msg.Method != "" {
 		// request comes to server
@@ -93,8 +174,9 @@ func (c *jsonCodec) ReadHeader(req *rpc2.Request, resp *rpc2.Response) error {
 		// JSON request id can be any JSON value;
 		// RPC package expects uint64.  Translate to
 		// internal uint64 and save JSON on the side.
-		if c.serverRequest.Id == nil {
-			// Notification
+		if c.serverRequest.Id == nil || string(*c.serverRequest.Id) == "null" {
+			// Notification, a null id can't be responded to either
+			c.serverRequest.Id = nil
 		} else {
 			c.mutex.Lock()
 			c.seq++
@@ -105,15 +187,33 @@ func (c *jsonCodec) ReadHeader(req *rpc2.Request, resp *rpc2.Response) error {
 		}
 	} else {
 		// response comes to client
-		err := json.Unmarshal(*c.msg.Id, &c.clientResponse.Id)
+		id, err := parseID(c.msg.Id)
 		if err != nil {
 			return err
 		}
+		c.clientResponse.Id = id
 		c.clientResponse.Result = c.msg.Result
 		c.clientResponse.Error = c.msg.Error
+		if c.interceptors.Response != nil {
+			c.interceptResponse()
+		}
+
+		// Responses with an unknown id get the sequence number 0,
+		// which is never pending, so rpc2 discards them.
+		c.mutex.Lock()
+		seq, ok := c.clientPending[id]
+		delete(c.clientPending, id)
+		c.mutex.Unlock()
+		if !ok && c.interceptors.Unmatched != nil {
+			c.interceptors.Unmatched(id)
+		}
 
 		resp.Error = ""
-		resp.Seq = c.clientResponse.Id
+		resp.Seq = seq
+		if c.version == Version1 && c.clientResponse.Error == nil && c.clientResponse.Result == nil {
+			// JSON-RPC 1.0 responses always have a result, which is null only if the call succeeded without one
+			c.clientResponse.Result = &null
+		}
 		if c.clientResponse.Error != nil || c.clientResponse.Result == nil {
 			resp.Error = formatError(c.clientResponse.Error)
 			if resp.Error == "" {
@@ -124,6 +224,36 @@ func (c *jsonCodec) ReadHeader(req *rpc2.Request, resp *rpc2.Response) error {
 	return nil
 }
 
+// parseID converts the id of a response to the format used by WriteRequest.
+// Numeric ids are accepted as well, a missing or null id results in an empty string.
+func parseID(raw *json.RawMessage) (string, error) {
+	if raw == nil || string(*raw) == "null" {
+		return "", nil
+	}
+
+	var id string
+	if err := json.Unmarshal(*raw, &id); err == nil {
+		return id, nil
+	}
+
+	var num uint64
+	if err := json.Unmarshal(*raw, &num); err != nil {
+		return "", fmt.Errorf("jsonrpc: invalid response id %s", *raw)
+	}
+	return strconv.FormatUint(num, 10), nil
+}
+
+// Error is a JSON-RPC 2.0 error object.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// errorPrefix marks error strings which hold an encoded Error.
+const errorPrefix = "jsonrpc error "
+
+// formatError converts the error of a response to a string for rpc2.
+// JSON-RPC 2.0 error objects are encoded so that ParseError can recover the code.
 func formatError(errVal interface{}) string {
 	switch e := errVal.(type) {
 	case nil:
@@ -133,7 +263,12 @@ func formatError(errVal interface{}) string {
 	case map[string]interface{}:
 		// JSON-RPC 2.0 error object: {"code":..., "message":..., "data":...}
 		if msg, ok := e["message"].(string); ok {
-			return msg
+			code, _ := e["code"].(float64)
+			data, err := json.Marshal(Error{Code: int(code), Message: msg})
+			if err != nil {
+				return msg
+			}
+			return errorPrefix + string(data)
 		}
 		return fmt.Sprintf("rpc error: %v", e)
 	default:
@@ -141,6 +276,20 @@ func formatError(errVal interface{}) string {
 	}
 }
 
+// ParseError recovers the Error from the error string of an rpc2.ServerError returned by the codec.
+// If the server didn't respond with an error object, it returns an Error with code 0 and
+// the error string as message.
+func ParseError(serverErr string) Error {
+	if strings.HasPrefix(serverErr, errorPrefix) {
+		var e Error
+		if err := json.Unmarshal([]byte(serverErr[len(errorPrefix):]), &e); err == nil {
+			return e
+		}
+	}
+
+	return Error{Message: serverErr}
+}
+
 var errMissingParams = errors.New("jsonrpc: request body missing params")
 
 func (c *jsonCodec) ReadRequestBody(x interface{}) error {
@@ -150,44 +299,111 @@ func (c *jsonCodec) ReadRequestBody(x interface{}) error {
 	if c.serverRequest.Params == nil {
 		return errMissingParams
 	}
-	var params *[]interface{}
+	var params interface{}
 	switch x := x.(type) {
-	case *[]interface{}:
+	case *[]interface{}, *[]json.RawMessage:
 		params = x
 	default:
 		params = &[]interface{}{x}
 	}
-	return json.Unmarshal(*c.serverRequest.Params, params)
+	return c.encoding.Unmarshal(*c.serverRequest.Params, params)
 }
 
 func (c *jsonCodec) ReadResponseBody(x interface{}) error {
+	defer c.releaseResult()
+
 	if x == nil {
 		return nil
 	}
-	return json.Unmarshal(*c.clientResponse.Result, x)
+	return c.encoding.Unmarshal(*c.clientResponse.Result, x)
+}
+
+// interceptResponse passes the response in clientResponse to the response interceptor
+// and applies its changes.
+func (c *jsonCodec) interceptResponse() {
+	resp := &Response{ID: c.clientResponse.Id, Error: c.clientResponse.Error}
+	if c.clientResponse.Result != nil {
+		resp.Result = *c.clientResponse.Result
+	}
+
+	c.interceptors.Response(resp)
+
+	c.clientResponse.Id = resp.ID
+	c.clientResponse.Error = resp.Error
+	c.clientResponse.Result = nil
+	if resp.Result != nil {
+		c.clientResponse.Result = &resp.Result
+	}
 }
 
 func (c *jsonCodec) WriteRequest(r *rpc2.Request, param interface{}) error {
-	req := &clientRequest{Method: r.Method}
+	req := &Request{Method: r.Method}
 	switch param := param.(type) {
 	case []interface{}:
 		req.Params = param
 	default:
 		req.Params = []interface{}{param}
 	}
+	if r.Seq != 0 {
+		req.ID = c.nextID()
+	}
+
+	if c.interceptors.Request != nil {
+		if err := c.interceptors.Request(req); err != nil {
+			return err
+		}
+	}
 	if r.Seq == 0 {
-		// Notification
-		req.Id = nil
-	} else {
-		seq := r.Seq
-		req.Id = &seq
+		// Notification, it doesn't get a response
+		return c.enc.Encode(req.envelope(c.version))
+	}
+
+	id := req.ID
+	if id == "" {
+		// the response couldn't be matched to the call, which would never return
+		return errors.New("jsonrpc: the request interceptor removed the request id")
+	}
+	c.mutex.Lock()
+	if _, ok := c.clientPending[id]; ok {
+		// the request interceptor changed the id to the one of a pending request
+		c.mutex.Unlock()
+		return fmt.Errorf("jsonrpc: request id %s is already in use", id)
+	}
+	c.clientPending[id] = r.Seq
+	c.mutex.Unlock()
+
+	err := c.enc.Encode(req.envelope(c.version))
+	if err != nil {
+		c.mutex.Lock()
+		delete(c.clientPending, id)
+		c.mutex.Unlock()
+	}
+	return err
+}
+
+// nextID returns the id of the next request.
+// Ids of pending requests are skipped, so a response is never matched to the wrong request,
+// even after ids wrapped around.
+func (c *jsonCodec) nextID() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for {
+		id := strconv.FormatUint(atomic.AddUint64(c.ids, 1), 10)
+		if _, ok := c.clientPending[id]; !ok {
+			return id
+		}
 	}
-	return c.enc.Encode(req)
 }
 
 var null = json.RawMessage([]byte("null"))
 
 func (c *jsonCodec) WriteResponse(r *rpc2.Response, x interface{}) error {
+	if r.Seq == 0 {
+		// Notifications don't get a response
+		return nil
+	}
+
 	c.mutex.Lock()
 	b, ok := c.pending[r.Seq]
 	if !ok {
@@ -0,0 +1,276 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rpc2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name     string
+		errVal   interface{}
+		expected Error
+	}{
+		{"error object", map[string]interface{}{"code": float64(1), "message": "Unauthorized"}, Error{Code: 1, Message: "Unauthorized"}},
+		{"negative code", map[string]interface{}{"code": float64(-32700), "message": "Parse error."}, Error{Code: -32700, Message: "Parse error."}},
+		{"string", "something failed", Error{Message: "something failed"}},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, ParseError(formatError(test.errVal)), test.name)
+	}
+}
+
+// testConn is a connection which reads the given data.
+type testConn struct {
+	io.Reader
+	io.Writer
+}
+
+func (testConn) Close() error {
+	return nil
+}
+
+func TestReadHeaderResponseID(t *testing.T) {
+	data := `{"jsonrpc":"2.0","id":"1","result":"OK"}
+{"jsonrpc":"2.0","id":2,"result":"OK"}
+{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"Parse error."}}
+{"jsonrpc":"2.0","id":"unknown","result":"OK"}
+`
+	var buf bytes.Buffer
+	codec := NewJSONCodec(testConn{strings.NewReader(data), &buf})
+
+	// send two requests, so the responses match them
+	for seq := uint64(5); seq < 7; seq++ {
+		require.NoError(t, codec.WriteRequest(&rpc2.Request{Seq: seq, Method: "aria2.getVersion"}, nil))
+	}
+	assert.Contains(t, buf.String(), `"id":"1"`)
+	assert.Contains(t, buf.String(), `"id":"2"`)
+
+	for _, expected := range []uint64{5, 6, 0, 0} {
+		var resp rpc2.Response
+		require.NoError(t, codec.ReadHeader(&rpc2.Request{}, &resp))
+		assert.Equal(t, expected, resp.Seq)
+		require.NoError(t, codec.ReadResponseBody(nil))
+	}
+}
+
+func TestDuplicateResponse(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close()
+
+	unmatched := make(chan string, 1)
+	interceptors := Interceptors{Unmatched: func(id string) { unmatched <- id }}
+	client := rpc2.NewClientWithCodec(NewJSONCodecWithInterceptors(clientConn, new(uint64), StdEncoding, interceptors))
+	defer client.Close()
+	go client.Run()
+
+	go func() {
+		dec := json.NewDecoder(serverConn)
+		var ids []string
+		for len(ids) < 2 {
+			var req struct {
+				ID string `json:"id"`
+			}
+			if dec.Decode(&req) != nil {
+				return
+			}
+			ids = append(ids, req.ID)
+		}
+
+		// the response to the first call is replayed while the second one is still in-flight
+		for _, id := range []string{ids[0], ids[0], ids[1]} {
+			_, _ = fmt.Fprintf(serverConn, `{"jsonrpc":"2.0","id":%q,"result":%q}`, id, "result "+id)
+		}
+	}()
+
+	calls := make([]*rpc2.Call, 2)
+	replies := make([]string, 2)
+	for i := range calls {
+		calls[i] = client.Go("custom.method", nil, &replies[i], make(chan *rpc2.Call, 1))
+	}
+	for i, call := range calls {
+		select {
+		case <-call.Done:
+			require.NoError(t, call.Error)
+		case <-time.After(time.Second):
+			t.Fatal("call didn't finish")
+		}
+		assert.Equal(t, fmt.Sprintf("result %d", i+1), replies[i])
+	}
+
+	select {
+	case id := <-unmatched:
+		assert.Equal(t, "1", id)
+	case <-time.After(time.Second):
+		t.Fatal("duplicate response wasn't reported")
+	}
+}
+
+func TestPendingIDNotReused(t *testing.T) {
+	ids := new(uint64)
+	codec := NewJSONCodecWithIDs(testConn{strings.NewReader(""), ioutil.Discard}, ids)
+
+	require.NoError(t, codec.WriteRequest(&rpc2.Request{Seq: 5, Method: "aria2.getVersion"}, nil))
+	// simulate a wraparound of the ids while the first request is pending
+	*ids = 0
+	require.NoError(t, codec.WriteRequest(&rpc2.Request{Seq: 6, Method: "aria2.getVersion"}, nil))
+	assert.Equal(t, map[string]uint64{"1": 5, "2": 6}, codec.(*jsonCodec).clientPending)
+
+	interceptors := Interceptors{Request: func(req *Request) error {
+		req.ID = "1"
+		return nil
+	}}
+	codec = NewJSONCodecWithInterceptors(testConn{strings.NewReader(""), ioutil.Discard}, ids, StdEncoding, interceptors)
+	require.NoError(t, codec.WriteRequest(&rpc2.Request{Seq: 5, Method: "aria2.getVersion"}, nil))
+	assert.Error(t, codec.WriteRequest(&rpc2.Request{Seq: 6, Method: "aria2.getVersion"}, nil),
+		"an interceptor must not reuse the id of a pending request")
+}
+
+func TestWriteNotification(t *testing.T) {
+	var buf bytes.Buffer
+	codec := NewJSONCodec(testConn{strings.NewReader(""), &buf})
+
+	require.NoError(t, codec.WriteRequest(&rpc2.Request{Method: "custom.notify"}, []interface{}{"value"}))
+	assert.JSONEq(t, `{"jsonrpc":"2.0","method":"custom.notify","params":["value"]}`, buf.String())
+	assert.Empty(t, codec.(*jsonCodec).clientPending)
+}
+
+func TestProtocolVersion(t *testing.T) {
+	tests := []struct {
+		version      Version
+		request      string
+		notification string
+		responses    string
+	}{
+		{
+			Version2,
+			`{"jsonrpc":"2.0","id":"1","method":"aria2.getVersion","params":["token:secret"]}`,
+			`{"jsonrpc":"2.0","method":"custom.notify","params":["value"]}`,
+			`{"jsonrpc":"2.0","id":"1","result":{"version":"1.36.0"}}
+{"jsonrpc":"2.0","id":"2","error":{"code":1,"message":"Unauthorized"}}
+`,
+		},
+		{
+			Version1,
+			`{"id":1,"method":"aria2.getVersion","params":["token:secret"]}`,
+			`{"id":null,"method":"custom.notify","params":["value"]}`,
+			`{"id":1,"result":{"version":"1.36.0"},"error":null}
+{"id":2,"result":null,"error":{"code":1,"message":"Unauthorized"}}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		codec := NewJSONCodecWithVersion(testConn{strings.NewReader(test.responses), &buf}, new(uint64), StdEncoding, Interceptors{}, test.version)
+
+		require.NoError(t, codec.WriteRequest(&rpc2.Request{Seq: 5, Method: "aria2.getVersion"}, []interface{}{"token:secret"}))
+		assert.JSONEq(t, test.request, buf.String(), test.version)
+		buf.Reset()
+		require.NoError(t, codec.WriteRequest(&rpc2.Request{Seq: 6, Method: "aria2.getVersion"}, []interface{}{"token:secret"}))
+		buf.Reset()
+		require.NoError(t, codec.WriteRequest(&rpc2.Request{Method: "custom.notify"}, []interface{}{"value"}))
+		assert.JSONEq(t, test.notification, buf.String(), test.version)
+
+		var resp rpc2.Response
+		require.NoError(t, codec.ReadHeader(&rpc2.Request{}, &resp))
+		assert.Equal(t, uint64(5), resp.Seq, test.version)
+		assert.Empty(t, resp.Error, test.version)
+		var version map[string]string
+		require.NoError(t, codec.ReadResponseBody(&version))
+		assert.Equal(t, map[string]string{"version": "1.36.0"}, version, test.version)
+
+		require.NoError(t, codec.ReadHeader(&rpc2.Request{}, &resp))
+		assert.Equal(t, uint64(6), resp.Seq, test.version)
+		assert.Equal(t, Error{Code: 1, Message: "Unauthorized"}, ParseError(resp.Error), test.version)
+		require.NoError(t, codec.ReadResponseBody(nil))
+	}
+}
+
+func TestVersion1NullResult(t *testing.T) {
+	data := `{"id":1,"result":null,"error":null}
+`
+	codec := NewJSONCodecWithVersion(testConn{strings.NewReader(data), ioutil.Discard}, new(uint64), StdEncoding, Interceptors{}, Version1)
+	require.NoError(t, codec.WriteRequest(&rpc2.Request{Seq: 5, Method: "custom.method"}, nil))
+
+	// a 1.0 response without an error succeeded, even if its result is null
+	var resp rpc2.Response
+	require.NoError(t, codec.ReadHeader(&rpc2.Request{}, &resp))
+	assert.Equal(t, uint64(5), resp.Seq)
+	assert.Empty(t, resp.Error)
+	var result interface{}
+	require.NoError(t, codec.ReadResponseBody(&result))
+	assert.Nil(t, result)
+}
+
+func TestNotificationBetweenRequestAndResponse(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close()
+
+	client := rpc2.NewClientWithCodec(NewJSONCodec(clientConn))
+	defer client.Close()
+
+	notified := make(chan string, 2)
+	client.Handle("aria2.onDownloadStart", func(_ *rpc2.Client, params map[string]string, _ *interface{}) error {
+		notified <- params["gid"]
+		return nil
+	})
+	go client.Run()
+
+	go func() {
+		dec := json.NewDecoder(serverConn)
+		var req struct {
+			ID string `json:"id"`
+		}
+		if dec.Decode(&req) != nil {
+			return
+		}
+
+		// the notifications look like a response to a tellStatus call, but must not be treated as one
+		_, _ = io.WriteString(serverConn, `{"jsonrpc":"2.0","method":"aria2.onDownloadStart","params":[{"gid":"2089b05ecca3d829"}]}`)
+		_, _ = io.WriteString(serverConn, `{"jsonrpc":"2.0","id":null,"method":"aria2.onDownloadStart","params":[{"gid":"0123456789abcdef"}]}`)
+		_, _ = fmt.Fprintf(serverConn, `{"jsonrpc":"2.0","id":%q,"result":{"gid":"d0b0e7c087a1d2ba","status":"active"}}`, req.ID)
+	}()
+
+	var status map[string]string
+	require.NoError(t, client.Call("aria2.tellStatus", []string{"d0b0e7c087a1d2ba"}, &status))
+	assert.Equal(t, map[string]string{"gid": "d0b0e7c087a1d2ba", "status": "active"}, status)
+
+	// notification handlers run concurrently, so they may finish in any order
+	received := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case gid := <-notified:
+			received[gid] = true
+		case <-time.After(time.Second):
+			t.Fatal("notification wasn't dispatched")
+		}
+	}
+	assert.Equal(t, map[string]bool{"2089b05ecca3d829": true, "0123456789abcdef": true}, received)
+}
+
+func TestUnknownNotification(t *testing.T) {
+	var buf bytes.Buffer
+	conn := testConn{strings.NewReader(`{"jsonrpc":"2.0","method":"aria2.onUnknown","params":[]}`), &buf}
+	codec := NewJSONCodec(conn)
+
+	var req rpc2.Request
+	require.NoError(t, codec.ReadHeader(&req, &rpc2.Response{}))
+	assert.Equal(t, "aria2.onUnknown", req.Method)
+
+	// rpc2 responds to notifications without a handler, which must neither fail nor send anything
+	require.NoError(t, codec.WriteResponse(&rpc2.Response{Seq: req.Seq, Error: "rpc2: can't find method"}, nil))
+	assert.Empty(t, buf.String())
+}
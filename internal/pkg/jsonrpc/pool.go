@@ -0,0 +1,48 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// maxPooledResult is the capacity above which result buffers aren't returned to the pool,
+// so a single huge response doesn't keep its memory alive.
+const maxPooledResult = 64 * 1024
+
+// resultPool holds the buffers the results of responses are decoded into.
+// They are shared by all codecs, and reused once the result was decoded by ReadResponseBody.
+var resultPool = sync.Pool{
+	New: func() interface{} { return new(json.RawMessage) },
+}
+
+// acquireResult returns a buffer for the result of the next message,
+// or nil if results aren't pooled by c.
+//
+// Results are only pooled if they are decoded by a CopyingEncoding which copies all data
+// out of the buffer, like encoding/json, and if there's no response interceptor which could keep it.
+func (c *jsonCodec) acquireResult() *json.RawMessage {
+	if !c.pool {
+		return nil
+	}
+
+	buf := resultPool.Get().(*json.RawMessage)
+	*buf = (*buf)[:0]
+	c.resultBuf = buf
+	return buf
+}
+
+// releaseResult returns the buffer of the current result to the pool.
+// The result must not be used afterwards.
+func (c *jsonCodec) releaseResult() {
+	buf := c.resultBuf
+	if buf == nil {
+		return
+	}
+
+	c.resultBuf = nil
+	c.msg.Result = nil
+	c.clientResponse.Result = nil
+	if cap(*buf) <= maxPooledResult {
+		resultPool.Put(buf)
+	}
+}
@@ -0,0 +1,137 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/cenkalti/rpc2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPooledResults(t *testing.T) {
+	data := `{"jsonrpc":"2.0","id":"1","result":{"gid":"2089b05ecca3d829","status":"active"}}
+{"jsonrpc":"2.0","id":"2","result":[{"gid":"d2703803b52216d1"}]}
+{"jsonrpc":"2.0","id":"3","error":{"code":1,"message":"GID 0123456789abcdef is not found"}}
+{"jsonrpc":"2.0","id":"4","result":null}
+`
+	var buf bytes.Buffer
+	codec := NewJSONCodec(testConn{strings.NewReader(data), &buf})
+	require.True(t, codec.(*jsonCodec).pool)
+
+	for seq := uint64(1); seq <= 4; seq++ {
+		require.NoError(t, codec.WriteRequest(&rpc2.Request{Seq: seq, Method: "aria2.tellStatus"}, nil))
+	}
+
+	var status map[string]string
+	var resp rpc2.Response
+	require.NoError(t, codec.ReadHeader(&rpc2.Request{}, &resp))
+	require.NoError(t, codec.ReadResponseBody(&status))
+
+	// the next response reuses the buffer, decoded values must not be affected
+	var raw []json.RawMessage
+	resp = rpc2.Response{}
+	require.NoError(t, codec.ReadHeader(&rpc2.Request{}, &resp))
+	require.NoError(t, codec.ReadResponseBody(&raw))
+
+	assert.Equal(t, map[string]string{"gid": "2089b05ecca3d829", "status": "active"}, status)
+	assert.Equal(t, []json.RawMessage{json.RawMessage(`{"gid":"d2703803b52216d1"}`)}, raw)
+
+	resp = rpc2.Response{}
+	require.NoError(t, codec.ReadHeader(&rpc2.Request{}, &resp))
+	assert.Equal(t, "GID 0123456789abcdef is not found", ParseError(resp.Error).Message)
+	require.NoError(t, codec.ReadResponseBody(nil))
+
+	resp = rpc2.Response{}
+	require.NoError(t, codec.ReadHeader(&rpc2.Request{}, &resp))
+	assert.Equal(t, "unspecified error", resp.Error)
+	require.NoError(t, codec.ReadResponseBody(nil))
+}
+
+func TestResultsNotPooledWithInterceptor(t *testing.T) {
+	interceptors := Interceptors{Response: func(*Response) {}}
+	codec := NewJSONCodecWithInterceptors(testConn{strings.NewReader(""), ioutil.Discard}, new(uint64), StdEncoding, interceptors)
+	assert.False(t, codec.(*jsonCodec).pool)
+}
+
+// wrappedEncoding is a custom Encoding backed by encoding/json.
+type wrappedEncoding struct {
+	Encoding
+	copies bool
+}
+
+func (e wrappedEncoding) CopiesData() bool {
+	return e.copies
+}
+
+func TestResultsPooledWithCopyingEncoding(t *testing.T) {
+	conn := testConn{strings.NewReader(""), ioutil.Discard}
+
+	codec := NewJSONCodecWithEncoding(conn, new(uint64), wrappedEncoding{StdEncoding, true})
+	assert.True(t, codec.(*jsonCodec).pool)
+
+	codec = NewJSONCodecWithEncoding(conn, new(uint64), wrappedEncoding{StdEncoding, false})
+	assert.False(t, codec.(*jsonCodec).pool)
+
+	// encodings which don't say whether they copy aren't trusted with pooled buffers
+	codec = NewJSONCodecWithEncoding(conn, new(uint64), struct{ Encoding }{StdEncoding})
+	assert.False(t, codec.(*jsonCodec).pool)
+}
+
+// responseStream endlessly repeats a response to the request with id 1.
+type responseStream struct {
+	data []byte
+	off  int
+}
+
+func (s *responseStream) Read(p []byte) (int, error) {
+	n := copy(p, s.data[s.off:])
+	s.off = (s.off + n) % len(s.data)
+	return n, nil
+}
+
+func BenchmarkReadResponse(b *testing.B) {
+	var files strings.Builder
+	for i := 0; i < 20; i++ {
+		if i > 0 {
+			files.WriteByte(',')
+		}
+		fmt.Fprintf(&files, `{"index":"%d","length":"34896138","path":"/downloads/file%d","selected":"true"}`, i+1, i)
+	}
+	response := `{"jsonrpc":"2.0","id":"1","result":{"gid":"2089b05ecca3d829","status":"active",` +
+		`"totalLength":"34896138","completedLength":"1048576","files":[` + files.String() + `]}}` + "\n"
+
+	for _, pool := range []bool{false, true} {
+		name := "unpooled"
+		if pool {
+			name = "pooled"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			codec := NewJSONCodec(testConn{&responseStream{data: []byte(response)}, ioutil.Discard}).(*jsonCodec)
+			codec.pool = pool
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				// the ids are reset so the repeated response always matches
+				*codec.ids = 0
+				if err := codec.WriteRequest(&rpc2.Request{Seq: 1, Method: "aria2.tellStatus"}, nil); err != nil {
+					b.Fatal(err)
+				}
+
+				var resp rpc2.Response
+				if err := codec.ReadHeader(&rpc2.Request{}, &resp); err != nil {
+					b.Fatal(err)
+				}
+				var status json.RawMessage
+				if err := codec.ReadResponseBody(&status); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
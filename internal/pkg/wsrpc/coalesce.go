@@ -0,0 +1,112 @@
+package wsrpc
+
+import (
+	"io"
+	"time"
+)
+
+// maxCoalescedSize is the size in bytes at which coalesced writes are flushed right away.
+const maxCoalescedSize = 64 * 1024
+
+// SetWriteCoalescing makes Write collect the data written within window and send it as a single message,
+// instead of sending every Write as a separate message. This reduces the number of frames for
+// bursts of small messages, but only works with peers which read the messages as one continuous
+// stream of JSON values. aria2 expects a single request per message, so it must not be used with it.
+//
+// Write returns once the data is buffered, an error of the deferred write is returned by the next Write.
+// The buffered data is also sent once it exceeds 64 KiB, by Flush and by Close. Close gives a Write
+// in progress and the buffered data up to a second to be sent, it doesn't wait for a stalled connection
+// any longer. A window of 0 disables coalescing, which is the default, and sends the buffered data.
+func (rwc *ReadWriteCloser) SetWriteCoalescing(window time.Duration) error {
+	rwc.writeMu.Lock()
+	defer rwc.writeMu.Unlock()
+
+	if window < 0 {
+		window = 0
+	}
+	rwc.mu.Lock()
+	rwc.coalesce = window
+	rwc.mu.Unlock()
+	if window == 0 {
+		return rwc.flushLocked()
+	}
+	return nil
+}
+
+// Flush sends the data buffered by Write if coalescing is enabled, see SetWriteCoalescing.
+func (rwc *ReadWriteCloser) Flush() error {
+	rwc.writeMu.Lock()
+	defer rwc.writeMu.Unlock()
+
+	return rwc.flushLocked()
+}
+
+// writeCoalesced buffers p until it's sent by flushLocked, rwc.writeMu must be held.
+func (rwc *ReadWriteCloser) writeCoalesced(p []byte) (int, error) {
+	rwc.mu.Lock()
+	closed := rwc.ws == nil
+	keepaliveErr := rwc.keepaliveErr
+	rwc.mu.Unlock()
+
+	if closed {
+		return 0, io.ErrClosedPipe
+	}
+	if keepaliveErr != nil {
+		return 0, keepaliveErr
+	}
+	if err := rwc.flushErr; err != nil {
+		rwc.flushErr = nil
+		return 0, err
+	}
+
+	rwc.pending = append(rwc.pending, p...)
+	if len(rwc.pending) >= maxCoalescedSize {
+		return len(p), rwc.flushLocked()
+	}
+
+	if rwc.flushTimer == nil {
+		rwc.flushTimer = time.AfterFunc(rwc.coalesce, func() {
+			rwc.writeMu.Lock()
+			defer rwc.writeMu.Unlock()
+
+			if err := rwc.flushLocked(); err != nil {
+				rwc.flushErr = err
+			}
+		})
+	}
+	return len(p), nil
+}
+
+// flushLocked sends the buffered data as a single message, rwc.writeMu must be held.
+func (rwc *ReadWriteCloser) flushLocked() error {
+	if rwc.flushTimer != nil {
+		rwc.flushTimer.Stop()
+		rwc.flushTimer = nil
+	}
+	if len(rwc.pending) == 0 {
+		return nil
+	}
+
+	_, err := rwc.writeMessage(rwc.pending)
+	rwc.pending = rwc.pending[:0]
+	return err
+}
+
+// flushBeforeClose sends the buffered data, waiting at most closeTimeout for a Write in progress
+// and for the data to be sent. After that, closing the connection releases the stalled write.
+func (rwc *ReadWriteCloser) flushBeforeClose() {
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		// sending the buffered data is best effort, like the close frame
+		_ = rwc.Flush()
+	}()
+
+	timer := time.NewTimer(closeTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-flushed:
+	case <-timer.C:
+	}
+}
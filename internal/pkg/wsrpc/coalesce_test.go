@@ -0,0 +1,157 @@
+package wsrpc
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// messageReceiver returns a handler which passes every message received by the server to received.
+func messageReceiver(received chan<- string) func(ws *websocket.Conn) {
+	return func(ws *websocket.Conn) {
+		defer close(received)
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(data)
+		}
+	}
+}
+
+func TestWriteCoalescing(t *testing.T) {
+	received := make(chan string, 10)
+	rwc := newTestRWC(t, messageReceiver(received))
+	require.NoError(t, rwc.SetWriteCoalescing(20*time.Millisecond))
+
+	for _, msg := range []string{`{"id":"1"}` + "\n", `{"id":"2"}` + "\n", `{"id":"3"}` + "\n"} {
+		n, err := rwc.Write([]byte(msg))
+		require.NoError(t, err)
+		assert.Equal(t, len(msg), n)
+	}
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, `{"id":"1"}`+"\n"+`{"id":"2"}`+"\n"+`{"id":"3"}`+"\n", msg)
+	case <-time.After(time.Second):
+		t.Fatal("coalesced message not received")
+	}
+
+	// disabling coalescing sends every write right away again
+	require.NoError(t, rwc.SetWriteCoalescing(0))
+	_, err := rwc.Write([]byte("a"))
+	require.NoError(t, err)
+	_, err = rwc.Write([]byte("b"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", <-received)
+	assert.Equal(t, "b", <-received)
+}
+
+func TestWriteCoalescingClose(t *testing.T) {
+	received := make(chan string, 10)
+	rwc := newTestRWC(t, messageReceiver(received))
+	require.NoError(t, rwc.SetWriteCoalescing(time.Hour))
+
+	_, err := rwc.Write([]byte("a"))
+	require.NoError(t, err)
+	_, err = rwc.Write([]byte("b"))
+	require.NoError(t, err)
+	require.NoError(t, rwc.Close())
+
+	// Close flushes the buffered data before the close frame
+	assert.Equal(t, "ab", <-received)
+	_, ok := <-received
+	assert.False(t, ok)
+
+	_, err = rwc.Write([]byte("c"))
+	assert.Error(t, err)
+}
+
+func TestWriteCoalescingCloseStalledWrite(t *testing.T) {
+	rwc, conn := newStallingRWC(t)
+	require.NoError(t, rwc.SetWriteCoalescing(time.Hour))
+
+	// the buffer exceeds the size limit, sending it blocks on the socket holding the write lock
+	close(conn.stall)
+	go func() {
+		_, _ = rwc.Write([]byte(strings.Repeat("a", maxCoalescedSize)))
+	}()
+	<-conn.stalled
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- rwc.Close()
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * closeTimeout):
+		t.Fatal("Close waited for the stalled Write")
+	}
+}
+
+func TestWriteCoalescingSizeLimit(t *testing.T) {
+	received := make(chan string, 10)
+	rwc := newTestRWC(t, messageReceiver(received))
+	require.NoError(t, rwc.SetWriteCoalescing(time.Hour))
+
+	msg := strings.Repeat("a", maxCoalescedSize)
+	_, err := rwc.Write([]byte(msg))
+	require.NoError(t, err)
+
+	select {
+	case data := <-received:
+		assert.Equal(t, msg, data)
+	case <-time.After(time.Second):
+		t.Fatal("oversized buffer wasn't flushed")
+	}
+}
+
+func BenchmarkWriteCoalescing(b *testing.B) {
+	msg := []byte(`{"jsonrpc":"2.0","id":"1","method":"aria2.tellStatus","params":["2089b05ecca3d829"]}` + "\n")
+
+	for _, window := range []time.Duration{0, time.Millisecond} {
+		name := "per message"
+		if window > 0 {
+			name = "coalesced"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			var frames, bytes int64
+			rwc := newTestRWC(b, func(ws *websocket.Conn) {
+				for {
+					_, data, err := ws.ReadMessage()
+					if err != nil {
+						return
+					}
+					atomic.AddInt64(&frames, 1)
+					atomic.AddInt64(&bytes, int64(len(data)))
+				}
+			})
+			if err := rwc.SetWriteCoalescing(window); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := rwc.Write(msg); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := rwc.Flush(); err != nil {
+				b.Fatal(err)
+			}
+			for atomic.LoadInt64(&bytes) < int64(b.N*len(msg)) {
+				time.Sleep(time.Millisecond)
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(atomic.LoadInt64(&frames))/float64(b.N), "frames/op")
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package wsrpc
+
+import (
+	"encoding/json"
+	"io"
+	"sync/atomic"
+)
+
+// WriteTo writes the payloads of the incoming messages to w until the connection is closed,
+// which makes io.Copy stream every message directly from its frame reader instead of
+// using an intermediate buffer. Like with Read, the messages are written as one continuous
+// stream without separators, so the output is the same as the one of the generic io.Copy loop.
+//
+// It returns nil once the connection was closed cleanly, by either side.
+// A message exceeding MaxMessageSize ends the copy with a *ReadLimitError.
+// If w fails, the rest of the current message is returned by the following Read.
+func (rwc *ReadWriteCloser) WriteTo(w io.Writer) (n int64, err error) {
+	rwc.readMu.Lock()
+	defer rwc.readMu.Unlock()
+
+	for {
+		r, err := rwc.nextReader()
+		if err != nil {
+			if isCleanClose(err) {
+				err = nil
+			}
+			return n, err
+		}
+
+		src := &messageReader{rwc: rwc, r: r}
+		var limited io.Reader = src
+		if rwc.MaxMessageSize > 0 {
+			// read at most one byte more than allowed to detect oversized messages
+			limited = io.LimitReader(src, rwc.MaxMessageSize-rwc.read+1)
+		}
+
+		m, err := io.Copy(w, limited)
+		n += m
+		rwc.read += m
+		if rwc.MaxMessageSize > 0 && rwc.read > rwc.MaxMessageSize {
+			rwc.dropReader(r)
+			return n, &ReadLimitError{Limit: rwc.MaxMessageSize}
+		}
+		if src.err != nil && src.err != io.EOF {
+			rwc.dropReader(r)
+			return n, rwc.mapClosedErr(rwc.mapReadErr(src.err))
+		}
+		if err != nil {
+			return n, err
+		}
+		if src.err == io.EOF {
+			rwc.dropReader(r)
+			rwc.observe(Incoming, rwc.read)
+		}
+	}
+}
+
+// dropReader makes sure the next read doesn't pick up the frame reader r again.
+func (rwc *ReadWriteCloser) dropReader(r io.Reader) {
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	if rwc.r == r {
+		rwc.r = nil
+	}
+}
+
+// messageReader reads the payload of a message for WriteTo
+// and records the error of the frame reader, to tell it apart from the errors of the writer.
+type messageReader struct {
+	rwc *ReadWriteCloser
+	r   io.Reader
+	err error
+}
+
+func (m *messageReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	if n > 0 {
+		m.rwc.touch()
+		atomic.AddUint64(&m.rwc.bytesRead, uint64(n))
+	}
+	if err != nil {
+		m.err = err
+	}
+	return n, err
+}
+
+// ReadFrom reads JSON values from r until io.EOF and sends every value as a separate message.
+// Unlike the generic io.Copy loop, which sends every chunk read from r as a message and may
+// split a JSON-RPC request across messages or merge several into one, this keeps one request
+// per message as expected by aria2. The whitespace between the values isn't sent.
+//
+// n is the number of bytes of the values sent. It returns an error if r contains
+// something else than JSON values.
+func (rwc *ReadWriteCloser) ReadFrom(r io.Reader) (n int64, err error) {
+	dec := json.NewDecoder(r)
+	for {
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+
+		m, err := rwc.Write(value)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package wsrpc
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var copyMessages = []string{
+	`{"jsonrpc":"2.0","method":"aria2.onDownloadStart","params":[{"gid":"2089b05ecca3d829"}]}`,
+	`{"jsonrpc":"2.0","id":"1","result":"OK"}`,
+	`{"jsonrpc":"2.0","id":"2","result":{"files":[` + strings.Repeat(`{"path":"/downloads/file"},`, 2000) + `{}]}}`,
+}
+
+// sendAndClose returns a handler which sends messages and closes the connection normally.
+func sendAndClose(messages []string) func(ws *websocket.Conn) {
+	return func(ws *websocket.Conn) {
+		for _, msg := range messages {
+			if err := ws.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+				return
+			}
+		}
+		closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		_ = ws.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+		// wait for the close frame of the client
+		_, _, _ = ws.ReadMessage()
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	var generic bytes.Buffer
+	rwc := newTestRWC(t, sendAndClose(copyMessages))
+	// hiding WriteTo makes io.Copy use its generic buffer loop
+	_, err := io.Copy(&generic, struct{ io.Reader }{rwc})
+	require.NoError(t, err)
+
+	var direct bytes.Buffer
+	rwc = newTestRWC(t, sendAndClose(copyMessages))
+	n, err := io.Copy(&direct, rwc)
+	require.NoError(t, err)
+
+	assert.Equal(t, strings.Join(copyMessages, ""), direct.String())
+	assert.Equal(t, generic.String(), direct.String())
+	assert.Equal(t, int64(direct.Len()), n)
+}
+
+func TestWriteToMaxMessageSize(t *testing.T) {
+	rwc := newTestRWC(t, sendAndClose(copyMessages))
+	rwc.MaxMessageSize = 100
+
+	var buf bytes.Buffer
+	_, err := io.Copy(&buf, rwc)
+	assert.Equal(t, &ReadLimitError{Limit: 100}, err)
+	assert.True(t, strings.HasPrefix(buf.String(), copyMessages[0]+copyMessages[1]))
+}
+
+func TestReadFrom(t *testing.T) {
+	received := make(chan string, 10)
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				close(received)
+				return
+			}
+			received <- string(data)
+		}
+	})
+
+	src := strings.Join(copyMessages, "\n") + "\n"
+	// strings.Reader implements io.WriterTo, which io.Copy would prefer
+	n, err := io.Copy(rwc, struct{ io.Reader }{strings.NewReader(src)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(src)-len(copyMessages)), n)
+	require.NoError(t, rwc.Close())
+
+	var messages []string
+	for msg := range received {
+		messages = append(messages, msg)
+	}
+	// every value is a message of its own, the generic loop would have sent chunks of 32 KiB
+	assert.Equal(t, copyMessages, messages)
+}
+
+func TestReadFromInvalidJSON(t *testing.T) {
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		_, _, _ = ws.ReadMessage()
+	})
+
+	_, err := rwc.ReadFrom(strings.NewReader(`{"id":1} not json`))
+	assert.Error(t, err)
+}
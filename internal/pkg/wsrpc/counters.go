@@ -0,0 +1,17 @@
+package wsrpc
+
+import "sync/atomic"
+
+// BytesRead returns the number of payload bytes read from the connection by Read and WriteTo
+// since the rwc was created. The counter keeps counting across messages and never resets.
+// It's safe to call BytesRead concurrently with all other methods.
+func (rwc *ReadWriteCloser) BytesRead() uint64 {
+	return atomic.LoadUint64(&rwc.bytesRead)
+}
+
+// BytesWritten returns the number of payload bytes written to the connection since the rwc
+// was created. Data buffered by write coalescing is counted once it's sent.
+// It's safe to call BytesWritten concurrently with all other methods.
+func (rwc *ReadWriteCloser) BytesWritten() uint64 {
+	return atomic.LoadUint64(&rwc.bytesWritten)
+}
@@ -0,0 +1,68 @@
+package wsrpc
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestByteCounters(t *testing.T) {
+	rwc := newTestRWC(t, echo)
+
+	// the counters are read concurrently with the reads and writes
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_, _ = rwc.BytesRead(), rwc.BytesWritten()
+			}
+		}
+	}()
+
+	messages := []string{`{"id":"1","method":"aria2.getVersion"}`, `{"id":"2","method":"aria2.tellActive","params":[]}`}
+	total := 0
+	for _, msg := range messages {
+		n, err := rwc.Write([]byte(msg))
+		require.NoError(t, err)
+		assert.Equal(t, len(msg), n)
+		total += len(msg)
+	}
+	assert.Equal(t, uint64(total), rwc.BytesWritten())
+
+	// a small buffer makes the reads cross the message boundary
+	buf := make([]byte, total)
+	for read := 0; read < total; {
+		end := read + 7
+		if end > total {
+			end = total
+		}
+		n, err := rwc.Read(buf[read:end])
+		require.NoError(t, err)
+		read += n
+	}
+	assert.Equal(t, strings.Join(messages, ""), string(buf))
+	assert.Equal(t, uint64(total), rwc.BytesRead())
+
+	close(stop)
+	wg.Wait()
+}
+
+func TestByteCountersWriteTo(t *testing.T) {
+	rwc := newTestRWC(t, sendAndClose(copyMessages))
+
+	n, err := io.Copy(ioutil.Discard, rwc)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(n), rwc.BytesRead())
+	assert.Zero(t, rwc.BytesWritten())
+}
@@ -0,0 +1,106 @@
+package wsrpc
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// IdleTimeoutError is returned by Read once nothing was received from the peer
+// within the idle timeout set using SetIdleTimeout.
+// It's a net.Error whose Timeout method reports true.
+type IdleTimeoutError struct {
+	Idle time.Duration // the idle timeout
+}
+
+func (e *IdleTimeoutError) Error() string {
+	return fmt.Sprintf("wsrpc: nothing received for %v", e.Idle)
+}
+
+// Timeout is always true.
+func (e *IdleTimeoutError) Timeout() bool {
+	return true
+}
+
+// Temporary is always false, the connection is unusable after an idle timeout.
+func (e *IdleTimeoutError) Temporary() bool {
+	return false
+}
+
+// SetIdleTimeout makes Read fail with an *IdleTimeoutError if neither a message
+// nor a control frame is received from the peer within timeout.
+// This detects connections which are dead without being closed, for example because the
+// peer crashed. Since aria2 doesn't send anything on its own while it's idle, it should be
+// combined with EnableKeepalive using an interval shorter than timeout,
+// the pongs received count as activity.
+//
+// The idle timeout is implemented using the read deadline, so while it's enabled
+// it replaces the deadline set using SetReadDeadline. A timeout of 0 disables it.
+// Like the keepalive, it only works if there is a goroutine calling Read.
+func (rwc *ReadWriteCloser) SetIdleTimeout(timeout time.Duration) error {
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	ws := rwc.ws
+	if ws == nil {
+		return io.ErrClosedPipe
+	}
+
+	rwc.idleTimeout = timeout
+	if timeout <= 0 {
+		return ws.SetReadDeadline(time.Time{})
+	}
+
+	return ws.SetReadDeadline(time.Now().Add(timeout))
+}
+
+// handlePing returns the ping handler of ws, which answers pings like the default handler
+// and counts them as activity.
+func (rwc *ReadWriteCloser) handlePing(ws *websocket.Conn) func(data string) error {
+	return func(data string) error {
+		rwc.touch()
+
+		// same as the default ping handler
+		err := ws.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(closeTimeout))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+			return nil
+		}
+		return err
+	}
+}
+
+// touch extends the read deadline by the idle timeout, if there is one.
+// It's called whenever something was received from the peer.
+func (rwc *ReadWriteCloser) touch() {
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	// the keepalive unblocks reads using the deadline, which must not be extended afterwards
+	if rwc.ws == nil || rwc.idleTimeout <= 0 || rwc.keepaliveErr != nil {
+		return
+	}
+	_ = rwc.ws.SetReadDeadline(time.Now().Add(rwc.idleTimeout))
+}
+
+// mapIdleErr replaces the timeout error of the read deadline with an *IdleTimeoutError
+// if the idle timeout is enabled.
+func (rwc *ReadWriteCloser) mapIdleErr(err error) error {
+	netErr, ok := err.(net.Error)
+	if !ok || !netErr.Timeout() {
+		return err
+	}
+
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	if rwc.idleTimeout <= 0 {
+		return err
+	}
+	return &IdleTimeoutError{Idle: rwc.idleTimeout}
+}
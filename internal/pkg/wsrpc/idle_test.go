@@ -0,0 +1,102 @@
+package wsrpc
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	// the server stops sending anything, like a peer which crashed
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		<-done
+	})
+	require.NoError(t, rwc.SetIdleTimeout(50*time.Millisecond))
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := rwc.Read(make([]byte, 1))
+		readErr <- err
+	}()
+
+	select {
+	case err := <-readErr:
+		var idleErr *IdleTimeoutError
+		require.True(t, errors.As(err, &idleErr), "unexpected error %v", err)
+		assert.Equal(t, 50*time.Millisecond, idleErr.Idle)
+
+		netErr, ok := err.(net.Error)
+		require.True(t, ok)
+		assert.True(t, netErr.Timeout())
+	case <-time.After(time.Second):
+		t.Fatal("read wasn't unblocked by the idle timeout")
+	}
+}
+
+func TestIdleTimeoutMessages(t *testing.T) {
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		for i := 0; i < 10; i++ {
+			time.Sleep(20 * time.Millisecond)
+			if ws.WriteMessage(websocket.TextMessage, []byte("x")) != nil {
+				return
+			}
+		}
+		_, _, _ = ws.ReadMessage()
+	})
+	require.NoError(t, rwc.SetIdleTimeout(100*time.Millisecond))
+
+	// the whole exchange takes longer than the timeout
+	buf := make([]byte, 1)
+	for i := 0; i < 10; i++ {
+		_, err := rwc.Read(buf)
+		require.NoError(t, err, "message %d", i)
+	}
+}
+
+func TestIdleTimeoutKeepalive(t *testing.T) {
+	rwc := newTestRWC(t, echo)
+	require.NoError(t, rwc.SetIdleTimeout(50*time.Millisecond))
+	require.NoError(t, rwc.EnableKeepalive(10*time.Millisecond, 40*time.Millisecond))
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := rwc.Read(make([]byte, 2))
+		readErr <- err
+	}()
+
+	// the pongs keep the connection alive
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case err := <-readErr:
+		t.Fatalf("read returned early: %v", err)
+	default:
+	}
+
+	_, err := rwc.Write([]byte(`{}`))
+	require.NoError(t, err)
+	assert.NoError(t, <-readErr)
+}
+
+func TestIdleTimeoutDisabled(t *testing.T) {
+	rwc := newTestRWC(t, echo)
+	require.NoError(t, rwc.SetIdleTimeout(10*time.Millisecond))
+	require.NoError(t, rwc.SetIdleTimeout(0))
+
+	time.Sleep(50 * time.Millisecond)
+	_, err := rwc.Write([]byte(`{}`))
+	require.NoError(t, err)
+	_, err = rwc.Read(make([]byte, 2))
+	assert.NoError(t, err)
+
+	require.NoError(t, rwc.Close())
+	assert.Equal(t, io.ErrClosedPipe, rwc.SetIdleTimeout(time.Second))
+}
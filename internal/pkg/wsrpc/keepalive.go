@@ -0,0 +1,242 @@
+package wsrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrKeepaliveTimeout is returned by Read and Write
+// when the peer didn't answer a keepalive ping in time.
+var ErrKeepaliveTimeout = errors.New("wsrpc: keepalive timed out")
+
+// EnableKeepalive starts sending ping frames to the peer every interval.
+// If the peer doesn't answer a ping with a pong within timeout,
+// the connection is considered dead and all Read and Write calls,
+// including the ones which are currently blocked, return ErrKeepaliveTimeout.
+// A ping which can't be sent within timeout, for example because a Write is stuck
+// on a peer which stopped reading, counts as unanswered as well.
+//
+// Pong frames are only processed while reading from the rwc,
+// so a keepalive only works if there is a goroutine calling Read.
+// The keepalive is stopped when the rwc is closed.
+//
+// Every ping carries a sequence number, the round-trip time of the last ping answered
+// by a matching pong is reported by LastPingRTT.
+func (rwc *ReadWriteCloser) EnableKeepalive(interval, timeout time.Duration) error {
+	if interval <= 0 || timeout <= 0 {
+		return errors.New("wsrpc: keepalive interval and timeout must be positive")
+	}
+
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	if rwc.ws == nil {
+		return io.ErrClosedPipe
+	}
+	if rwc.keepaliveStop != nil {
+		return errors.New("wsrpc: keepalive already enabled")
+	}
+
+	pong := make(chan string, 1)
+	rwc.keepalivePong = pong
+
+	rwc.keepaliveStop = make(chan struct{})
+	rwc.keepaliveDone = make(chan struct{})
+
+	go rwc.keepalive(rwc.ws, interval, timeout, pong, rwc.keepaliveStop, rwc.keepaliveDone)
+
+	return nil
+}
+
+func (rwc *ReadWriteCloser) keepalive(ws *websocket.Conn, interval, timeout time.Duration, pong chan string, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for seq := uint64(1); ; seq++ {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		// discard a pong which arrived late for the previous ping
+		select {
+		case <-pong:
+		default:
+		}
+
+		// WriteControl is safe to use concurrently with the other methods of the connection,
+		// holding mu while it waits for a stalled socket would block Read, Write and Close.
+		payload := strconv.FormatUint(seq, 10)
+		sent := time.Now()
+		err := ws.WriteControl(websocket.PingMessage, []byte(payload), sent.Add(timeout))
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			// a Write stuck on the socket held up the ping, the peer doesn't receive anything
+			rwc.failKeepalive(ws)
+			return
+		}
+		if err != nil {
+			// the connection is broken, Read and Write report the actual error.
+			return
+		}
+
+		if !rwc.awaitPong(ws, payload, sent, timeout, pong, stop) {
+			return
+		}
+	}
+}
+
+// awaitPong waits for the pong answering the ping with payload which was sent at sent
+// and records its round-trip time. Pongs for earlier pings are ignored.
+// It returns false if the keepalive is stopped or timed out.
+func (rwc *ReadWriteCloser) awaitPong(ws *websocket.Conn, payload string, sent time.Time, timeout time.Duration, pong chan string, stop chan struct{}) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return false
+		case appData := <-pong:
+			if appData != payload {
+				continue
+			}
+			rtt := time.Since(sent)
+			rwc.mu.Lock()
+			rwc.pingRTT = rtt
+			rwc.mu.Unlock()
+			return true
+		case <-timer.C:
+			rwc.failKeepalive(ws)
+			return false
+		}
+	}
+}
+
+// failKeepalive makes the Reads and Writes of the rwc return ErrKeepaliveTimeout,
+// the ones which are currently blocked are released using deadlines in the past.
+func (rwc *ReadWriteCloser) failKeepalive(ws *websocket.Conn) {
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	rwc.keepaliveErr = ErrKeepaliveTimeout
+	_ = ws.SetReadDeadline(time.Now())
+	// the write deadline of the WebSocket connection only applies to the next frame,
+	// the one of the socket also releases a frame which is being written
+	_ = ws.UnderlyingConn().SetWriteDeadline(time.Now())
+}
+
+// LastPingRTT returns the round-trip time of the last keepalive ping, measured from
+// sending the ping until its pong arrived. Unlike timing a call, it doesn't include the
+// time aria2 takes to process a request. It's zero until a ping was answered.
+func (rwc *ReadWriteCloser) LastPingRTT() time.Duration {
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	return rwc.pingRTT
+}
+
+// Ping sends a ping frame to the peer and waits for the matching pong.
+// It returns the round-trip time, which only covers the WebSocket connection,
+// so it tells a broken connection apart from a peer which doesn't respond to messages.
+//
+// Like for the keepalive, pongs are only processed while reading from the rwc.
+// Ping waits until ctx is done. Sending the ping is bounded by the deadline of ctx,
+// but takes at most a second.
+func (rwc *ReadWriteCloser) Ping(ctx context.Context) (time.Duration, error) {
+	rwc.mu.Lock()
+	ws := rwc.ws
+	if ws == nil {
+		rwc.mu.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	rwc.pingSeq++
+	payload := "ping-" + strconv.FormatUint(rwc.pingSeq, 10)
+	pong := make(chan struct{})
+	if rwc.pongWaiters == nil {
+		rwc.pongWaiters = make(map[string]chan struct{})
+	}
+	rwc.pongWaiters[payload] = pong
+	rwc.mu.Unlock()
+
+	// WriteControl is safe to use concurrently with the other methods of the connection,
+	// it's bounded like the close frame, so a stalled socket can't block Ping indefinitely.
+	sent := time.Now()
+	deadline := sent.Add(closeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	err := ws.WriteControl(websocket.PingMessage, []byte(payload), deadline)
+
+	if err == nil {
+		select {
+		case <-pong:
+			return time.Since(sent), nil
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	rwc.mu.Lock()
+	delete(rwc.pongWaiters, payload)
+	rwc.mu.Unlock()
+	return 0, rwc.mapWriteErr(err)
+}
+
+// handlePong is the pong handler of the connection.
+// It passes the pong on to the keepalive and to Ping.
+func (rwc *ReadWriteCloser) handlePong(appData string) error {
+	rwc.touch()
+
+	rwc.mu.Lock()
+	keepalivePong := rwc.keepalivePong
+	if pong, ok := rwc.pongWaiters[appData]; ok {
+		close(pong)
+		delete(rwc.pongWaiters, appData)
+	}
+	rwc.mu.Unlock()
+
+	if keepalivePong != nil {
+		select {
+		case keepalivePong <- appData:
+		default:
+		}
+	}
+	return nil
+}
+
+// stopKeepalive stops the keepalive goroutine, if any, and waits for it to return.
+func (rwc *ReadWriteCloser) stopKeepalive() {
+	rwc.mu.Lock()
+	stop := rwc.keepaliveStop
+	done := rwc.keepaliveDone
+	rwc.keepaliveStop = nil
+	rwc.keepaliveDone = nil
+	rwc.keepalivePong = nil
+	rwc.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// mapKeepaliveErr replaces err with ErrKeepaliveTimeout
+// if the connection was torn down by the keepalive.
+func (rwc *ReadWriteCloser) mapKeepaliveErr(err error) error {
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	if rwc.keepaliveErr != nil {
+		return rwc.keepaliveErr
+	}
+	return err
+}
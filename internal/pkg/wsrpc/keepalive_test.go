@@ -0,0 +1,245 @@
+package wsrpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepalive(t *testing.T) {
+	rwc := newTestRWC(t, echo)
+	require.NoError(t, rwc.EnableKeepalive(10*time.Millisecond, 100*time.Millisecond))
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := rwc.Read(make([]byte, 1))
+		readErr <- err
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+
+	select {
+	case err := <-readErr:
+		t.Fatalf("read returned early: %v", err)
+	default:
+	}
+
+	_, err := rwc.Write([]byte(`{}`))
+	assert.NoError(t, err)
+	assert.NoError(t, <-readErr)
+}
+
+func TestLastPingRTT(t *testing.T) {
+	pings := make(chan string, 16)
+	// the server echoes pings like the default handler of gorilla, but delays the pongs
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		ws.SetPingHandler(func(appData string) error {
+			select {
+			case pings <- appData:
+			default:
+			}
+			time.Sleep(20 * time.Millisecond)
+			return ws.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+		})
+		echo(ws)
+	})
+	assert.Equal(t, time.Duration(0), rwc.LastPingRTT())
+	require.NoError(t, rwc.EnableKeepalive(50*time.Millisecond, time.Second))
+
+	go func() {
+		_, _ = rwc.Read(make([]byte, 1))
+	}()
+
+	assert.Equal(t, "1", <-pings)
+	deadline := time.Now().Add(2 * time.Second)
+	for rwc.LastPingRTT() == 0 {
+		require.True(t, time.Now().Before(deadline), "no round-trip time was recorded")
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	rtt := rwc.LastPingRTT()
+	assert.True(t, rtt >= 20*time.Millisecond && rtt < time.Second, "unexpected rtt %v", rtt)
+}
+
+func TestPing(t *testing.T) {
+	rwc := newTestRWC(t, echo)
+	require.NoError(t, rwc.EnableKeepalive(10*time.Millisecond, time.Second))
+	go func() {
+		_, _ = rwc.Read(make([]byte, 1))
+	}()
+
+	for i := 0; i < 3; i++ {
+		rtt, err := rwc.Ping(context.Background())
+		require.NoError(t, err)
+		assert.True(t, rtt > 0)
+	}
+
+	rwc.mu.Lock()
+	assert.Empty(t, rwc.pongWaiters)
+	rwc.mu.Unlock()
+
+	require.NoError(t, rwc.Close())
+	_, err := rwc.Ping(context.Background())
+	assert.Equal(t, io.ErrClosedPipe, err)
+}
+
+func TestPingTimeout(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	// the server never reads, so it never answers pings
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		<-done
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := rwc.Ping(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	rwc.mu.Lock()
+	assert.Empty(t, rwc.pongWaiters, "the waiter of the ping must be removed")
+	rwc.mu.Unlock()
+}
+
+// stallingConn is a net.Conn whose writes block once stall is closed, until release is closed.
+type stallingConn struct {
+	net.Conn
+	stall, stalled, release chan struct{}
+	once                    *sync.Once
+}
+
+func (c stallingConn) Write(p []byte) (int, error) {
+	select {
+	case <-c.stall:
+		c.once.Do(func() { close(c.stalled) })
+		<-c.release
+		return 0, io.ErrClosedPipe
+	default:
+		return c.Conn.Write(p)
+	}
+}
+
+// newStallingRWC creates a rwc connected to an echo server whose writes to the socket
+// block once conn.stall is closed. conn.release is closed by the cleanup.
+func newStallingRWC(t *testing.T) (*ReadWriteCloser, stallingConn) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		echo(ws)
+	}))
+	t.Cleanup(server.Close)
+
+	conn := stallingConn{stall: make(chan struct{}), stalled: make(chan struct{}), release: make(chan struct{}), once: new(sync.Once)}
+	t.Cleanup(func() { close(conn.release) })
+	dialer := websocket.Dialer{NetDial: func(network, addr string) (net.Conn, error) {
+		c, err := net.Dial(network, addr)
+		conn.Conn = c
+		return conn, err
+	}}
+	ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	rwc := NewReadWriteCloser(ws)
+	t.Cleanup(func() { _ = rwc.Close() })
+
+	return rwc, conn
+}
+
+func TestPingStalledConnection(t *testing.T) {
+	rwc, conn := newStallingRWC(t)
+
+	// a Write stuck on the socket holds the write lock of the connection
+	close(conn.stall)
+	go func() {
+		_, _ = rwc.Write([]byte("{}"))
+	}()
+	<-conn.stalled
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := rwc.Ping(ctx)
+	assert.Error(t, err)
+	assert.NotEqual(t, context.DeadlineExceeded, err, "sending the ping must be bounded")
+	assert.True(t, time.Since(start) < 10*time.Second, "sending the ping took %v", time.Since(start))
+}
+
+func TestKeepaliveTimeout(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	// the server never reads, so it never answers pings
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		<-done
+	})
+	require.NoError(t, rwc.EnableKeepalive(10*time.Millisecond, 50*time.Millisecond))
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := rwc.Read(make([]byte, 1))
+		readErr <- err
+	}()
+
+	select {
+	case err := <-readErr:
+		assert.Equal(t, ErrKeepaliveTimeout, err)
+	case <-time.After(time.Second):
+		t.Fatal("read wasn't unblocked by the keepalive")
+	}
+
+	_, err := rwc.Write([]byte(`{}`))
+	assert.Equal(t, ErrKeepaliveTimeout, err)
+}
+
+func TestKeepaliveTimeoutBlockedWrite(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	// the server never reads, so the socket buffers fill up and pings aren't answered
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		<-done
+	})
+	require.NoError(t, rwc.EnableKeepalive(10*time.Millisecond, 50*time.Millisecond))
+
+	writeErr := make(chan error, 1)
+	go func() {
+		_, err := rwc.Write(make([]byte, 64<<20))
+		writeErr <- err
+	}()
+
+	select {
+	case err := <-writeErr:
+		assert.Equal(t, ErrKeepaliveTimeout, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("write wasn't unblocked by the keepalive")
+	}
+}
+
+func TestKeepaliveStoppedByClose(t *testing.T) {
+	rwc := newTestRWC(t, echo)
+	require.NoError(t, rwc.EnableKeepalive(10*time.Millisecond, 50*time.Millisecond))
+	assert.Error(t, rwc.EnableKeepalive(10*time.Millisecond, 50*time.Millisecond))
+
+	done := rwc.keepaliveDone
+	require.NoError(t, rwc.Close())
+
+	select {
+	case <-done:
+	default:
+		t.Fatal("keepalive goroutine still running after close")
+	}
+
+	assert.Error(t, rwc.EnableKeepalive(10*time.Millisecond, 50*time.Millisecond))
+}
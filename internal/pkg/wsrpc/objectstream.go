@@ -0,0 +1,65 @@
+package wsrpc
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// ObjectStream reads and writes JSON values over a ReadWriteCloser.
+// Every value is sent as a separate WebSocket message.
+//
+// ObjectStream satisfies the ObjectStream interface of jsonrpc2 implementations
+// such as github.com/sourcegraph/jsonrpc2.
+type ObjectStream struct {
+	rwc *ReadWriteCloser
+
+	readMu sync.Mutex // protects dec
+	dec    *json.Decoder
+}
+
+// NewObjectStream creates a new ObjectStream operating on rwc.
+func NewObjectStream(rwc *ReadWriteCloser) *ObjectStream {
+	return &ObjectStream{
+		rwc: rwc,
+		dec: json.NewDecoder(rwc),
+	}
+}
+
+// WriteObject encodes obj as JSON and sends it as a single message.
+func (s *ObjectStream) WriteObject(obj interface{}) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.rwc.Write(data)
+	return err
+}
+
+// ReadObject reads the next JSON value from the stream and stores it in v.
+// It returns io.EOF once the stream has been closed cleanly,
+// either locally or by the peer.
+func (s *ObjectStream) ReadObject(v interface{}) error {
+	s.readMu.Lock()
+	defer s.readMu.Unlock()
+
+	err := s.dec.Decode(v)
+	if isCleanClose(err) {
+		return io.EOF
+	}
+	return err
+}
+
+// Close closes the underlying ReadWriteCloser.
+func (s *ObjectStream) Close() error {
+	return s.rwc.Close()
+}
+
+// isCleanClose reports whether err denotes an orderly end of the connection.
+func isCleanClose(err error) bool {
+	closeErr, ok := err.(*CloseError)
+	return err == io.EOF || err == io.ErrClosedPipe || ok && closeErr.Code == websocket.CloseGoingAway
+}
@@ -0,0 +1,84 @@
+package wsrpc
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type testResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Result  json.RawMessage `json:"result"`
+}
+
+func TestObjectStream(t *testing.T) {
+	requests := make(chan testRequest, 1)
+
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		var req testRequest
+		if err := ws.ReadJSON(&req); err != nil {
+			return
+		}
+		requests <- req
+
+		_ = ws.WriteJSON(testResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Result:  json.RawMessage(`"2089b05ecca3d829"`),
+		})
+		_, _, _ = ws.ReadMessage()
+	})
+
+	stream := NewObjectStream(rwc)
+
+	req := testRequest{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "aria2.addUri",
+		Params:  []interface{}{[]interface{}{"http://example.org/file"}},
+	}
+	require.NoError(t, stream.WriteObject(req))
+	assert.Equal(t, req, <-requests)
+
+	var resp testResponse
+	require.NoError(t, stream.ReadObject(&resp))
+	assert.Equal(t, uint64(1), resp.ID)
+	assert.JSONEq(t, `"2089b05ecca3d829"`, string(resp.Result))
+}
+
+func TestObjectStreamClosedByPeer(t *testing.T) {
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		_ = ws.WriteJSON(testResponse{JSONRPC: "2.0", ID: 1, Result: json.RawMessage(`"OK"`)})
+		_ = ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		_, _, _ = ws.ReadMessage()
+	})
+
+	stream := NewObjectStream(rwc)
+
+	var resp testResponse
+	require.NoError(t, stream.ReadObject(&resp))
+	assert.Equal(t, io.EOF, stream.ReadObject(&resp))
+}
+
+func TestObjectStreamClosedLocally(t *testing.T) {
+	rwc := newTestRWC(t, echo)
+	stream := NewObjectStream(rwc)
+
+	require.NoError(t, stream.Close())
+
+	var resp testResponse
+	assert.Equal(t, io.EOF, stream.ReadObject(&resp))
+	assert.Error(t, stream.WriteObject(testRequest{}))
+}
@@ -0,0 +1,41 @@
+package wsrpc
+
+// Direction tells whether a message was received or sent, see SetMessageObserver.
+type Direction int
+
+const (
+	// Incoming messages were received from the peer.
+	Incoming Direction = iota
+	// Outgoing messages were sent to the peer.
+	Outgoing
+)
+
+func (d Direction) String() string {
+	if d == Outgoing {
+		return "outgoing"
+	}
+	return "incoming"
+}
+
+// SetMessageObserver makes the rwc call observer with the size in bytes of every complete message
+// read by Read or WriteTo and of every message written. Messages skipped because they exceeded
+// MaxMessageSize aren't reported. A nil observer removes the current one.
+//
+// observer is called by the goroutine reading or writing the message, it must not block
+// and must not call Read or Write.
+func (rwc *ReadWriteCloser) SetMessageObserver(observer func(direction Direction, size int)) {
+	rwc.mu.Lock()
+	rwc.observer = observer
+	rwc.mu.Unlock()
+}
+
+// observe reports a complete message to the observer, if there is one.
+func (rwc *ReadWriteCloser) observe(direction Direction, size int64) {
+	rwc.mu.Lock()
+	observer := rwc.observer
+	rwc.mu.Unlock()
+
+	if observer != nil {
+		observer(direction, int(size))
+	}
+}
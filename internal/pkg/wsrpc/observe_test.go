@@ -0,0 +1,78 @@
+package wsrpc
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// messageRecorder records the messages reported to a message observer.
+type messageRecorder struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (r *messageRecorder) observe(direction Direction, size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.messages = append(r.messages, fmt.Sprintf("%s %d", direction, size))
+}
+
+func (r *messageRecorder) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.messages...)
+}
+
+func TestMessageObserver(t *testing.T) {
+	rwc := newTestRWC(t, echo)
+	var recorder messageRecorder
+	rwc.SetMessageObserver(recorder.observe)
+
+	messages := []string{`{"id":"1","method":"aria2.getVersion"}`, strings.Repeat("x", 5000)}
+	for _, msg := range messages {
+		_, err := rwc.Write([]byte(msg))
+		require.NoError(t, err)
+	}
+
+	// the messages are read in chunks, every message is reported once
+	buf := make([]byte, len(messages[0])+len(messages[1]))
+	_, err := io.ReadFull(rwc, buf)
+	require.NoError(t, err)
+	// the end of the last message is only noticed by the next read
+	_, err = rwc.Write([]byte("{}"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(rwc, buf[:2])
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"outgoing 38", "outgoing 5000", "incoming 38", "outgoing 2", "incoming 5000"}, recorder.recorded())
+
+	// a nil observer reports nothing
+	rwc.SetMessageObserver(nil)
+	_, err = rwc.Write([]byte("{}"))
+	require.NoError(t, err)
+	assert.Len(t, recorder.recorded(), 5)
+}
+
+func TestMessageObserverWriteTo(t *testing.T) {
+	rwc := newTestRWC(t, sendAndClose(copyMessages))
+	var recorder messageRecorder
+	rwc.SetMessageObserver(recorder.observe)
+
+	_, err := io.Copy(ioutil.Discard, rwc)
+	require.NoError(t, err)
+
+	var expected []string
+	for _, msg := range copyMessages {
+		expected = append(expected, fmt.Sprintf("incoming %d", len(msg)))
+	}
+	assert.Equal(t, expected, recorder.recorded())
+}
@@ -3,92 +3,406 @@
 package wsrpc
 
 import (
+	"fmt"
 	"io"
+	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-// ReadWriteCloser is a rwc based on WebSockets
+// ReadWriteCloser is a rwc based on WebSockets.
+//
+// The underlying WebSocket connection supports at most one concurrent reader
+// and one concurrent writer. ReadWriteCloser serializes all calls to Read
+// and all calls to Write, so it's safe to call them from multiple goroutines.
+// A Read may run concurrently with a Write.
+// Every Write is sent as a single message and is never interleaved with another Write.
 type ReadWriteCloser struct {
-	mu sync.Mutex
+	// payload bytes read and written, see BytesRead and BytesWritten.
+	// They are accessed atomically and come first to be 64-bit aligned on 32-bit platforms.
+	bytesRead    uint64
+	bytesWritten uint64
+
+	// MaxMessageSize is the maximum size in bytes of a message returned by Read.
+	// If a message exceeds it, Read returns a *ReadLimitError and the rest of the message
+	// is skipped, the following Read continues with the next message.
+	// Unlike SetReadLimit, this keeps the connection open. Zero means there's no limit.
+	// It must not be changed while a Read is in progress.
+	MaxMessageSize int64
+
+	readMu sync.Mutex // serializes Read
+	read   int64      // number of bytes read from the current message, protected by readMu
+
+	writeMu sync.Mutex // serializes Write
+
+	// coalescing state, see SetWriteCoalescing, protected by writeMu.
+	// coalesce is changed holding mu as well, so Close can check it without waiting for a Write.
+	coalesce   time.Duration
+	pending    []byte      // data buffered by Write
+	flushTimer *time.Timer // sends the buffered data, nil if none is buffered
+	flushErr   error       // error of the last deferred write
+
+	mu sync.Mutex // protects the fields below
 	ws *websocket.Conn
 	r  io.Reader
 	w  io.WriteCloser
+
+	readLimit   int64         // limit set using SetReadLimit, 0 if there's none
+	idleTimeout time.Duration // timeout set using SetIdleTimeout, 0 if there's none
+
+	// writeTimeout bounds the time a message may take to be written, see SetWriteTimeout.
+	writeTimeout time.Duration
+
+	// observer is called for every complete message, see SetMessageObserver.
+	observer func(direction Direction, size int)
+
+	// close error received from the peer, nil if there was none or it was a normal closure
+	closeErr *CloseError
+
+	// message type used for outgoing frames,
+	// either websocket.TextMessage or websocket.BinaryMessage.
+	messageType int
+	// strict is set if incoming messages must have messageType as well, see SetStrictMessageType.
+	strict bool
+	// compressThreshold is the size from which messages are compressed, see SetCompressionThreshold.
+	compressThreshold int
+
+	keepaliveStop chan struct{} // closed to stop the keepalive goroutine
+	keepaliveDone chan struct{} // closed once the keepalive goroutine returned
+	keepaliveErr  error         // set once a pong wasn't received in time
+	pingRTT       time.Duration // round-trip time of the last answered ping
+	keepalivePong chan string   // receives the pongs for the keepalive goroutine
+
+	pingSeq     uint64                   // sequence number of the last ping sent by Ping
+	pongWaiters map[string]chan struct{} // closed once the pong for the payload arrived
 }
 
-// NewReadWriteCloser creates a new rwc from a WebSocket connection
-func NewReadWriteCloser(ws *websocket.Conn) ReadWriteCloser {
-	return ReadWriteCloser{ws: ws}
+// NewReadWriteCloser creates a new rwc from a WebSocket connection.
+// It replaces the ping and pong handlers of the connection, the rwc needs them for the keepalive,
+// Ping and the idle timeout.
+func NewReadWriteCloser(ws *websocket.Conn) *ReadWriteCloser {
+	rwc := &ReadWriteCloser{ws: ws, messageType: websocket.TextMessage}
+	ws.SetPongHandler(rwc.handlePong)
+	ws.SetPingHandler(rwc.handlePing(ws))
+	return rwc
 }
 
-// Read reads from the WebSocket into p
-func (rwc *ReadWriteCloser) Read(p []byte) (n int, err error) {
-	var r io.Reader
-	var ws *websocket.Conn
+// SetMessageType sets the type of the frames created by Write.
+// messageType must be either websocket.TextMessage (the default) or websocket.BinaryMessage.
+// The new type applies to the next message, a message which is currently being written
+// keeps its type.
+func (rwc *ReadWriteCloser) SetMessageType(messageType int) error {
+	if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+		return fmt.Errorf("wsrpc: invalid message type %d", messageType)
+	}
 
 	rwc.mu.Lock()
-	ws = rwc.ws
-	r = rwc.r
+	rwc.messageType = messageType
 	rwc.mu.Unlock()
 
-	if ws == nil {
-		return 0, io.ErrClosedPipe
+	return nil
+}
+
+// SetStrictMessageType makes Read reject messages whose type differs from the one set
+// using SetMessageType, by default messages of both types are read.
+// A rejected message is skipped and Read returns a *MessageTypeError, the connection stays open.
+func (rwc *ReadWriteCloser) SetStrictMessageType(strict bool) {
+	rwc.mu.Lock()
+	rwc.strict = strict
+	rwc.mu.Unlock()
+}
+
+// MessageTypeError is returned by Read if a message was rejected because of its type,
+// see SetStrictMessageType.
+type MessageTypeError struct {
+	Type     int // type of the received message
+	Expected int // type set using SetMessageType
+}
+
+func (e *MessageTypeError) Error() string {
+	return fmt.Sprintf("wsrpc: received %s message, expected %s", messageTypeName(e.Type), messageTypeName(e.Expected))
+}
+
+// messageTypeName returns the name of a data message type.
+func messageTypeName(messageType int) string {
+	switch messageType {
+	case websocket.TextMessage:
+		return "text"
+	case websocket.BinaryMessage:
+		return "binary"
+	}
+	return fmt.Sprintf("unknown (%d)", messageType)
+}
+
+// ReadLimitError is returned by Read if a message exceeded the limit set using SetReadLimit
+// or MaxMessageSize. The connection is closed if the limit set using SetReadLimit is exceeded.
+type ReadLimitError struct {
+	Limit int64
+}
+
+func (e *ReadLimitError) Error() string {
+	return fmt.Sprintf("wsrpc: message exceeds read limit of %d bytes", e.Limit)
+}
+
+// Is reports whether target is websocket.ErrReadLimit.
+func (e *ReadLimitError) Is(target error) bool {
+	return target == websocket.ErrReadLimit
+}
+
+// SetReadLimit sets the maximum size in bytes of a message read from the peer.
+// If a message exceeds the limit, Read returns a *ReadLimitError and the connection is closed.
+// A limit of 0 means there's no limit.
+func (rwc *ReadWriteCloser) SetReadLimit(limit int64) error {
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	if rwc.ws == nil {
+		return io.ErrClosedPipe
 	}
+	rwc.readLimit = limit
+	rwc.ws.SetReadLimit(limit)
+	return nil
+}
 
-	if r == nil {
-		_, r, err = ws.NextReader()
-		if err != nil {
-			return 0, err
-		}
+// CloseError is returned by Read and Write once the peer closed the connection
+// with a close frame. A normal closure isn't reported as a CloseError,
+// Read returns io.EOF and Write io.ErrClosedPipe instead.
+type CloseError struct {
+	Code int    // close code sent by the peer, see RFC 6455 section 7.4
+	Text string // reason sent by the peer, may be empty
+}
+
+func (e *CloseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("wsrpc: connection closed with code %d", e.Code)
+	}
+	return fmt.Sprintf("wsrpc: connection closed with code %d: %s", e.Code, e.Text)
+}
+
+// Temporary reports whether the peer closed the connection because of a condition
+// which may go away, so reconnecting is worth a try.
+// This is the case if the peer is going away or restarting,
+// ran into an internal error, or the connection was closed without a close frame.
+func (e *CloseError) Temporary() bool {
+	switch e.Code {
+	case websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseInternalServerErr,
+		websocket.CloseServiceRestart, websocket.CloseTryAgainLater:
+		return true
+	}
+	return false
+}
+
+// mapReadErr replaces the errors of the WebSocket connection with the errors of the rwc.
+func (rwc *ReadWriteCloser) mapReadErr(err error) error {
+	if err == websocket.ErrReadLimit {
 		rwc.mu.Lock()
-		if rwc.ws == nil {
-			rwc.mu.Unlock()
-			return 0, io.ErrClosedPipe
+		limit := rwc.readLimit
+		rwc.mu.Unlock()
+
+		return &ReadLimitError{Limit: limit}
+	}
+
+	if wsErr, ok := err.(*websocket.CloseError); ok {
+		if wsErr.Code == websocket.CloseNormalClosure {
+			return io.EOF
 		}
-		rwc.r = r
+
+		closeErr := &CloseError{Code: wsErr.Code, Text: wsErr.Text}
+		rwc.mu.Lock()
+		rwc.closeErr = closeErr
 		rwc.mu.Unlock()
+		return closeErr
 	}
+	return rwc.mapIdleErr(rwc.mapKeepaliveErr(err))
+}
 
-	for n = 0; n < len(p); {
-		var m int
-		m, err = r.Read(p[n:])
-		n += m
-		if err == io.EOF {
-			// done
+// mapClosedErr replaces err with io.ErrClosedPipe if the rwc was closed,
+// so a Read interrupted by Close reports the closure instead of the error of the torn down connection.
+func (rwc *ReadWriteCloser) mapClosedErr(err error) error {
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	if rwc.ws == nil {
+		return io.ErrClosedPipe
+	}
+	return err
+}
+
+// mapWriteErr replaces the errors of the WebSocket connection with the errors of the rwc.
+func (rwc *ReadWriteCloser) mapWriteErr(err error) error {
+	if err != websocket.ErrCloseSent {
+		return err
+	}
+
+	// the close frame of the peer was answered while reading
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	if rwc.closeErr != nil {
+		return rwc.closeErr
+	}
+	return io.ErrClosedPipe
+}
+
+// Read reads from the WebSocket into p.
+// The messages received are read as one continuous stream,
+// the end of a message isn't reported as io.EOF.
+// A single Read never returns bytes of more than one message.
+func (rwc *ReadWriteCloser) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	rwc.readMu.Lock()
+	defer rwc.readMu.Unlock()
+
+	for {
+		r, err := rwc.nextReader()
+		if err != nil {
+			return 0, err
+		}
+
+		buf := p
+		if rwc.MaxMessageSize > 0 && int64(len(buf)) > rwc.MaxMessageSize-rwc.read+1 {
+			// read at most one byte more than allowed to detect oversized messages
+			buf = buf[:rwc.MaxMessageSize-rwc.read+1]
+		}
+
+		n, err = rwc.readFull(r, buf)
+		rwc.read += int64(n)
+		if rwc.MaxMessageSize > 0 && rwc.read > rwc.MaxMessageSize {
+			// the next call of NextReader skips the rest of the message
 			rwc.mu.Lock()
 			if rwc.r == r {
 				rwc.r = nil
 			}
 			rwc.mu.Unlock()
-			break
+			return 0, &ReadLimitError{Limit: rwc.MaxMessageSize}
 		}
-		if err != nil {
-			break
+		if err == nil {
+			return n, nil
+		}
+
+		// the frame reader is done after EOF and unusable after an error,
+		// make sure the next call doesn't pick it up again.
+		rwc.mu.Lock()
+		if rwc.r == r {
+			rwc.r = nil
 		}
+		rwc.mu.Unlock()
+
+		if err != io.EOF {
+			return n, rwc.mapClosedErr(rwc.mapReadErr(err))
+		}
+		rwc.observe(Incoming, rwc.read)
+		if n > 0 {
+			return n, nil
+		}
+		// the previous message ended exactly at the last Read, continue with the next one.
+	}
+}
+
+// nextReader returns the reader of the current message, or of the next one if there's none.
+// rwc.readMu must be held.
+func (rwc *ReadWriteCloser) nextReader() (io.Reader, error) {
+	rwc.mu.Lock()
+	ws := rwc.ws
+	r := rwc.r
+	keepaliveErr := rwc.keepaliveErr
+	rwc.mu.Unlock()
+
+	if ws == nil {
+		return nil, io.ErrClosedPipe
+	}
+	if keepaliveErr != nil {
+		return nil, keepaliveErr
+	}
+	if r != nil {
+		return r, nil
 	}
 
+	messageType, r, err := ws.NextReader()
+	if err != nil {
+		return nil, rwc.mapClosedErr(rwc.mapReadErr(err))
+	}
+
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	if rwc.ws == nil {
+		return nil, io.ErrClosedPipe
+	}
+	if rwc.strict && messageType != rwc.messageType {
+		// the next call of NextReader skips the message
+		return nil, &MessageTypeError{Type: messageType, Expected: rwc.messageType}
+	}
+	rwc.r = r
+	rwc.read = 0
+	return r, nil
+}
+
+// readFull reads from r until p is full or r returns an error.
+// Every chunk received from r extends the idle timeout.
+func (rwc *ReadWriteCloser) readFull(r io.Reader, p []byte) (n int, err error) {
+	for n < len(p) && err == nil {
+		var m int
+		m, err = r.Read(p[n:])
+		n += m
+		if m > 0 {
+			rwc.touch()
+			atomic.AddUint64(&rwc.bytesRead, uint64(m))
+		}
+	}
 	return
 }
 
 // Write writes the provided bytes to the WebSocket
 func (rwc *ReadWriteCloser) Write(p []byte) (n int, err error) {
+	rwc.writeMu.Lock()
+	defer rwc.writeMu.Unlock()
+
+	if rwc.coalesce > 0 {
+		return rwc.writeCoalesced(p)
+	}
+	return rwc.writeMessage(p)
+}
+
+// writeMessage writes p as a single message, rwc.writeMu must be held.
+func (rwc *ReadWriteCloser) writeMessage(p []byte) (n int, err error) {
 	var w io.WriteCloser
 	var ws *websocket.Conn
+	var messageType int
+	var keepaliveErr error
 
 	rwc.mu.Lock()
 	ws = rwc.ws
 	w = rwc.w
+	messageType = rwc.messageType
+	keepaliveErr = rwc.keepaliveErr
+	threshold := rwc.compressThreshold
+	timeout := rwc.writeTimeout
 	rwc.mu.Unlock()
 
 	if ws == nil {
 		return 0, io.ErrClosedPipe
 	}
+	if keepaliveErr != nil {
+		return 0, keepaliveErr
+	}
+	if timeout > 0 {
+		_ = ws.SetWriteDeadline(time.Now().Add(timeout))
+	}
 
 	if w == nil {
-		w, err = ws.NextWriter(websocket.TextMessage)
+		if threshold > 0 {
+			ws.EnableWriteCompression(len(p) >= threshold)
+		}
+		w, err = ws.NextWriter(messageType)
 		if err != nil {
-			return 0, err
+			return 0, rwc.mapClosedErr(rwc.mapKeepaliveErr(mapWriteTimeoutErr(rwc.mapWriteErr(err), timeout)))
 		}
 		rwc.mu.Lock()
 		if rwc.ws == nil {
@@ -101,8 +415,10 @@ func (rwc *ReadWriteCloser) Write(p []byte) (n int, err error) {
 	}
 
 	for n = 0; n < len(p); {
-		m, err := w.Write(p[n:])
+		var m int
+		m, err = w.Write(p[n:])
 		n += m
+		atomic.AddUint64(&rwc.bytesWritten, uint64(m))
 		if err != nil {
 			break
 		}
@@ -117,32 +433,290 @@ func (rwc *ReadWriteCloser) Write(p []byte) (n int, err error) {
 		if err == nil {
 			err = closeErr
 		}
+		if err == nil {
+			rwc.observe(Outgoing, int64(n))
+		}
 	}
 
-	return
+	if err != nil {
+		// a Write interrupted by Close reports the closure instead of the error of the torn down connection
+		err = rwc.mapClosedErr(rwc.mapKeepaliveErr(mapWriteTimeoutErr(rwc.mapWriteErr(err), timeout)))
+	}
+	return n, err
+}
+
+// Reset discards the message which is currently being read or written, so the following
+// Read and Write start with a new message. It's meant for callers which recover from an
+// error themselves, for example after abandoning a decode halfway through a message.
+//
+// The rest of the message being read is skipped. A message being written is terminated,
+// the peer receives the part which was written so far as a complete message.
+// Reset is only safe between logical messages, and it must not be called while a Read
+// is in progress. It waits for a Write in progress to finish.
+//
+// Reset doesn't recover from errors of the connection itself. In particular, a tripped
+// read deadline stays permanent, see SetReadDeadline.
+func (rwc *ReadWriteCloser) Reset() error {
+	rwc.writeMu.Lock()
+	defer rwc.writeMu.Unlock()
+
+	rwc.mu.Lock()
+	if rwc.ws == nil {
+		rwc.mu.Unlock()
+		return io.ErrClosedPipe
+	}
+	w := rwc.w
+	rwc.w = nil
+	rwc.r = nil
+	rwc.mu.Unlock()
+
+	if w != nil {
+		return rwc.mapWriteErr(w.Close())
+	}
+	return nil
+}
+
+// EnableWriteCompression enables or disables the compression of the following messages.
+// It only has an effect if compression was negotiated during the handshake,
+// see websocket.Dialer.EnableCompression. Reading compressed messages is always supported.
+// A message which is currently being written is not affected.
+func (rwc *ReadWriteCloser) EnableWriteCompression(enable bool) error {
+	rwc.writeMu.Lock()
+	defer rwc.writeMu.Unlock()
+
+	rwc.mu.Lock()
+	ws := rwc.ws
+	rwc.mu.Unlock()
+
+	if ws == nil {
+		return io.ErrClosedPipe
+	}
+	ws.EnableWriteCompression(enable)
+	return nil
+}
+
+// SetCompressionThreshold makes Write compress only the messages of at least threshold bytes.
+// Compressing small messages costs more time than it saves bandwidth, while large ones,
+// like the base64 encoded torrents of aria2.addTorrent, shrink considerably.
+// Like EnableWriteCompression, which it overrides for every message, it only has an effect
+// if compression was negotiated during the handshake. Zero disables the threshold.
+func (rwc *ReadWriteCloser) SetCompressionThreshold(threshold int) error {
+	if threshold < 0 {
+		return fmt.Errorf("wsrpc: invalid compression threshold %d", threshold)
+	}
+
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	if rwc.ws == nil {
+		return io.ErrClosedPipe
+	}
+	rwc.compressThreshold = threshold
+	return nil
+}
+
+// SetCompressionLevel sets the flate compression level of the following messages.
+// The level must be between -2 and 9 as defined by the compress/flate package.
+func (rwc *ReadWriteCloser) SetCompressionLevel(level int) error {
+	rwc.writeMu.Lock()
+	defer rwc.writeMu.Unlock()
+
+	rwc.mu.Lock()
+	ws := rwc.ws
+	rwc.mu.Unlock()
+
+	if ws == nil {
+		return io.ErrClosedPipe
+	}
+	return ws.SetCompressionLevel(level)
+}
+
+// SetReadDeadline sets the read deadline on the underlying WebSocket connection.
+// A Read blocked past the deadline returns a net.Error whose Timeout method reports true.
+// A zero value for t means Read will not time out.
+//
+// Note that the WebSocket connection treats a tripped read deadline as permanent,
+// every following Read returns the same timeout error.
+func (rwc *ReadWriteCloser) SetReadDeadline(t time.Time) error {
+	rwc.mu.Lock()
+	ws := rwc.ws
+	rwc.mu.Unlock()
+
+	if ws == nil {
+		return io.ErrClosedPipe
+	}
+	return ws.SetReadDeadline(t)
 }
 
-// Close the rwc and the underlying WebSocket connection
+// SetWriteDeadline sets the write deadline on the underlying WebSocket connection.
+// A Write blocked past the deadline returns a net.Error whose Timeout method reports true.
+// A zero value for t means Write will not time out.
+//
+// Note that the WebSocket connection treats a tripped write deadline as permanent,
+// every following Write returns the same timeout error.
+func (rwc *ReadWriteCloser) SetWriteDeadline(t time.Time) error {
+	rwc.mu.Lock()
+	ws := rwc.ws
+	rwc.mu.Unlock()
+
+	if ws == nil {
+		return io.ErrClosedPipe
+	}
+	return ws.SetWriteDeadline(t)
+}
+
+// WriteTimeoutError is returned by Write if a message couldn't be written
+// within the timeout set using SetWriteTimeout.
+// It's a net.Error whose Timeout method reports true.
+type WriteTimeoutError struct {
+	Limit time.Duration // the write timeout
+}
+
+func (e *WriteTimeoutError) Error() string {
+	return fmt.Sprintf("wsrpc: writing a message took longer than %v", e.Limit)
+}
+
+// Timeout is always true.
+func (e *WriteTimeoutError) Timeout() bool {
+	return true
+}
+
+// Temporary is always false, the connection is unusable after a write timeout.
+func (e *WriteTimeoutError) Temporary() bool {
+	return false
+}
+
+// SetWriteTimeout limits the time writing a single message may take, from starting the message
+// until its last frame was handed to the connection. It protects against a peer which stopped
+// reading, whose full socket buffers would otherwise block Write indefinitely.
+// Unlike a timeout of a call, it doesn't include waiting for a response.
+// A Write exceeding the timeout returns a *WriteTimeoutError.
+//
+// The timeout is implemented using the write deadline, which is set before every message,
+// so while it's enabled it replaces the deadline set using SetWriteDeadline.
+// Like a tripped write deadline, a write timeout is permanent. A timeout of 0 disables it.
+func (rwc *ReadWriteCloser) SetWriteTimeout(timeout time.Duration) error {
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	if rwc.ws == nil {
+		return io.ErrClosedPipe
+	}
+	if timeout < 0 {
+		timeout = 0
+	}
+	rwc.writeTimeout = timeout
+	if timeout == 0 {
+		return rwc.ws.SetWriteDeadline(time.Time{})
+	}
+	return nil
+}
+
+// mapWriteTimeoutErr replaces the timeout error of the write deadline with a *WriteTimeoutError
+// if the write timeout is enabled.
+func mapWriteTimeoutErr(err error, timeout time.Duration) error {
+	netErr, ok := err.(net.Error)
+	if timeout <= 0 || !ok || !netErr.Timeout() {
+		return err
+	}
+	return &WriteTimeoutError{Limit: timeout}
+}
+
+// RemoteAddr returns the network address of the peer.
+// It returns nil once the rwc is closed.
+func (rwc *ReadWriteCloser) RemoteAddr() net.Addr {
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	if rwc.ws == nil {
+		return nil
+	}
+	return rwc.ws.RemoteAddr()
+}
+
+// LocalAddr returns the local network address.
+// It returns nil once the rwc is closed.
+func (rwc *ReadWriteCloser) LocalAddr() net.Addr {
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	if rwc.ws == nil {
+		return nil
+	}
+	return rwc.ws.LocalAddr()
+}
+
+// Subprotocol returns the subprotocol negotiated during the handshake,
+// or "" if the server didn't select one or the rwc is closed.
+func (rwc *ReadWriteCloser) Subprotocol() string {
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	if rwc.ws == nil {
+		return ""
+	}
+	return rwc.ws.Subprotocol()
+}
+
+// UnderlyingConn returns the WebSocket connection of the rwc, for example to set socket options
+// or to inspect state of gorilla/websocket which the rwc doesn't expose.
+// It returns nil once the rwc is closed.
+//
+// The connection must not be used for reading or writing messages, closing it or changing its
+// handlers and deadlines while the rwc is in use, since the rwc relies on being its only user.
+// None of the methods of the connection are synchronized with Read and Write.
+func (rwc *ReadWriteCloser) UnderlyingConn() *websocket.Conn {
+	rwc.mu.Lock()
+	defer rwc.mu.Unlock()
+
+	return rwc.ws
+}
+
+// closeTimeout is the time the peer is given to receive the close frame.
+const closeTimeout = time.Second
+
+// Close the rwc and the underlying WebSocket connection.
+// The peer is notified using a normal closure close frame.
 func (rwc *ReadWriteCloser) Close() error {
+	return rwc.CloseWithCode(websocket.CloseNormalClosure, "")
+}
+
+// CloseWithCode closes the rwc and the underlying WebSocket connection.
+// Before the connection is closed, a close frame with the given code and text is sent to the peer.
+// If the close frame can't be sent, the connection is closed without it.
+// A Write in progress isn't waited for, it fails with io.ErrClosedPipe unless it completed
+// before the connection was closed. If write coalescing is enabled, the buffered data is sent
+// first, provided that takes less than a second, see SetWriteCoalescing.
+func (rwc *ReadWriteCloser) CloseWithCode(code int, text string) error {
 	var err error
-	var w io.WriteCloser
 	var ws *websocket.Conn
 
 	rwc.mu.Lock()
-	w = rwc.w
+	coalesce := rwc.coalesce
+	rwc.mu.Unlock()
+	if coalesce > 0 {
+		rwc.flushBeforeClose()
+	}
+
+	rwc.stopKeepalive()
+
+	// a message which is being written is left to its Write, which closes the writer itself
+	// and fails with io.ErrClosedPipe once the connection is closed. Closing the writer here
+	// would race with the Write and close the writer twice.
+	rwc.mu.Lock()
 	rwc.w = nil
 	rwc.r = nil
 	ws = rwc.ws
 	rwc.ws = nil
 	rwc.mu.Unlock()
 
-	if w != nil {
-		if err = w.Close(); err != nil {
-			return err
-		}
-	}
 	if ws != nil {
-		return ws.Close()
+		// a deadline in the past makes a Read blocked in NextReader return right away,
+		// independently of how closing the connection affects it.
+		_ = ws.SetReadDeadline(time.Now())
+		// the close frame is best effort, the connection is closed either way.
+		_ = ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(closeTimeout))
+		err = ws.Close()
 	}
-	return nil
+	return err
 }
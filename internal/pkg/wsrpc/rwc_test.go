@@ -0,0 +1,850 @@
+package wsrpc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var upgrader = websocket.Upgrader{}
+
+// newTestRWC starts a WebSocket server which passes every connection to handler
+// and returns a rwc connected to it.
+func newTestRWC(t testing.TB, handler func(ws *websocket.Conn)) *ReadWriteCloser {
+	rwc, _ := newTestRWCWithServer(t, handler)
+	return rwc
+}
+
+// newTestRWCWithServer is like newTestRWC but also returns the server.
+func newTestRWCWithServer(t testing.TB, handler func(ws *websocket.Conn)) (*ReadWriteCloser, *httptest.Server) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		handler(ws)
+	}))
+	t.Cleanup(server.Close)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+
+	rwc := NewReadWriteCloser(ws)
+	t.Cleanup(func() { _ = rwc.Close() })
+	return rwc, server
+}
+
+func TestReadDeadline(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		<-done
+	})
+
+	require.NoError(t, rwc.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+
+	_, err := rwc.Read(make([]byte, 8))
+	require.Error(t, err)
+
+	netErr, ok := err.(net.Error)
+	require.True(t, ok, "expected net.Error, got %T", err)
+	assert.True(t, netErr.Timeout())
+	assert.Nil(t, rwc.r)
+
+	// the following call must report the timeout again rather than a closed pipe
+	_, err = rwc.Read(make([]byte, 8))
+	netErr, ok = err.(net.Error)
+	require.True(t, ok, "expected net.Error, got %T", err)
+	assert.True(t, netErr.Timeout())
+}
+
+func TestWriteDeadline(t *testing.T) {
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		_, _, _ = ws.ReadMessage()
+	})
+
+	require.NoError(t, rwc.SetWriteDeadline(time.Now().Add(-time.Second)))
+
+	_, err := rwc.Write([]byte(`{"hello":"world"}`))
+	require.Error(t, err)
+
+	netErr, ok := err.(net.Error)
+	require.True(t, ok, "expected net.Error, got %T", err)
+	assert.True(t, netErr.Timeout())
+	assert.Nil(t, rwc.w)
+}
+
+func TestDeadlineAfterClose(t *testing.T) {
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {})
+	require.NoError(t, rwc.Close())
+
+	assert.Error(t, rwc.SetReadDeadline(time.Now()))
+	assert.Error(t, rwc.SetWriteDeadline(time.Now()))
+}
+
+// echo sends every message back to the client using the type it was received with.
+func echo(ws *websocket.Conn) {
+	for {
+		messageType, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err = ws.WriteMessage(messageType, data); err != nil {
+			return
+		}
+	}
+}
+
+func TestBinaryMessageType(t *testing.T) {
+	received := make(chan int, 1)
+
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		messageType, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		received <- messageType
+		_ = ws.WriteMessage(messageType, data)
+	})
+
+	require.NoError(t, rwc.SetMessageType(websocket.BinaryMessage))
+
+	payload := []byte(`{"jsonrpc":"2.0","id":1,"method":"aria2.getVersion"}`)
+	n, err := rwc.Write(payload)
+	require.NoError(t, err)
+	assert.Equal(t, len(payload), n)
+
+	assert.Equal(t, websocket.BinaryMessage, <-received)
+
+	buf := make([]byte, len(payload))
+	n, err = rwc.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, payload, buf[:n])
+}
+
+func TestInvalidMessageType(t *testing.T) {
+	rwc := newTestRWC(t, echo)
+
+	assert.Error(t, rwc.SetMessageType(websocket.PingMessage))
+	assert.Equal(t, websocket.TextMessage, rwc.messageType)
+}
+
+func TestStrictMessageType(t *testing.T) {
+	tests := []struct {
+		name        string
+		messageType int
+		unexpected  int
+	}{
+		{"text", websocket.TextMessage, websocket.BinaryMessage},
+		{"binary", websocket.BinaryMessage, websocket.TextMessage},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rwc := newTestRWC(t, func(ws *websocket.Conn) {
+				_ = ws.WriteMessage(test.unexpected, []byte("unexpected"))
+				_ = ws.WriteMessage(test.messageType, []byte("expected"))
+				_, _, _ = ws.ReadMessage()
+			})
+			require.NoError(t, rwc.SetMessageType(test.messageType))
+			rwc.SetStrictMessageType(true)
+
+			buf := make([]byte, 64)
+			_, err := rwc.Read(buf)
+			var typeErr *MessageTypeError
+			require.True(t, errors.As(err, &typeErr), "unexpected error %v", err)
+			assert.Equal(t, &MessageTypeError{Type: test.unexpected, Expected: test.messageType}, typeErr)
+
+			// the rejected message is skipped
+			n, err := rwc.Read(buf)
+			require.NoError(t, err)
+			assert.Equal(t, "expected", string(buf[:n]))
+		})
+	}
+}
+
+func TestLenientMessageType(t *testing.T) {
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		_ = ws.WriteMessage(websocket.BinaryMessage, []byte("binary"))
+		_, _, _ = ws.ReadMessage()
+	})
+
+	buf := make([]byte, 64)
+	n, err := rwc.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "binary", string(buf[:n]))
+}
+
+// closeReceiver returns a handler which reports the error,
+// which the server encountered reading from the connection.
+func closeReceiver(received chan<- error) func(ws *websocket.Conn) {
+	return func(ws *websocket.Conn) {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				received <- err
+				return
+			}
+		}
+	}
+}
+
+func TestCloseSendsCloseFrame(t *testing.T) {
+	received := make(chan error, 1)
+	rwc := newTestRWC(t, closeReceiver(received))
+
+	require.NoError(t, rwc.Close())
+
+	err := <-received
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "unexpected error %v", err)
+}
+
+func TestCloseUnblocksRead(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	// the server never sends anything, so the Read blocks in NextReader
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		<-done
+	})
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := rwc.Read(make([]byte, 8))
+		readErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- rwc.Close()
+	}()
+
+	select {
+	case err := <-readErr:
+		assert.Equal(t, io.ErrClosedPipe, err)
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("read wasn't unblocked by close")
+	}
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("close didn't return")
+	}
+}
+
+func TestCloseDuringWrite(t *testing.T) {
+	// large messages span many frames, so Close regularly hits a Write holding a writer
+	msg := []byte(strings.Repeat("x", 256*1024))
+	for i := 0; i < 50; i++ {
+		rwc := newTestRWC(t, func(ws *websocket.Conn) {
+			for {
+				if _, _, err := ws.ReadMessage(); err != nil {
+					return
+				}
+			}
+		})
+
+		writeErr := make(chan error, 1)
+		go func() {
+			for {
+				if _, err := rwc.Write(msg); err != nil {
+					writeErr <- err
+					return
+				}
+			}
+		}()
+		go func() {
+			_ = rwc.Close()
+		}()
+
+		select {
+		case err := <-writeErr:
+			require.Equal(t, io.ErrClosedPipe, err, "iteration %d", i)
+		case <-time.After(time.Second):
+			t.Fatal("write wasn't ended by close")
+		}
+	}
+}
+
+func TestCloseWithCode(t *testing.T) {
+	received := make(chan error, 1)
+	rwc := newTestRWC(t, closeReceiver(received))
+
+	require.NoError(t, rwc.CloseWithCode(websocket.CloseGoingAway, "shutting down"))
+
+	err := <-received
+	closeErr, ok := err.(*websocket.CloseError)
+	require.True(t, ok, "expected close error, got %v", err)
+	assert.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+	assert.Equal(t, "shutting down", closeErr.Text)
+}
+
+func TestPeerClose(t *testing.T) {
+	tests := []struct {
+		code      int
+		temporary bool
+	}{
+		{websocket.CloseGoingAway, true},
+		{websocket.CloseMessageTooBig, false},
+		{websocket.CloseInternalServerErr, true},
+		{websocket.CloseServiceRestart, true},
+		{websocket.ClosePolicyViolation, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprint(tt.code), func(t *testing.T) {
+			rwc := newTestRWC(t, func(ws *websocket.Conn) {
+				_ = ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(tt.code, "bye"))
+				_, _, _ = ws.ReadMessage()
+			})
+
+			_, err := rwc.Read(make([]byte, 8))
+			var closeErr *CloseError
+			require.True(t, errors.As(err, &closeErr), "unexpected error %v", err)
+			assert.Equal(t, &CloseError{Code: tt.code, Text: "bye"}, closeErr)
+			assert.Equal(t, tt.temporary, closeErr.Temporary())
+
+			// the close frame was answered while reading, writing reports the same error
+			_, err = rwc.Write([]byte("{}"))
+			assert.Equal(t, closeErr, err)
+		})
+	}
+}
+
+func TestPeerCloseNormal(t *testing.T) {
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		_ = ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		_, _, _ = ws.ReadMessage()
+	})
+
+	_, err := rwc.Read(make([]byte, 8))
+	assert.Equal(t, io.EOF, err)
+
+	_, err = rwc.Write([]byte("{}"))
+	assert.Equal(t, io.ErrClosedPipe, err)
+}
+
+func TestPeerCloseWithoutCloseFrame(t *testing.T) {
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		_ = ws.UnderlyingConn().Close()
+	})
+
+	_, err := rwc.Read(make([]byte, 8))
+	var closeErr *CloseError
+	require.True(t, errors.As(err, &closeErr), "unexpected error %v", err)
+	assert.Equal(t, websocket.CloseAbnormalClosure, closeErr.Code)
+	assert.True(t, closeErr.Temporary())
+}
+
+func TestCloseWithoutCloseFrame(t *testing.T) {
+	received := make(chan error, 1)
+	rwc := newTestRWC(t, closeReceiver(received))
+
+	// break the write side so the close frame can't be sent
+	require.NoError(t, rwc.SetWriteDeadline(time.Now().Add(-time.Second)))
+	_, err := rwc.Write([]byte("{}"))
+	require.Error(t, err)
+
+	assert.NoError(t, rwc.Close())
+
+	err = <-received
+	assert.False(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "unexpected close frame")
+}
+
+func TestAddr(t *testing.T) {
+	rwc, server := newTestRWCWithServer(t, echo)
+
+	remote := rwc.RemoteAddr()
+	require.NotNil(t, remote)
+	assert.Equal(t, server.Listener.Addr().String(), remote.String())
+
+	local := rwc.LocalAddr()
+	require.NotNil(t, local)
+	assert.NotEqual(t, remote.String(), local.String())
+
+	require.NoError(t, rwc.Close())
+	assert.Nil(t, rwc.RemoteAddr())
+	assert.Nil(t, rwc.LocalAddr())
+}
+
+func TestWriteTimeout(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	// the server stops reading, so the socket buffers fill up eventually
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		<-done
+	})
+	require.NoError(t, rwc.SetWriteTimeout(100*time.Millisecond))
+
+	msg := bytes.Repeat([]byte("a"), 1<<20)
+	start := time.Now()
+	var err error
+	for i := 0; i < 1000 && err == nil; i++ {
+		_, err = rwc.Write(msg)
+	}
+	require.Error(t, err, "the writes never blocked")
+	assert.Equal(t, &WriteTimeoutError{Limit: 100 * time.Millisecond}, err)
+	assert.True(t, err.(net.Error).Timeout())
+	assert.True(t, time.Since(start) < 10*time.Second)
+
+	require.NoError(t, rwc.Close())
+	assert.Equal(t, io.ErrClosedPipe, rwc.SetWriteTimeout(time.Second))
+}
+
+func TestUnderlyingConn(t *testing.T) {
+	rwc := newTestRWC(t, echo)
+
+	ws := rwc.UnderlyingConn()
+	require.NotNil(t, ws)
+	assert.Equal(t, rwc.RemoteAddr(), ws.RemoteAddr())
+	// the escape hatch allows settings which the rwc doesn't expose
+	_, ok := ws.UnderlyingConn().(*net.TCPConn)
+	assert.True(t, ok)
+
+	require.NoError(t, rwc.Close())
+	assert.Nil(t, rwc.UnderlyingConn())
+}
+
+func TestPartialRead(t *testing.T) {
+	first := []byte(`{"jsonrpc":"2.0","id":10,"result":"OK"}`)
+	second := []byte(`{"jsonrpc":"2.0","id":2,"result":"2089b05ecca3d829"}`)
+
+	tests := []struct {
+		name    string
+		bufSize int
+	}{
+		{"single byte", 1},
+		{"three bytes", 3},
+		{"frame length", len(first)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rwc := newTestRWC(t, func(ws *websocket.Conn) {
+				_ = ws.WriteMessage(websocket.TextMessage, first)
+				_ = ws.WriteMessage(websocket.TextMessage, second)
+				_, _, _ = ws.ReadMessage()
+			})
+
+			var data []byte
+			buf := make([]byte, test.bufSize)
+			for len(data) < len(first) {
+				n, err := rwc.Read(buf)
+				require.NoError(t, err)
+				require.True(t, n > 0 && n <= test.bufSize, "invalid n %d", n)
+
+				data = append(data, buf[:n]...)
+				if len(data) < len(first) {
+					assert.NotNil(t, rwc.r, "reader cleared before the end of the frame")
+				}
+			}
+
+			assert.Equal(t, first, data)
+
+			// the reader is only cleared if the last read encountered the end of the frame
+			if len(first)%test.bufSize == 0 {
+				assert.NotNil(t, rwc.r)
+			} else {
+				assert.Nil(t, rwc.r)
+			}
+
+			// the next message must come through unchanged
+			buf = make([]byte, 2*len(second))
+			n, err := rwc.Read(buf)
+			require.NoError(t, err)
+			assert.Equal(t, second, buf[:n])
+			assert.Nil(t, rwc.r)
+		})
+	}
+}
+
+func TestConcurrentWrite(t *testing.T) {
+	const writers = 50
+
+	received := make(chan []byte, writers)
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- data
+		}
+	})
+
+	expected := make(map[string]bool, writers)
+	for i := 0; i < writers; i++ {
+		expected[fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"aria2.tellStatus"}`, i)] = true
+	}
+
+	var wg sync.WaitGroup
+	for msg := range expected {
+		wg.Add(1)
+		go func(msg string) {
+			defer wg.Done()
+			_, err := rwc.Write([]byte(msg))
+			assert.NoError(t, err)
+		}(msg)
+	}
+	wg.Wait()
+
+	for i := 0; i < writers; i++ {
+		select {
+		case data := <-received:
+			assert.True(t, expected[string(data)], "unexpected message %q", data)
+			delete(expected, string(data))
+		case <-time.After(time.Second):
+			t.Fatal("messages missing")
+		}
+	}
+}
+
+func TestConcurrentReadWrite(t *testing.T) {
+	rwc := newTestRWC(t, echo)
+
+	const messages = 50
+
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		buf := make([]byte, 2)
+		for i := 0; i < 2*messages; i++ {
+			_, err := rwc.Read(buf[:1])
+			if !assert.NoError(t, err) {
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < messages; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := rwc.Write([]byte("{}"))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case <-readDone:
+	case <-time.After(time.Second):
+		t.Fatal("reader didn't receive all messages")
+	}
+}
+
+// countingListener counts the bytes read from all accepted connections.
+type countingListener struct {
+	net.Listener
+	read *int64
+}
+
+func (l countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{conn, l.read}, nil
+}
+
+type countingConn struct {
+	net.Conn
+	read *int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(c.read, int64(n))
+	return n, err
+}
+
+func TestCompression(t *testing.T) {
+	compressionUpgrader := websocket.Upgrader{EnableCompression: true}
+
+	var read int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := compressionUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		echo(ws)
+	}))
+	server.Listener = countingListener{server.Listener, &read}
+	server.Start()
+	t.Cleanup(server.Close)
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+
+	rwc := NewReadWriteCloser(ws)
+	t.Cleanup(func() { _ = rwc.Close() })
+
+	var payload bytes.Buffer
+	payload.WriteString(`{"jsonrpc":"2.0","id":"1","result":[`)
+	for i := 0; i < 2000; i++ {
+		if i > 0 {
+			payload.WriteByte(',')
+		}
+		fmt.Fprintf(&payload, `{"index":"%d","length":"34896138","path":"/downloads/file%d","selected":"true"}`, i, i)
+	}
+	payload.WriteString(`]}`)
+
+	before := atomic.LoadInt64(&read)
+	_, err = rwc.Write(payload.Bytes())
+	require.NoError(t, err)
+
+	received, err := ioutil.ReadAll(io.LimitReader(rwc, int64(payload.Len())))
+	require.NoError(t, err)
+	assert.Equal(t, payload.Bytes(), received)
+
+	sent := atomic.LoadInt64(&read) - before
+	assert.True(t, sent < int64(payload.Len())/4, "sent %d bytes for a %d byte payload", sent, payload.Len())
+
+	// disabling compression must still produce valid messages
+	require.NoError(t, rwc.EnableWriteCompression(false))
+	_, err = rwc.Write([]byte(`{"jsonrpc":"2.0","id":"2","result":"OK"}`))
+	require.NoError(t, err)
+
+	buf := make([]byte, 64)
+	n, err := rwc.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, `{"jsonrpc":"2.0","id":"2","result":"OK"}`, string(buf[:n]))
+}
+
+// newCompressedTestRWC is like newTestRWC but negotiates compression.
+// The number of bytes received by the server is counted in read.
+func newCompressedTestRWC(t testing.TB, handler func(ws *websocket.Conn)) (rwc *ReadWriteCloser, read *int64) {
+	compressionUpgrader := websocket.Upgrader{EnableCompression: true}
+
+	read = new(int64)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := compressionUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		handler(ws)
+	}))
+	server.Listener = countingListener{server.Listener, read}
+	server.Start()
+	t.Cleanup(server.Close)
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+
+	c := NewReadWriteCloser(ws)
+	t.Cleanup(func() { _ = c.Close() })
+	return c, read
+}
+
+func TestCompressionThreshold(t *testing.T) {
+	rwc, read := newCompressedTestRWC(t, echo)
+	require.NoError(t, rwc.SetCompressionThreshold(1024))
+
+	// write sends the payload and returns the number of bytes received by the server
+	write := func(payload []byte) int64 {
+		before := atomic.LoadInt64(read)
+		_, err := rwc.Write(payload)
+		require.NoError(t, err)
+
+		received, err := ioutil.ReadAll(io.LimitReader(rwc, int64(len(payload))))
+		require.NoError(t, err)
+		require.Equal(t, payload, received)
+
+		return atomic.LoadInt64(read) - before
+	}
+
+	small := bytes.Repeat([]byte("a"), 512)
+	assert.True(t, write(small) > int64(len(small)), "small message must not be compressed")
+
+	large := bytes.Repeat([]byte("a"), 4096)
+	assert.True(t, write(large) < int64(len(large))/4, "large message must be compressed")
+
+	assert.Error(t, rwc.SetCompressionThreshold(-1))
+}
+
+func BenchmarkCompressionThreshold(b *testing.B) {
+	var large bytes.Buffer
+	for large.Len() < 1<<20 {
+		fmt.Fprintf(&large, "%x", large.Len())
+	}
+	payloads := []struct {
+		name string
+		data []byte
+	}{
+		{"small", []byte(`{"jsonrpc":"2.0","id":"1","method":"aria2.tellStatus","params":["2089b05ecca3d829"]}`)},
+		{"large", large.Bytes()},
+	}
+
+	for _, payload := range payloads {
+		for _, threshold := range []int{0, 64 * 1024} {
+			name := payload.name + "/always"
+			if threshold > 0 {
+				name = payload.name + "/threshold"
+			}
+
+			b.Run(name, func(b *testing.B) {
+				var received int64
+				rwc, read := newCompressedTestRWC(b, func(ws *websocket.Conn) {
+					for {
+						_, data, err := ws.ReadMessage()
+						if err != nil {
+							return
+						}
+						atomic.AddInt64(&received, int64(len(data)))
+					}
+				})
+				if err := rwc.SetCompressionThreshold(threshold); err != nil {
+					b.Fatal(err)
+				}
+
+				b.SetBytes(int64(len(payload.data)))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := rwc.Write(payload.data); err != nil {
+						b.Fatal(err)
+					}
+				}
+				for atomic.LoadInt64(&received) < int64(b.N*len(payload.data)) {
+					time.Sleep(time.Millisecond)
+				}
+				b.StopTimer()
+
+				b.ReportMetric(float64(atomic.LoadInt64(read))/float64(b.N), "wire-bytes/op")
+			})
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		_ = ws.WriteMessage(websocket.TextMessage, []byte(`{"id":"1","result":"partially read"}`))
+		_ = ws.WriteMessage(websocket.TextMessage, []byte(`{"id":"2"}`))
+		echo(ws)
+	})
+
+	buf := make([]byte, 8)
+	n, err := rwc.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":"1`, string(buf[:n]))
+
+	require.NoError(t, rwc.Reset())
+
+	// the rest of the first message is skipped
+	buf = make([]byte, 64)
+	n, err = rwc.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":"2"}`, string(buf[:n]))
+
+	// Reset between messages has no effect
+	require.NoError(t, rwc.Reset())
+	_, err = rwc.Write([]byte(`{"id":"3"}`))
+	require.NoError(t, err)
+	n, err = rwc.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":"3"}`, string(buf[:n]))
+
+	require.NoError(t, rwc.Close())
+	assert.Equal(t, io.ErrClosedPipe, rwc.Reset())
+}
+
+func TestReadLimit(t *testing.T) {
+	const limit = 64
+
+	tests := []struct {
+		name    string
+		size    int
+		exceeds bool
+	}{
+		{"under limit", limit - 1, false},
+		{"at limit", limit, false},
+		{"over limit", limit + 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := bytes.Repeat([]byte("a"), test.size)
+			rwc := newTestRWC(t, func(ws *websocket.Conn) {
+				_ = ws.WriteMessage(websocket.TextMessage, msg)
+				_, _, _ = ws.ReadMessage()
+			})
+			require.NoError(t, rwc.SetReadLimit(limit))
+
+			buf := make([]byte, 2*limit)
+			n, err := rwc.Read(buf)
+			if !test.exceeds {
+				require.NoError(t, err)
+				assert.Equal(t, msg, buf[:n])
+				return
+			}
+
+			var limitErr *ReadLimitError
+			require.True(t, errors.As(err, &limitErr), "unexpected error %v", err)
+			assert.Equal(t, int64(limit), limitErr.Limit)
+			assert.True(t, errors.Is(err, websocket.ErrReadLimit))
+		})
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	const max = 64
+
+	oversized := bytes.Repeat([]byte("a"), 4*max)
+	atLimit := bytes.Repeat([]byte("b"), max)
+	rwc := newTestRWC(t, func(ws *websocket.Conn) {
+		_ = ws.WriteMessage(websocket.TextMessage, oversized)
+		_ = ws.WriteMessage(websocket.TextMessage, atLimit)
+
+		// a message split into multiple frames must be limited as a whole
+		w, _ := ws.NextWriter(websocket.TextMessage)
+		_, _ = w.Write(oversized[:max])
+		_, _ = w.Write(oversized[max:])
+		_ = w.Close()
+		_ = ws.WriteMessage(websocket.TextMessage, []byte("next"))
+
+		_, _, _ = ws.ReadMessage()
+	})
+	rwc.MaxMessageSize = max
+
+	buf := make([]byte, 8*max)
+
+	_, err := rwc.Read(buf)
+	var limitErr *ReadLimitError
+	require.True(t, errors.As(err, &limitErr), "unexpected error %v", err)
+	assert.Equal(t, int64(max), limitErr.Limit)
+
+	// the rest of the oversized message is skipped
+	n, err := rwc.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, atLimit, buf[:n])
+
+	_, err = rwc.Read(buf)
+	require.True(t, errors.As(err, &limitErr), "unexpected error %v", err)
+
+	n, err = rwc.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "next", string(buf[:n]))
+}
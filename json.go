@@ -0,0 +1,75 @@
+package arigo
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// Int64 is an integer in an aria2 response.
+//
+// aria2 sends numbers as strings, but some versions and builds send bare numbers instead.
+// Int64 decodes from both representations and encodes as a string, like aria2 does.
+type Int64 int64
+
+// MarshalJSON encodes the integer as a quoted string.
+func (i Int64) MarshalJSON() ([]byte, error) {
+	return strconv.AppendQuote(nil, strconv.FormatInt(int64(i), 10)), nil
+}
+
+// UnmarshalJSON decodes a quoted or bare integer.
+func (i *Int64) UnmarshalJSON(data []byte) error {
+	s, isNull := unquoteScalar(data)
+	if isNull {
+		return nil
+	}
+
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	*i = Int64(v)
+	return nil
+}
+
+// Bool is a boolean in an aria2 response.
+//
+// aria2 sends booleans as the strings "true" and "false", but some versions and builds send
+// bare booleans instead.
+// Bool decodes from both representations and encodes as a string, like aria2 does.
+type Bool bool
+
+// MarshalJSON encodes the boolean as a quoted string.
+func (b Bool) MarshalJSON() ([]byte, error) {
+	return strconv.AppendQuote(nil, strconv.FormatBool(bool(b))), nil
+}
+
+// UnmarshalJSON decodes a quoted or bare boolean.
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	s, isNull := unquoteScalar(data)
+	if isNull {
+		return nil
+	}
+
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+
+	*b = Bool(v)
+	return nil
+}
+
+// unquoteScalar returns the JSON number, boolean or string in data without quotes.
+// isNull reports whether data is null, which leaves the value untouched like encoding/json does.
+func unquoteScalar(data []byte) (s string, isNull bool) {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return "", true
+	}
+	if len(data) >= 2 && data[0] == '"' && data[len(data)-1] == '"' {
+		data = data[1 : len(data)-1]
+	}
+
+	return string(data), false
+}
@@ -0,0 +1,43 @@
+package arigo
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestInt64JSON(t *testing.T) {
+	var v struct {
+		Quoted Int64 `json:"quoted"`
+		Bare   Int64 `json:"bare"`
+		Null   Int64 `json:"null"`
+	}
+	v.Null = 3
+	assert.NoError(t, json.Unmarshal([]byte(`{"quoted": "-1048576", "bare": 5368709120, "null": null}`), &v))
+	assert.Equal(t, Int64(-1048576), v.Quoted)
+	assert.Equal(t, Int64(5368709120), v.Bare)
+	assert.Equal(t, Int64(3), v.Null)
+
+	data, err := json.Marshal(v)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"quoted": "-1048576", "bare": "5368709120", "null": "3"}`, string(data))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"quoted": "1.5"}`), &v))
+	assert.Error(t, json.Unmarshal([]byte(`{"quoted": true}`), &v))
+}
+
+func TestBoolJSON(t *testing.T) {
+	var v struct {
+		Quoted Bool `json:"quoted"`
+		Bare   Bool `json:"bare"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(`{"quoted": "true", "bare": true}`), &v))
+	assert.Equal(t, Bool(true), v.Quoted)
+	assert.Equal(t, Bool(true), v.Bare)
+
+	data, err := json.Marshal(v)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"quoted": "true", "bare": "true"}`, string(data))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"quoted": "yes"}`), &v))
+}
@@ -0,0 +1,39 @@
+package arigo
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Logger receives the log messages of a Client.
+// The messages are formatted like fmt.Sprintf.
+// A Logger must be safe for concurrent use.
+type Logger interface {
+	// Debugf logs connection events and the calls made by the client.
+	Debugf(format string, args ...interface{})
+	// Errorf logs failed connection attempts, transport errors and unexpected responses.
+	Errorf(format string, args ...interface{})
+}
+
+// noopLogger is the default Logger which discards all messages.
+type noopLogger struct{}
+
+func (noopLogger) Debugf(string, ...interface{}) {}
+func (noopLogger) Errorf(string, ...interface{}) {}
+
+// redactedToken replaces the secret token in logged payloads.
+const redactedToken = "token:[redacted]"
+
+// payload formats v for the verbose log, replacing the secret token.
+func (c *Client) payload(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+
+	s := string(data)
+	if c.authToken != "" {
+		s = strings.Replace(s, "token:"+c.authToken, redactedToken, -1)
+	}
+	return s
+}
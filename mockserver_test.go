@@ -0,0 +1,361 @@
+package arigo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// mockError is the error object returned by a mockHandler.
+type mockError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mockHandler handles a method call on the mockServer.
+// params contains the raw parameters of the call.
+type mockHandler func(params []json.RawMessage) (interface{}, *mockError)
+
+type mockRequest struct {
+	ID     *json.RawMessage  `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+
+	// Raw is the request as it was received.
+	Raw json.RawMessage `json:"-"`
+}
+
+type mockResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *mockError       `json:"error,omitempty"`
+}
+
+type mockNotification struct {
+	JSONRPC string        `json:"jsonrpc"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type mockConn struct {
+	ws      *websocket.Conn
+	writeMu sync.Mutex
+}
+
+func (c *mockConn) writeJSON(v interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return c.ws.WriteJSON(v)
+}
+
+// mockServer is an in-process stand-in for the aria2 WebSocket rpc interface.
+type mockServer struct {
+	t      testing.TB
+	server *httptest.Server
+
+	mu       sync.Mutex
+	secret   string
+	header   http.Header
+	handlers map[string]mockHandler
+	conns    map[*mockConn]bool
+	requests []mockRequest
+}
+
+func newMockServer(t testing.TB) *mockServer {
+	return startMockServer(t, httptest.NewServer)
+}
+
+// newMockTLSServer is like newMockServer but the server uses TLS with a self-signed certificate.
+func newMockTLSServer(t testing.TB) *mockServer {
+	return startMockServer(t, httptest.NewTLSServer)
+}
+
+func startMockServer(t testing.TB, newServer func(http.Handler) *httptest.Server) *mockServer {
+	s := &mockServer{
+		t:        t,
+		handlers: make(map[string]mockHandler),
+		conns:    make(map[*mockConn]bool),
+	}
+
+	upgrader := websocket.Upgrader{}
+	s.server = newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.checkHeader(r.Header) {
+			http.Error(w, "missing header", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			s.servePost(w, r)
+			return
+		}
+
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		s.serve(&mockConn{ws: ws})
+	}))
+	t.Cleanup(s.server.Close)
+
+	return s
+}
+
+// url returns the WebSocket url of the server.
+// It's a wss:// url if the server uses TLS.
+func (s *mockServer) url() string {
+	return "ws" + strings.TrimPrefix(s.server.URL, "http") + "/jsonrpc"
+}
+
+// httpURL returns the HTTP url of the server.
+func (s *mockServer) httpURL() string {
+	return s.server.URL + "/jsonrpc"
+}
+
+// dial connects a new client to the server.
+func (s *mockServer) dial(authToken string, opts ...ClientOption) *Client {
+	client, err := Dial(s.url(), authToken, opts...)
+	require.NoError(s.t, err)
+	s.t.Cleanup(func() { _ = client.Close() })
+
+	return client
+}
+
+// handle registers the handler for method.
+func (s *mockServer) handle(method string, handler mockHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers[method] = handler
+}
+
+// requireSecret makes the server reject calls which don't pass the secret token,
+// just like aria2 does if it's started with --rpc-secret.
+func (s *mockServer) requireSecret(secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.secret = secret
+}
+
+// requireHeader makes the server reject connections and HTTP requests
+// which don't send value for the header key, like an authenticating reverse proxy.
+func (s *mockServer) requireHeader(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.header == nil {
+		s.header = make(http.Header)
+	}
+	s.header.Add(key, value)
+}
+
+// checkHeader reports whether header contains all values added using requireHeader.
+func (s *mockServer) checkHeader(header http.Header) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, values := range s.header {
+		for _, value := range values {
+			if !containsString(header[key], value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize reports whether a call of method with params passes the secret token.
+func (s *mockServer) authorize(method string, params []json.RawMessage) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.secret == "" || strings.HasPrefix(method, "system.") {
+		return true
+	}
+
+	var token string
+	return len(params) > 0 && json.Unmarshal(params[0], &token) == nil && token == "token:"+s.secret
+}
+
+// reply registers a handler for method which always returns result.
+func (s *mockServer) reply(method string, result interface{}) {
+	s.handle(method, func([]json.RawMessage) (interface{}, *mockError) {
+		return result, nil
+	})
+}
+
+// notify sends a notification for gid to all connected clients.
+func (s *mockServer) notify(method string, gid string) {
+	s.notifyParams(method, map[string]string{"gid": gid})
+}
+
+// notifyParams sends a notification with params to all connected clients.
+func (s *mockServer) notifyParams(method string, params ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := mockNotification{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+	}
+	for conn := range s.conns {
+		_ = conn.writeJSON(n)
+	}
+}
+
+// dropConnections closes all client connections without a close handshake.
+func (s *mockServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		_ = conn.ws.Close()
+	}
+}
+
+// connectionCount returns the number of connected clients.
+func (s *mockServer) connectionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.conns)
+}
+
+// receivedRequests returns all requests received so far.
+func (s *mockServer) receivedRequests() []mockRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]mockRequest(nil), s.requests...)
+}
+
+// multicall implements system.multicall using the registered handlers.
+func (s *mockServer) multicall(params []json.RawMessage) (interface{}, *mockError) {
+	var calls []struct {
+		MethodName string            `json:"methodName"`
+		Params     []json.RawMessage `json:"params"`
+	}
+	if len(params) != 1 || json.Unmarshal(params[0], &calls) != nil {
+		return nil, &mockError{Code: 1, Message: "The parameter at 0 has wrong type."}
+	}
+
+	results := make([]interface{}, len(calls))
+	for i, call := range calls {
+		s.mu.Lock()
+		handler := s.handlers[call.MethodName]
+		s.mu.Unlock()
+
+		if !s.authorize(call.MethodName, call.Params) {
+			results[i] = mockError{Code: 1, Message: "Unauthorized"}
+			continue
+		}
+		if handler == nil {
+			results[i] = mockError{Code: 1, Message: "No such method: " + call.MethodName}
+			continue
+		}
+
+		result, err := handler(call.Params)
+		if err != nil {
+			results[i] = err
+		} else {
+			results[i] = []interface{}{result}
+		}
+	}
+
+	return results, nil
+}
+
+func (s *mockServer) serve(conn *mockConn) {
+	s.mu.Lock()
+	s.conns[conn] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.ws.Close()
+	}()
+
+	for {
+		_, data, err := conn.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req mockRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return
+		}
+		req.Raw = data
+		// requests are recorded in the order they arrived, before they're handled concurrently
+		s.record(req)
+
+		go func() {
+			// notifications don't get a response
+			if resp := s.call(req); req.ID != nil {
+				_ = conn.writeJSON(resp)
+			}
+		}()
+	}
+}
+
+// servePost handles a request sent using HTTP POST.
+func (s *mockServer) servePost(w http.ResponseWriter, r *http.Request) {
+	var req mockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.record(req)
+	resp := s.call(req)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// record adds req to the received requests.
+func (s *mockServer) record(req mockRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, req)
+}
+
+// call calls the handler of req.
+func (s *mockServer) call(req mockRequest) mockResponse {
+	s.mu.Lock()
+	handler, ok := s.handlers[req.Method]
+	if !ok && req.Method == "system.multicall" {
+		handler = s.multicall
+	}
+	s.mu.Unlock()
+
+	resp := mockResponse{JSONRPC: "2.0", ID: req.ID}
+	if !s.authorize(req.Method, req.Params) {
+		resp.Error = &mockError{Code: 1, Message: "Unauthorized"}
+	} else if handler == nil {
+		resp.Error = &mockError{Code: 1, Message: "No such method: " + req.Method}
+	} else {
+		resp.Result, resp.Error = handler(req.Params)
+	}
+
+	return resp
+}
@@ -2,17 +2,11 @@ package arigo
 
 import (
 	"encoding/json"
+	"fmt"
 )
 
 // MethodCallError represents an error returned by aria2 for a MethodCall
-type MethodCallError struct {
-	Code    uint   `json:"code,string"`
-	Message string `json:"message"`
-}
-
-func (e *MethodCallError) Error() string {
-	return e.Message
-}
+type MethodCallError = RPCError
 
 // MethodResult represents the result of a MethodCall
 // in a MultiCall operation.
@@ -23,20 +17,47 @@ type MethodResult struct {
 	// This is likely to be a MethodCallError but it's
 	// not guaranteed.
 	Error error
+
+	// encoding decodes Result, it's the JSONEncoding of the client which made the call.
+	encoding JSONEncoding
 }
 
 // Unmarshal unmarshals the raw result into v.
 // If the result contains an error, it is returned directly
 // without ever even attempting to unmarshal the result.
+// Results returned by MultiCall are decoded using the JSONEncoding of the client.
 func (res *MethodResult) Unmarshal(v interface{}) error {
 	if res.Error != nil {
 		return res.Error
 	}
 
+	if res.encoding != nil {
+		return res.encoding.Unmarshal(res.Result, v)
+	}
 	err := json.Unmarshal(res.Result, v)
 	return err
 }
 
+// parseMethodResult parses an entry of a system.multicall response.
+// aria2 wraps the result of a successful call in an array with a single element
+// and returns a fault struct for failed calls.
+func parseMethodResult(encoding JSONEncoding, data json.RawMessage) MethodResult {
+	var result []json.RawMessage
+	if err := encoding.Unmarshal(data, &result); err == nil {
+		if len(result) != 1 {
+			return MethodResult{Error: fmt.Errorf("unexpected multicall result %s", data)}
+		}
+		return MethodResult{Result: result[0], encoding: encoding}
+	}
+
+	var methodErr MethodCallError
+	if err := encoding.Unmarshal(data, &methodErr); err != nil {
+		return MethodResult{Error: err}
+	}
+
+	return MethodResult{Error: &methodErr}
+}
+
 // MethodCall represents a method call in a multi call operation
 type MethodCall struct {
 	MethodName string        `json:"methodName"` // Method name to call
@@ -0,0 +1,69 @@
+package arigo
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Braurbeki/arigo/internal/pkg/jsonrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMethodResult(t *testing.T) {
+	result := parseMethodResult(jsonrpc.StdEncoding, json.RawMessage(`["2089b05ecca3d829"]`))
+	require.NoError(t, result.Error)
+
+	var gid string
+	require.NoError(t, result.Unmarshal(&gid))
+	assert.Equal(t, "2089b05ecca3d829", gid)
+
+	result = parseMethodResult(jsonrpc.StdEncoding, json.RawMessage(`{"code":1,"message":"GID 2089b05ecca3d829 is not found"}`))
+	require.Error(t, result.Error)
+	assert.Equal(t, &MethodCallError{Code: 1, Message: "GID 2089b05ecca3d829 is not found"}, result.Error)
+	assert.Equal(t, result.Error, result.Unmarshal(&gid))
+
+	result = parseMethodResult(jsonrpc.StdEncoding, json.RawMessage(`[]`))
+	assert.Error(t, result.Error)
+}
+
+func TestMultiCall(t *testing.T) {
+	server := newMockServer(t)
+	server.handle("aria2.pause", func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		_ = json.Unmarshal(params[0], &gid)
+		if gid != "2089b05ecca3d829" {
+			return nil, &mockError{Code: 1, Message: "GID " + gid + " is not found"}
+		}
+		return gid, nil
+	})
+
+	client := server.dial("")
+
+	results, err := client.MultiCall(
+		NewMethodCall("aria2.pause", "2089b05ecca3d829"),
+		NewMethodCall("aria2.pause", "d2703803b52216d1"),
+		NewMethodCall("aria2.bogus"),
+	)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	var gid string
+	require.NoError(t, results[0].Unmarshal(&gid))
+	assert.Equal(t, "2089b05ecca3d829", gid)
+	assert.Error(t, results[1].Error)
+	assert.Error(t, results[2].Error)
+
+	errs, err := client.PauseMany("2089b05ecca3d829", "invalid", "d2703803b52216d1")
+	require.NoError(t, err)
+	require.Len(t, errs, 3)
+	assert.NoError(t, errs[0])
+	assert.True(t, errors.Is(errs[1], ErrInvalidGID))
+	assert.Equal(t, &MethodCallError{Code: 1, Message: "GID d2703803b52216d1 is not found"}, errs[2])
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 2)
+	var calls []MethodCall
+	require.NoError(t, json.Unmarshal(requests[1].Params[0], &calls))
+	assert.Len(t, calls, 2, "invalid gid was sent")
+}
@@ -1,6 +1,19 @@
 package arigo
 
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
 // Options represents the aria2 input file options
+//
+// Fields which are left at their zero value aren't sent to aria2.
+// Options which aren't represented by a field, or which need to be
+// set to a zero value (e.g. "false"), can be set using Extra.
 type Options struct {
 	AllProxy                      string  `json:"all-proxy,omitempty"`
 	AllProxyPassword              string  `json:"all-proxy-passwd,omitempty"`
@@ -71,9 +84,11 @@ type Options struct {
 	HTTPSProxyUser                string  `json:"https-proxy-user,omitempty"`
 	IndexOut                      uint    `json:"index-out,omitempty,string"`
 	LowestSpeedLimit              string  `json:"lowest-speed-limit,omitempty"`
+	MaxConcurrentDownloads        uint    `json:"max-concurrent-downloads,omitempty,string"`
 	MaxConnectionPerServer        uint    `json:"max-connection-per-server,omitempty,string"`
 	MaxDownloadLimit              string  `json:"max-download-limit,omitempty"`
 	MaxOverallDownloadLimit       string  `json:"max-overall-download-limit,omitempty"`
+	MaxOverallUploadLimit         string  `json:"max-overall-upload-limit,omitempty"`
 	MaxFileNotFound               uint    `json:"max-file-not-found,omitempty,string"`
 	MaxMMapLimit                  string  `json:"max-mmap-limit,omitempty"`
 	MaxResumeFailureTries         uint    `json:"max-resume-failure-tries,omitempty,string"`
@@ -103,6 +118,8 @@ type Options struct {
 	RetryWait                     uint    `json:"retry-wait,omitempty,string"`
 	ReuseURI                      bool    `json:"reuse-uri,omitempty,string"`
 	RPCSaveUploadMetadata         string  `json:"rpc-save-upload-metadata,omitempty"`
+	SaveSession                   string  `json:"save-session,omitempty"`
+	SaveSessionInterval           uint    `json:"save-session-interval,omitempty,string"`
 	SeedRatio                     float32 `json:"seed-ratio,omitempty,string"`
 	SeedTime                      uint    `json:"seed-time,omitempty,string"`
 	SelectFile                    string  `json:"select-file,omitempty"`
@@ -113,4 +130,229 @@ type Options struct {
 	URISelector                   string  `json:"uri-selector,omitempty"`
 	UseHead                       bool    `json:"use-head,omitempty,string"`
 	UserAgent                     string  `json:"user-agent,omitempty"`
+
+	// Extra holds additional options using the aria2 option names as keys.
+	// The values take precedence over the values of the fields.
+	Extra map[string]string `json:"-"`
+}
+
+// optionValues holds the accepted values of the options which only accept a fixed set of values.
+var optionValues = map[string][]string{
+	"bt-min-crypto-level":         {"plain", "arc4"},
+	"file-allocation":             {"none", "prealloc", "trunc", "falloc"},
+	"ftp-type":                    {"binary", "ascii"},
+	"metalink-preferred-protocol": {"http", "https", "ftp", "none"},
+	"proxy-method":                {"get", "tunnel"},
+	"remove-control-file":         {"true", "false"},
+	"rpc-save-upload-metadata":    {"true", "false"},
+	"stream-piece-selector":       {"default", "inorder", "random", "geom"},
+	"uri-selector":                {"inorder", "feedback", "adaptive"},
+}
+
+// ToMap converts the options to the format used by aria2,
+// a map of option names to string values.
+// An error is returned if an option has a value aria2 doesn't accept.
+//
+// The values of size and speed limit options like MinSplitSize and MaxDownloadLimit are parsed
+// using ParseSize. Values which aria2 doesn't accept as they are, like "1.5G", are converted to bytes.
+func (o Options) ToMap() (map[string]string, error) {
+	m := make(map[string]string, len(o.Extra))
+
+	v := reflect.ValueOf(o)
+	for name, i := range optionFields {
+		if field := v.Field(i); !field.IsZero() {
+			m[name] = formatOption(field)
+		}
+	}
+
+	for key, value := range o.Extra {
+		m[key] = value
+	}
+
+	if err := validateOptions(m); err != nil {
+		return nil, err
+	}
+	if err := normalizeSizes(m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Clone returns a deep copy of the options, which doesn't share Extra with o.
+func (o Options) Clone() Options {
+	if o.Extra != nil {
+		extra := make(map[string]string, len(o.Extra))
+		for key, value := range o.Extra {
+			extra[key] = value
+		}
+		o.Extra = extra
+	}
+	return o
+}
+
+// Merge returns a copy of o with the options set in override applied on top.
+// Neither o nor override is modified.
+//
+// Like when sending options to aria2, a field counts as set if it's not at its zero value.
+// The fields set in override replace those of o, and so do its Extra options, which are
+// merged by key. An option can therefore only be overridden with a zero value, like "false"
+// or "0", using Extra.
+func (o Options) Merge(override Options) Options {
+	merged := o.Clone()
+
+	dst := reflect.ValueOf(&merged).Elem()
+	src := reflect.ValueOf(override)
+	typ := src.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		name := optionName(typ.Field(i))
+		if name == "" || src.Field(i).IsZero() {
+			continue
+		}
+
+		dst.Field(i).Set(src.Field(i))
+		// Extra takes precedence over the fields, so a value of o would win otherwise
+		delete(merged.Extra, name)
+	}
+
+	if len(override.Extra) > 0 && merged.Extra == nil {
+		merged.Extra = make(map[string]string, len(override.Extra))
+	}
+	for key, value := range override.Extra {
+		merged.Extra[key] = value
+	}
+
+	return merged
+}
+
+// MarshalJSON encodes the options in the format used by aria2.
+func (o Options) MarshalJSON() ([]byte, error) {
+	m, err := o.ToMap()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON decodes the options in the format used by aria2,
+// as returned by GetOptions and GetGlobalOptions.
+// Options which aren't represented by a field, or whose value can't be
+// stored in the field, are collected in Extra.
+func (o *Options) UnmarshalJSON(data []byte) error {
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	*o = optionsFromMap(m)
+	return nil
+}
+
+// optionsFromMap converts options in the format used by aria2 to Options, like UnmarshalJSON.
+// The client decodes the options into a map using its JSONEncoding and converts them using
+// optionsFromMap, so encoding/json isn't involved.
+func optionsFromMap(m map[string]string) Options {
+	var o Options
+	v := reflect.ValueOf(&o).Elem()
+	for key, value := range m {
+		if i, ok := optionFields[key]; ok && parseOption(v.Field(i), value) {
+			continue
+		}
+
+		if o.Extra == nil {
+			o.Extra = make(map[string]string)
+		}
+		o.Extra[key] = value
+	}
+
+	return o
+}
+
+// formatOption returns the value of an option field in the format used by aria2.
+func formatOption(field reflect.Value) string {
+	switch field.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(field.Bool())
+	case reflect.Uint:
+		return strconv.FormatUint(field.Uint(), 10)
+	case reflect.Float32:
+		return strconv.FormatFloat(field.Float(), 'f', -1, 32)
+	default:
+		return field.String()
+	}
+}
+
+// parseOption stores value in an option field and reports whether the value fits the field.
+func parseOption(field reflect.Value, value string) bool {
+	switch field.Kind() {
+	case reflect.Bool:
+		if value != "true" && value != "false" {
+			return false
+		}
+		field.SetBool(value == "true")
+	case reflect.Uint:
+		u, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return false
+		}
+		field.SetUint(u)
+	case reflect.Float32:
+		f, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return false
+		}
+		field.SetFloat(f)
+	default:
+		field.SetString(value)
+	}
+	return true
+}
+
+// optionFields maps the names of the options represented by a field of Options to the field index.
+var optionFields = optionFieldIndices()
+
+func optionFieldIndices() map[string]int {
+	fields := make(map[string]int)
+
+	typ := reflect.TypeOf(Options{})
+	for i := 0; i < typ.NumField(); i++ {
+		if name := optionName(typ.Field(i)); name != "" {
+			fields[name] = i
+		}
+	}
+
+	return fields
+}
+
+// optionName returns the aria2 name of the option stored in field, or "" if it's not an option.
+func optionName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+func validateOptions(m map[string]string) error {
+	for key, value := range m {
+		allowed, ok := optionValues[key]
+		if !ok {
+			continue
+		}
+
+		valid := false
+		for _, a := range allowed {
+			if value == a {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			sorted := append([]string(nil), allowed...)
+			sort.Strings(sorted)
+			return fmt.Errorf("invalid value %q for option %s, expected one of %s", value, key, strings.Join(sorted, ", "))
+		}
+	}
+
+	return nil
 }
@@ -3,6 +3,7 @@ package arigo
 import (
 	"encoding/json"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
 )
 
@@ -24,3 +25,131 @@ func TestOptionFormat(t *testing.T) {
 		AsyncDNS:               true,
 	}, options)
 }
+
+func TestOptionsToMap(t *testing.T) {
+	options := Options{
+		Dir:                    "/downloads",
+		Out:                    "file.iso",
+		MaxConnectionPerServer: 4,
+		Split:                  8,
+		Continue:               true,
+		SeedRatio:              1.5,
+		FileAllocation:         "falloc",
+		Extra: map[string]string{
+			"pause":                     "false",
+			"some-future-option":        "value",
+			"max-connection-per-server": "16",
+		},
+	}
+
+	m, err := options.ToMap()
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"dir":                       "/downloads",
+		"out":                       "file.iso",
+		"max-connection-per-server": "16",
+		"split":                     "8",
+		"continue":                  "true",
+		"seed-ratio":                "1.5",
+		"file-allocation":           "falloc",
+		"pause":                     "false",
+		"some-future-option":        "value",
+	}, m)
+
+	data, err := json.Marshal(options)
+	require.NoError(t, err)
+
+	var decoded map[string]string
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, m, decoded)
+}
+
+func TestOptionsUnmarshal(t *testing.T) {
+	var options Options
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"dir": "/downloads",
+		"split": "5",
+		"continue": "true",
+		"seed-ratio": "1.5",
+		"pause": "false",
+		"max-connection-per-server": "many",
+		"some-future-option": "value"
+	}`), &options))
+
+	assert.Equal(t, Options{
+		Dir:       "/downloads",
+		Split:     5,
+		Continue:  true,
+		SeedRatio: 1.5,
+		Extra: map[string]string{
+			"max-connection-per-server": "many",
+			"some-future-option":        "value",
+		},
+	}, options)
+
+	var empty Options
+	require.NoError(t, json.Unmarshal([]byte(`{}`), &empty))
+	assert.Equal(t, Options{}, empty)
+}
+
+func TestOptionsToMapInvalidValue(t *testing.T) {
+	_, err := Options{FileAllocation: "fast"}.ToMap()
+	assert.Error(t, err)
+
+	_, err = Options{Extra: map[string]string{"uri-selector": "random"}}.ToMap()
+	assert.Error(t, err)
+
+	_, err = json.Marshal(Options{ProxyMethod: "post"})
+	assert.Error(t, err)
+}
+
+func TestOptionsClone(t *testing.T) {
+	base := Options{Dir: "/downloads", Extra: map[string]string{"max-tries": "5"}}
+
+	clone := base.Clone()
+	assert.Equal(t, base, clone)
+
+	clone.Extra["max-tries"] = "10"
+	clone.Extra["split"] = "4"
+	clone.Dir = "/tmp"
+	assert.Equal(t, Options{Dir: "/downloads", Extra: map[string]string{"max-tries": "5"}}, base)
+
+	assert.Nil(t, Options{}.Clone().Extra)
+}
+
+func TestOptionsMerge(t *testing.T) {
+	base := Options{
+		Dir:            "/downloads",
+		Split:          4,
+		AllowOverwrite: true,
+		Extra:          map[string]string{"max-tries": "5", "out": "base.iso", "seed-time": "0"},
+	}
+	override := Options{
+		Split: 8,
+		Out:   "override.iso",
+		Extra: map[string]string{"allow-overwrite": "false", "seed-time": "60"},
+	}
+
+	merged := base.Merge(override)
+	m, err := merged.ToMap()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"dir":             "/downloads",
+		"split":           "8",
+		"out":             "override.iso",
+		"allow-overwrite": "false",
+		"max-tries":       "5",
+		"seed-time":       "60",
+	}, m)
+
+	// neither input is modified
+	assert.Equal(t, uint(4), base.Split)
+	assert.Equal(t, map[string]string{"max-tries": "5", "out": "base.iso", "seed-time": "0"}, base.Extra)
+	assert.Equal(t, map[string]string{"allow-overwrite": "false", "seed-time": "60"}, override.Extra)
+
+	merged.Extra["max-tries"] = "1"
+	assert.Equal(t, "5", base.Extra["max-tries"])
+
+	assert.Equal(t, Options{Dir: "/downloads"}, Options{}.Merge(Options{Dir: "/downloads"}))
+}
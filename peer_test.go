@@ -38,7 +38,7 @@ func TestPeerFormat(t *testing.T) {
 	assert.Equal(t, Peer{
 		AmChoking:     true,
 		BitField:      "ffffffffffffffffffffffffffffffffffffffff",
-		DownloadSpeed: uint(10602),
+		DownloadSpeed: Int64(10602),
 		IP:            "10.0.0.9",
 		PeerChoking:   false,
 		ID:            "aria2%2F1%2E10%2E5%2D%87%2A%EDz%2F%F7%E6",
@@ -51,7 +51,7 @@ func TestPeerFormat(t *testing.T) {
 	assert.Equal(t, Peer{
 		AmChoking:     false,
 		BitField:      "ffffeff0fffffffbfffffff9fffffcfff7f4ffff",
-		DownloadSpeed: uint(8654),
+		DownloadSpeed: Int64(8654),
 		IP:            "10.0.0.30",
 		PeerChoking:   false,
 		ID:            "bittorrent client758",
@@ -60,3 +60,26 @@ func TestPeerFormat(t *testing.T) {
 		UploadSpeed:   6890,
 	}, secondPeer)
 }
+
+func TestPeerBareValues(t *testing.T) {
+	data := []byte(`{
+		"amChoking": true,
+		"peerChoking": "false",
+		"downloadSpeed": 10602,
+		"uploadSpeed": "7",
+		"ip": "10.0.0.9",
+		"port": 6881,
+		"seeder": true
+	}`)
+
+	var peer Peer
+	assert.NoError(t, json.Unmarshal(data, &peer))
+	assert.Equal(t, Peer{
+		AmChoking:     true,
+		DownloadSpeed: 10602,
+		UploadSpeed:   7,
+		IP:            "10.0.0.9",
+		Port:          6881,
+		Seeder:        true,
+	}, peer)
+}
@@ -7,4 +7,8 @@ const (
 	OnDownloadComplete   = "aria2.onDownloadComplete"
 	OnDownloadError      = "aria2.onDownloadError"
 	OnBTDownloadComplete = "aria2.onBtDownloadComplete"
+
+	// OnGlobalStat isn't sent by aria2 itself, some builds push the result of
+	// aria2.getGlobalStat periodically using it and advertise it by system.listNotifications.
+	OnGlobalStat = "aria2.onGlobalStat"
 )
@@ -0,0 +1,176 @@
+// Package arigotest provides an in-memory arigo.Transport for unit testing code
+// which uses an arigo.Client without a running aria2 instance.
+package arigotest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/Braurbeki/arigo"
+)
+
+// ErrClosed is returned by the calls made after the Transport was closed.
+var ErrClosed = errors.New("arigotest: transport closed")
+
+// Handler handles a call of a method on a Transport.
+// params contains the raw parameters of the call, starting with the secret token if the client has one.
+// Errors should be returned as *arigo.RPCError to simulate an error reported by aria2.
+type Handler func(params []json.RawMessage) (result interface{}, err error)
+
+// Call is a call or notification received by a Transport.
+type Call struct {
+	Method string
+	Params []json.RawMessage
+}
+
+// Transport is an in-memory arigo.Transport which answers the calls of a client using handlers.
+// It's passed to the client using arigo.WithTransport:
+//
+//	transport := arigotest.NewTransport()
+//	transport.Reply("aria2.getVersion", arigo.VersionInfo{Version: "1.36.0"})
+//	client, err := arigo.Dial("", "", arigo.WithTransport(transport))
+//
+// Calls of methods without a handler fail with an *arigo.RPCError, like they do on aria2.
+type Transport struct {
+	mu       sync.Mutex
+	handlers map[string]Handler
+	calls    []Call
+	notify   arigo.NotificationHandler
+	closed   bool
+}
+
+// NewTransport creates a new Transport without any handlers.
+func NewTransport() *Transport {
+	return &Transport{handlers: make(map[string]Handler)}
+}
+
+// Handle registers the handler for method, replacing the previous one.
+func (t *Transport) Handle(method string, handler Handler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.handlers[method] = handler
+}
+
+// Reply registers a handler for method which always returns result.
+func (t *Transport) Reply(method string, result interface{}) {
+	t.Handle(method, func([]json.RawMessage) (interface{}, error) {
+		return result, nil
+	})
+}
+
+// Calls returns the calls and notifications received so far, in order.
+func (t *Transport) Calls() []Call {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]Call(nil), t.calls...)
+}
+
+// SendNotification delivers a notification with params to the client,
+// for example aria2.onDownloadComplete with map[string]string{"gid": gid}.
+// It returns once the listeners of the client have handled it.
+func (t *Transport) SendNotification(method string, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	notify := t.notify
+	closed := t.closed
+	t.mu.Unlock()
+
+	if closed {
+		return ErrClosed
+	}
+	if notify != nil {
+		notify(method, raw)
+	}
+	return nil
+}
+
+// Call implements arigo.Transport.
+// The params and the result are passed through encoding/json, like they would be on a real connection.
+func (t *Transport) Call(ctx context.Context, method string, params interface{}, reply interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	rawParams, err := t.record(method, params)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	handler := t.handlers[method]
+	t.mu.Unlock()
+
+	if handler == nil {
+		return &arigo.RPCError{Code: 1, Message: "No such method: " + method}
+	}
+
+	result, err := handler(rawParams)
+	if err != nil {
+		return err
+	}
+	if reply == nil {
+		return nil
+	}
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, reply)
+}
+
+// Notify implements arigo.Transport, the notification is recorded like a call.
+func (t *Transport) Notify(method string, params interface{}) error {
+	_, err := t.record(method, params)
+	return err
+}
+
+// record adds a call of method with params to the received calls.
+func (t *Transport) record(method string, params interface{}) ([]json.RawMessage, error) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	var rawParams []json.RawMessage
+	if err := json.Unmarshal(raw, &rawParams); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, ErrClosed
+	}
+	t.calls = append(t.calls, Call{Method: method, Params: rawParams})
+	return rawParams, nil
+}
+
+// Subscribe implements arigo.Transport.
+func (t *Transport) Subscribe(handler arigo.NotificationHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.notify = handler
+}
+
+// Close implements arigo.Transport.
+// The calls made after closing the transport fail with ErrClosed.
+func (t *Transport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	return nil
+}
@@ -0,0 +1,96 @@
+package arigotest
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Braurbeki/arigo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dial(t *testing.T, transport *Transport) *arigo.Client {
+	client, err := arigo.Dial("", "secret", arigo.WithTransport(transport))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	return client
+}
+
+func TestTransportCall(t *testing.T) {
+	transport := NewTransport()
+	transport.Reply("aria2.getVersion", arigo.VersionInfo{Version: "1.36.0"})
+	transport.Handle("aria2.pause", func(params []json.RawMessage) (interface{}, error) {
+		return nil, &arigo.RPCError{Code: 1, Message: "GID 2089b05ecca3d829 is not found"}
+	})
+
+	client := dial(t, transport)
+	assert.True(t, client.IsConnected())
+
+	version, err := client.GetVersion()
+	require.NoError(t, err)
+	assert.Equal(t, "1.36.0", version.Version)
+
+	err = client.Pause("2089b05ecca3d829")
+	var rpcErr *arigo.RPCError
+	require.True(t, errors.As(err, &rpcErr))
+	assert.Equal(t, "GID 2089b05ecca3d829 is not found", rpcErr.Message)
+
+	_, err = client.GetGlobalStats()
+	require.True(t, errors.As(err, &rpcErr))
+	assert.Equal(t, "No such method: aria2.getGlobalStat", rpcErr.Message)
+
+	require.NoError(t, client.Notify("custom.notify", []interface{}{"value"}))
+
+	calls := transport.Calls()
+	require.Len(t, calls, 4)
+	assert.Equal(t, "aria2.pause", calls[1].Method)
+	require.Len(t, calls[1].Params, 2)
+	assert.JSONEq(t, `"token:secret"`, string(calls[1].Params[0]))
+	assert.JSONEq(t, `"2089b05ecca3d829"`, string(calls[1].Params[1]))
+	assert.Equal(t, "custom.notify", calls[3].Method)
+}
+
+func TestTransportNotification(t *testing.T) {
+	transport := NewTransport()
+	client := dial(t, transport)
+
+	var completed []string
+	unsub := client.Subscribe(arigo.CompleteEvent, func(event *arigo.DownloadEvent) {
+		completed = append(completed, event.GID)
+	})
+	defer unsub()
+
+	var unknown []*arigo.UnknownEvent
+	unsubUnknown := client.SubscribeUnknown(func(event *arigo.UnknownEvent) {
+		unknown = append(unknown, event)
+	})
+	defer unsubUnknown()
+
+	// the listeners have run once SendNotification returns
+	require.NoError(t, transport.SendNotification("aria2.onDownloadComplete", map[string]string{"gid": "2089b05ecca3d829"}))
+	require.NoError(t, transport.SendNotification("aria2.onDownloadUnknown", "value"))
+
+	assert.Equal(t, []string{"2089b05ecca3d829"}, completed)
+	require.Len(t, unknown, 1)
+	assert.Equal(t, "aria2.onDownloadUnknown", unknown[0].Method)
+	require.Len(t, unknown[0].Params, 1)
+	assert.JSONEq(t, `"value"`, string(unknown[0].Params[0]))
+}
+
+func TestTransportClose(t *testing.T) {
+	transport := NewTransport()
+	transport.Reply("aria2.getVersion", arigo.VersionInfo{Version: "1.36.0"})
+
+	client := dial(t, transport)
+	require.NoError(t, client.Close())
+	assert.False(t, client.IsConnected())
+
+	<-client.Done()
+	assert.NoError(t, client.Err())
+
+	_, err := client.GetVersion()
+	assert.Equal(t, arigo.ErrClientClosed, err)
+	assert.Equal(t, ErrClosed, transport.SendNotification("aria2.onDownloadStart"))
+}
@@ -0,0 +1,111 @@
+package arigo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ClientPool is a Client which spreads its calls across multiple connections
+// to the same aria2 rpc interface.
+//
+// A single WebSocket connection sends one message at a time, which limits the throughput
+// if many calls are made concurrently. The calls of a ClientPool take turns using the
+// connections of the pool instead.
+//
+// Notifications are only received on an additional connection, which isn't used for calls,
+// so every event is dispatched exactly once.
+// Closing the pool closes all of its connections.
+//
+// Done, Err and IsConnected cover all connections of the pool, while the methods of the
+// embedded Client only know about the connection receiving notifications.
+type ClientPool struct {
+	*Client
+
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// DialPool creates a new ClientPool with size connections to an aria2 rpc interface
+// which are used for calls, plus one connection for notifications.
+// The options apply to all connections.
+func DialPool(url string, authToken string, size int, opts ...ClientOption) (*ClientPool, error) {
+	return DialPoolContext(context.Background(), url, authToken, size, opts...)
+}
+
+// DialPoolContext is like DialPool but aborts connecting once ctx is done.
+// If one of the connections can't be established, those already established are closed.
+func DialPoolContext(ctx context.Context, url string, authToken string, size int, opts ...ClientOption) (*ClientPool, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("pool size must be at least 1, got %d", size)
+	}
+
+	client, err := DialContext(ctx, url, authToken, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	conns := make([]*Client, 0, size)
+	for i := 0; i < size; i++ {
+		conn, err := DialContext(ctx, url, authToken, opts...)
+		if err != nil {
+			client.pool = conns
+			_ = client.Close()
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+	client.pool = conns
+
+	p := &ClientPool{Client: client, done: make(chan struct{})}
+	for _, conn := range append([]*Client{client}, conns...) {
+		go p.watchDone(conn)
+	}
+
+	return p, nil
+}
+
+// watchDone closes the done channel of the pool once conn is done.
+func (p *ClientPool) watchDone(conn *Client) {
+	<-conn.Done()
+	p.doneOnce.Do(func() { close(p.done) })
+}
+
+// Done returns a channel which is closed once the pool is closed or one of its connections,
+// including the one used for calls, was lost.
+// If reconnecting is enabled, lost connections are replaced, so the channel is only closed by Close.
+func (p *ClientPool) Done() <-chan struct{} {
+	return p.done
+}
+
+// Err returns the error which ended the first lost connection once Done is closed.
+// It's nil if the pool was closed, or if Done isn't closed yet.
+func (p *ClientPool) Err() error {
+	if err := p.Client.Err(); err != nil {
+		return err
+	}
+	for _, conn := range p.pool {
+		if err := conn.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsConnected reports whether all connections of the pool are alive.
+func (p *ClientPool) IsConnected() bool {
+	if !p.Client.IsConnected() {
+		return false
+	}
+	for _, conn := range p.pool {
+		if !conn.IsConnected() {
+			return false
+		}
+	}
+	return true
+}
+
+// Size returns the number of connections used for calls.
+func (p *ClientPool) Size() int {
+	return len(p.pool)
+}
@@ -0,0 +1,133 @@
+package arigo
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rpc2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dialPool(t testing.TB, server *mockServer, size int) *ClientPool {
+	pool, err := DialPool(server.url(), "", size)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = pool.Close() })
+
+	return pool
+}
+
+func TestClientPool(t *testing.T) {
+	server := newLatencyServer(t, 0)
+	pool := dialPool(t, server, 3)
+
+	eventually(t, func() bool { return server.connectionCount() == 4 }, "pool didn't connect")
+	assert.Equal(t, 3, pool.Size())
+
+	used := make(map[*rpc2.Client]int)
+	for i := 0; i < 6; i++ {
+		used[pool.callRPCClient()]++
+	}
+	assert.Len(t, used, 3)
+	assert.Zero(t, used[pool.getRPCClient()], "the notification connection must not be used for calls")
+	for _, n := range used {
+		assert.Equal(t, 2, n)
+	}
+
+	status, err := pool.TellStatus("2089b05ecca3d829")
+	require.NoError(t, err)
+	assert.Equal(t, "2089b05ecca3d829", status.GID)
+}
+
+func TestClientPoolNotifications(t *testing.T) {
+	server := newMockServer(t)
+	pool := dialPool(t, server, 2)
+
+	events, unsub := pool.SubscribeChan(CompleteEvent, 2)
+	defer unsub()
+
+	eventually(t, func() bool { return server.connectionCount() == 3 }, "pool didn't connect")
+	server.notify("aria2.onDownloadComplete", "2089b05ecca3d829")
+
+	select {
+	case event := <-events:
+		assert.Equal(t, "2089b05ecca3d829", event.GID)
+	case <-time.After(time.Second):
+		t.Fatal("event not received")
+	}
+
+	select {
+	case <-events:
+		t.Fatal("event received more than once")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestClientPoolClose(t *testing.T) {
+	server := newMockServer(t)
+	pool := dialPool(t, server, 3)
+	eventually(t, func() bool { return server.connectionCount() == 4 }, "pool didn't connect")
+
+	require.NoError(t, pool.Close())
+	eventually(t, func() bool { return server.connectionCount() == 0 }, "connections weren't closed")
+
+	_, err := pool.GetVersion()
+	assert.Error(t, err)
+}
+
+func TestClientPoolDone(t *testing.T) {
+	server := newMockServer(t)
+	pool := dialPool(t, server, 2)
+	eventually(t, func() bool { return server.connectionCount() == 3 }, "pool didn't connect")
+	assert.True(t, pool.IsConnected())
+
+	// losing a connection used for calls must be visible, not just the notification connection
+	require.NoError(t, pool.pool[1].Close())
+	select {
+	case <-pool.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done wasn't closed")
+	}
+	assert.False(t, pool.IsConnected())
+	assert.True(t, pool.Client.IsConnected())
+	assert.NoError(t, pool.Err())
+
+	pool = dialPool(t, server, 2)
+	eventually(t, func() bool { return server.connectionCount() == 5 }, "pool didn't connect")
+	server.dropConnections()
+	select {
+	case <-pool.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done wasn't closed")
+	}
+	assert.Error(t, pool.Err())
+}
+
+func TestDialPoolSize(t *testing.T) {
+	server := newMockServer(t)
+
+	_, err := DialPool(server.url(), "", 0)
+	assert.Error(t, err)
+	assert.Zero(t, server.connectionCount())
+}
+
+func BenchmarkClientPool(b *testing.B) {
+	for _, size := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			server := newLatencyServer(b, time.Millisecond)
+			pool := dialPool(b, server, size)
+
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := pool.TellStatus("2089b05ecca3d829"); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package arigo
+
+// Progress is the combined progress of several downloads, see AggregateProgress.
+type Progress struct {
+	// CompletedLength and TotalLength are the sums over the downloads with a known length
+	// which didn't fail, in bytes.
+	CompletedLength int64
+	TotalLength     int64
+
+	Downloads int // number of downloads
+	Completed int // downloads which are complete
+	Failed    int // downloads which stopped because of an error or were removed
+	// Unknown is the number of downloads whose total length isn't known yet, for example
+	// because the download hasn't started or is fetching BitTorrent metadata.
+	// They aren't included in the lengths.
+	Unknown int
+}
+
+// AggregateProgress combines the progress of the downloads described by statuses,
+// for example to show the progress of a batch of downloads.
+//
+// Downloads which failed will never finish, they're counted in Failed but not included
+// in the lengths, so the remaining downloads can still reach 100%. Downloads whose total
+// length is unknown are counted in Unknown and make the progress indeterminate.
+// Requires the Status, TotalLength and CompletedLength keys.
+func AggregateProgress(statuses []Status) Progress {
+	var p Progress
+	p.Downloads = len(statuses)
+
+	for _, s := range statuses {
+		switch s.Status {
+		case StatusError, StatusRemoved:
+			p.Failed++
+			continue
+		case StatusCompleted:
+			p.Completed++
+			p.CompletedLength += int64(s.TotalLength)
+			p.TotalLength += int64(s.TotalLength)
+			continue
+		}
+
+		if s.TotalLength <= 0 {
+			p.Unknown++
+			continue
+		}
+
+		completed := s.CompletedLength
+		if completed > s.TotalLength {
+			completed = s.TotalLength
+		}
+		p.CompletedLength += int64(completed)
+		p.TotalLength += int64(s.TotalLength)
+	}
+
+	return p
+}
+
+// Percent returns the completed share of the total length in percent, between 0 and 100.
+// It's 100 if all downloads completed and 0 if no total length is known.
+// If the progress is indeterminate, it only covers the downloads with a known length.
+func (p Progress) Percent() float64 {
+	if p.TotalLength <= 0 {
+		if p.Downloads > 0 && p.Completed == p.Downloads {
+			return 100
+		}
+		return 0
+	}
+	return float64(p.CompletedLength) * 100 / float64(p.TotalLength)
+}
+
+// Indeterminate reports whether the total length of some downloads isn't known yet,
+// so Percent may still drop once it becomes known.
+func (p Progress) Indeterminate() bool {
+	return p.Unknown > 0
+}
@@ -0,0 +1,67 @@
+package arigo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregateProgress(t *testing.T) {
+	tests := []struct {
+		name          string
+		statuses      []Status
+		progress      Progress
+		percent       float64
+		indeterminate bool
+	}{
+		{"empty", nil, Progress{}, 0, false},
+		{
+			"active",
+			[]Status{
+				{Status: StatusActive, TotalLength: 1000, CompletedLength: 250},
+				{Status: StatusWaiting, TotalLength: 1000},
+			},
+			Progress{CompletedLength: 250, TotalLength: 2000, Downloads: 2},
+			12.5, false,
+		},
+		{
+			"mixed",
+			[]Status{
+				{Status: StatusCompleted, TotalLength: 1000, CompletedLength: 1000},
+				{Status: StatusActive, TotalLength: 1000, CompletedLength: 500},
+				{Status: StatusError, TotalLength: 1000, CompletedLength: 100},
+				{Status: StatusRemoved, TotalLength: 1000},
+				{Status: StatusActive},
+			},
+			Progress{CompletedLength: 1500, TotalLength: 2000, Downloads: 5, Completed: 1, Failed: 2, Unknown: 1},
+			75, true,
+		},
+		{
+			"all unknown",
+			[]Status{{Status: StatusActive}, {Status: StatusPaused}},
+			Progress{Downloads: 2, Unknown: 2},
+			0, true,
+		},
+		{
+			"complete without length",
+			[]Status{{Status: StatusCompleted}},
+			Progress{Downloads: 1, Completed: 1},
+			100, false,
+		},
+		{
+			"completed length exceeds total",
+			[]Status{{Status: StatusActive, TotalLength: 100, CompletedLength: 150}},
+			Progress{CompletedLength: 100, TotalLength: 100, Downloads: 1},
+			100, false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress := AggregateProgress(tt.statuses)
+			assert.Equal(t, tt.progress, progress)
+			assert.Equal(t, tt.percent, progress.Percent())
+			assert.Equal(t, tt.indeterminate, progress.Indeterminate())
+		})
+	}
+}
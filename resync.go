@@ -0,0 +1,152 @@
+package arigo
+
+import (
+	"context"
+	"sync"
+)
+
+// resyncState holds the status of the downloads as last seen by a client created
+// using WithResyncOnReconnect. It's updated by the notifications and by every sweep.
+type resyncState struct {
+	sweepMu sync.Mutex // serializes the sweeps
+
+	mu       sync.Mutex // protects the fields below
+	statuses map[string]DownloadStatus
+	// synced is set once a sweep succeeded, the statuses are complete from then on.
+	synced bool
+	// syncedCh is closed when synced is set.
+	syncedCh chan struct{}
+}
+
+func newResyncState() *resyncState {
+	return &resyncState{syncedCh: make(chan struct{})}
+}
+
+// statusEvents maps the status of a download to the event announcing it.
+// Waiting downloads don't have an event.
+var statusEvents = map[DownloadStatus]EventType{
+	StatusActive:    StartEvent,
+	StatusPaused:    PauseEvent,
+	StatusRemoved:   StopEvent,
+	StatusCompleted: CompleteEvent,
+	StatusError:     ErrorEvent,
+}
+
+// eventStatuses maps the events to the status of the download after it.
+// BTCompleteEvent is missing, the download keeps seeding.
+var eventStatuses = map[EventType]DownloadStatus{
+	StartEvent:    StatusActive,
+	PauseEvent:    StatusPaused,
+	StopEvent:     StatusRemoved,
+	CompleteEvent: StatusCompleted,
+	ErrorEvent:    StatusError,
+}
+
+// observe records the status of gid after an event of evtType.
+func (s *resyncState) observe(gid string, evtType EventType) {
+	status, ok := eventStatuses[evtType]
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.statuses == nil {
+		s.statuses = make(map[string]DownloadStatus)
+	}
+	s.statuses[gid] = status
+}
+
+// update replaces the recorded statuses and returns the events for the downloads
+// whose status differs from the recorded one. The first update only records the statuses.
+func (s *resyncState) update(statuses map[string]DownloadStatus) map[string]EventType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events map[string]EventType
+	if s.synced {
+		events = make(map[string]EventType)
+		for gid, status := range statuses {
+			if old, ok := s.statuses[gid]; ok && old == status {
+				continue
+			}
+			if evtType, ok := statusEvents[status]; ok {
+				events[gid] = evtType
+			}
+		}
+	}
+
+	s.statuses = statuses
+	if !s.synced {
+		s.synced = true
+		close(s.syncedCh)
+	}
+	return events
+}
+
+// Resynced returns a channel which is closed once the client fetched the status of all
+// downloads for the first time. Changes of the status are only recovered from then on,
+// see WithResyncOnReconnect. It returns nil if the client doesn't resync the downloads.
+func (c *Client) Resynced() <-chan struct{} {
+	if c.resync == nil {
+		return nil
+	}
+	return c.resync.syncedCh
+}
+
+// resyncDownloads fetches the status of all downloads and dispatches an event for every download
+// whose status changed since it was last seen, see WithResyncOnReconnect.
+func (c *Client) resyncDownloads(ctx context.Context) {
+	c.resync.sweepMu.Lock()
+	defer c.resync.sweepMu.Unlock()
+
+	statuses, err := c.sweepStatuses(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.logger.Errorf("arigo: resyncing downloads failed: %v", err)
+		}
+		return
+	}
+
+	for gid, evtType := range c.resync.update(statuses) {
+		c.logger.Debugf("arigo: resynced %s for %s", evtType, gid)
+		c.evtTarget.Dispatch(evtType, &DownloadEvent{GID: gid, Resynced: true})
+	}
+}
+
+// sweepStatuses returns the status of all active, waiting and stopped downloads.
+func (c *Client) sweepStatuses(ctx context.Context) (map[string]DownloadStatus, error) {
+	statuses := make(map[string]DownloadStatus)
+	add := func(downloads []Status) {
+		for _, status := range downloads {
+			statuses[status.GID] = status.Status
+		}
+	}
+
+	active, err := c.TellActiveContext(ctx, "gid", "status")
+	if err != nil {
+		return nil, err
+	}
+	add(active)
+
+	tells := []func(ctx context.Context, offset int, num uint, keys ...string) ([]Status, error){
+		c.TellWaitingContext,
+		c.TellStoppedContext,
+	}
+	for _, tell := range tells {
+		for offset := 0; ; offset += pageSize {
+			downloads, err := tell(ctx, offset, pageSize, "gid", "status")
+			if err != nil {
+				return nil, err
+			}
+			add(downloads)
+
+			if len(downloads) < pageSize {
+				break
+			}
+		}
+	}
+
+	return statuses, nil
+}
@@ -0,0 +1,121 @@
+package arigo
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resyncServer is a mockServer which reports the statuses of its downloads
+// to tellActive, tellWaiting and tellStopped.
+type resyncServer struct {
+	*mockServer
+
+	mu       sync.Mutex
+	statuses map[string]DownloadStatus
+}
+
+func newResyncServer(t *testing.T, statuses map[string]DownloadStatus) *resyncServer {
+	s := &resyncServer{mockServer: newMockServer(t), statuses: statuses}
+
+	tell := func(matches ...DownloadStatus) mockHandler {
+		return func([]json.RawMessage) (interface{}, *mockError) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			downloads := []Status{}
+			for gid, status := range s.statuses {
+				for _, match := range matches {
+					if status == match {
+						downloads = append(downloads, Status{GID: gid, Status: status})
+					}
+				}
+			}
+			return downloads, nil
+		}
+	}
+	s.handle("aria2.tellActive", tell(StatusActive))
+	s.handle("aria2.tellWaiting", tell(StatusWaiting, StatusPaused))
+	s.handle("aria2.tellStopped", tell(StatusCompleted, StatusError, StatusRemoved))
+
+	return s
+}
+
+func (s *resyncServer) setStatus(gid string, status DownloadStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.statuses[gid] = status
+}
+
+// sweeps returns the number of tellStopped calls, the last call of every sweep.
+func (s *resyncServer) sweeps() int {
+	n := 0
+	for _, req := range s.receivedRequests() {
+		if req.Method == "aria2.tellStopped" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestResyncOnReconnect(t *testing.T) {
+	server := newResyncServer(t, map[string]DownloadStatus{
+		"2089b05ecca3d829": StatusActive,
+		"d0b0e7c087a1d2ba": StatusActive,
+		"0123456789abcdef": StatusCompleted,
+	})
+	client := server.dial("", WithReconnect(ConstantBackoff(10*time.Millisecond)), WithResyncOnReconnect())
+
+	events := make(chan string, 10)
+	for _, evtType := range []EventType{StartEvent, PauseEvent, StopEvent, CompleteEvent, ErrorEvent} {
+		evtType := evtType
+		client.Subscribe(evtType, func(event *DownloadEvent) {
+			events <- fmt.Sprintf("%s %s resynced=%t", evtType, event.GID, event.Resynced)
+		})
+	}
+	select {
+	case <-client.Resynced():
+	case <-time.After(time.Second):
+		t.Fatal("the initial statuses weren't fetched")
+	}
+
+	// a notification received before the connection is lost is taken into account
+	server.setStatus("d0b0e7c087a1d2ba", StatusPaused)
+	server.notify("aria2.onDownloadPause", "d0b0e7c087a1d2ba")
+	assert.Equal(t, "PauseEvent d0b0e7c087a1d2ba resynced=false", <-events)
+
+	// the notification about the completion is lost with the connection
+	server.setStatus("2089b05ecca3d829", StatusCompleted)
+	server.dropConnections()
+
+	select {
+	case event := <-events:
+		assert.Equal(t, "CompleteEvent 2089b05ecca3d829 resynced=true", event)
+	case <-time.After(time.Second):
+		t.Fatal("no event was dispatched after reconnecting")
+	}
+	eventually(t, func() bool { return server.sweeps() == 2 }, "the statuses weren't fetched after reconnecting")
+
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %s for an unchanged download", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestResyncWithoutReconnect(t *testing.T) {
+	server := newResyncServer(t, map[string]DownloadStatus{})
+	server.reply("aria2.getVersion", VersionInfo{Version: "1.36.0"})
+	client := server.dial("", WithResyncOnReconnect())
+
+	_, err := client.GetVersion()
+	require.NoError(t, err)
+	assert.Zero(t, server.sweeps(), "downloads must only be tracked by reconnecting clients")
+	assert.Nil(t, client.Resynced())
+}
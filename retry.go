@@ -0,0 +1,94 @@
+package arigo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Braurbeki/arigo/pkg/aria2proto"
+)
+
+// RetryPolicy decides whether a failed call is tried again, see WithRetry.
+type RetryPolicy interface {
+	// Retry is called after attempt of a call of method failed with err, attempt is 0 for the first one.
+	// It returns whether to try again and the duration to wait before the next attempt.
+	Retry(method string, attempt int, err error) (wait time.Duration, retry bool)
+}
+
+// RetryPolicyFunc is a function which is a RetryPolicy.
+type RetryPolicyFunc func(method string, attempt int, err error) (time.Duration, bool)
+
+// Retry calls f.
+func (f RetryPolicyFunc) Retry(method string, attempt int, err error) (time.Duration, bool) {
+	return f(method, attempt, err)
+}
+
+// RetryTransient returns a RetryPolicy which tries a call up to attempts times in total as long as it fails
+// because of the connection, that is with ErrConnectionLost, a *ReadError or a *TimeoutError.
+// Errors reported by aria2 aren't retried. backoff determines the time to wait before each retry,
+// if it's nil the call is retried immediately.
+func RetryTransient(attempts int, backoff BackoffPolicy) RetryPolicy {
+	return RetryPolicyFunc(func(_ string, attempt int, err error) (time.Duration, bool) {
+		if attempt+1 >= attempts || !isTransientErr(err) {
+			return 0, false
+		}
+		if backoff == nil {
+			return 0, true
+		}
+		return backoff.NextInterval(attempt), true
+	})
+}
+
+// isTransientErr reports whether err was caused by the connection rather than by aria2.
+func isTransientErr(err error) bool {
+	return errors.Is(err, ErrConnectionLost) || errors.As(err, new(*ReadError)) || errors.As(err, new(*TimeoutError))
+}
+
+// idempotentMethods contains the methods which are retried by default, they only read state,
+// so executing them twice does no harm.
+var idempotentMethods = map[string]bool{
+	aria2proto.TellStatus:        true,
+	aria2proto.GetURIs:           true,
+	aria2proto.GetFiles:          true,
+	aria2proto.GetPeers:          true,
+	aria2proto.GetServers:        true,
+	aria2proto.GetOptions:        true,
+	aria2proto.TellActive:        true,
+	aria2proto.TellWaiting:       true,
+	aria2proto.TellStopped:       true,
+	aria2proto.GetGlobalOptions:  true,
+	aria2proto.GetGlobalStats:    true,
+	aria2proto.GetVersion:        true,
+	aria2proto.GetSessionInfo:    true,
+	aria2proto.ListMethods:       true,
+	aria2proto.ListNotifications: true,
+}
+
+// retryCall reports whether a call of method should be tried again after attempt failed with err.
+// It waits before returning true, and returns false if ctx is done or the client is closed meanwhile.
+func (c *Client) retryCall(ctx context.Context, method string, attempt int, err error) bool {
+	if c.retry == nil || err == ErrClientClosed || ctx.Err() != nil {
+		return false
+	}
+	if !idempotentMethods[method] && !c.retryOptIn[method] {
+		return false
+	}
+
+	wait, retry := c.retry.Retry(method, attempt, err)
+	if !retry {
+		return false
+	}
+
+	c.logger.Debugf("arigo: retrying %s in %v after: %v", method, wait, err)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-c.closeCtx.Done():
+		return false
+	}
+}
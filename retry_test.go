@@ -0,0 +1,110 @@
+package arigo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyHandler returns a mockHandler which fails the first failures calls and then returns result.
+func flakyHandler(failures int32, result interface{}) (mockHandler, *int32) {
+	var calls int32
+	return func([]json.RawMessage) (interface{}, *mockError) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			return nil, &mockError{Code: 1, Message: "temporarily unavailable"}
+		}
+		return result, nil
+	}, &calls
+}
+
+// retryRPCErrors retries every call failing with an *RPCError up to 3 times in total.
+var retryRPCErrors = RetryPolicyFunc(func(_ string, attempt int, err error) (time.Duration, bool) {
+	return time.Millisecond, attempt < 2 && errors.As(err, new(*RPCError))
+})
+
+func TestRetry(t *testing.T) {
+	server := newMockServer(t)
+	tellStatus, tellStatusCalls := flakyHandler(2, map[string]string{"gid": "2089b05ecca3d829", "status": "active"})
+	server.handle("aria2.tellStatus", tellStatus)
+	pause, pauseCalls := flakyHandler(1, "2089b05ecca3d829")
+	server.handle("aria2.pause", pause)
+
+	client := server.dial("", WithRetry(retryRPCErrors))
+
+	status, err := client.TellStatus("2089b05ecca3d829")
+	require.NoError(t, err)
+	assert.Equal(t, StatusActive, status.Status)
+	assert.Equal(t, int32(3), atomic.LoadInt32(tellStatusCalls))
+
+	// mutating methods aren't retried by default
+	assert.Error(t, client.Pause("2089b05ecca3d829"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(pauseCalls))
+}
+
+func TestRetryExhausted(t *testing.T) {
+	server := newMockServer(t)
+	tellStatus, calls := flakyHandler(5, map[string]string{"gid": "2089b05ecca3d829", "status": "active"})
+	server.handle("aria2.tellStatus", tellStatus)
+
+	client := server.dial("", WithRetry(retryRPCErrors))
+
+	_, err := client.TellStatus("2089b05ecca3d829")
+	var rpcErr *RPCError
+	require.True(t, errors.As(err, &rpcErr), "unexpected error %v", err)
+	assert.Equal(t, "temporarily unavailable", rpcErr.Message)
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestRetryMethods(t *testing.T) {
+	server := newMockServer(t)
+	pause, calls := flakyHandler(1, "2089b05ecca3d829")
+	server.handle("aria2.pause", pause)
+
+	client := server.dial("", WithRetry(retryRPCErrors), WithRetryMethods("aria2.pause"))
+
+	require.NoError(t, client.Pause("2089b05ecca3d829"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestRetryTransient(t *testing.T) {
+	server := newMockServer(t)
+
+	var calls int32
+	release := make(chan struct{})
+	defer close(release)
+	server.handle("aria2.getVersion", func([]json.RawMessage) (interface{}, *mockError) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// the first attempt times out
+			<-release
+		}
+		return VersionInfo{Version: "1.36.0"}, nil
+	})
+	tellStatus, tellStatusCalls := flakyHandler(1, map[string]string{"gid": "2089b05ecca3d829", "status": "active"})
+	server.handle("aria2.tellStatus", tellStatus)
+
+	client := server.dial("", WithCallTimeout(50*time.Millisecond), WithRetry(RetryTransient(3, ConstantBackoff(time.Millisecond))))
+
+	version, err := client.GetVersion()
+	require.NoError(t, err)
+	assert.Equal(t, "1.36.0", version.Version)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// errors reported by aria2 aren't transient
+	_, err = client.TellStatus("2089b05ecca3d829")
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(tellStatusCalls))
+}
+
+func TestIsTransientErr(t *testing.T) {
+	assert.True(t, isTransientErr(ErrConnectionLost))
+	assert.True(t, isTransientErr(fmt.Errorf("aria2.tellStatus: %w", ErrConnectionLost)), "wrapped errors must be detected")
+	assert.True(t, isTransientErr(&TimeoutError{}))
+	assert.False(t, isTransientErr(ErrClientClosed))
+	assert.False(t, isTransientErr(&RPCError{Code: 1, Message: "GID 2089b05ecca3d829 is not found"}))
+}
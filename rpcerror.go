@@ -0,0 +1,133 @@
+package arigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Braurbeki/arigo/internal/pkg/jsonrpc"
+	"github.com/cenkalti/rpc2"
+)
+
+// Error codes of the JSON-RPC error objects returned by aria2.
+const (
+	// CodeUnknown is used if aria2 didn't respond with a JSON-RPC error object.
+	CodeUnknown = 0
+	// CodeMethodFailed is used by aria2 for all errors raised by a method.
+	// The message describes the actual problem.
+	CodeMethodFailed = 1
+	// CodeParseError is used if aria2 couldn't parse the request.
+	CodeParseError = -32700
+	// CodeInvalidRequest is used if the request isn't a valid JSON-RPC request.
+	CodeInvalidRequest = -32600
+)
+
+var (
+	// ErrNotFound matches RPCErrors returned because aria2 doesn't know the download.
+	ErrNotFound = errors.New("download not found")
+	// ErrNoSuchMethod matches RPCErrors returned because aria2 doesn't support the method.
+	ErrNoSuchMethod = errors.New("no such method")
+	// ErrInvalidParams matches RPCErrors returned because a parameter has the wrong type.
+	ErrInvalidParams = errors.New("invalid parameters")
+	// ErrDownloadNotFinished matches the errors returned by RemoveDownloadResult
+	// because the download is still active, waiting or paused.
+	ErrDownloadNotFinished = errors.New("download not finished")
+)
+
+// RPCError is an error object returned by aria2 in response to a call.
+//
+// aria2 reports almost all failures with CodeMethodFailed and distinguishes them
+// only by the message, for example:
+//   - "Unauthorized" if the secret token is wrong or missing, matches ErrUnauthorized
+//   - "GID 2089b05ecca3d829 is not found" for unknown downloads, matches ErrNotFound
+//   - "No such method: aria2.foo" for unsupported methods, matches ErrNoSuchMethod
+//   - "The parameter at 1 has wrong type." for invalid parameters, matches ErrInvalidParams
+//   - "Could not remove download result of GID#2089b05ecca3d829" if the download
+//     hasn't stopped yet, but also for unknown downloads. RemoveDownloadResult tells them
+//     apart, its errors match either ErrDownloadNotFinished or ErrNotFound.
+//   - "GID#2089b05ecca3d829 cannot be paused now" if the download is in the wrong state
+//
+// Use errors.Is with the sentinel errors above instead of comparing messages.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// Is reports whether e is described by target,
+// which is one of the sentinel errors documented on RPCError.
+func (e *RPCError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.Message == "Unauthorized"
+	case ErrNotFound:
+		return strings.HasSuffix(e.Message, " is not found") || strings.HasPrefix(e.Message, "No such download")
+	case ErrNoSuchMethod:
+		return strings.HasPrefix(e.Message, "No such method")
+	case ErrInvalidParams:
+		return strings.HasSuffix(e.Message, " has wrong type.")
+	}
+
+	return false
+}
+
+// isRemoveResultErr reports whether e is the error aria2 returns if it can't remove the result
+// of a download, because the download hasn't stopped yet or is unknown.
+func (e *RPCError) isRemoveResultErr() bool {
+	return strings.HasPrefix(e.Message, "Could not remove download result")
+}
+
+// removeResultError is an RPCError returned by RemoveDownloadResult whose cause was found out
+// using TellStatus, since aria2 uses the same message for unfinished and unknown downloads.
+type removeResultError struct {
+	*RPCError
+	cause error // ErrDownloadNotFinished or ErrNotFound
+}
+
+func (e *removeResultError) Unwrap() error {
+	return e.RPCError
+}
+
+// Is reports whether target is the cause of the error.
+func (e *removeResultError) Is(target error) bool {
+	return target == e.cause
+}
+
+// newRPCError converts the error returned by rpc2 for an error response.
+func newRPCError(serverErr rpc2.ServerError) *RPCError {
+	e := jsonrpc.ParseError(string(serverErr))
+	return &RPCError{Code: e.Code, Message: e.Message}
+}
+
+// TimeoutError is returned by calls which didn't receive a response within the
+// timeout set using WithCallTimeout.
+type TimeoutError struct {
+	Method  string        // aria2 method of the call
+	Timeout time.Duration // timeout of the call
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %v", e.Method, e.Timeout)
+}
+
+// Is reports whether target is context.DeadlineExceeded,
+// so timeouts can be detected regardless of their origin.
+func (e *TimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// UnexpectedReplyError is returned by calls which aria2 acknowledges with "OK"
+// if the response is something else.
+type UnexpectedReplyError struct {
+	Method string // aria2 method of the call
+	Reply  string // response received instead of "OK"
+}
+
+func (e *UnexpectedReplyError) Error() string {
+	return fmt.Sprintf("%s: unexpected reply %q", e.Method, e.Reply)
+}
@@ -0,0 +1,87 @@
+package arigo
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRPCErrorIs(t *testing.T) {
+	tests := []struct {
+		message string
+		target  error
+	}{
+		{"Unauthorized", ErrUnauthorized},
+		{"GID 2089b05ecca3d829 is not found", ErrNotFound},
+		{"No such download for GID#2089b05ecca3d829", ErrNotFound},
+		{"No such method: aria2.foo", ErrNoSuchMethod},
+		{"The parameter at 1 has wrong type.", ErrInvalidParams},
+		// aria2 uses it for unfinished and unknown downloads alike, see RemoveDownloadResult
+		{"Could not remove download result of GID#2089b05ecca3d829", nil},
+	}
+
+	targets := []error{ErrUnauthorized, ErrNotFound, ErrNoSuchMethod, ErrInvalidParams, ErrDownloadNotFinished}
+
+	for _, test := range tests {
+		err := error(&RPCError{Code: CodeMethodFailed, Message: test.message})
+		for _, target := range targets {
+			assert.Equal(t, target == test.target, errors.Is(err, target), "%q is %v", test.message, target)
+		}
+	}
+
+	err := error(&RPCError{Code: CodeMethodFailed, Message: "GID#2089b05ecca3d829 cannot be paused now"})
+	for _, target := range targets {
+		assert.False(t, errors.Is(err, target))
+	}
+}
+
+func TestRPCErrorFromClient(t *testing.T) {
+	server := newMockServer(t)
+	server.handle("aria2.tellStatus", func(params []json.RawMessage) (interface{}, *mockError) {
+		return nil, &mockError{Code: 1, Message: "GID 2089b05ecca3d829 is not found"}
+	})
+
+	client := server.dial("")
+
+	_, err := client.TellStatus("2089b05ecca3d829")
+
+	var rpcErr *RPCError
+	require.True(t, errors.As(err, &rpcErr), "unexpected error %v", err)
+	assert.Equal(t, CodeMethodFailed, rpcErr.Code)
+	assert.Equal(t, "GID 2089b05ecca3d829 is not found", rpcErr.Message)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestRemoveDownloadResultNotFinished(t *testing.T) {
+	server := newMockServer(t)
+	server.handle("aria2.removeDownloadResult", func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		_ = json.Unmarshal(params[0], &gid)
+		return nil, &mockError{Code: 1, Message: "Could not remove download result of GID#" + gid}
+	})
+	server.handle("aria2.tellStatus", func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		_ = json.Unmarshal(params[0], &gid)
+		if gid != "2089b05ecca3d829" {
+			return nil, &mockError{Code: 1, Message: "GID " + gid + " is not found"}
+		}
+		return map[string]string{"gid": gid, "status": "active"}, nil
+	})
+
+	client := server.dial("")
+
+	err := client.RemoveDownloadResult("2089b05ecca3d829")
+	assert.True(t, errors.Is(err, ErrDownloadNotFinished), "unexpected error %v", err)
+	assert.False(t, errors.Is(err, ErrNotFound))
+	var rpcErr *RPCError
+	require.True(t, errors.As(err, &rpcErr))
+	assert.Equal(t, "Could not remove download result of GID#2089b05ecca3d829", rpcErr.Message)
+
+	// aria2 responds with the same error for unknown downloads
+	err = client.RemoveDownloadResult("d2703803b52216d1")
+	assert.True(t, errors.Is(err, ErrNotFound), "unexpected error %v", err)
+	assert.False(t, errors.Is(err, ErrDownloadNotFinished))
+}
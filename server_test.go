@@ -32,3 +32,61 @@ func TestServerFormat(t *testing.T) {
 		}},
 	}, server)
 }
+
+func TestServerFormatMultipleFiles(t *testing.T) {
+	// the servers of a download with several files, like a metalink with mirrors
+	data := []byte(`[{
+		"index": "1",
+		"servers": [{
+			"currentUri": "https://mirror1.example.org/pub/image.iso",
+			"downloadSpeed": "3145728",
+			"uri": "http://example.org/image.iso"
+		}, {
+			"currentUri": "http://mirror2.example.org/image.iso",
+			"downloadSpeed": "0",
+			"uri": "http://mirror2.example.org/image.iso"
+		}]
+	}, {
+		"index": "2",
+		"servers": []
+	}]`)
+
+	var servers []FileServers
+	assert.NoError(t, json.Unmarshal(data, &servers), "Couldn't unmarshal JSON")
+
+	assert.Equal(t, []FileServers{{
+		Index: 1,
+		Servers: []Server{{
+			URI:           "http://example.org/image.iso",
+			CurrentURI:    "https://mirror1.example.org/pub/image.iso",
+			DownloadSpeed: 3145728,
+		}, {
+			URI:           "http://mirror2.example.org/image.iso",
+			CurrentURI:    "http://mirror2.example.org/image.iso",
+			DownloadSpeed: 0,
+		}},
+	}, {
+		Index:   2,
+		Servers: []Server{},
+	}}, servers)
+}
+
+func TestServerBareNumbers(t *testing.T) {
+	data := []byte(`[{
+		"index": 1,
+		"servers": [
+			{"uri": "http://a.example.com/file", "currentUri": "http://a.example.com/file", "downloadSpeed": 10602},
+			{"uri": "http://b.example.com/file", "currentUri": "http://b.example.com/file", "downloadSpeed": "8654"}
+		]
+	}]`)
+
+	var servers []FileServers
+	assert.NoError(t, json.Unmarshal(data, &servers))
+	assert.Equal(t, []FileServers{{
+		Index: 1,
+		Servers: []Server{
+			{URI: "http://a.example.com/file", CurrentURI: "http://a.example.com/file", DownloadSpeed: 10602},
+			{URI: "http://b.example.com/file", CurrentURI: "http://b.example.com/file", DownloadSpeed: 8654},
+		},
+	}}, servers)
+}
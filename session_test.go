@@ -1,9 +1,13 @@
 package arigo
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 func TestSessionFormat(t *testing.T) {
@@ -18,3 +22,74 @@ func TestSessionFormat(t *testing.T) {
 		ID: "cd6a3bc6a1de28eb5bfa181e5f6b916d44af31a9",
 	}, info)
 }
+
+func TestGetSessionInfo(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.getSessionInfo", map[string]string{"sessionId": "cd6a3bc6a1de28eb5bfa181e5f6b916d44af31a9"})
+
+	client := server.dial("secret")
+	server.requireSecret("secret")
+
+	info, err := client.GetSessionInfo()
+	require.NoError(t, err)
+	assert.Equal(t, "cd6a3bc6a1de28eb5bfa181e5f6b916d44af31a9", info.ID)
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "aria2.getSessionInfo", requests[0].Method)
+	assert.Equal(t, `["token:secret"]`, rawParams(requests[0].Params))
+}
+
+func TestSaveSession(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.saveSession", "OK")
+
+	client := server.dial("")
+	require.NoError(t, client.SaveSession())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- client.AutoSaveSession(ctx, 10*time.Millisecond)
+	}()
+
+	eventually(t, func() bool { return len(server.receivedRequests()) >= 3 }, "session wasn't saved")
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+
+	server.handle("aria2.saveSession", func([]json.RawMessage) (interface{}, *mockError) {
+		return nil, &mockError{Code: 1, Message: "Filename is not given."}
+	})
+
+	err := client.AutoSaveSession(context.Background(), 10*time.Millisecond)
+	require.Error(t, err)
+	assert.True(t, errors.As(err, new(*RPCError)))
+}
+
+func TestPurgeAndSave(t *testing.T) {
+	server := newMockServer(t)
+	server.reply("aria2.purgeDownloadResult", "OK")
+	server.reply("aria2.saveSession", "OK")
+
+	client := server.dial("")
+	require.NoError(t, client.PurgeAndSave())
+
+	requests := server.receivedRequests()
+	require.Len(t, requests, 2)
+	assert.Equal(t, "aria2.purgeDownloadResult", requests[0].Method)
+	assert.Equal(t, "aria2.saveSession", requests[1].Method)
+
+	server.handle("aria2.saveSession", func([]json.RawMessage) (interface{}, *mockError) {
+		return nil, &mockError{Code: 1, Message: "Filename is not given."}
+	})
+	err := client.PurgeAndSave()
+	assert.EqualError(t, err, "save session: Filename is not given.")
+
+	server.handle("aria2.purgeDownloadResult", func([]json.RawMessage) (interface{}, *mockError) {
+		return nil, &mockError{Code: 1, Message: "Unauthorized"}
+	})
+	err = client.PurgeAndSave()
+	assert.EqualError(t, err, "purge download results: Unauthorized")
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+	assert.Len(t, server.receivedRequests(), 5, "the session must not be saved if purging failed")
+}
@@ -0,0 +1,137 @@
+package arigo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sizeOptions are the options whose values are sizes or rates in bytes,
+// which aria2 accepts as integers optionally followed by K or M.
+var sizeOptions = map[string]bool{
+	"bt-request-peer-speed-limit": true,
+	"lowest-speed-limit":          true,
+	"max-download-limit":          true,
+	"max-mmap-limit":              true,
+	"max-overall-download-limit":  true,
+	"max-overall-upload-limit":    true,
+	"max-upload-limit":            true,
+	"min-split-size":              true,
+	"no-file-allocation-limit":    true,
+	"piece-length":                true,
+}
+
+// ParseSize parses a size in bytes as written in aria2 options, for example "10M".
+// The value is a non-negative number of bytes, optionally followed by K, M or G,
+// which multiply it by 1024, 1024² and 1024³. With a suffix, the number may have
+// a fraction, like "1.5G". The suffixes aren't case-sensitive.
+func ParseSize(s string) (int64, error) {
+	size, err := parseSize(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %v", s, err)
+	}
+	return size, nil
+}
+
+// ParseRate parses a rate in bytes/sec as written in the aria2 limit options, for example "5K".
+// It accepts the values ParseSize accepts, optionally followed by "/s" like in "5K/s".
+// 0 means unrestricted.
+func ParseRate(s string) (int64, error) {
+	rate, err := parseSize(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q: %v", s, err)
+	}
+	return rate, nil
+}
+
+// parseSize implements ParseSize, the error describes what's wrong with s.
+func parseSize(s string) (int64, error) {
+	value := strings.TrimSpace(s)
+
+	multiplier := int64(1)
+	if n := len(value); n > 0 {
+		switch value[n-1] {
+		case 'K', 'k':
+			multiplier = 1 << 10
+		case 'M', 'm':
+			multiplier = 1 << 20
+		case 'G', 'g':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			value = value[:n-1]
+		}
+	}
+
+	digits, dots := 0, 0
+	for _, c := range value {
+		switch {
+		case '0' <= c && c <= '9':
+			digits++
+		case c == '.':
+			dots++
+		default:
+			return 0, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	if digits == 0 || dots > 1 {
+		return 0, errors.New("expected a number of bytes, optionally followed by K, M or G")
+	}
+
+	if dots == 0 {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n > math.MaxInt64/multiplier {
+			return 0, errors.New("too large")
+		}
+		return n * multiplier, nil
+	}
+
+	if multiplier == 1 {
+		return 0, errors.New("fractions of a byte")
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	size := f * float64(multiplier)
+	if size >= math.MaxInt64 {
+		return 0, errors.New("too large")
+	}
+	return int64(size), nil
+}
+
+// normalizeSizes converts the values of the size options in m which aria2 doesn't accept as they are,
+// like "1.5G", into bytes. It returns an error for values which aren't sizes.
+func normalizeSizes(m map[string]string) error {
+	for key, value := range m {
+		if !sizeOptions[key] || isAria2Size(value) {
+			continue
+		}
+
+		size, err := parseSize(value)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for option %s: %v", value, key, err)
+		}
+		m[key] = strconv.FormatInt(size, 10)
+	}
+	return nil
+}
+
+// isAria2Size reports whether aria2 accepts value as a size as it is,
+// which is the case for integers optionally followed by K or M.
+func isAria2Size(value string) bool {
+	if n := len(value); n > 1 && strings.ContainsAny(value[n-1:], "KkMm") {
+		value = value[:n-1]
+	}
+	if value == "" {
+		return false
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package arigo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value string
+		size  int64
+		valid bool
+	}{
+		{"0", 0, true},
+		{"1048576", 1048576, true},
+		{"10M", 10 << 20, true},
+		{"10m", 10 << 20, true},
+		{"5K", 5 << 10, true},
+		{"1.5G", 3 << 29, true},
+		{"0.5K", 512, true},
+		{" 2G ", 2 << 30, true},
+		{"", 0, false},
+		{"M", 0, false},
+		{"-1", 0, false},
+		{"1.5", 0, false},
+		{"1..5M", 0, false},
+		{"10MB", 0, false},
+		{"1e3", 0, false},
+		{"ten", 0, false},
+		{"9223372036854775807", 9223372036854775807, true},
+		{"9223372036854775807K", 0, false},
+	}
+
+	for _, tt := range tests {
+		size, err := ParseSize(tt.value)
+		if !tt.valid {
+			assert.Error(t, err, "%q must be rejected", tt.value)
+			continue
+		}
+		require.NoError(t, err, tt.value)
+		assert.Equal(t, tt.size, size, tt.value)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	rate, err := ParseRate("5K/s")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5<<10), rate)
+
+	rate, err = ParseRate("0")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), rate)
+
+	_, err = ParseRate("fast")
+	assert.EqualError(t, err, `invalid rate "fast": unexpected character 'f'`)
+}
+
+func TestToMapNormalizesSizes(t *testing.T) {
+	m, err := Options{
+		MaxDownloadLimit: "1M",
+		MinSplitSize:     "1.5M",
+		PieceLength:      "1048576",
+		Extra:            map[string]string{"max-overall-upload-limit": "1G"},
+	}.ToMap()
+	require.NoError(t, err)
+	// values aria2 accepts are sent as they are
+	assert.Equal(t, "1M", m["max-download-limit"])
+	assert.Equal(t, "1048576", m["piece-length"])
+	assert.Equal(t, "1572864", m["min-split-size"])
+	assert.Equal(t, "1073741824", m["max-overall-upload-limit"])
+
+	_, err = Options{MaxUploadLimit: "10 MB/s"}.ToMap()
+	assert.EqualError(t, err, `invalid value "10 MB/s" for option max-upload-limit: unexpected character ' '`)
+}
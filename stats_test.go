@@ -26,3 +26,39 @@ func TestStatsFormat(t *testing.T) {
 		UploadSpeed:   0,
 	}, stats)
 }
+
+func TestStatsLargeSpeed(t *testing.T) {
+	// a speed above 4 GiB/s, which overflows 32-bit integers
+	data := []byte(`{
+		"downloadSpeed": "5368709120",
+		"numActive": "1",
+		"numStopped": "3",
+		"numStoppedTotal": "1042",
+		"numWaiting": "12",
+		"uploadSpeed": "53687"
+	}`)
+
+	var stats Stats
+	assert.NoError(t, json.Unmarshal(data, &stats), "Couldn't unmarshal JSON")
+
+	assert.Equal(t, Stats{
+		DownloadSpeed:   5368709120,
+		UploadSpeed:     53687,
+		NumActive:       1,
+		NumWaiting:      12,
+		NumStopped:      3,
+		NumStoppedTotal: 1042,
+	}, stats)
+}
+
+func TestStatsBareNumbers(t *testing.T) {
+	quoted := []byte(`{"downloadSpeed": "21846", "uploadSpeed": "12", "numActive": "2", "numWaiting": "1", "numStopped": "3", "numStoppedTotal": "4"}`)
+	bare := []byte(`{"downloadSpeed": 21846, "uploadSpeed": 12, "numActive": 2, "numWaiting": 1, "numStopped": 3, "numStoppedTotal": 4}`)
+
+	var fromQuoted, fromBare Stats
+	assert.NoError(t, json.Unmarshal(quoted, &fromQuoted))
+	assert.NoError(t, json.Unmarshal(bare, &fromBare))
+
+	assert.Equal(t, Stats{DownloadSpeed: 21846, UploadSpeed: 12, NumActive: 2, NumWaiting: 1, NumStopped: 3, NumStoppedTotal: 4}, fromBare)
+	assert.Equal(t, fromQuoted, fromBare)
+}
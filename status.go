@@ -2,6 +2,9 @@ package arigo
 
 import (
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,18 +21,18 @@ const (
 	// StatusError represents downloads that were stopped because of error
 	StatusError DownloadStatus = "error"
 	// StatusCompleted represents stopped and completed downloads
-	StatusCompleted DownloadStatus = "completed"
+	StatusCompleted DownloadStatus = "complete"
 	// StatusRemoved represents the downloads removed by user
 	StatusRemoved DownloadStatus = "removed"
 )
 
 // Status holds information for a download.
 type Status struct {
-	GID             string         `json:"gid"`                    // gid of the download
-	Status          DownloadStatus `json:"status"`                 // Download status
-	TotalLength     uint           `json:"totalLength,string"`     // Total length of the download in bytes
-	CompletedLength uint           `json:"completedLength,string"` // Completed length of the download in bytes
-	UploadLength    uint           `json:"uploadLength,string"`    // Uploaded length of the download in bytes
+	GID             string         `json:"gid"`             // gid of the download
+	Status          DownloadStatus `json:"status"`          // Download status
+	TotalLength     Int64          `json:"totalLength"`     // Total length of the download in bytes
+	CompletedLength Int64          `json:"completedLength"` // Completed length of the download in bytes
+	UploadLength    Int64          `json:"uploadLength"`    // Uploaded length of the download in bytes
 
 	// Hexadecimal representation of the download progress.
 	// The highest bit corresponds to the piece at index 0. Any set bits indicate loaded pieces,
@@ -37,20 +40,20 @@ type Status struct {
 	// Any overflow bits at the end are set to zero.
 	// When the download was not started yet, this will be an empty string.
 	BitField      string `json:"bitfield"`
-	DownloadSpeed uint   `json:"downloadSpeed,string"` // Download speed of this download measured in bytes/sec
-	UploadSpeed   uint   `json:"uploadSpeed,string"`   // Upload speed of this download measured in bytes/sec
-	InfoHash      string `json:"infoHash"`             // InfoHash. BitTorrent only
+	DownloadSpeed Int64  `json:"downloadSpeed"` // Download speed of this download measured in bytes/sec
+	UploadSpeed   Int64  `json:"uploadSpeed"`   // Upload speed of this download measured in bytes/sec
+	InfoHash      string `json:"infoHash"`      // InfoHash. BitTorrent only
 
 	// The number of seeders aria2 has connected to. BitTorrent only
-	NumSeeders uint `json:"numSeeders,string"`
+	NumSeeders Int64 `json:"numSeeders"`
 
 	// true if the local endpoint is a seeder. Otherwise false. BitTorrent only
-	Seeder       bool       `json:"seeder,string"`
-	PieceLength  uint       `json:"pieceLength,string"` // Piece length in bytes
-	NumPieces    uint       `json:"numPieces,string"`   // The number of pieces
-	Connections  uint       `json:"connections,string"` // The number of peers/servers aria2 has connected to
-	ErrorCode    ExitStatus `json:"errorCode,string"`   // The code of the last error for this item, if any.
-	ErrorMessage string     `json:"errorMessage"`       // The human readable error message associated to ErrorCode
+	Seeder       Bool       `json:"seeder"`
+	PieceLength  Int64      `json:"pieceLength"`  // Piece length in bytes
+	NumPieces    Int64      `json:"numPieces"`    // The number of pieces
+	Connections  Int64      `json:"connections"`  // The number of peers/servers aria2 has connected to
+	ErrorCode    ExitStatus `json:"errorCode"`    // The code of the last error for this item, if any.
+	ErrorMessage string     `json:"errorMessage"` // The human readable error message associated to ErrorCode
 
 	// List of GIDs which are generated as the result of this download.
 	// For example, when aria2 downloads a Metalink file, it generates downloads described in the Metalink
@@ -75,10 +78,135 @@ type Status struct {
 	// The number of verified number of bytes while the files are being has
 	// checked.
 	// This key exists only when this download is being hash checked
-	VerifiedLength uint `json:"verifiedLength,string"`
+	VerifiedLength Int64 `json:"verifiedLength"`
 
 	// true if this download is waiting for the hash check in a queue.
-	VerifyIntegrityPending bool `json:"verifyIntegrityPending,string"`
+	VerifyIntegrityPending Bool `json:"verifyIntegrityPending"`
+}
+
+// DownloadError describes why a download failed, it's returned by Status.Err.
+// It matches ErrDownloadError.
+type DownloadError struct {
+	GID     string     // gid of the download
+	Code    ExitStatus // code of the error
+	Message string     // human readable message, may be empty
+}
+
+func (e *DownloadError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("download %s failed: %v", e.GID, e.Code)
+	}
+	return fmt.Sprintf("download %s failed: %s (%v)", e.GID, e.Message, e.Code)
+}
+
+// Is reports whether target is ErrDownloadError.
+func (e *DownloadError) Is(target error) bool {
+	return target == ErrDownloadError
+}
+
+// Err returns a *DownloadError if the download is in the error state and nil otherwise.
+// Requires the status, errorCode and errorMessage keys.
+func (s Status) Err() error {
+	if s.Status != StatusError {
+		return nil
+	}
+	return &DownloadError{GID: s.GID, Code: s.ErrorCode, Message: s.ErrorMessage}
+}
+
+// ETAUnknown is returned by Status.ETA if the remaining time can't be estimated.
+const ETAUnknown time.Duration = -1
+
+// ETA estimates the time remaining until the download completes based on
+// its current download speed.
+// It returns ETAUnknown if the download speed or the total length is zero,
+// which is the case for stalled downloads and downloads which haven't started yet.
+// Both, CompletedLength and TotalLength are required, DownloadSpeed is required
+// as well if the download hasn't completed yet.
+func (s Status) ETA() time.Duration {
+	if s.TotalLength <= 0 {
+		return ETAUnknown
+	}
+
+	remaining := s.TotalLength - s.CompletedLength
+	if remaining <= 0 {
+		return 0
+	}
+	if s.DownloadSpeed <= 0 {
+		return ETAUnknown
+	}
+
+	// round up to a full second, the speed only has a resolution of 1 byte/sec anyway
+	seconds := (remaining + s.DownloadSpeed - 1) / s.DownloadSpeed
+	return time.Duration(seconds) * time.Second
+}
+
+// Name returns a name suitable to display the download.
+// It's the name of the torrent for BitTorrent downloads and the base name of the
+// first file otherwise. If the path of the file isn't known yet, the base name
+// of its first uri is used. Requires the BitTorrent and Files keys.
+func (s Status) Name() string {
+	if name := s.BitTorrent.Info.Name; name != "" {
+		return name
+	}
+	if len(s.Files) == 0 {
+		return ""
+	}
+
+	file := s.Files[0]
+	if file.Path != "" {
+		return baseName(file.Path)
+	}
+	if len(file.URIs) > 0 {
+		uri := file.URIs[0].URI
+		if i := strings.IndexAny(uri, "?#"); i >= 0 {
+			uri = uri[:i]
+		}
+		return baseName(uri)
+	}
+	return ""
+}
+
+// DownloadType represents the kind of a download, see Status.Type.
+type DownloadType string
+
+const (
+	// DownloadTypeHTTP represents a plain download using HTTP(S), FTP or SFTP uris
+	DownloadTypeHTTP DownloadType = "http"
+	// DownloadTypeBitTorrent represents a BitTorrent download, including magnet links
+	DownloadTypeBitTorrent DownloadType = "bittorrent"
+	// DownloadTypeMetalink represents a Metalink document or a download described by one
+	DownloadTypeMetalink DownloadType = "metalink"
+)
+
+// Type returns the kind of the download, aria2 doesn't report it, so it's inferred:
+//   - Downloads with an info hash or torrent information are BitTorrent downloads.
+//   - Downloads following another download were generated from a Metalink document downloaded by aria2,
+//     downloads generated from a .torrent file have an info hash and are BitTorrent downloads.
+//   - Downloads of a file ending in .metalink or .meta4 are Metalink documents.
+//   - All other downloads are plain downloads, including the ones added using AddMetalink,
+//     since aria2 doesn't tell them apart from downloads added using AddURI.
+//
+// Requires the InfoHash, BitTorrent, Following and Files keys.
+func (s Status) Type() DownloadType {
+	if s.InfoHash != "" || s.BitTorrent.Mode != "" || s.BitTorrent.Info.Name != "" || len(s.BitTorrent.AnnounceList) > 0 {
+		return DownloadTypeBitTorrent
+	}
+	if s.Following != "" {
+		return DownloadTypeMetalink
+	}
+
+	name := strings.ToLower(s.Name())
+	if strings.HasSuffix(name, ".metalink") || strings.HasSuffix(name, ".meta4") {
+		return DownloadTypeMetalink
+	}
+	return DownloadTypeHTTP
+}
+
+// baseName returns the last element of p.
+// Both slashes and backslashes are treated as separators, since aria2 may run on Windows.
+func baseName(p string) string {
+	p = strings.TrimRight(p, `/\`)
+	return p[strings.LastIndexAny(p, `/\`)+1:]
 }
 
 // UNIXTime is a wrapper around time.Time that marshals to a unix timestamp.
@@ -91,12 +219,19 @@ func (t UNIXTime) MarshalJSON() ([]byte, error) {
 	return json.Marshal(t.Unix())
 }
 
-// UnmarshalJSON loads a unix timestamp
+// UnmarshalJSON loads a unix timestamp.
+// The timestamp may be a number or a string.
 func (t *UNIXTime) UnmarshalJSON(data []byte) error {
 	var ts int64
 	err := json.Unmarshal(data, &ts)
 	if err != nil {
-		return err
+		var s string
+		if json.Unmarshal(data, &s) != nil {
+			return err
+		}
+		if ts, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return err
+		}
 	}
 
 	*t = UNIXTime{time.Unix(ts, 0)}
@@ -113,7 +248,8 @@ const (
 	TorrentModeMulti TorrentMode = "multi"
 )
 
-// BitTorrentStatus holds information for a BitTorrent download
+// BitTorrentStatus holds information for a BitTorrent download.
+// It's the zero value for downloads which aren't BitTorrent downloads.
 type BitTorrentStatus struct {
 	// List of lists of announce URIs.
 	// If the torrent contains announce and no announce-list,
@@ -2,9 +2,12 @@ package arigo
 
 import (
 	"encoding/json"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestStatusFormat(t *testing.T) {
@@ -71,3 +74,183 @@ func TestStatusFormat(t *testing.T) {
 	assert.EqualValues(t, true, file1.Selected)
 	assert.Equal(t, []URI{{Status: URIUsed, URI: "http://example.org/file"}}, file1.URIs)
 }
+
+func TestStatusETA(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   Status
+		expected time.Duration
+	}{
+		{"active", Status{TotalLength: 1000, CompletedLength: 400, DownloadSpeed: 100}, 6 * time.Second},
+		{"round up", Status{TotalLength: 1000, CompletedLength: 400, DownloadSpeed: 700}, time.Second},
+		{"stalled", Status{TotalLength: 1000, CompletedLength: 400}, ETAUnknown},
+		{"not started", Status{DownloadSpeed: 100}, ETAUnknown},
+		{"complete", Status{TotalLength: 1000, CompletedLength: 1000}, 0},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, test.status.ETA(), test.name)
+	}
+}
+
+func TestStatusLargeLength(t *testing.T) {
+	var status Status
+	err := json.Unmarshal([]byte(`{"status":"complete","totalLength":"5368709120","completedLength":"5368709120"}`), &status)
+	assert.NoError(t, err)
+
+	assert.Equal(t, StatusCompleted, status.Status)
+	assert.Equal(t, Int64(5368709120), status.TotalLength)
+	assert.Equal(t, time.Duration(0), status.ETA())
+}
+
+func TestStatusBareValues(t *testing.T) {
+	data := []byte(`{
+		"gid": "2089b05ecca3d829",
+		"status": "active",
+		"totalLength": 5368709120,
+		"completedLength": "1048576",
+		"uploadLength": 0,
+		"downloadSpeed": 1048576,
+		"uploadSpeed": "0",
+		"numSeeders": 3,
+		"seeder": false,
+		"pieceLength": 1048576,
+		"numPieces": 5120,
+		"connections": 4,
+		"errorCode": 0,
+		"verifiedLength": 0,
+		"verifyIntegrityPending": false,
+		"bittorrent": {"creationDate": "1123456789", "mode": "single"},
+		"files": [{"index": 1, "length": 5368709120, "completedLength": "1048576", "selected": "true"}]
+	}`)
+
+	var status Status
+	assert.NoError(t, json.Unmarshal(data, &status))
+
+	assert.Equal(t, "2089b05ecca3d829", status.GID)
+	assert.Equal(t, StatusActive, status.Status)
+	assert.Equal(t, Int64(5368709120), status.TotalLength)
+	assert.Equal(t, Int64(1048576), status.CompletedLength)
+	assert.Equal(t, Int64(1048576), status.DownloadSpeed)
+	assert.Equal(t, Int64(3), status.NumSeeders)
+	assert.Equal(t, Int64(1048576), status.PieceLength)
+	assert.Equal(t, Int64(5120), status.NumPieces)
+	assert.Equal(t, Int64(4), status.Connections)
+	assert.Equal(t, time.Unix(1123456789, 0), status.BitTorrent.CreationDate.Time)
+	assert.Equal(t, []File{{Index: 1, Length: 5368709120, CompletedLength: 1048576, Selected: true}}, status.Files)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"totalLength": "many"}`), &status))
+}
+
+func TestStatusBitTorrent(t *testing.T) {
+	var torrent Status
+	err := json.Unmarshal([]byte(`{
+		"gid": "2089b05ecca3d829",
+		"bittorrent": {
+			"announceList": [["udp://tracker.example.com:1337"], ["http://tracker.example.org/announce"]],
+			"comment": "example",
+			"info": {"name": "example"},
+			"mode": "multi"
+		},
+		"files": [{"index": "1", "path": "/downloads/example/a.mkv"}]
+	}`), &torrent)
+	assert.NoError(t, err)
+
+	assert.Equal(t, BitTorrentStatus{
+		AnnounceList: [][]string{{"udp://tracker.example.com:1337"}, {"http://tracker.example.org/announce"}},
+		Comment:      "example",
+		Mode:         TorrentModeMulti,
+		Info:         BitTorrentStatusInfo{Name: "example"},
+	}, torrent.BitTorrent)
+	assert.Equal(t, "example", torrent.Name())
+
+	var plain Status
+	err = json.Unmarshal([]byte(`{
+		"gid": "d2703803b52216d1",
+		"files": [{"index": "1", "path": "/downloads/file.iso", "uris": [{"status": "used", "uri": "http://example.com/other.iso"}]}]
+	}`), &plain)
+	assert.NoError(t, err)
+
+	assert.Equal(t, BitTorrentStatus{}, plain.BitTorrent)
+	assert.Equal(t, "file.iso", plain.Name())
+}
+
+func TestStatusName(t *testing.T) {
+	tests := []struct {
+		status Status
+		name   string
+	}{
+		{Status{}, ""},
+		{Status{Files: []File{{Path: `C:\downloads\file.iso`}}}, "file.iso"},
+		{Status{Files: []File{{URIs: []URI{{URI: "http://example.com/dir/file.iso?token=1"}}}}}, "file.iso"},
+		{Status{Files: []File{{}}}, ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.name, tt.status.Name())
+	}
+}
+
+func TestStatusType(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		typ     DownloadType
+	}{
+		{"http", `{
+			"gid": "2089b05ecca3d829",
+			"files": [{"path": "/downloads/file.iso", "uris": [{"uri": "http://example.org/file.iso", "status": "used"}]}]
+		}`, DownloadTypeHTTP},
+		{"torrent", `{
+			"gid": "2089b05ecca3d829",
+			"infoHash": "248d0a1cd08284299de78d5c1ed359bb46717d8c",
+			"bittorrent": {"mode": "multi", "info": {"name": "debian"}},
+			"files": [{"path": "/downloads/debian/debian.iso", "uris": []}]
+		}`, DownloadTypeBitTorrent},
+		{"magnet", `{
+			"gid": "2089b05ecca3d829",
+			"infoHash": "248d0a1cd08284299de78d5c1ed359bb46717d8c",
+			"files": [{"path": "[METADATA]248d0a1cd08284299de78d5c1ed359bb46717d8c", "uris": []}]
+		}`, DownloadTypeBitTorrent},
+		{"metalink document", `{
+			"gid": "2089b05ecca3d829",
+			"followedBy": ["d2703803b52216d1"],
+			"files": [{"path": "/downloads/file.META4", "uris": [{"uri": "http://example.org/file.meta4", "status": "used"}]}]
+		}`, DownloadTypeMetalink},
+		{"metalink entry", `{
+			"gid": "d2703803b52216d1",
+			"following": "2089b05ecca3d829",
+			"files": [{"path": "/downloads/file.iso", "uris": [{"uri": "http://mirror.example.org/file.iso", "status": "used"}]}]
+		}`, DownloadTypeMetalink},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var status Status
+			require.NoError(t, json.Unmarshal([]byte(tt.fixture), &status))
+			assert.Equal(t, tt.typ, status.Type())
+		})
+	}
+}
+
+func TestStatusErr(t *testing.T) {
+	var failed Status
+	err := json.Unmarshal([]byte(`{
+		"gid": "2089b05ecca3d829",
+		"status": "error",
+		"errorCode": "3",
+		"errorMessage": "Resource not found"
+	}`), &failed)
+	assert.NoError(t, err)
+
+	assert.Equal(t, ResourceNotFound, failed.ErrorCode)
+	assert.Equal(t, "Resource not found", failed.ErrorMessage)
+
+	err = failed.Err()
+	assert.Equal(t, &DownloadError{GID: "2089b05ecca3d829", Code: ResourceNotFound, Message: "Resource not found"}, err)
+	assert.True(t, errors.Is(err, ErrDownloadError))
+	assert.Equal(t, "download 2089b05ecca3d829 failed: Resource not found (ResourceNotFound)", err.Error())
+
+	assert.NoError(t, Status{Status: StatusActive}.Err())
+	assert.NoError(t, Status{Status: StatusCompleted}.Err())
+}
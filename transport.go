@@ -0,0 +1,71 @@
+package arigo
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Transport carries the calls and notifications between a Client and aria2.
+// Clients use a WebSocket or HTTP connection by default, WithTransport replaces it,
+// for example with the in-memory transport of package arigotest in unit tests.
+type Transport interface {
+	// Call invokes method with params and decodes its result into reply, which may be nil.
+	// Errors returned by aria2 should be reported as *RPCError.
+	Call(ctx context.Context, method string, params interface{}, reply interface{}) error
+	// Notify sends a notification, which has no response.
+	Notify(method string, params interface{}) error
+	// Subscribe registers handler for the notifications received by the transport.
+	// The client calls it once, before it makes the first call.
+	Subscribe(handler NotificationHandler)
+	// Close closes the transport.
+	Close() error
+}
+
+// NotificationSupporter is implemented by Transports which know whether they deliver notifications.
+// If NotificationsSupported returns false, the client refuses subscriptions with
+// ErrNotificationsUnsupported and falls back to polling, like a client using HTTP.
+// Transports which don't implement it are assumed to deliver notifications.
+type NotificationSupporter interface {
+	NotificationsSupported() bool
+}
+
+// transportSupportsNotifications reports whether transport delivers notifications.
+func transportSupportsNotifications(transport Transport) bool {
+	s, ok := transport.(NotificationSupporter)
+	return !ok || s.NotificationsSupported()
+}
+
+// NotificationHandler handles a notification received by a Transport.
+// params contains the JSON encoded array of parameters of the notification.
+type NotificationHandler func(method string, params json.RawMessage)
+
+// newTransportClient creates a client which uses transport instead of an rpc2 connection.
+func newTransportClient(transport Transport, authToken string, cfg *clientConfig) *Client {
+	client := newClient(nil, authToken, cfg)
+	client.transport = transport
+	client.noNotifications = !transportSupportsNotifications(transport)
+	transport.Subscribe(client.onTransportNotification)
+
+	return client
+}
+
+// onTransportNotification dispatches a notification received by the transport of the client.
+func (c *Client) onTransportNotification(method string, params json.RawMessage) {
+	evtType, ok := notificationEvents[method]
+	if !ok {
+		event := &UnknownEvent{Method: method}
+		if err := c.encoding.Unmarshal(params, &event.Params); err != nil {
+			c.logger.Errorf("arigo: invalid notification %s: %v", method, err)
+			return
+		}
+		_ = c.onUnknownNotification(nil, event, nil)
+		return
+	}
+
+	event := new(DownloadEvent)
+	if err := c.encoding.Unmarshal(params, &[]interface{}{event}); err != nil {
+		c.logger.Errorf("arigo: invalid notification %s: %v", method, err)
+		return
+	}
+	c.dispatch(evtType, event)
+}
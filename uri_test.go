@@ -2,7 +2,9 @@ package arigo
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
 )
 
@@ -21,3 +23,67 @@ func TestURIFormat(t *testing.T) {
 	assert.Equal(t, URIUsed, uri.Status)
 	assert.Equal(t, "http://example.org/file", uri.URI)
 }
+
+func TestGetURIs(t *testing.T) {
+	server := newMockServer(t)
+	server.handle("aria2.getUris", func(params []json.RawMessage) (interface{}, *mockError) {
+		var gid string
+		if len(params) != 1 || json.Unmarshal(params[0], &gid) != nil || gid != "2089b05ecca3d829" {
+			return nil, &mockError{Code: 1, Message: "GID is not found"}
+		}
+		return []map[string]string{
+			{"uri": "http://mirror1.example.org/file", "status": "used"},
+			{"uri": "http://mirror2.example.org/file", "status": "waiting"},
+			{"uri": "http://mirror3.example.org/file", "status": "waiting"},
+			{"uri": "ftp://mirror4.example.org/file", "status": "used"},
+		}, nil
+	})
+	client := server.dial("")
+
+	uris, err := client.GetURIs("2089b05ecca3d829")
+	require.NoError(t, err)
+	assert.Equal(t, []URI{
+		{URI: "http://mirror1.example.org/file", Status: URIUsed},
+		{URI: "http://mirror2.example.org/file", Status: URIWaiting},
+		{URI: "http://mirror3.example.org/file", Status: URIWaiting},
+		{URI: "ftp://mirror4.example.org/file", Status: URIUsed},
+	}, uris)
+}
+
+func TestChangeURI(t *testing.T) {
+	server := newMockServer(t)
+	var params []json.RawMessage
+	server.handle("aria2.changeUri", func(p []json.RawMessage) (interface{}, *mockError) {
+		params = p
+		return []int{1, 2}, nil
+	})
+	client := server.dial("")
+
+	deleted, added, err := client.ChangeURIAt("2089b05ecca3d829", 1,
+		URIs("http://slow.example.org/file"), URIs("http://mirror1.example.org/file", "http://mirror2.example.org/file"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), deleted)
+	assert.Equal(t, uint(2), added)
+	require.Len(t, params, 5)
+	assert.JSONEq(t, `["http://slow.example.org/file"]`, string(params[2]))
+	assert.JSONEq(t, `0`, string(params[4]))
+
+	// nil lists are sent as empty arrays
+	_, _, err = client.ChangeURI("2089b05ecca3d829", 1, nil, URIs("http://mirror1.example.org/file"))
+	require.NoError(t, err)
+	require.Len(t, params, 4)
+	assert.JSONEq(t, `[]`, string(params[2]))
+
+	_, _, err = client.ChangeURI("2089b05ecca3d829", 0, nil, nil)
+	assert.Error(t, err)
+
+	server.reply("aria2.changeUri", []int{1})
+	_, _, err = client.ChangeURI("2089b05ecca3d829", 1, nil, nil)
+	assert.Error(t, err)
+
+	server.handle("aria2.changeUri", func([]json.RawMessage) (interface{}, *mockError) {
+		return nil, &mockError{Code: 1, Message: "GID 2089b05ecca3d829 is not found"}
+	})
+	_, _, err = client.ChangeURI("2089b05ecca3d829", 1, nil, nil)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
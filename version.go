@@ -1,7 +1,31 @@
 package arigo
 
+// Features which may be reported in VersionInfo.EnabledFeatures.
+const (
+	FeatureAsyncDNS      = "Async DNS"
+	FeatureBitTorrent    = "BitTorrent"
+	FeatureFirefoxCookie = "Firefox3 Cookie"
+	FeatureGZip          = "GZip"
+	FeatureHTTPS         = "HTTPS"
+	FeatureMessageDigest = "Message Digest"
+	FeatureMetalink      = "Metalink"
+	FeatureSFTP          = "SFTP"
+	FeatureXMLRPC        = "XML-RPC"
+)
+
 // VersionInfo represents the version information sent by aria2
 type VersionInfo struct {
 	Version         string   `json:"version"`         // Version number of aria2 as a string.
 	EnabledFeatures []string `json:"enabledFeatures"` // Slice of enabled features. Each feature is given as a string.
 }
+
+// HasFeature reports whether the feature is enabled in aria2.
+// name is one of the Feature constants or any other name reported by aria2.
+func (v VersionInfo) HasFeature(name string) bool {
+	for _, feature := range v.EnabledFeatures {
+		if feature == name {
+			return true
+		}
+	}
+	return false
+}
@@ -38,3 +38,29 @@ func TestVersionFormat(t *testing.T) {
 		Version: "1.11.0",
 	}, version)
 }
+
+func TestVersionHasFeature(t *testing.T) {
+	// written in the format of aria2.getVersion
+	data := []byte(`{
+		"enabledFeatures": [
+			"Async DNS",
+			"BitTorrent",
+			"Firefox3 Cookie",
+			"GZip",
+			"HTTPS",
+			"Message Digest",
+			"Metalink",
+			"XML-RPC",
+			"SFTP"
+		],
+		"version": "1.36.0"
+	}`)
+
+	var version VersionInfo
+	assert.NoError(t, json.Unmarshal(data, &version), "Couldn't unmarshal JSON")
+
+	assert.True(t, version.HasFeature(FeatureBitTorrent))
+	assert.True(t, version.HasFeature(FeatureSFTP))
+	assert.False(t, version.HasFeature("bittorrent"))
+	assert.False(t, VersionInfo{}.HasFeature(FeatureMetalink))
+}
@@ -0,0 +1,143 @@
+package arigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// watchedEvents are the events which make Watch fetch the status right away.
+var watchedEvents = []EventType{StartEvent, PauseEvent, StopEvent, CompleteEvent, BTCompleteEvent, ErrorEvent}
+
+// Watcher delivers the status changes of a download, see Client.Watch.
+type Watcher struct {
+	// C receives the statuses, it's closed once the watch ended.
+	C <-chan Status
+
+	mu  sync.Mutex
+	err error
+}
+
+// Err returns the error which ended the watch once C is closed, it's nil if the watch ended
+// because the download finished or the context passed to Watch is done.
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// Watch sends the status of the download denoted by gid on the channel of the returned Watcher
+// whenever it changes.
+//
+// The status is fetched every interval, and additionally whenever aria2 sends a notification
+// for the download, provided the client supports notifications.
+// A status is only sent if its Status, CompletedLength or DownloadSpeed differ from the
+// previously sent one, so the channel doesn't receive values at a fixed cadence.
+// Stalled or paused downloads may not produce a value for a long time.
+// The first status is always sent.
+//
+// The channel is closed after the status of the download was sent as complete, error or removed,
+// once ctx is done, or once fetching the status failed. Calls which timed out or failed while the
+// client is reconnecting are skipped, any other error ends the watch and is reported by Err,
+// for example ErrNotFound if the download was purged or ErrClientClosed.
+// An error is returned right away if interval isn't positive or the initial status can't be fetched.
+func (c *Client) Watch(ctx context.Context, gid string, interval time.Duration) (*Watcher, error) {
+	if err := ValidateGID(gid); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid watch interval %v", interval)
+	}
+
+	status, err := c.TellStatusContext(ctx, GIDString(gid))
+	if err != nil {
+		return nil, err
+	}
+
+	wake := make(chan struct{}, 1)
+	var unsubs []UnsubscribeFunc
+	if c.NotificationsSupported() {
+		listener := func(ev *DownloadEvent) {
+			if ev.GID != gid {
+				return
+			}
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+		for _, evtType := range watchedEvents {
+			unsubs = append(unsubs, c.evtTarget.Subscribe(evtType, listener))
+		}
+	}
+
+	statuses := make(chan Status)
+	w := &Watcher{C: statuses}
+
+	go func() {
+		defer close(statuses)
+		defer func() {
+			for _, unsub := range unsubs {
+				unsub()
+			}
+		}()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case statuses <- status:
+			case <-ctx.Done():
+				return
+			}
+			if isFinalStatus(status.Status) {
+				return
+			}
+
+			last := status
+			for !statusChanged(last, status) {
+				select {
+				case <-ticker.C:
+				case <-wake:
+				case <-ctx.Done():
+					return
+				}
+
+				reply, err := c.TellStatusContext(ctx, GIDString(gid))
+				switch {
+				case err == nil:
+					status = reply
+				case ctx.Err() != nil:
+					return
+				case !isTemporaryWatchErr(err):
+					w.mu.Lock()
+					w.err = err
+					w.mu.Unlock()
+					return
+				}
+			}
+		}
+	}()
+
+	return w, nil
+}
+
+// isTemporaryWatchErr reports whether Watch keeps polling after fetching the status failed with err.
+// Timed out calls and a connection which the client is reestablishing are temporary.
+func isTemporaryWatchErr(err error) bool {
+	return errors.Is(err, ErrConnectionLost) || errors.As(err, new(*TimeoutError))
+}
+
+// isFinalStatus reports whether a download with the given status has finished for good.
+func isFinalStatus(status DownloadStatus) bool {
+	return status == StatusCompleted || status == StatusError || status == StatusRemoved
+}
+
+// statusChanged reports whether the fields watched by Watch differ between a and b.
+func statusChanged(a, b Status) bool {
+	return a.Status != b.Status || a.CompletedLength != b.CompletedLength || a.DownloadSpeed != b.DownloadSpeed
+}
@@ -0,0 +1,161 @@
+package arigo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// progressServer answers tellStatus with the statuses returned by next.
+func progressServer(t *testing.T, next func(call int) map[string]string) *mockServer {
+	server := newMockServer(t)
+
+	var mu sync.Mutex
+	calls := 0
+	server.handle("aria2.tellStatus", func([]json.RawMessage) (interface{}, *mockError) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls++
+		return next(calls), nil
+	})
+	return server
+}
+
+func collectStatuses(t *testing.T, statuses <-chan Status) []Status {
+	var received []Status
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case status, ok := <-statuses:
+			if !ok {
+				return received
+			}
+			received = append(received, status)
+		case <-timeout:
+			t.Fatal("channel wasn't closed")
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	server := progressServer(t, func(call int) map[string]string {
+		// every status is returned twice, the repetitions must not be sent
+		completed := (call - 1) / 2 * 100
+		if completed >= 300 {
+			return map[string]string{"status": "complete", "completedLength": "300", "downloadSpeed": "0"}
+		}
+		return map[string]string{"status": "active", "completedLength": strconv.Itoa(completed), "downloadSpeed": "100"}
+	})
+	client := server.dial("")
+
+	w, err := client.Watch(context.Background(), "0123456789abcdef", time.Millisecond)
+	require.NoError(t, err)
+
+	received := collectStatuses(t, w.C)
+	require.Len(t, received, 4)
+	for i, status := range received[:3] {
+		assert.Equal(t, StatusActive, status.Status)
+		assert.Equal(t, Int64(i*100), status.CompletedLength)
+	}
+	assert.Equal(t, StatusCompleted, received[3].Status)
+}
+
+func TestWatchNotification(t *testing.T) {
+	var mu sync.Mutex
+	status := "active"
+	server := progressServer(t, func(int) map[string]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return map[string]string{"status": status, "completedLength": "0", "downloadSpeed": "0"}
+	})
+	client := server.dial("")
+
+	// the interval is too long for the test, so only the notification can trigger the update
+	w, err := client.Watch(context.Background(), "0123456789abcdef", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, StatusActive, (<-w.C).Status)
+
+	mu.Lock()
+	status = "error"
+	mu.Unlock()
+	server.notify("aria2.onDownloadError", "0123456789abcdef")
+
+	assert.Equal(t, []Status{{Status: StatusError}}, collectStatuses(t, w.C))
+}
+
+func TestWatchCancel(t *testing.T) {
+	server := progressServer(t, func(int) map[string]string {
+		return map[string]string{"status": "paused"}
+	})
+	client := server.dial("")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := client.Watch(ctx, "0123456789abcdef", time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPaused, (<-w.C).Status)
+
+	cancel()
+	assert.Empty(t, collectStatuses(t, w.C))
+}
+
+func TestWatchError(t *testing.T) {
+	server := newMockServer(t)
+	server.handle("aria2.tellStatus", func([]json.RawMessage) (interface{}, *mockError) {
+		return nil, &mockError{Code: 1, Message: "GID 0123456789abcdef is not found"}
+	})
+	client := server.dial("")
+
+	_, err := client.Watch(context.Background(), "0123456789abcdef", time.Millisecond)
+	assert.Error(t, err)
+
+	_, err = client.Watch(context.Background(), "invalid", time.Millisecond)
+	assert.Error(t, err)
+	_, err = client.Watch(context.Background(), "0123456789abcdef", 0)
+	assert.Error(t, err)
+}
+
+func TestWatchEndsOnError(t *testing.T) {
+	server := newMockServer(t)
+	var mu sync.Mutex
+	purged := false
+	server.handle("aria2.tellStatus", func([]json.RawMessage) (interface{}, *mockError) {
+		mu.Lock()
+		defer mu.Unlock()
+		if purged {
+			return nil, &mockError{Code: 1, Message: "GID 0123456789abcdef is not found"}
+		}
+		return map[string]string{"status": "paused"}, nil
+	})
+	client := server.dial("")
+
+	w, err := client.Watch(context.Background(), "0123456789abcdef", time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPaused, (<-w.C).Status)
+	assert.NoError(t, w.Err())
+
+	// someone else removed and purged the download
+	mu.Lock()
+	purged = true
+	mu.Unlock()
+	assert.Empty(t, collectStatuses(t, w.C))
+	assert.True(t, errors.Is(w.Err(), ErrNotFound), "unexpected error %v", w.Err())
+
+	mu.Lock()
+	purged = false
+	mu.Unlock()
+	w, err = client.Watch(context.Background(), "0123456789abcdef", time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPaused, (<-w.C).Status)
+
+	require.NoError(t, client.Close())
+	assert.Empty(t, collectStatuses(t, w.C))
+	assert.Equal(t, ErrClientClosed, w.Err())
+}